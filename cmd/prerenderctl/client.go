@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// client calls the server's API.
+type client struct {
+	server string
+	token  string
+	apiKey string
+	http   *http.Client
+}
+
+func newClient(opts *options) *client {
+	return &client{
+		server: strings.TrimRight(opts.server, "/"),
+		token:  opts.token,
+		apiKey: opts.apiKey,
+		http:   &http.Client{Timeout: opts.timeout},
+	}
+}
+
+// apiError is an error response of the API.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server answered %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("server answered %d: %s", e.Status, e.Message)
+}
+
+// do sends a request with body encoded as JSON, unless it is nil, and returns
+// the response if its status is 2xx. The caller must close its body.
+func (c *client) do(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&errResp)
+		return nil, &apiError{Status: resp.StatusCode, Message: errResp.Error}
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes the JSON response into out.
+func (c *client) call(method, path string, body, out interface{}) error {
+	resp, err := c.do(method, path, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
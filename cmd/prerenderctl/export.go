@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"prerender-url-shortener/internal/api"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd(opts *options) *cobra.Command {
+	var shortCode, granularity, from, to, output string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export clicks as CSV",
+		Long: "Export the clicks on one link, or on all of them, as CSV: per link and day, or one row " +
+			"per raw click event. Dates are UTC and inclusive; the last 30 days are exported by default.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if granularity != "daily" && granularity != "raw" {
+				return fmt.Errorf("--granularity must be daily or raw")
+			}
+			out := cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				out = file
+			}
+
+			if opts.databaseURL != "" {
+				fromDate, toDate, err := api.ParseDateRange(from, to)
+				if err != nil {
+					return err
+				}
+				if err := db.Connect(opts.databaseURL); err != nil {
+					return err
+				}
+				defer db.Close()
+				return api.WriteClicksCSV(out, shortCode, granularity, fromDate, toDate)
+			}
+
+			path := "/admin/analytics/export"
+			if shortCode != "" {
+				path = "/links/" + url.PathEscape(shortCode) + "/stats/export"
+			}
+			query := url.Values{"granularity": {granularity}}
+			if from != "" {
+				query.Set("from", from)
+			}
+			if to != "" {
+				query.Set("to", to)
+			}
+			resp, err := newClient(opts).do(http.MethodGet, path, query, nil)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			_, err = io.Copy(out, resp.Body)
+			return err
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&shortCode, "link", "", "short code of the link to export, all links if empty")
+	flags.StringVar(&granularity, "granularity", "daily", "daily or raw")
+	flags.StringVar(&from, "from", "", "first day, as YYYY-MM-DD")
+	flags.StringVar(&to, "to", "", "last day, as YYYY-MM-DD, today if empty")
+	flags.StringVarP(&output, "output", "o", "", "file to write, stdout if empty")
+	return cmd
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"prerender-url-shortener/internal/api"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// addLinkFlags registers the render settings of new links on cmd.
+func addLinkFlags(cmd *cobra.Command, req *api.GenerateRequest) {
+	flags := cmd.Flags()
+	flags.StringVar(&req.AcceptLanguage, "accept-language", "", "Accept-Language header to render with")
+	flags.StringVar(&req.Locale, "locale", "", "BCP 47 locale to render with")
+	flags.StringVar(&req.Timezone, "timezone", "", "IANA time zone to render with")
+	flags.StringVar(&req.Profile, "profile", "", "RENDER_PROFILES entry to render with")
+	flags.StringVar(&req.RobotsTag, "robots-tag", "", "X-Robots-Tag of the short URL")
+	flags.StringVar(&req.CacheControl, "cache-control", "", "Cache-Control of the short URL's redirects and snapshots")
+	flags.BoolVar(&req.Static, "static", false, "serve every visitor the snapshot instead of redirecting")
+}
+
+// addWaitFlag registers --wait, the wait_seconds of /generate, on cmd.
+func addWaitFlag(cmd *cobra.Command, req *api.GenerateRequest) {
+	cmd.Flags().Func("wait", "seconds to wait for the first render, 0 not to wait (default GENERATE_MAX_WAIT_SECONDS)", func(value string) error {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return errors.New("must be a number of seconds")
+		}
+		req.WaitSeconds = &seconds
+		return nil
+	})
+}
+
+func newCreateCmd(opts *options) *cobra.Command {
+	var req api.GenerateRequest
+	cmd := &cobra.Command{
+		Use:   "create URL",
+		Short: "Shorten a URL and print its short code",
+		Long: "Shorten a URL and print its short code. Like POST /generate, it waits up to " +
+			"--wait seconds for the first render.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.URL = args[0]
+			var resp api.GenerateResponse
+			if err := newClient(opts).call(http.MethodPost, "/generate", req, &resp); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), resp.ShortCode)
+			if resp.LastRenderError != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Render %s: %s\n", resp.RenderStatus, resp.LastRenderError)
+			}
+			return nil
+		},
+	}
+	addLinkFlags(cmd, &req)
+	addWaitFlag(cmd, &req)
+	cmd.Flags().StringVar(&req.Alias, "alias", "", "custom short code")
+	return cmd
+}
+
+func newImportCmd(opts *options) *cobra.Command {
+	var defaults api.GenerateRequest
+	var concurrency int
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Shorten the URLs listed in a file, or - for stdin",
+		Long: "Shorten the URLs listed in a file, one per line or in the first column of a CSV file " +
+			"with an optional alias in the second. Lines starting with # are skipped. The short codes " +
+			"are printed as CSV in the order of the input: url, short_code, render_status, error.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if concurrency < 1 {
+				return errors.New("--concurrency must be at least 1")
+			}
+			in := cmd.InOrStdin()
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+			reqs, err := readImport(in, defaults)
+			if err != nil {
+				return err
+			}
+			return importLinks(newClient(opts), reqs, concurrency, cmd.OutOrStdout())
+		},
+	}
+	addLinkFlags(cmd, &defaults)
+	addWaitFlag(cmd, &defaults)
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "URLs shortened at once")
+	return cmd
+}
+
+// readImport reads the URLs to import, each with the render settings of
+// defaults.
+func readImport(in io.Reader, defaults api.GenerateRequest) ([]api.GenerateRequest, error) {
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	var reqs []api.GenerateRequest
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return reqs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rawURL := strings.TrimSpace(record[0])
+		if rawURL == "" || (len(reqs) == 0 && strings.EqualFold(rawURL, "url")) {
+			continue // Blank lines and a header row
+		}
+		req := defaults
+		req.URL = rawURL
+		if len(record) > 1 {
+			req.Alias = strings.TrimSpace(record[1])
+		}
+		reqs = append(reqs, req)
+	}
+}
+
+// importLinks creates the links of reqs, concurrency at a time, and writes the
+// outcome of each as CSV. It fails if any of them failed.
+func importLinks(c *client, reqs []api.GenerateRequest, concurrency int, out io.Writer) error {
+	type outcome struct {
+		resp api.GenerateResponse
+		err  error
+	}
+	outcomes := make([]outcome, len(reqs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(reqs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				outcomes[i].err = c.call(http.MethodPost, "/generate", reqs[i], &outcomes[i].resp)
+			}
+		}()
+	}
+	for i := range reqs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"url", "short_code", "render_status", "error"})
+	failed := 0
+	for i, o := range outcomes {
+		if o.err != nil {
+			failed++
+			w.Write([]string{reqs[i].URL, "", "", o.err.Error()})
+			continue
+		}
+		w.Write([]string{reqs[i].URL, o.resp.ShortCode, string(o.resp.RenderStatus), o.resp.LastRenderError})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d URLs failed to import", failed, len(reqs))
+	}
+	return nil
+}
+
+func newGetCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get SHORT_CODE",
+		Short: "Print the details of a link as JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var details api.LinkDetails
+			if err := newClient(opts).call(http.MethodGet, "/admin/links/"+url.PathEscape(args[0]), nil, &details); err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), details)
+		},
+	}
+}
+
+func newRerenderCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rerender SHORT_CODE...",
+		Short: "Queue fresh renders of links",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := newClient(opts)
+			var errs []error
+			for _, shortCode := range args {
+				var resp struct{}
+				if err := c.call(http.MethodPost, "/admin/links/"+url.PathEscape(shortCode)+"/rerender", nil, &resp); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", shortCode, err))
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Queued a render of %s\n", shortCode)
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// printJSON writes v as indented JSON.
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
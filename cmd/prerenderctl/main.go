@@ -0,0 +1,66 @@
+// Command prerenderctl manages links from the command line, for scripts and
+// cron jobs. It talks to a running server's API, authenticating to the admin
+// endpoints with a session token or ADMIN_TOKEN. With --database-url, queue
+// status and exports are read straight from the database instead.
+package main
+
+import (
+	"os"
+	"prerender-url-shortener/internal/version"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// options holds the global flags shared by the subcommands.
+type options struct {
+	server      string
+	token       string
+	apiKey      string
+	databaseURL string
+	timeout     time.Duration
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:          "prerenderctl",
+		Short:        "Manage prerender-url-shortener links",
+		Version:      version.Get().String(),
+		SilenceUsage: true,
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.server, "server", envOr("PRERENDERCTL_SERVER", "http://localhost:8080"),
+		"base URL of the server, or $PRERENDERCTL_SERVER")
+	flags.StringVar(&opts.token, "token", os.Getenv("PRERENDERCTL_TOKEN"),
+		"admin session token or ADMIN_TOKEN, or $PRERENDERCTL_TOKEN")
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv("PRERENDERCTL_API_KEY"),
+		"tenant API key to create links with, or $PRERENDERCTL_API_KEY")
+	flags.StringVar(&opts.databaseURL, "database-url", os.Getenv("PRERENDERCTL_DATABASE_URL"),
+		"read queue status and exports from this database instead of the API, or $PRERENDERCTL_DATABASE_URL")
+	flags.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "timeout of each API request")
+
+	root.AddCommand(
+		newCreateCmd(opts),
+		newImportCmd(opts),
+		newGetCmd(opts),
+		newRerenderCmd(opts),
+		newQueueCmd(opts),
+		newExportCmd(opts),
+	)
+	return root
+}
+
+// envOr returns the environment variable name, or fallback if it is unset.
+func envOr(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
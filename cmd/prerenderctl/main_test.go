@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/api"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run executes prerenderctl with args and returns what it printed.
+func run(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestCreateAndImport(t *testing.T) {
+	var mu sync.Mutex
+	var received []api.GenerateRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/generate", r.URL.Path)
+		assert.Equal(t, "tenant-key", r.Header.Get("X-API-Key"))
+		var req api.GenerateRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+		if strings.Contains(req.URL, "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Invalid URL"}`))
+			return
+		}
+		code := strings.ToUpper(strings.TrimPrefix(req.URL, "https://"))[:3]
+		if req.Alias != "" {
+			code = req.Alias
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(api.GenerateResponse{ShortCode: code, OriginalURL: req.URL, RenderStatus: db.RenderStatusCompleted})
+	}))
+	defer server.Close()
+
+	out, err := run(t, "", "--server", server.URL, "--api-key", "tenant-key", "create", "https://one.com", "--static", "--locale", "de-DE")
+	require.NoError(t, err)
+	assert.Equal(t, "ONE\n", out)
+	require.Len(t, received, 1)
+	assert.True(t, received[0].Static)
+	assert.Equal(t, "de-DE", received[0].Locale)
+	assert.Nil(t, received[0].WaitSeconds, "the server's wait unless --wait is set")
+
+	received = nil
+	input := "url,alias\nhttps://two.com\n# skipped\n\nhttps://bad.com\nhttps://six.com, mine\n"
+	out, err = run(t, input, "--server", server.URL, "--api-key", "tenant-key", "import", "-", "--profile", "mobile", "--wait", "0")
+	require.EqualError(t, err, "1 of 3 URLs failed to import")
+	assert.Equal(t, "url,short_code,render_status,error\n"+
+		"https://two.com,TWO,completed,\n"+
+		"https://bad.com,,,server answered 400: Invalid URL\n"+
+		"https://six.com,mine,completed,\n", strings.Split(out, "Error:")[0])
+	require.Len(t, received, 3)
+	for _, req := range received {
+		assert.Equal(t, "mobile", req.Profile, "flags apply to every URL")
+		if assert.NotNil(t, req.WaitSeconds) {
+			assert.Equal(t, 0, *req.WaitSeconds)
+		}
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"Invalid admin token"}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /admin/links/ABC123":
+			json.NewEncoder(w).Encode(api.LinkDetails{ShortCode: "ABC123", OriginalURL: "https://abc.com"})
+		case "POST /admin/links/ABC123/rerender":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"short_code":"ABC123","render_status":"pending"}`))
+		case "GET /status":
+			w.Write([]byte(`{"status":"UP","render_queue":{"queue_length":2}}`))
+		case "GET /links/ABC123/stats/export":
+			assert.Equal(t, "raw", r.URL.Query().Get("granularity"))
+			assert.Equal(t, "2026-01-01", r.URL.Query().Get("from"))
+			w.Write([]byte("short_code,clicked_at\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Short code not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	_, err := run(t, "", "--server", server.URL, "--token", "wrong", "get", "ABC123")
+	assert.EqualError(t, err, "server answered 403: Invalid admin token")
+
+	out, err := run(t, "", "--server", server.URL, "--token", "secret", "get", "ABC123")
+	require.NoError(t, err)
+	var details api.LinkDetails
+	require.NoError(t, json.Unmarshal([]byte(out), &details))
+	assert.Equal(t, "https://abc.com", details.OriginalURL)
+
+	out, err = run(t, "", "--server", server.URL, "--token", "secret", "rerender", "ABC123", "MISSING")
+	assert.EqualError(t, err, "MISSING: server answered 404: Short code not found")
+	assert.Contains(t, out, "Queued a render of ABC123\n")
+
+	out, err = run(t, "", "--server", server.URL, "--token", "secret", "queue")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"queue_length":2}`, out)
+
+	out, err = run(t, "", "--server", server.URL, "--token", "secret", "export", "--link", "ABC123", "--granularity", "raw", "--from", "2026-01-01")
+	require.NoError(t, err)
+	assert.Equal(t, "short_code,clicked_at\n", out)
+}
+
+func TestDatabaseCommands(t *testing.T) {
+	databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "links.db")
+	require.NoError(t, db.InitDB(databaseURL, db.BackendGORM, true))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "DB1234", OriginalURL: "https://db.com", RenderStatus: db.RenderStatusPending}))
+	day := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, db.RecordClickEvents([]db.ClickEvent{
+		{ShortCode: "DB1234", ClickedAt: day, UAClass: db.UAClassBrowser},
+		{ShortCode: "DB1234", ClickedAt: day, UAClass: db.UAClassBot},
+	}))
+	require.NoError(t, db.Close())
+
+	out, err := run(t, "", "--database-url", databaseURL, "queue")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"links_by_render_status":{"pending":1,"rendering":0,"completed":0,"failed":0}}`, out)
+
+	output := filepath.Join(t.TempDir(), "clicks.csv")
+	_, err = run(t, "", "--database-url", databaseURL, "export", "--from", "2026-03-01", "--to", "2026-03-31", "-o", output)
+	require.NoError(t, err)
+	assert.FileExists(t, output)
+	out, err = run(t, "", "--database-url", databaseURL, "export", "--from", "2026-03-01", "--to", "2026-03-31")
+	require.NoError(t, err)
+	assert.Equal(t, "short_code,day,clicks,bot_clicks\nDB1234,2026-03-02,2,1\n", out)
+
+	_, err = run(t, "", "--database-url", databaseURL, "export", "--from", "2026-04-01", "--to", "2026-03-01")
+	assert.EqualError(t, err, "from must not be after to")
+}
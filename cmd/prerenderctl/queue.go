@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/spf13/cobra"
+)
+
+func newQueueCmd(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "queue",
+		Short: "Print the state of the render queue as JSON",
+		Long: "Print the state of the render queue as JSON: the server's render_queue status, or " +
+			"with --database-url the number of links in each render status.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.databaseURL != "" {
+				if err := db.Connect(opts.databaseURL); err != nil {
+					return err
+				}
+				defer db.Close()
+				counts, err := db.CountLinksByRenderStatus()
+				if err != nil {
+					return err
+				}
+				return printJSON(cmd.OutOrStdout(), map[string]interface{}{"links_by_render_status": counts})
+			}
+
+			var status struct {
+				RenderQueue map[string]interface{} `json:"render_queue"`
+			}
+			if err := newClient(opts).call(http.MethodGet, "/status", nil, &status); err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), status.RenderQueue)
+		},
+	}
+}
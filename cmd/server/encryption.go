@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"prerender-url-shortener/internal/config"
+	"strings"
+)
+
+// snapshotKey returns the snapshot encryption key, base64-encoded in
+// SNAPSHOT_ENCRYPTION_KEY or printed by SNAPSHOT_ENCRYPTION_KEY_COMMAND, such as
+// a KMS CLI call decrypting a wrapped key. It returns nil if neither is set.
+func snapshotKey() ([]byte, error) {
+	cfg := config.Get()
+	encoded := cfg.SnapshotEncryptionKey
+	if encoded == "" && cfg.SnapshotEncryptionKeyCommand != "" {
+		out, err := exec.Command("sh", "-c", cfg.SnapshotEncryptionKeyCommand).Output()
+		if err != nil {
+			return nil, fmt.Errorf("SNAPSHOT_ENCRYPTION_KEY_COMMAND failed: %w", err)
+		}
+		encoded = string(out)
+	}
+	if encoded = strings.TrimSpace(encoded); encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot encryption key is not valid base64: %w", err)
+	}
+	return key, nil
+}
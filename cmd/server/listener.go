@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor systemd passes, after stdin,
+// stdout and stderr.
+const listenFDsStart = 3
+
+// unixSocketPrefix marks a SERVER_PORT that is the path of a unix socket.
+const unixSocketPrefix = "unix://"
+
+// systemdListener returns the socket passed by systemd socket activation, or nil
+// when the process wasn't started that way. The LISTEN_* variables are unset
+// and the socket is closed on exec, so the browsers started for renders neither
+// inherit it nor mistake it for theirs.
+func systemdListener() (net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, expected one", count)
+	}
+
+	syscall.CloseOnExec(listenFDsStart)
+	file := os.NewFile(listenFDsStart, "systemd-socket")
+	defer file.Close() // FileListener works on a duplicate
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket is not a listening socket: %w", err)
+	}
+	if _, ok := listener.(*net.UnixListener); ok {
+		return localListener{listener}, nil
+	}
+	return listener, nil
+}
+
+// listen opens the server's listening socket on addr, a TCP address or a
+// unix:// socket path.
+func listen(addr, socketMode, socketGroup string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	return listenUnix(path, socketMode, socketGroup)
+}
+
+// listenUnix listens on a unix socket at path with the permission bits in mode,
+// an octal string, owned by group unless that is empty. A socket left behind by
+// a server that didn't exit cleanly is replaced, one still in use is not.
+func listenUnix(path, mode, group string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0o777 {
+		return nil, fmt.Errorf("invalid SERVER_SOCKET_MODE %q, expected octal permissions such as 0660", mode)
+	}
+	gid := -1
+	if group != "" {
+		if gid, err = lookupGroup(group); err != nil {
+			return nil, fmt.Errorf("invalid SERVER_SOCKET_GROUP: %w", err)
+		}
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Chown(path, -1, gid); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return localListener{listener}, nil
+}
+
+// lookupGroup returns the ID of the group with the given name or ID.
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// localListener reports the peers of a unix socket as loopback clients. Their
+// own address isn't an IP, which rate limits, allowlists and click analytics
+// need, and the proxy in front, e.g. nginx, runs on the same host anyway.
+type localListener struct {
+	net.Listener
+}
+
+func (l localListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return localConn{conn}, nil
+}
+
+type localConn struct {
+	net.Conn
+}
+
+var loopbackAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+func (localConn) RemoteAddr() net.Addr {
+	return loopbackAddr
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging applies LOG_FORMAT and LOG_LEVEL. Messages written with the log
+// package are logged at info level. Plain text at debug or info level is the log
+// package's own output, which is left alone.
+func setupLogging(format string, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		if lvl <= slog.LevelInfo {
+			return nil
+		}
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q, expected text or json", format)
+	}
+	return nil
+}
@@ -1,57 +1,423 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
+	"prerender-url-shortener/internal/analytics"
 	"prerender-url-shortener/internal/api"
+	"prerender-url-shortener/internal/botdetect"
+	"prerender-url-shortener/internal/cache"
 	"prerender-url-shortener/internal/config"
 	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/geoip"
+	"prerender-url-shortener/internal/janitor"
+	"prerender-url-shortener/internal/ratelimit"
 	"prerender-url-shortener/internal/renderer"
+	"prerender-url-shortener/internal/reputation"
+	"prerender-url-shortener/internal/shortener"
+	"prerender-url-shortener/internal/version"
+	"prerender-url-shortener/internal/webhook"
 	"syscall"
+	"time"
 
-	_ "github.com/jinzhu/gorm/dialects/postgres" // PostgreSQL driver for GORM
+	"github.com/gin-gonic/gin"
 )
 
+// Deployment modes selected by --mode or SERVER_MODE.
+const (
+	modeAll    = "all"    // Serve HTTP and render
+	modeAPI    = "api"    // Serve HTTP, leaving renders to worker replicas
+	modeWorker = "worker" // Render the links requested by API replicas
+)
+
+// shutdownTimeout bounds how long requests still open after the drain's grace
+// period may take before the server exits anyway.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Load application configuration
 	err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	log.Println("Configuration loaded successfully.")
+	if err := setupLogging(config.Get().LogFormat, config.Get().LogLevel); err != nil {
+		log.Fatalf("Invalid logging settings: %v", err)
+	}
+	switch config.Get().GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+		gin.SetMode(config.Get().GinMode)
+	default:
+		log.Fatalf("Invalid GIN_MODE %q, expected debug or release", config.Get().GinMode)
+	}
+	build := version.Get()
+	log.Printf("prerender-url-shortener %s, built %s with %s", build, build.BuildDate, build.GoVersion)
+	if config.Get().AppEnv != "" {
+		log.Printf("Configuration loaded successfully for %s.", config.Get().AppEnv)
+	} else {
+		log.Println("Configuration loaded successfully.")
+	}
+
+	if err := shortener.SetCodeLength(config.Get().ShortCodeLength); err != nil {
+		log.Fatalf("Invalid SHORT_CODE_LENGTH: %v", err)
+	}
+	if err := shortener.SetAlphabet(config.Get().ShortCodeAlphabet); err != nil {
+		log.Fatalf("Invalid SHORT_CODE_ALPHABET: %v", err)
+	}
+	if err := shortener.SetMode(config.Get().ShortCodeMode); err != nil {
+		log.Fatalf("Invalid SHORT_CODE_MODE: %v", err)
+	}
+	shortener.SetObfuscationKey(config.Get().ShortCodeObfuscationKey)
+	shortener.SetReservedWords(config.Get().ShortCodeReserved)
+	shortener.SetProfanityFilter(config.Get().ShortCodeProfanityFilter)
+	if err := shortener.SetCollisionPolicy(config.Get().ShortCodeMaxAttempts, config.Get().ShortCodeGrowAfter); err != nil {
+		log.Fatalf("Invalid SHORT_CODE_MAX_ATTEMPTS or SHORT_CODE_GROW_AFTER: %v", err)
+	}
+	err = shortener.SetAliasRules(shortener.AliasRules{
+		MinLength: config.Get().ShortCodeAliasMinLength,
+		MaxLength: config.Get().ShortCodeAliasMaxLength,
+		Charset:   config.Get().ShortCodeAliasCharset,
+		Pattern:   config.Get().ShortCodeAliasPattern,
+		FoldCase:  config.Get().ShortCodeAliasFoldCase,
+	})
+	if err != nil {
+		log.Fatalf("Invalid SHORT_CODE_ALIAS_* settings: %v", err)
+	}
+	if err := shortener.SetSigningKey(config.Get().ShortCodeSigningKey, config.Get().ShortCodeSignatureLength); err != nil {
+		log.Fatalf("Invalid SHORT_CODE_SIGNATURE_LENGTH: %v", err)
+	}
+	if err := shortener.SetAllowedSchemes(config.Get().URLAllowedSchemes); err != nil {
+		log.Fatalf("Invalid URL_ALLOWED_SCHEMES: %v", err)
+	}
+	shortener.SetNormalizeOptions(shortener.NormalizeOptions{
+		StripFragment: config.Get().URLStripFragment,
+		SortQuery:     config.Get().URLSortQuery,
+		StripParams:   config.Get().URLStripParams,
+	})
+	if _, err := shortener.ParseNetworks(config.Get().SSRFAllowedNetworks); err != nil {
+		log.Fatalf("Invalid SSRF_ALLOWED_NETWORKS: %v", err)
+	}
+	if config.Get().AdminUsername != "" && len(config.Get().AdminPassword) < 8 {
+		log.Fatalf("Invalid ADMIN_PASSWORD: it must be at least 8 characters long")
+	}
+	if path := config.Get().BotPatternsFile; path != "" {
+		if _, _, err := botdetect.LoadPatterns(path); err != nil {
+			log.Fatalf("Invalid BOT_PATTERNS_FILE: %v", err)
+		}
+	}
+	if _, err := shortener.ParseNetworks(config.Get().TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if _, err := shortener.ParseNetworks(config.Get().ManagementAllowedNetworks); err != nil {
+		log.Fatalf("Invalid MANAGEMENT_ALLOWED_NETWORKS: %v", err)
+	}
+
+	// --mode splits the HTTP server and the render workers into separate deployments
+	mode := flag.String("mode", config.Get().ServerMode, "all, api (serve HTTP, render on worker replicas) or worker (render only)")
+	flag.Parse()
+	switch *mode {
+	case modeAll, modeAPI, modeWorker:
+		cfg := *config.Get()
+		cfg.ServerMode = *mode
+		config.Set(&cfg)
+	default:
+		log.Fatalf("Invalid --mode %q, expected all, api or worker", *mode)
+	}
+
+	// "server migrate ..." manages the schema instead of starting the server
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(args[1:]))
+	}
+
+	// Under systemd socket activation the listening socket is inherited, and
+	// connections wait in its backlog while the service restarts
+	inherited, err := systemdListener()
+	if err != nil {
+		log.Fatalf("Failed to use the socket passed by systemd: %v", err)
+	}
 
 	// Initialize database connection
-	log.Printf("Connecting to database: %s...", redactDBURL(config.AppConfig.DatabaseURL))
-	err = db.InitDB(config.AppConfig.DatabaseURL)
+	log.Printf("Connecting to database: %s...", redactDBURL(config.Get().DatabaseURL))
+	err = db.InitDB(config.Get().DatabaseURL, config.Get().DatabaseBackend, config.Get().DatabaseAutoMigrate)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer db.DB.Close()
+	defer db.Close()
 	log.Println("Database connection successful and schema migrated.")
 
-	// Initialize render queue with configurable worker count
-	workerCount := config.AppConfig.RenderWorkerCount
-	renderer.InitRenderQueue(workerCount)
+	// Give a fresh deployment its first admin user
+	if config.Get().AdminUsername != "" {
+		created, err := db.BootstrapAdminUser(config.Get().AdminUsername, config.Get().AdminPassword)
+		if err != nil {
+			log.Fatalf("Failed to create admin user %s: %v", config.Get().AdminUsername, err)
+		}
+		if created {
+			log.Printf("Created admin user %s.", config.Get().AdminUsername)
+		}
+	}
+	if config.Get().AdminToken != "" {
+		log.Println("Warning: ADMIN_TOKEN is deprecated, log in as an admin user with POST /admin/login instead.")
+	}
+
+	// Encrypt snapshots at rest
+	key, err := snapshotKey()
+	if err != nil {
+		log.Fatalf("Failed to load snapshot encryption key: %v", err)
+	}
+	if err := db.SetSnapshotKey(key); err != nil {
+		log.Fatalf("Invalid snapshot encryption key: %v", err)
+	}
+	cacheMaxHTMLBytes := config.Get().LinkCacheMaxHTMLBytes
+	if key != nil {
+		cacheMaxHTMLBytes = 0 // Keep decrypted snapshots out of Redis
+		log.Println("Encrypting stored snapshots.")
+	}
+
+	// Cache short-code lookups in Redis, shared by all replicas, or else in memory
+	if config.Get().RedisURL != "" {
+		linkCache, err := cache.NewRedis(config.Get().RedisURL, time.Duration(config.Get().LinkCacheTTLSeconds)*time.Second)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer linkCache.Close()
+		db.SetLinkCache(linkCache, cacheMaxHTMLBytes)
+		log.Println("Caching short-code lookups in Redis.")
+
+		// Share rate limit counters between replicas too
+		limiter, err := ratelimit.NewRedis(config.Get().RedisURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer limiter.Close()
+		ratelimit.SetLimiter(limiter)
+	} else if config.Get().LocalLinkCacheSize > 0 {
+		// Only the destination and render status are kept; bots' snapshots are still loaded by hash
+		db.SetLinkCache(cache.NewLRU(config.Get().LocalLinkCacheSize,
+			time.Duration(config.Get().LocalLinkCacheTTLSeconds)*time.Second), 0)
+		log.Printf("Caching up to %d short-code lookups in memory.", config.Get().LocalLinkCacheSize)
+	}
+
+	db.SetRenderHistory(config.Get().RenderHistoryVersions)
+
+	// Make snapshots stored before content search was added searchable
+	go func() {
+		indexed, err := db.BackfillSearchText()
+		if err != nil {
+			log.Printf("Search: Failed to index existing snapshots: %v", err)
+		} else if indexed > 0 {
+			log.Printf("Search: Indexed %d existing snapshots", indexed)
+		}
+	}()
+
+	// A crash leaves the links being rendered stuck in rendering without a
+	// snapshot; once their render would have timed out, request them again
+	recovered, err := db.RecoverStuckRenders(time.Duration(config.Get().RenderTimeoutSeconds) * time.Second)
+	if err != nil {
+		log.Printf("Failed to recover renders stuck in rendering: %v", err)
+	} else if len(recovered) > 0 {
+		log.Printf("Re-queued %d renders stuck in rendering: %v", len(recovered), recovered)
+	}
+
+	// Render on this replica unless it only serves the API, in which case renders
+	// are requested from the worker replicas through the database
+	stopPolling := func() {}
+	if *mode == modeAPI {
+		renderer.InitRemoteRenderQueue()
+	} else {
+		renderer.InitRenderQueue(config.Get().RenderWorkerCount)
+		stopPolling = renderer.GlobalRenderQueue.StartPolling(time.Duration(config.Get().RenderPollIntervalSeconds) * time.Second)
+	}
+	servesLinks := *mode != modeWorker
+	log.Printf("Running in %s mode.", *mode)
+
+	// Record clicks in the background so redirects don't wait on INSERTs
+	if config.Get().ClickTrackingEnabled && servesLinks {
+		analytics.InitClickWriter(config.Get().ClickBufferSize, config.Get().ClickBatchSize,
+			time.Duration(config.Get().ClickFlushIntervalSeconds)*time.Second)
+	}
+
+	// Forward clicks to Google Analytics
+	if config.Get().GA4MeasurementID != "" && servesLinks {
+		if config.Get().GA4APISecret == "" {
+			log.Fatalf("GA4_API_SECRET is required with GA4_MEASUREMENT_ID")
+		}
+		analytics.InitGA4Forwarder(config.Get().GA4MeasurementID, config.Get().GA4APISecret,
+			config.Get().GA4EventName, config.Get().ClickBufferSize)
+	}
+
+	// Look up client countries, keeping the database up to date
+	stopGeoIP := func() {}
+	if path := config.Get().GeoIPDatabasePath; path != "" && servesLinks {
+		var source *geoip.Source
+		if config.Get().GeoIPLicenseKey != "" {
+			source = &geoip.Source{AccountID: config.Get().GeoIPAccountID,
+				LicenseKey: config.Get().GeoIPLicenseKey, EditionID: config.Get().GeoIPEditionID}
+			if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Downloading the %s GeoIP database to %s...", source.EditionID, path)
+				if err := geoip.Download(context.Background(), *source, path); err != nil {
+					log.Fatalf("Failed to download GeoIP database: %v", err)
+				}
+			}
+		}
+		if err := geoip.Open(path); err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+		defer geoip.Close()
+		log.Printf("Looking up client countries in %s.", path)
+		if config.Get().GeoIPRefreshHours > 0 {
+			stopGeoIP = geoip.StartRefresh(path, time.Duration(config.Get().GeoIPRefreshHours)*time.Hour, source)
+		}
+	}
+
+	stopRollups := func() {}
+	if config.Get().ClickRollupIntervalMinutes > 0 {
+		// With raw retention, rolled up events stay until they expire
+		stopRollups = analytics.StartRollups(time.Duration(config.Get().ClickRollupIntervalMinutes)*time.Minute,
+			config.Get().ClickRawRetentionDays > 0)
+	}
+	stopRetention := func() {}
+	if (config.Get().ClickRawRetentionDays > 0 || config.Get().ClickAggregateRetentionDays > 0) &&
+		config.Get().JanitorIntervalMinutes > 0 {
+		stopRetention = janitor.StartAnalyticsRetention(time.Duration(config.Get().JanitorIntervalMinutes)*time.Minute,
+			time.Duration(config.Get().ClickRawRetentionDays)*24*time.Hour,
+			time.Duration(config.Get().ClickAggregateRetentionDays)*24*time.Hour)
+	}
+	stopJanitor := func() {}
+	if config.Get().ContentRetentionDays > 0 && config.Get().JanitorIntervalMinutes > 0 {
+		stopJanitor = janitor.Start(time.Duration(config.Get().JanitorIntervalMinutes)*time.Minute,
+			time.Duration(config.Get().ContentRetentionDays)*24*time.Hour, config.Get().ContentRetentionMode)
+	}
+	stopArchiving := func() {}
+	if config.Get().ArchiveInactiveMonths > 0 && config.Get().JanitorIntervalMinutes > 0 {
+		// A month is taken as 30 days
+		stopArchiving = janitor.StartArchiving(time.Duration(config.Get().JanitorIntervalMinutes)*time.Minute,
+			time.Duration(config.Get().ArchiveInactiveMonths)*30*24*time.Hour)
+	}
+	stopPartitions := func() {}
+	if partitioned, err := db.ClickEventsPartitioned(); err != nil {
+		log.Printf("Failed to check click event partitioning: %v", err)
+	} else if partitioned && config.Get().JanitorIntervalMinutes > 0 {
+		stopPartitions = janitor.StartClickPartitions(time.Duration(config.Get().JanitorIntervalMinutes)*time.Minute,
+			config.Get().ClickPartitionRetentionMonths)
+	}
 
-	// Setup graceful shutdown
+	stopScreening := func() {}
+	if config.Get().SafeBrowsingAPIKey != "" {
+		reputation.SetChecker(reputation.NewSafeBrowsing(config.Get().SafeBrowsingAPIKey))
+		if config.Get().URLScreeningIntervalHours > 0 {
+			stopScreening = janitor.StartScreening(time.Duration(config.Get().URLScreeningIntervalHours) * time.Hour)
+		}
+	}
+
+	// Apply edits to the reloadable settings in .env on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			changed, err := config.Reload()
+			if err != nil {
+				log.Printf("Config: Reload failed, keeping the current settings: %v", err)
+				continue
+			}
+			log.Printf("Config: Reloaded %v", changed)
+		}
+	}()
+
+	// Setup router; worker replicas only answer health checks
+	var router *gin.Engine
+	if servesLinks {
+		router = api.SetupRouter()
+	} else {
+		router = api.SetupWorkerRouter()
+	}
+	sup := newSupervisor(router)
+	if certFile := config.Get().TLSCertFile; certFile != "" {
+		if err := sup.loadCertificate(certFile, config.Get().TLSKeyFile); err != nil {
+			log.Fatalf("Invalid TLS_CERT_FILE or TLS_KEY_FILE: %v", err)
+		}
+		sup.tls = true
+	}
+
+	// Setup graceful shutdown: fail readiness and stop taking render jobs, but
+	// keep serving for the grace period so the replica leaves the load balancer
+	// before it stops listening
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-c
-		log.Println("Shutting down gracefully...")
+		grace := time.Duration(config.Get().ShutdownGraceSeconds) * time.Second
+		log.Printf("Shutting down gracefully, draining for %s...", grace)
+		api.StartDraining()
+		sup.drain()
+		stopPolling()
+		renderer.GlobalRenderQueue.StopAccepting()
+		select {
+		case <-time.After(grace):
+		case <-c:
+			log.Println("Second signal received, skipping the rest of the grace period")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := sup.shutdown(ctx); err != nil {
+			log.Printf("Server did not shut down cleanly: %v", err)
+		}
 		renderer.GlobalRenderQueue.Shutdown()
-		os.Exit(0)
+		webhook.Drain()
+		if analytics.GlobalClickWriter != nil {
+			analytics.GlobalClickWriter.Close() // Flush buffered clicks before exiting
+		}
+		if analytics.GlobalGA4Forwarder != nil {
+			analytics.GlobalGA4Forwarder.Close()
+		}
+		stopRollups()
+		stopRetention()
+		stopJanitor()
+		stopArchiving()
+		stopPartitions()
+		stopScreening()
+		stopGeoIP()
 	}()
 
-	// Setup router
-	router := api.SetupRouter()
-	serverAddr := config.AppConfig.ServerPort
+	listener := inherited
+	sup.inherited = inherited != nil
+	if listener == nil {
+		listener, err = listen(config.Get().ServerPort, config.Get().ServerSocketMode, config.Get().ServerSocketGroup)
+		if err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}
+	log.Printf("Starting server on %s...", listener.Addr())
+	sup.serve(listener, config.Get().ServerPort)
+
+	// Reloads also rebind the listener and re-read the TLS certificate, leaving
+	// the render queue alone
+	config.OnReload(sup.reload)
 
-	log.Printf("Starting server on %s...", serverAddr)
-	if err := router.Run(serverAddr); err != nil {
+	select {
+	case err := <-sup.errs:
 		log.Fatalf("Failed to start server: %v", err)
+	case <-stopped:
+	}
+	log.Println("Server stopped")
+}
+
+// serverWriteTimeout is SERVER_WRITE_TIMEOUT_SECONDS, or by default long enough
+// for /generate to wait out a render and still answer. Streams and exports lift
+// it for their own responses.
+func serverWriteTimeout() time.Duration {
+	cfg := config.Get()
+	if seconds := cfg.ServerWriteTimeoutSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
 	}
+	wait := max(cfg.RenderTimeoutSeconds, cfg.GenerateMaxWaitSeconds)
+	return time.Duration(wait)*time.Second + 30*time.Second
 }
 
 // redactDBURL is a helper function to avoid logging sensitive parts of the DB URL.
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+)
+
+const migrateUsage = `Usage: server migrate [command]
+
+Commands:
+  up       Apply all pending migrations (default)
+  down     Roll back the most recent migration
+  status   List migrations and whether they are applied`
+
+// runMigrate implements the migrate subcommand and returns the process exit code.
+func runMigrate(args []string) int {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if command != "up" && command != "down" && command != "status" {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	if err := db.Connect(config.Get().DatabaseURL); err != nil {
+		log.Printf("Failed to connect to database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	var err error
+	switch command {
+	case "up":
+		err = db.Migrate()
+	case "down":
+		err = db.MigrateDown()
+	case "status":
+		var states []db.MigrationState
+		states, err = db.GetMigrationStates()
+		for _, state := range states {
+			applied := "pending"
+			if state.Applied {
+				applied = "applied"
+			}
+			fmt.Printf("%5d  %-8s %s\n", state.Version, applied, state.Name)
+		}
+	}
+	if err != nil {
+		log.Printf("Migration failed: %v", err)
+		return 1
+	}
+	return 0
+}
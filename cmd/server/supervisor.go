@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// supervisor runs the HTTP server and applies listener and TLS settings
+// reloaded on SIGHUP within the process, so the render queue and its jobs carry
+// on: the certificate is re-read from TLS_CERT_FILE and TLS_KEY_FILE, and when
+// SERVER_PORT changed the new address is bound and served before the old
+// listener is closed gracefully.
+type supervisor struct {
+	handler   http.Handler
+	tls       bool // Serve HTTPS, with TLS_CERT_FILE set at startup
+	inherited bool // The listener came from systemd, which owns the address
+	cert      atomic.Pointer[tls.Certificate]
+	errs      chan error // Serving failures other than a shutdown
+
+	mu       sync.Mutex
+	server   *http.Server
+	addr     string // SERVER_PORT the server listens on
+	draining bool
+}
+
+func newSupervisor(handler http.Handler) *supervisor {
+	return &supervisor{handler: handler, errs: make(chan error, 1)}
+}
+
+// loadCertificate reads the key pair served from now on. Connections made
+// earlier keep the certificate they were made with.
+func (s *supervisor) loadCertificate(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	s.cert.Store(&cert)
+	return nil
+}
+
+// newServer returns an HTTP server with the configured timeouts.
+func (s *supervisor) newServer() *http.Server {
+	cfg := config.Get()
+	server := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: time.Duration(cfg.ServerReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(cfg.ServerReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      serverWriteTimeout(),
+		IdleTimeout:       time.Duration(cfg.ServerIdleTimeoutSeconds) * time.Second,
+	}
+	if s.tls {
+		server.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.cert.Load(), nil
+			},
+		}
+	}
+	return server
+}
+
+// serve serves on listener, bound to addr. The server serving until then is
+// shut down gracefully, finishing the requests it is handling.
+func (s *supervisor) serve(listener net.Listener, addr string) {
+	server := s.newServer()
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		listener.Close()
+		return
+	}
+	old := s.server
+	s.server, s.addr = server, addr
+	s.mu.Unlock()
+
+	go func() {
+		var err error
+		if s.tls {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case s.errs <- err:
+			default: // The first failure already ends the process
+			}
+		}
+	}()
+	if old != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := old.Shutdown(ctx); err != nil {
+				log.Printf("Server: The previous listener did not shut down cleanly: %v", err)
+			}
+		}()
+	}
+}
+
+// reload applies the reloaded TLS_CERT_FILE, TLS_KEY_FILE and SERVER_PORT. A
+// setting that can't be applied is logged and the current one kept.
+func (s *supervisor) reload() {
+	cfg := config.Get()
+	if s.tls {
+		if err := s.loadCertificate(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			log.Printf("TLS: Failed to reload the certificate, keeping the current one: %v", err)
+		} else {
+			log.Printf("TLS: Reloaded the certificate from %s", cfg.TLSCertFile)
+		}
+	}
+
+	addr := cfg.ServerPort
+	s.mu.Lock()
+	current, draining := s.addr, s.draining
+	s.mu.Unlock()
+	if addr == current || draining {
+		return
+	}
+	if s.inherited {
+		log.Printf("Server: Not moving to %s, the socket passed by systemd is kept", addr)
+		return
+	}
+	listener, err := listen(addr, cfg.ServerSocketMode, cfg.ServerSocketGroup)
+	if err != nil {
+		log.Printf("Server: Failed to move to %s, still serving on %s: %v", addr, current, err)
+		return
+	}
+	log.Printf("Server: Moving from %s to %s", current, listener.Addr())
+	s.serve(listener, addr)
+}
+
+// drain stops keeping connections alive and rebinding, ahead of shutdown.
+func (s *supervisor) drain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.draining = true
+	s.server.SetKeepAlivesEnabled(false)
+}
+
+// shutdown stops the server gracefully, waiting for open requests until ctx
+// is done.
+func (s *supervisor) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	server := s.server
+	s.mu.Unlock()
+	return server.Shutdown(ctx)
+}
@@ -0,0 +1,128 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClickWriter buffers click events in memory and writes them to the database in
+// batches from a background goroutine, so recording a click never waits on an
+// INSERT. When the buffer is full, new events are dropped rather than slowing
+// down redirects.
+type ClickWriter struct {
+	events        chan db.ClickEvent
+	batchSize     int
+	flushInterval time.Duration
+	flush         func([]db.ClickEvent) error
+
+	dropped   atomic.Uint64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var GlobalClickWriter *ClickWriter
+
+// InitClickWriter starts the global click writer, flushing to the database.
+func InitClickWriter(bufferSize, batchSize int, flushInterval time.Duration) {
+	GlobalClickWriter = NewClickWriter(bufferSize, batchSize, flushInterval, db.RecordClickEvents)
+	log.Printf("Initialized click writer (buffer %d, batch %d, flush every %s)", bufferSize, batchSize, flushInterval)
+}
+
+// NewClickWriter starts a writer that hands batches of up to batchSize events to
+// flush, at least every flushInterval while events are pending.
+func NewClickWriter(bufferSize, batchSize int, flushInterval time.Duration, flush func([]db.ClickEvent) error) *ClickWriter {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	w := &ClickWriter{
+		events:        make(chan db.ClickEvent, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		flush:         flush,
+		done:          make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Record queues an event without blocking. It reports whether the event was
+// accepted; false means the buffer was full and the event was dropped.
+func (w *ClickWriter) Record(event db.ClickEvent) bool {
+	select {
+	case w.events <- event:
+		return true
+	default:
+		if dropped := w.dropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+			log.Printf("Clicks: Buffer full, dropped %d events so far", dropped)
+		}
+		return false
+	}
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (w *ClickWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Close stops accepting events and blocks until all buffered events are written.
+// Record must not be called after Close.
+func (w *ClickWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.events)
+		<-w.done
+	})
+}
+
+func (w *ClickWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]db.ClickEvent, 0, w.batchSize)
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.flush(batch); err != nil {
+			log.Printf("Clicks: Failed to write %d events: %v", len(batch), err)
+		}
+		batch = make([]db.ClickEvent, 0, w.batchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				write()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.batchSize {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		}
+	}
+}
+
+// HashIP returns a salted SHA-256 of a client IP, so clicks from the same visitor
+// can be grouped without storing the address itself.
+func HashIP(ip, salt string) string {
+	if ip == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + ip))
+	return hex.EncodeToString(sum[:])
+}
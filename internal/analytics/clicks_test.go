@@ -0,0 +1,89 @@
+package analytics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingFlush collects the batches handed to it by a ClickWriter.
+type recordingFlush struct {
+	mu      sync.Mutex
+	batches [][]db.ClickEvent
+}
+
+func (r *recordingFlush) flush(events []db.ClickEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, events)
+	return nil
+}
+
+func (r *recordingFlush) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, batch := range r.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func TestClickWriterBatches(t *testing.T) {
+	rec := &recordingFlush{}
+	w := NewClickWriter(100, 2, time.Hour, rec.flush)
+
+	for _, code := range []string{"A", "B", "C"} {
+		require.True(t, w.Record(db.ClickEvent{ShortCode: code}))
+	}
+	// A full batch is written without waiting for the flush interval
+	require.Eventually(t, func() bool { return rec.count() == 2 }, time.Second, 5*time.Millisecond)
+
+	// Close writes the partial batch
+	w.Close()
+	require.Len(t, rec.batches, 2)
+	assert.Equal(t, "C", rec.batches[1][0].ShortCode)
+}
+
+func TestClickWriterFlushInterval(t *testing.T) {
+	rec := &recordingFlush{}
+	w := NewClickWriter(100, 100, 10*time.Millisecond, rec.flush)
+	defer w.Close()
+
+	w.Record(db.ClickEvent{ShortCode: "A"})
+	assert.Eventually(t, func() bool { return rec.count() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestClickWriterDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	var flushed int
+	w := NewClickWriter(1, 1, time.Hour, func(events []db.ClickEvent) error {
+		<-release // Hold the writer so the buffer fills up
+		flushed += len(events)
+		return nil
+	})
+
+	require.True(t, w.Record(db.ClickEvent{ShortCode: "A"}))
+	// The first event is taken off the buffer once the writer blocks in flush
+	require.Eventually(t, func() bool { return len(w.events) == 0 }, time.Second, 5*time.Millisecond)
+	require.True(t, w.Record(db.ClickEvent{ShortCode: "B"}))
+	assert.False(t, w.Record(db.ClickEvent{ShortCode: "C"}))
+	assert.Equal(t, uint64(1), w.Dropped())
+
+	close(release)
+	w.Close()
+	assert.Equal(t, 2, flushed)
+}
+
+func TestHashIP(t *testing.T) {
+	assert.Empty(t, HashIP("", "salt"))
+	assert.Len(t, HashIP("203.0.113.7", "salt"), 64)
+	assert.Equal(t, HashIP("203.0.113.7", "salt"), HashIP("203.0.113.7", "salt"))
+	assert.NotEqual(t, HashIP("203.0.113.7", "salt"), HashIP("203.0.113.7", "other"))
+	assert.NotEqual(t, HashIP("203.0.113.7", "salt"), HashIP("203.0.113.8", "salt"))
+}
@@ -0,0 +1,227 @@
+package analytics
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ga4Endpoint is GA4's Measurement Protocol collection endpoint. Tests point it
+// elsewhere.
+var ga4Endpoint = "https://www.google-analytics.com/mp/collect"
+
+const (
+	ga4MaxEvents = 25               // Events the Measurement Protocol accepts per request
+	ga4MaxBatch  = 100              // Hits taken off the buffer at once
+	ga4Timeout   = 10 * time.Second // Per request
+)
+
+// GA4Forwarder sends clicks to a GA4 property through the Measurement Protocol,
+// so they show up next to the site's own analytics. Like ClickWriter it
+// buffers hits and sends them from a background goroutine, dropping new ones
+// when the buffer is full rather than slowing down redirects.
+type GA4Forwarder struct {
+	hits          chan ga4Hit
+	measurementID string
+	apiSecret     string
+	eventName     string
+	client        *http.Client
+
+	sent      atomic.Uint64
+	dropped   atomic.Uint64
+	failed    atomic.Uint64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ga4Hit is a click waiting to be sent.
+type ga4Hit struct {
+	event  db.ClickEvent
+	target string
+}
+
+// GlobalGA4Forwarder forwards redirects to GA4, nil when forwarding is off.
+var GlobalGA4Forwarder *GA4Forwarder
+
+// InitGA4Forwarder starts the global forwarder.
+func InitGA4Forwarder(measurementID, apiSecret, eventName string, bufferSize int) {
+	GlobalGA4Forwarder = NewGA4Forwarder(measurementID, apiSecret, eventName, bufferSize)
+	log.Printf("Forwarding clicks to GA4 property %s as %q events", measurementID, eventName)
+}
+
+// NewGA4Forwarder starts a forwarder that sends eventName events to the GA4
+// data stream with measurementID, e.g. G-XXXXXXX, authenticated by one of its
+// Measurement Protocol API secrets.
+func NewGA4Forwarder(measurementID, apiSecret, eventName string, bufferSize int) *GA4Forwarder {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	f := &GA4Forwarder{
+		hits:          make(chan ga4Hit, bufferSize),
+		measurementID: measurementID,
+		apiSecret:     apiSecret,
+		eventName:     eventName,
+		client:        &http.Client{Timeout: ga4Timeout},
+		done:          make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+// Forward queues a click on a link redirecting to target without blocking. It
+// reports whether the click was accepted; false means the buffer was full.
+func (f *GA4Forwarder) Forward(event db.ClickEvent, target string) bool {
+	select {
+	case f.hits <- ga4Hit{event: event, target: target}:
+		return true
+	default:
+		if dropped := f.dropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+			log.Printf("GA4: Buffer full, dropped %d clicks so far", dropped)
+		}
+		return false
+	}
+}
+
+// Close stops accepting clicks and blocks until the buffered ones are sent.
+// Forward must not be called after Close.
+func (f *GA4Forwarder) Close() {
+	f.closeOnce.Do(func() {
+		close(f.hits)
+		<-f.done
+	})
+}
+
+// GetStatus reports how forwarding has fared since startup, for /status.
+func (f *GA4Forwarder) GetStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"measurement_id": f.measurementID,
+		"sent":           f.sent.Load(),
+		"dropped":        f.dropped.Load(),
+		"failed":         f.failed.Load(),
+	}
+}
+
+func (f *GA4Forwarder) run() {
+	defer close(f.done)
+	for hit := range f.hits {
+		// Send what else is waiting along with it. A request carries the hits of
+		// one client only.
+		batch := map[string][]ga4Hit{}
+		var order []string
+		add := func(hit ga4Hit) {
+			id := ga4ClientID(hit.event)
+			if _, ok := batch[id]; !ok {
+				order = append(order, id)
+			}
+			batch[id] = append(batch[id], hit)
+		}
+		add(hit)
+	drain:
+		for i := 1; i < ga4MaxBatch; i++ {
+			select {
+			case next, ok := <-f.hits:
+				if !ok {
+					break drain
+				}
+				add(next)
+			default:
+				break drain
+			}
+		}
+		for _, id := range order {
+			hits := batch[id]
+			for len(hits) > 0 {
+				n := min(len(hits), ga4MaxEvents)
+				if err := f.send(id, hits[:n]); err != nil {
+					f.failed.Add(uint64(n))
+					log.Printf("GA4: Failed to send %d clicks: %v", n, err)
+				} else {
+					f.sent.Add(uint64(n))
+				}
+				hits = hits[n:]
+			}
+		}
+	}
+}
+
+// ga4ClientID identifies the visitor of a click to GA4 by the salted hash of
+// their IP, so repeat clicks count as one user without handing Google the
+// address. Clicks without one get a random ID.
+func ga4ClientID(event db.ClickEvent) string {
+	if len(event.IPHash) >= 32 {
+		return event.IPHash[:32]
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ga4Payload is a Measurement Protocol request body.
+type ga4Payload struct {
+	ClientID        string     `json:"client_id"`
+	TimestampMicros int64      `json:"timestamp_micros"` // When the events happened, since hits queue up for a moment
+	Events          []ga4Event `json:"events"`
+}
+
+type ga4Event struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// send posts the hits of one client in a request.
+func (f *GA4Forwarder) send(clientID string, hits []ga4Hit) error {
+	payload := ga4Payload{ClientID: clientID, TimestampMicros: hits[0].event.ClickedAt.UnixMicro()}
+	for _, hit := range hits {
+		params := map[string]interface{}{
+			"short_code":           hit.event.ShortCode,
+			"link_url":             hit.target,
+			"ua_class":             hit.event.UAClass,
+			"engagement_time_msec": 1, // Makes the click count as an active user
+		}
+		for key, value := range map[string]string{
+			"page_referrer": hit.event.Referrer,
+			"bot_name":      hit.event.BotName,
+			"device_class":  hit.event.DeviceClass,
+			"country":       hit.event.Country,
+		} {
+			if value != "" {
+				params[key] = value
+			}
+		}
+		payload.Events = append(payload.Events, ga4Event{Name: f.eventName, Params: params})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"measurement_id": {f.measurementID}, "api_secret": {f.apiSecret}}
+	req, err := http.NewRequest(http.MethodPost, ga4Endpoint+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // Its URL holds the API secret
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGA4Forwarder(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	var payloads []ga4Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload ga4Payload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		payloads = append(payloads, payload)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	defer func(endpoint string) { ga4Endpoint = endpoint }(ga4Endpoint)
+	ga4Endpoint = server.URL
+
+	clickedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	visitor := HashIP("203.0.113.7", "salt")
+	f := NewGA4Forwarder("G-TEST123", "s3cret", "short_link_click", 10)
+	assert.True(t, f.Forward(db.ClickEvent{ShortCode: "GA1", ClickedAt: clickedAt, UAClass: db.UAClassBrowser,
+		IPHash: visitor, Referrer: "https://news.example.com/", Country: "DE"}, "https://example.com/landing"))
+	assert.True(t, f.Forward(db.ClickEvent{ShortCode: "GA2", ClickedAt: clickedAt, UAClass: db.UAClassBrowser,
+		IPHash: visitor}, "https://example.com/other"))
+	f.Close()
+
+	require.NotEmpty(t, payloads)
+	assert.Equal(t, "api_secret=s3cret&measurement_id=G-TEST123", queries[0])
+	var events []ga4Event
+	for _, payload := range payloads {
+		assert.Equal(t, visitor[:32], payload.ClientID, "the visitor is identified by the IP hash")
+		assert.Equal(t, clickedAt.UnixMicro(), payload.TimestampMicros)
+		events = append(events, payload.Events...)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, "short_link_click", events[0].Name)
+	assert.Equal(t, "GA1", events[0].Params["short_code"])
+	assert.Equal(t, "https://example.com/landing", events[0].Params["link_url"])
+	assert.Equal(t, "https://news.example.com/", events[0].Params["page_referrer"])
+	assert.Equal(t, "DE", events[0].Params["country"])
+	assert.NotContains(t, events[1].Params, "page_referrer")
+	assert.Equal(t, uint64(2), f.GetStatus()["sent"])
+}
+
+func TestGA4ForwarderFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	defer func(endpoint string) { ga4Endpoint = endpoint }(ga4Endpoint)
+	ga4Endpoint = server.URL
+
+	f := NewGA4Forwarder("G-TEST123", "wrong", "short_link_click", 10)
+	f.Forward(db.ClickEvent{ShortCode: "GA1", ClickedAt: time.Now()}, "https://example.com/")
+	f.Close()
+	assert.Equal(t, uint64(1), f.GetStatus()["failed"])
+	assert.NotEqual(t, ga4ClientID(db.ClickEvent{}), ga4ClientID(db.ClickEvent{}), "clicks without an IP hash get random IDs")
+}
@@ -0,0 +1,46 @@
+package analytics
+
+import (
+	"log"
+	"prerender-url-shortener/internal/db"
+	"time"
+)
+
+// StartRollups rolls raw click events into daily per-link stats every interval,
+// keeping the click_events table small unless keepEvents leaves the rolled up
+// events for the retention job to prune. It returns a function that stops the job
+// and waits for a running rollup to finish.
+func StartRollups(interval time.Duration, keepEvents bool) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				runRollup(keepEvents)
+			case <-quit:
+				return
+			}
+		}
+	}()
+	log.Printf("Rollup: Rolling up click events every %s", interval)
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+func runRollup(keepEvents bool) {
+	start := time.Now()
+	rolled, err := db.RollupClickEvents(start, keepEvents)
+	if err != nil {
+		log.Printf("Rollup: Failed after rolling up %d click events: %v", rolled, err)
+		return
+	}
+	if rolled > 0 {
+		log.Printf("Rollup: Rolled up %d click events in %s", rolled, time.Since(start))
+	}
+}
@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"sync/atomic"
+)
+
+// streamBuffer is how many events a subscriber may fall behind before its
+// events are dropped.
+const streamBuffer = 256
+
+// ClickStream fans click events out to live subscribers, such as dashboards
+// following a campaign. Publishing never blocks: a subscriber that can't keep
+// up misses events instead of slowing down redirects. Only the clicks served
+// by this process are seen.
+type ClickStream struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+// GlobalClickStream carries every recorded click.
+var GlobalClickStream = NewClickStream()
+
+// NewClickStream returns a stream without subscribers.
+func NewClickStream() *ClickStream {
+	return &ClickStream{subscribers: make(map[*Subscription]struct{})}
+}
+
+// ClickFilter picks the events a subscriber receives. Zero fields match every
+// event.
+type ClickFilter struct {
+	ShortCodes []string // Any of these short codes
+	UAClass    string   // db.UAClassBrowser or db.UAClassBot
+}
+
+// matches reports whether e passes the filter.
+func (f ClickFilter) matches(e db.ClickEvent) bool {
+	if f.UAClass != "" && e.UAClass != f.UAClass {
+		return false
+	}
+	if len(f.ShortCodes) == 0 {
+		return true
+	}
+	for _, code := range f.ShortCodes {
+		if code == e.ShortCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the events matching its filter on Events until it is
+// closed.
+type Subscription struct {
+	Events  chan db.ClickEvent
+	filter  ClickFilter
+	stream  *ClickStream
+	dropped atomic.Uint64
+}
+
+// Subscribe starts receiving the events matching filter. The subscription must
+// be closed once done with.
+func (s *ClickStream) Subscribe(filter ClickFilter) *Subscription {
+	sub := &Subscription{Events: make(chan db.ClickEvent, streamBuffer), filter: filter, stream: s}
+	s.mu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+	return sub
+}
+
+// Close stops the subscription and closes its Events channel.
+func (sub *Subscription) Close() {
+	sub.stream.mu.Lock()
+	defer sub.stream.mu.Unlock()
+	if _, ok := sub.stream.subscribers[sub]; ok {
+		delete(sub.stream.subscribers, sub)
+		close(sub.Events)
+	}
+}
+
+// Dropped returns the number of events the subscriber missed because it fell
+// behind.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Publish hands e to every subscriber whose filter it matches, without
+// blocking.
+func (s *ClickStream) Publish(e db.ClickEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for sub := range s.subscribers {
+		if !sub.filter.matches(e) {
+			continue
+		}
+		select {
+		case sub.Events <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribers returns the number of open subscriptions.
+func (s *ClickStream) Subscribers() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.subscribers)
+}
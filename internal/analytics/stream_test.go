@@ -0,0 +1,36 @@
+package analytics
+
+import (
+	"testing"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClickStream(t *testing.T) {
+	stream := NewClickStream()
+	all := stream.Subscribe(ClickFilter{})
+	bots := stream.Subscribe(ClickFilter{ShortCodes: []string{"A", "B"}, UAClass: db.UAClassBot})
+	assert.Equal(t, 2, stream.Subscribers())
+
+	stream.Publish(db.ClickEvent{ShortCode: "A", UAClass: db.UAClassBot})
+	stream.Publish(db.ClickEvent{ShortCode: "A", UAClass: db.UAClassBrowser})
+	stream.Publish(db.ClickEvent{ShortCode: "C", UAClass: db.UAClassBot})
+	assert.Len(t, all.Events, 3)
+	assert.Len(t, bots.Events, 1)
+	assert.Equal(t, "A", (<-bots.Events).ShortCode)
+
+	for i := 0; i < streamBuffer+5; i++ {
+		stream.Publish(db.ClickEvent{ShortCode: "B", UAClass: db.UAClassBot})
+	}
+	assert.Equal(t, uint64(5), bots.Dropped(), "a subscriber that falls behind misses events")
+	assert.Equal(t, uint64(8), all.Dropped())
+
+	bots.Close()
+	bots.Close()
+	assert.Equal(t, 1, stream.Subscribers())
+	stream.Publish(db.ClickEvent{ShortCode: "A", UAClass: db.UAClassBot})
+	all.Close()
+	assert.Equal(t, 0, stream.Subscribers())
+}
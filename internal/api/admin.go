@@ -0,0 +1,460 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/cdn"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/renderer"
+	"prerender-url-shortener/internal/shortener"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminAuth guards the admin endpoints. Callers authenticate with the token of
+// a session from POST /admin/login, as a bearer token or in the session cookie.
+// Viewers may only read. The legacy ADMIN_TOKEN bearer token is still accepted
+// with the admin role while it is configured.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, role, sent := adminCredentials(c)
+		if !sent {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin credentials required"})
+			return
+		}
+		if username == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid admin token"})
+			return
+		}
+
+		if role != db.AdminRoleAdmin && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Viewers can't make changes"})
+			return
+		}
+		c.Set(adminUserKey, username)
+		c.Next()
+	}
+}
+
+// adminCredentials returns the admin user a request is authenticated as and
+// their role, from the bearer token or session cookie. sent is false without
+// either, and username is empty if the token matches no session.
+func adminCredentials(c *gin.Context) (username, role string, sent bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		token, _ = c.Cookie(adminSessionCookie)
+	}
+	if token == "" {
+		return "", "", false
+	}
+	if legacy := config.Get().AdminToken; legacy != "" && subtle.ConstantTimeCompare([]byte(token), []byte(legacy)) == 1 {
+		return "ADMIN_TOKEN", db.AdminRoleAdmin, true
+	}
+	user, err := db.GetAdminSessionUser(token)
+	if err != nil {
+		if !errors.Is(err, db.ErrNotFound) {
+			log.Printf("Error looking up admin session: %v", err)
+		}
+		return "", "", true
+	}
+	return user.Username, user.Role, true
+}
+
+// LinkDetails is the admin view of a link, including its render diagnostics.
+type LinkDetails struct {
+	ShortCode        string          `json:"short_code"`
+	SignedShortCode  string          `json:"signed_short_code,omitempty"` // The code served in short URLs, when they are signed
+	OriginalURL      string          `json:"original_url"`
+	FinalURL         string          `json:"final_url,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	Deleted          bool            `json:"deleted"`
+	RenderStatus     db.RenderStatus `json:"render_status"`
+	RenderAttempts   int             `json:"render_attempts"`
+	LastRenderError  string          `json:"last_render_error,omitempty"`
+	TargetStatusCode int             `json:"target_status_code,omitempty"`
+	RenderedAt       *time.Time      `json:"rendered_at"`
+	RenderDurationMs int64           `json:"render_duration_ms"`
+	HTMLSizeBytes    int64           `json:"html_size_bytes"`
+	LastAccessedAt   *time.Time      `json:"last_accessed_at"`
+	DisabledAt       *time.Time      `json:"disabled_at,omitempty"`
+	DisabledReason   string          `json:"disabled_reason,omitempty"`
+	RobotsTag        string          `json:"robots_tag,omitempty"`
+	CacheControl     string          `json:"cache_control,omitempty"`
+	StaticMode       bool            `json:"static_mode"`
+}
+
+// GetLinkHandler returns the details of a link, deleted or not.
+func GetLinkHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	link, err := db.GetLinkByShortCodeIncludingDeleted(shortCode)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, newLinkDetails(link))
+}
+
+// signedCode returns the code served for a link if short codes are signed.
+func signedCode(shortCode string) string {
+	if !shortener.SigningEnabled() {
+		return ""
+	}
+	return shortener.SignCode(shortCode)
+}
+
+// newLinkDetails builds the admin view of a link.
+func newLinkDetails(link *db.Link) LinkDetails {
+	return LinkDetails{
+		ShortCode:        link.ShortCode,
+		SignedShortCode:  signedCode(link.ShortCode),
+		OriginalURL:      link.OriginalURL,
+		FinalURL:         link.FinalURL,
+		CreatedAt:        link.CreatedAt,
+		Deleted:          link.DeletedAt.Valid,
+		RenderStatus:     link.RenderStatus,
+		RenderAttempts:   link.RenderAttempts,
+		LastRenderError:  link.LastRenderError,
+		TargetStatusCode: link.TargetStatusCode,
+		RenderedAt:       link.RenderedAt,
+		RenderDurationMs: link.RenderDurationMs,
+		HTMLSizeBytes:    link.HTMLSizeBytes,
+		LastAccessedAt:   link.LastAccessedAt,
+		DisabledAt:       link.DisabledAt,
+		DisabledReason:   link.DisabledReason,
+		RobotsTag:        link.RobotsTag,
+		CacheControl:     link.CacheControl,
+		StaticMode:       link.StaticMode,
+	}
+}
+
+// Page size limits for the stale content report.
+const (
+	defaultStaleLinksLimit = 100
+	maxStaleLinksLimit     = 1000
+)
+
+// StaleLinksHandler reports links whose snapshot was rendered more than
+// ?older_than_hours= ago, oldest first, along with how many there are in total.
+func StaleLinksHandler(c *gin.Context) {
+	hours, err := strconv.Atoi(c.Query("older_than_hours"))
+	if err != nil || hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "older_than_hours must be a positive number of hours"})
+		return
+	}
+	limit := defaultStaleLinksLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxStaleLinksLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxStaleLinksLimit)})
+			return
+		}
+	}
+
+	cutoff := time.Now().Add(-time.Duration(hours) * time.Hour)
+	total, err := db.CountStaleLinks(cutoff)
+	if err != nil {
+		log.Printf("Error counting stale links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	links, err := db.ListStaleLinks(cutoff, limit)
+	if err != nil {
+		log.Printf("Error listing stale links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	details := make([]LinkDetails, 0, len(links))
+	for i := range links {
+		details = append(details, newLinkDetails(&links[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"cutoff": cutoff, "total": total, "links": details})
+}
+
+// Limits for the content search.
+const (
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 100
+	maxSearchPhraseBytes = 200
+)
+
+// SearchLinksHandler finds the live links whose snapshot mentions the phrase in
+// ?content=, so editors can tell which short links point at pages about a topic.
+func SearchLinksHandler(c *gin.Context) {
+	phrase := strings.TrimSpace(c.Query("content"))
+	if phrase == "" || len(phrase) > maxSearchPhraseBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("content must be a phrase of 1 to %d bytes", maxSearchPhraseBytes)})
+		return
+	}
+	limit := defaultSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit)})
+			return
+		}
+	}
+
+	links, err := db.SearchLinksByContent(phrase, limit)
+	if err != nil {
+		log.Printf("Error searching links for %q: %v", phrase, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	details := make([]LinkDetails, 0, len(links))
+	for i := range links {
+		details = append(details, newLinkDetails(&links[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"content": phrase, "links": details})
+}
+
+// RenderStatsHandler reports aggregate render duration and snapshot size, for
+// all links or, with ?site=, for those whose URL starts with the given prefix.
+func RenderStatsHandler(c *gin.Context) {
+	site := c.Query("site")
+	stats, err := db.GetRenderStats(site)
+	if err != nil {
+		log.Printf("Error computing render stats for %q: %v", site, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"site": site, "stats": stats})
+}
+
+// DeleteLinkHandler soft-deletes a link. Its short code answers 410 Gone until the
+// link is restored and is never handed out to another URL.
+func DeleteLinkHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	if err := db.DeleteLink(shortCode); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error deleting link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: deleted link %s", shortCode)
+	cdn.Purge(shortCode)
+	c.JSON(http.StatusOK, gin.H{"short_code": shortCode, "deleted": true})
+}
+
+// RestoreLinkHandler undeletes a soft-deleted link within the retention window.
+func RestoreLinkHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	retention := time.Duration(config.Get().DeletedLinkRetentionHours) * time.Hour
+	link, err := db.RestoreLink(shortCode, retention)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+		case errors.Is(err, db.ErrRetentionExpired):
+			c.JSON(http.StatusGone, gin.H{"error": "Link was deleted too long ago to be restored"})
+		default:
+			log.Printf("Error restoring link %s: %v", shortCode, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	log.Printf("Admin: restored link %s", shortCode)
+	cdn.Purge(shortCode)
+	c.JSON(http.StatusOK, gin.H{"short_code": link.ShortCode, "original_url": link.OriginalURL, "deleted": false})
+}
+
+// DisableLinkRequest is the body of POST /admin/links/:shortCode/disable.
+type DisableLinkRequest struct {
+	Reason string `json:"reason"`
+}
+
+// DisableLinkHandler stops a link from redirecting without deleting it, e.g. to
+// take down abuse.
+func DisableLinkHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	var req DisableLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Disabled by an admin"
+	}
+	if err := db.DisableLink(shortCode, req.Reason); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error disabling link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: disabled link %s: %s", shortCode, req.Reason)
+	cdn.Purge(shortCode)
+	c.JSON(http.StatusOK, gin.H{"short_code": shortCode, "disabled": true, "disabled_reason": req.Reason})
+}
+
+// EnableLinkHandler lets a disabled link redirect again, e.g. after URL
+// screening flagged it by mistake.
+func EnableLinkHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	if err := db.EnableLink(shortCode); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error enabling link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: enabled link %s", shortCode)
+	cdn.Purge(shortCode)
+	c.JSON(http.StatusOK, gin.H{"short_code": shortCode, "disabled": false})
+}
+
+// RerenderLinkHandler queues a fresh render of a link, e.g. after its page
+// changed. It answers right away; the link serves its current snapshot until
+// the render finishes.
+func RerenderLinkHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	link, err := db.GetLinkByShortCode(shortCode)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if renderer.GlobalRenderQueue.IsInProgress(link.ShortCode) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Link is already being rendered"})
+		return
+	}
+	if err := db.UpdateLinkRenderStatus(shortCode, db.RenderStatusPending); err != nil {
+		log.Printf("Error resetting render status of %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	renderer.GlobalRenderQueue.QueueRender(link.ShortCode, link.OriginalURL)
+	log.Printf("Admin: queued a render of link %s", shortCode)
+	c.JSON(http.StatusAccepted, gin.H{"short_code": shortCode, "render_status": db.RenderStatusPending})
+}
+
+// PauseQueueHandler stops this replica's render workers from starting jobs,
+// e.g. while the sites they render are being deployed. Renders running finish,
+// and jobs queued meanwhile wait for ResumeQueueHandler.
+func PauseQueueHandler(c *gin.Context) {
+	if !renderer.GlobalRenderQueue.HasWorkers() {
+		c.JSON(http.StatusConflict, gin.H{"error": "This replica has no render workers to pause"})
+		return
+	}
+	if renderer.GlobalRenderQueue.Pause() {
+		log.Printf("Admin: %s paused the render queue", c.GetString(adminUserKey))
+	}
+	c.JSON(http.StatusOK, gin.H{"paused": true})
+}
+
+// ResumeQueueHandler lets the render workers start jobs again after
+// PauseQueueHandler.
+func ResumeQueueHandler(c *gin.Context) {
+	if renderer.GlobalRenderQueue.Resume() {
+		log.Printf("Admin: %s resumed the render queue", c.GetString(adminUserKey))
+	}
+	c.JSON(http.StatusOK, gin.H{"paused": false})
+}
+
+// RenderVersionDetails is the admin view of a kept render of a link.
+type RenderVersionDetails struct {
+	ID               uint      `json:"id"`
+	RenderedAt       time.Time `json:"rendered_at"`
+	ContentHash      string    `json:"content_hash"`
+	TargetStatusCode int       `json:"target_status_code,omitempty"`
+	FinalURL         string    `json:"final_url,omitempty"`
+	RenderDurationMs int64     `json:"render_duration_ms"`
+	HTMLSizeBytes    int64     `json:"html_size_bytes"`
+	Current          bool      `json:"current"` // Whether the link serves this snapshot
+}
+
+// ListRenderVersionsHandler lists the kept renders of a link, newest first.
+func ListRenderVersionsHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	link, err := db.GetLinkByShortCodeIncludingDeleted(shortCode)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	versions, err := db.ListRenderVersions(shortCode)
+	if err != nil {
+		log.Printf("Error listing render versions of %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	details := make([]RenderVersionDetails, 0, len(versions))
+	for _, v := range versions {
+		details = append(details, RenderVersionDetails{
+			ID:               v.ID,
+			RenderedAt:       v.RenderedAt,
+			ContentHash:      v.RenderedContentHash,
+			TargetStatusCode: v.TargetStatusCode,
+			FinalURL:         v.FinalURL,
+			RenderDurationMs: v.RenderDurationMs,
+			HTMLSizeBytes:    v.HTMLSizeBytes,
+			Current:          v.RenderedContentHash == link.RenderedContentHash,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"short_code": shortCode, "versions": details})
+}
+
+// RollbackRenderHandler makes a link serve the snapshot of one of its kept
+// renders again. The next render of the link replaces it as usual.
+func RollbackRenderHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	versionID, err := strconv.ParseUint(c.Param("versionID"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+	version, err := db.RollbackRender(shortCode, uint(versionID))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Render version not found"})
+			return
+		}
+		log.Printf("Error rolling back %s to version %d: %v", shortCode, versionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: rolled back link %s to version %d", shortCode, version.ID)
+	cdn.Purge(shortCode)
+	c.JSON(http.StatusOK, gin.H{"short_code": shortCode, "version_id": version.ID, "rendered_at": version.RenderedAt})
+}
+
+// ReloadConfigHandler applies edits to the reloadable settings in the .env file
+// without a restart, like SIGHUP, and lists the settings that changed.
+func ReloadConfigHandler(c *gin.Context) {
+	changed, err := config.Reload()
+	if err != nil {
+		log.Printf("Config: Reload failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Reload failed: " + err.Error()})
+		return
+	}
+	log.Printf("Config: Reloaded %v", changed)
+	c.JSON(http.StatusOK, gin.H{"changed": changed})
+}
@@ -0,0 +1,653 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/analytics"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/renderer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAuth(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "AUTH123", OriginalURL: "https://auth.com"}))
+
+	tests := []struct {
+		name           string
+		adminToken     string
+		authorization  string
+		expectedStatus int
+	}{
+		{"disabled without a configured token", "", "Bearer ", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusForbidden},
+		{"wrong token", "secret", "Bearer wrong", http.StatusForbidden},
+		{"token without bearer scheme", "secret", "secret", http.StatusForbidden},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Get().AdminToken = tt.adminToken
+			req := httptest.NewRequest("POST", "/admin/links/AUTH123/restore", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestDeleteAndRestoreLinkHandlers(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	config.Get().DeletedLinkRetentionHours = 1
+
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:    "DEL123",
+		OriginalURL:  "https://deleted.com",
+		RenderStatus: db.RenderStatusCompleted,
+	}))
+
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/admin/links/MISSING"))
+	assert.Equal(t, http.StatusOK, do("DELETE", "/admin/links/DEL123"))
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/admin/links/DEL123"), "already deleted")
+
+	// Deleted codes answer 410 rather than 404
+	assert.Equal(t, http.StatusGone, do("GET", "/DEL123"))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/MISSING"))
+
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/links/DEL123/restore"))
+	assert.Equal(t, http.StatusFound, do("GET", "/DEL123"))
+	assert.Equal(t, http.StatusNotFound, do("POST", "/admin/links/MISSING/restore"))
+
+	// Past the retention window the link can no longer be restored
+	assert.Equal(t, http.StatusOK, do("DELETE", "/admin/links/DEL123"))
+	longAgo := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, db.DB.Unscoped().Model(&db.Link{}).Where("short_code = ?", "DEL123").Update("deleted_at", longAgo).Error)
+	assert.Equal(t, http.StatusGone, do("POST", "/admin/links/DEL123/restore"))
+	assert.Equal(t, http.StatusGone, do("GET", "/DEL123"))
+}
+
+func TestDisableAndEnableLinkHandlers(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "ABUSE1", OriginalURL: "https://abuse.com"}))
+
+	assert.Equal(t, http.StatusNotFound, do("POST", "/admin/links/MISSING/disable", "").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/links/ABUSE1/disable", `{"reason": "Phishing report"}`).Code)
+	assert.Equal(t, http.StatusGone, do("GET", "/ABUSE1", "").Code)
+
+	var details LinkDetails
+	require.NoError(t, json.Unmarshal(do("GET", "/admin/links/ABUSE1", "").Body.Bytes(), &details))
+	assert.NotNil(t, details.DisabledAt)
+	assert.Equal(t, "Phishing report", details.DisabledReason)
+
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/links/ABUSE1/enable", "").Code)
+	assert.Equal(t, http.StatusFound, do("GET", "/ABUSE1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/admin/links/MISSING/enable", "").Code)
+
+	// Without a body the reason says who disabled it
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/links/ABUSE1/disable", "").Code)
+	link, err := db.GetLinkByShortCode("ABUSE1")
+	require.NoError(t, err)
+	assert.Equal(t, "Disabled by an admin", link.DisabledReason)
+}
+
+func TestRerenderLinkHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	// Keep the queued render from running, it would need a browser and network
+	require.True(t, renderer.GlobalRenderQueue.Pause())
+
+	do := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:    "AGAIN1",
+		OriginalURL:  "https://again.com",
+		RenderStatus: db.RenderStatusFailed,
+	}))
+
+	assert.Equal(t, http.StatusNotFound, do("/admin/links/MISSING/rerender").Code)
+
+	w := do("/admin/links/AGAIN1/rerender")
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "AGAIN1", resp["short_code"])
+	assert.Equal(t, string(db.RenderStatusPending), resp["render_status"])
+
+	link, err := db.GetLinkByShortCode("AGAIN1")
+	require.NoError(t, err)
+	assert.Equal(t, db.RenderStatusPending, link.RenderStatus)
+	assert.True(t, renderer.GlobalRenderQueue.IsInProgress("AGAIN1"))
+	assert.Equal(t, http.StatusConflict, do("/admin/links/AGAIN1/rerender").Code)
+}
+
+func TestPauseResumeQueue(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	paused := func() interface{} {
+		w := do("GET", "/status")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			RenderQueue map[string]interface{} `json:"render_queue"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.RenderQueue["paused"]
+	}
+
+	assert.Equal(t, false, paused())
+	w := do("POST", "/admin/queue/pause")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"paused": true}`, w.Body.String())
+	assert.Equal(t, true, paused())
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/queue/pause").Code, "pausing twice is fine")
+
+	w = do("POST", "/admin/queue/resume")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"paused": false}`, w.Body.String())
+	assert.Equal(t, false, paused())
+}
+
+func TestAdminLinkDetailsAndRenderStats(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	get := func(path string, v interface{}) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+		return w.Code
+	}
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "INFO01", OriginalURL: "https://info.com/page"}))
+	require.NoError(t, db.SaveRenderResult("INFO01", &db.RenderResult{
+		HTMLContent: "<html>info</html>",
+		Duration:    1500 * time.Millisecond,
+	}))
+
+	var details LinkDetails
+	assert.Equal(t, http.StatusOK, get("/admin/links/INFO01", &details))
+	assert.Equal(t, db.RenderStatusCompleted, details.RenderStatus)
+	assert.Equal(t, int64(1500), details.RenderDurationMs)
+	assert.Equal(t, int64(len("<html>info</html>")), details.HTMLSizeBytes)
+	assert.NotNil(t, details.RenderedAt)
+	assert.False(t, details.Deleted)
+	assert.Equal(t, http.StatusNotFound, get("/admin/links/MISSING", &details))
+
+	var report struct {
+		Site  string         `json:"site"`
+		Stats db.RenderStats `json:"stats"`
+	}
+	assert.Equal(t, http.StatusOK, get("/admin/render-stats?site=https://info.com/", &report))
+	assert.Equal(t, "https://info.com/", report.Site)
+	assert.Equal(t, int64(1), report.Stats.Links)
+	assert.Equal(t, int64(1500), report.Stats.MaxDurationMs)
+	assert.Equal(t, http.StatusOK, get("/admin/render-stats?site=https://elsewhere.com/", &report))
+	assert.Zero(t, report.Stats.Links)
+}
+
+func TestAdminStaleLinks(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, code := range []string{"STALE1", "STALE2", "FRESH1"} {
+		require.NoError(t, db.CreateLink(&db.Link{ShortCode: code, OriginalURL: "https://" + code + ".com"}))
+		require.NoError(t, db.SaveRenderResult(code, &db.RenderResult{HTMLContent: "<html></html>"}))
+	}
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	require.NoError(t, db.DB.Model(&db.Link{}).Where("short_code IN ?", []string{"STALE1", "STALE2"}).Update("rendered_at", weekAgo).Error)
+
+	w := get("/admin/stale-links?older_than_hours=24&limit=1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		Total int64         `json:"total"`
+		Links []LinkDetails `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, int64(2), report.Total)
+	require.Len(t, report.Links, 1)
+	assert.Contains(t, []string{"STALE1", "STALE2"}, report.Links[0].ShortCode)
+
+	assert.Equal(t, http.StatusBadRequest, get("/admin/stale-links").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/admin/stale-links?older_than_hours=-1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/admin/stale-links?older_than_hours=24&limit=5000").Code)
+}
+
+func TestAdminRenderVersions(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	db.SetRenderHistory(3)
+	defer db.SetRenderHistory(0)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "VER123", OriginalURL: "https://versions.com"}))
+	require.NoError(t, db.SaveRenderResult("VER123", &db.RenderResult{HTMLContent: "<html>good</html>"}))
+	require.NoError(t, db.SaveRenderResult("VER123", &db.RenderResult{HTMLContent: "<html>broken</html>"}))
+
+	w := do("GET", "/admin/links/VER123/versions")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Versions []RenderVersionDetails `json:"versions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Versions, 2)
+	assert.True(t, list.Versions[0].Current)
+	assert.False(t, list.Versions[1].Current)
+
+	good := list.Versions[1].ID
+	w = do("POST", fmt.Sprintf("/admin/links/VER123/versions/%d/rollback", good))
+	require.Equal(t, http.StatusOK, w.Code)
+	link, err := db.GetLinkByShortCode("VER123")
+	require.NoError(t, err)
+	assert.Equal(t, "<html>good</html>", link.RenderedHTMLContent)
+
+	assert.Equal(t, http.StatusNotFound, do("GET", "/admin/links/MISSING/versions").Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/admin/links/VER123/versions/9999/rollback").Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/links/VER123/versions/latest/rollback").Code)
+}
+
+func TestSearchLinks(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "FIND01", OriginalURL: "https://find.com"}))
+	require.NoError(t, db.SaveRenderResult("FIND01", &db.RenderResult{HTMLContent: "<h1>Quarterly results</h1>"}))
+
+	w := get("/links/search?content=quarterly+results")
+	require.Equal(t, http.StatusOK, w.Code)
+	var result struct {
+		Links []LinkDetails `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Len(t, result.Links, 1)
+	assert.Equal(t, "FIND01", result.Links[0].ShortCode)
+
+	assert.Equal(t, http.StatusBadRequest, get("/links/search").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/links/search?content=results&limit=500").Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/links/search?content=results", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "an admin token is required")
+}
+
+func TestLinkCrawls(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	analytics.GlobalClickWriter = analytics.NewClickWriter(10, 10, time.Hour, db.RecordClickEvents)
+	defer func() { analytics.GlobalClickWriter = nil }()
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "CRAWL1", OriginalURL: "https://crawled.com"}))
+	require.NoError(t, db.SaveRenderResult("CRAWL1", &db.RenderResult{HTMLContent: "<html>crawled</html>"}))
+	for _, ua := range []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Twitterbot/1.0",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+	} {
+		req := httptest.NewRequest("GET", "/CRAWL1", nil)
+		req.Header.Set("User-Agent", ua)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	analytics.GlobalClickWriter.Close()
+
+	req := httptest.NewRequest("GET", "/admin/links/CRAWL1/crawls", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Crawlers []CrawlerDetails `json:"crawlers"`
+		Crawls   []Crawl          `json:"crawls"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Crawls, 3, "people's clicks aren't crawls")
+	hits := map[string]int64{}
+	for _, crawler := range resp.Crawlers {
+		hits[crawler.BotName] = crawler.Hits
+		assert.True(t, crawler.CrawledSinceRender, crawler.BotName)
+	}
+	assert.Equal(t, map[string]int64{"Googlebot": 2, "Twitterbot": 1}, hits)
+
+	req = httptest.NewRequest("GET", "/admin/links/CRAWL1/crawls?limit=0", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLinkStats(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	analytics.GlobalClickWriter = analytics.NewClickWriter(10, 10, time.Hour, db.RecordClickEvents)
+	defer func() { analytics.GlobalClickWriter = nil }()
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "STATS1", OriginalURL: "https://stats.com"}))
+	for _, ua := range []string{
+		"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+	} {
+		req := httptest.NewRequest("GET", "/STATS1", nil)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Referer", "https://social.example.com/post/1")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	analytics.GlobalClickWriter.Close()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := get("/links/STATS1/stats?days=7")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Clicks     int64                      `json:"clicks"`
+		Breakdowns map[string][]db.ClickCount `json:"breakdowns"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(2), resp.Clicks)
+	assert.Equal(t, []db.ClickCount{{Value: "social.example.com", Clicks: 2}}, resp.Breakdowns[db.DimensionReferrer])
+	assert.Equal(t, []db.ClickCount{{Value: "desktop", Clicks: 1}, {Value: "mobile", Clicks: 1}}, resp.Breakdowns[db.DimensionDevice])
+
+	assert.Equal(t, http.StatusBadRequest, get("/links/STATS1/stats?days=0").Code)
+	assert.Equal(t, http.StatusNotFound, get("/links/MISSING/stats").Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/links/STATS1/stats", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAnalytics(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	now := time.Now().UTC()
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "DASH1", OriginalURL: "https://dash.com", RenderStatus: db.RenderStatusFailed}))
+	require.NoError(t, db.RecordClickEvents([]db.ClickEvent{
+		{ShortCode: "DASH1", ClickedAt: now, UAClass: db.UAClassBrowser},
+		{ShortCode: "DASH1", ClickedAt: now, UAClass: db.UAClassBot, BotName: "Googlebot"},
+	}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := get("/admin/analytics/top-links")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var top struct {
+		Range map[string]string `json:"range"`
+		Links []db.LinkClicks   `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &top))
+	assert.Equal(t, now.Format(time.DateOnly), top.Range["to"])
+	assert.Equal(t, now.AddDate(0, 0, -29).Format(time.DateOnly), top.Range["from"])
+	assert.Equal(t, []db.LinkClicks{{ShortCode: "DASH1", Clicks: 2, BotClicks: 1}}, top.Links)
+
+	w = get("/admin/analytics/clicks?from=" + now.AddDate(0, 0, -1).Format(time.DateOnly))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var clicks struct {
+		Clicks int64          `json:"clicks"`
+		Days   []db.DayClicks `json:"days"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &clicks))
+	assert.Equal(t, int64(2), clicks.Clicks)
+	assert.Len(t, clicks.Days, 2)
+
+	w = get("/admin/analytics/bots")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var bots struct {
+		BotRatio float64         `json:"bot_ratio"`
+		Crawlers []db.ClickCount `json:"crawlers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bots))
+	assert.Equal(t, 0.5, bots.BotRatio)
+	assert.Equal(t, []db.ClickCount{{Value: "Googlebot", Clicks: 1}}, bots.Crawlers)
+
+	w = get("/admin/analytics/renders")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var renders struct {
+		Renders db.RenderOutcomes `json:"renders"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &renders))
+	assert.Equal(t, 1.0, renders.Renders.FailureRate)
+
+	assert.Equal(t, http.StatusBadRequest, get("/admin/analytics/clicks?from=yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/admin/analytics/clicks?from=2024-02-01&to=2024-01-01").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/admin/analytics/clicks?from=2023-01-01&to=2024-12-31").Code)
+	assert.Equal(t, http.StatusOK, get("/admin/analytics/clicks?from=2024-01-01&to=2024-12-31").Code, "a leap year fits")
+
+	require.NoError(t, db.RecordAnalyticsPurge(db.DatasetClickEvents, now.AddDate(0, 0, -90), 42))
+	w = get("/admin/analytics/purges")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var purges struct {
+		Purges []struct {
+			Dataset     string `json:"dataset"`
+			RowsDeleted int64  `json:"rows_deleted"`
+		} `json:"purges"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &purges))
+	require.Len(t, purges.Purges, 1)
+	assert.Equal(t, int64(42), purges.Purges[0].RowsDeleted)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/analytics/clicks", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestClickExport(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	now := time.Now().UTC()
+	today := now.Format(time.DateOnly)
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "CSV1", OriginalURL: "https://csv.com"}))
+	require.NoError(t, db.RecordClickEvents([]db.ClickEvent{
+		{ShortCode: "CSV1", ClickedAt: now, UAClass: db.UAClassBrowser, Referrer: "https://a.example/, with comma", Country: "DE"},
+		{ShortCode: "CSV2", ClickedAt: now, UAClass: db.UAClassBot, BotName: "Googlebot"},
+	}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := get("/links/CSV1/stats/export")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "clicks-CSV1-daily-")
+	assert.Equal(t, "short_code,day,clicks,bot_clicks\nCSV1,"+today+",1,0\n", w.Body.String())
+
+	w = get("/links/CSV1/stats/export?granularity=raw")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "short_code,clicked_at,ua_class,referrer,bot_name,browser,platform,device_class,country\n"+
+		"CSV1,"+now.Format(time.RFC3339)+`,browser,"https://a.example/, with comma",,,,,DE`+"\n", w.Body.String())
+
+	w = get("/admin/analytics/export")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "short_code,day,clicks,bot_clicks\nCSV1,"+today+",1,0\nCSV2,"+today+",1,1\n", w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, get("/admin/analytics/export?granularity=hourly").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/admin/analytics/export?to=soon").Code)
+	assert.Equal(t, http.StatusNotFound, get("/links/MISSING/stats/export").Code)
+}
+
+func TestClearWriteDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	slow := func(c *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	}
+	router.GET("/slow", slow)
+	router.GET("/lifted", func(c *gin.Context) {
+		clearWriteDeadline(c)
+		slow(c)
+	})
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// Past the write timeout the connection is dropped without an answer
+	_, err := http.Get(server.URL + "/slow")
+	assert.Error(t, err)
+
+	resp, err := http.Get(server.URL + "/lifted")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+}
+
+func TestClickStreamEndpoint(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	analytics.GlobalClickWriter = analytics.NewClickWriter(10, 10, time.Hour, db.RecordClickEvents)
+	defer func() { analytics.GlobalClickWriter.Close(); analytics.GlobalClickWriter = nil }()
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "LIVE1", OriginalURL: "https://live.com"}))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "LIVE2", OriginalURL: "https://live2.com"}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/admin/analytics/stream?short_code=LIVE1&ua_class=bot", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/event-stream")
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	assert.Equal(t, "event:ping", lines.Text())
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, click := range []struct{ code, ua string }{
+		{"LIVE1", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"},
+		{"LIVE2", "Googlebot/2.1"},
+		{"LIVE1", "Googlebot/2.1"},
+	} {
+		req, _ := http.NewRequest("GET", server.URL+"/"+click.code, nil)
+		req.Header.Set("User-Agent", click.ua)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	var event string
+	for lines.Scan() {
+		if line := lines.Text(); strings.HasPrefix(line, "event:click") {
+			require.True(t, lines.Scan())
+			event = lines.Text()
+			break
+		}
+	}
+	var click StreamedClick
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data:")), &click))
+	assert.Equal(t, "LIVE1", click.ShortCode, "only the filtered link's bot clicks are streamed")
+	assert.Equal(t, "Googlebot", click.BotName)
+
+	cancel()
+	require.Eventually(t, func() bool { return analytics.GlobalClickStream.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/admin/analytics/stream?ua_class=robot", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminSessionCookie holds the session token for browsers, such as a dashboard.
+const adminSessionCookie = "admin_session"
+
+// adminUserKey is the context key adminAuth stores the authenticated username
+// under, for logging who made a change.
+const adminUserKey = "admin_user"
+
+// AdminLoginRequest is the body of POST /admin/login.
+type AdminLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// CreateAdminUserRequest is the body of POST /admin/users. bcrypt only uses the
+// first 72 bytes of a password, so longer ones are refused.
+type CreateAdminUserRequest struct {
+	Username string `json:"username" binding:"required,max=64,printascii"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Role     string `json:"role" binding:"required,oneof=admin viewer"`
+}
+
+// AdminLoginHandler checks an admin user's password and starts a session,
+// returning its token and setting it as a cookie.
+func AdminLoginHandler(c *gin.Context) {
+	var req AdminLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	user, err := db.AuthenticateAdminUser(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			log.Printf("Admin: failed login for %q from %s", req.Username, clientIP(c))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+		log.Printf("Error authenticating admin user %s: %v", req.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	ttl := time.Duration(config.Get().AdminSessionTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	token, expiresAt, err := db.CreateAdminSession(user.ID, ttl)
+	if err != nil {
+		log.Printf("Error creating admin session for %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(adminSessionCookie, token, int(ttl.Seconds()), "/", "", c.Request.TLS != nil, true)
+	log.Printf("Admin: %s logged in", user.Username)
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt.UTC(),
+		"username":   user.Username,
+		"role":       user.Role,
+	})
+}
+
+// AdminLogoutHandler ends the session whose token is sent, as a bearer token or
+// in the session cookie.
+func AdminLogoutHandler(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		token, _ = c.Cookie(adminSessionCookie)
+	}
+	if token != "" {
+		if err := db.DeleteAdminSession(token); err != nil {
+			log.Printf("Error deleting admin session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(adminSessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"logged_out": true})
+}
+
+// ListAdminUsersHandler lists the admin users and their roles.
+func ListAdminUsersHandler(c *gin.Context) {
+	users, err := db.ListAdminUsers()
+	if err != nil {
+		log.Printf("Error listing admin users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// CreateAdminUserHandler adds an admin user.
+func CreateAdminUserHandler(c *gin.Context) {
+	var req CreateAdminUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	user, err := db.CreateAdminUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		if errors.Is(err, db.ErrUsernameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already in use"})
+			return
+		}
+		log.Printf("Error creating admin user %s: %v", req.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: %s created %s user %s", c.GetString(adminUserKey), user.Role, user.Username)
+	c.JSON(http.StatusCreated, user)
+}
+
+// DeleteAdminUserHandler removes an admin user, ending their sessions.
+func DeleteAdminUserHandler(c *gin.Context) {
+	username := c.Param("username")
+	if err := db.DeleteAdminUser(username); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Admin user not found"})
+			return
+		}
+		log.Printf("Error deleting admin user %s: %v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: %s deleted user %s", c.GetString(adminUserKey), username)
+	c.JSON(http.StatusOK, gin.H{"username": username, "deleted": true})
+}
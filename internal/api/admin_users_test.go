@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminUserSessions(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	_, err := db.CreateAdminUser("root", "correct horse", db.AdminRoleAdmin)
+	require.NoError(t, err)
+	_, err = db.CreateAdminUser("watcher", "battery staple", db.AdminRoleViewer)
+	require.NoError(t, err)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(username, password string) string {
+		w := do("POST", "/admin/login", "", `{"username": "`+username+`", "password": "`+password+`"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["token"]
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/admin/login", "", `{"username": "root", "password": "wrong"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/admin/login", "", `{"username": "nobody", "password": "wrong"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/admin/users", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/admin/users", "made-up", "").Code)
+
+	// Admins can make changes
+	admin := login("root", "correct horse")
+	assert.Equal(t, http.StatusOK, do("GET", "/admin/users", admin, "").Code)
+	assert.Equal(t, http.StatusCreated, do("POST", "/admin/users", admin, `{"username": "carol", "password": "long enough", "role": "viewer"}`).Code)
+	assert.Equal(t, http.StatusConflict, do("POST", "/admin/users", admin, `{"username": "carol", "password": "long enough", "role": "viewer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/users", admin, `{"username": "dave", "password": "short", "role": "viewer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/users", admin, `{"username": "dave", "password": "long enough", "role": "owner"}`).Code)
+
+	// Viewers can only read
+	viewer := login("watcher", "battery staple")
+	w := do("GET", "/admin/users", viewer, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "carol")
+	assert.NotContains(t, w.Body.String(), "password")
+	assert.Equal(t, http.StatusForbidden, do("DELETE", "/admin/users/carol", viewer, "").Code)
+
+	// The session cookie works too
+	req := httptest.NewRequest("GET", "/admin/users", nil)
+	req.AddCookie(&http.Cookie{Name: adminSessionCookie, Value: viewer})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Logging out ends the session
+	assert.Equal(t, http.StatusOK, do("POST", "/admin/logout", viewer, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/admin/users", viewer, "").Code)
+
+	// Deleting a user ends their sessions
+	carol := login("carol", "long enough")
+	assert.Equal(t, http.StatusOK, do("DELETE", "/admin/users/carol", admin, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/admin/users", carol, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/admin/users/carol", admin, "").Code)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/shortener"
+
+	"github.com/gin-gonic/gin"
+)
+
+// managementAllowlist restricts the routes it guards to clients inside the
+// MANAGEMENT_ALLOWED_NETWORKS CIDR prefixes, so short links can be public while
+// management stays internal. Every client is allowed while the list is empty.
+func managementAllowlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list := config.Get().ManagementAllowedNetworks
+		if list == "" {
+			c.Next()
+			return
+		}
+		networks, err := shortener.ParseNetworks(list)
+		if err != nil {
+			log.Printf("Invalid MANAGEMENT_ALLOWED_NETWORKS, denying access: %v", err)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+		if addr, err := netip.ParseAddr(clientIP(c)); err == nil {
+			addr = addr.Unmap()
+			for _, network := range networks {
+				if network.Contains(addr) {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	}
+}
+
+// clientIP returns the address of the client making the request. Without
+// TRUSTED_PROXIES it is the peer address, since a forwarded-for header from an
+// untrusted client proves nothing.
+func clientIP(c *gin.Context) string {
+	if config.Get().TrustedProxies != "" {
+		return c.ClientIP()
+	}
+	return c.RemoteIP()
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagementAllowlist(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	get := func(path, remoteAddr, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Everyone is allowed while no networks are configured
+	assert.Equal(t, http.StatusOK, get("/status", "203.0.113.7:1234", ""))
+
+	config.Get().ManagementAllowedNetworks = "10.0.0.0/8, 192.168.1.5"
+	assert.Equal(t, http.StatusOK, get("/status", "10.1.2.3:1234", ""))
+	assert.Equal(t, http.StatusOK, get("/status", "192.168.1.5:1234", ""))
+	assert.Equal(t, http.StatusForbidden, get("/status", "203.0.113.7:1234", ""))
+	assert.Equal(t, http.StatusForbidden, get("/admin/links/abc", "203.0.113.7:1234", ""))
+	assert.Equal(t, http.StatusForbidden, get("/links/search?q=x", "203.0.113.7:1234", ""))
+
+	// Forwarded-for headers are ignored unless proxies are trusted
+	assert.Equal(t, http.StatusForbidden, get("/status", "203.0.113.7:1234", "10.1.2.3"))
+	config.Get().TrustedProxies = "203.0.113.0/24"
+	assert.Equal(t, http.StatusOK, get("/status", "203.0.113.7:1234", "10.1.2.3"))
+
+	// Short links stay public
+	assert.Equal(t, http.StatusNotFound, get("/nosuchcode", "198.51.100.1:1234", ""))
+
+	// An invalid list denies everyone rather than nobody
+	config.Get().ManagementAllowedNetworks = "not-a-network"
+	assert.Equal(t, http.StatusForbidden, get("/status", "10.1.2.3:1234", ""))
+}
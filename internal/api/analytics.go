@@ -0,0 +1,258 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/analytics"
+	"prerender-url-shortener/internal/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits for the site-wide analytics endpoints.
+const (
+	defaultAnalyticsDays  = 30
+	maxAnalyticsDays      = 366
+	defaultAnalyticsLimit = 20
+	maxAnalyticsLimit     = 1000
+)
+
+// dateRange reads the ?from= and ?to= range of an analytics request, see
+// ParseDateRange. On a bad range it responds with 400 and returns false.
+func dateRange(c *gin.Context) (from, to time.Time, ok bool) {
+	from, to, err := ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// ParseDateRange parses a range of UTC dates as YYYY-MM-DD. Both are
+// inclusive; to defaults to today and from to the defaultAnalyticsDays days up
+// to to.
+func ParseDateRange(rawFrom, rawTo string) (from, to time.Time, err error) {
+	to = time.Now().UTC().Truncate(24 * time.Hour)
+	if rawTo != "" {
+		if to, err = time.Parse(time.DateOnly, rawTo); err != nil {
+			return from, to, errors.New("to must be a date like 2006-01-02")
+		}
+	}
+	from = to.AddDate(0, 0, 1-defaultAnalyticsDays)
+	if rawFrom != "" {
+		if from, err = time.Parse(time.DateOnly, rawFrom); err != nil {
+			return from, to, errors.New("from must be a date like 2006-01-02")
+		}
+	}
+	if from.After(to) {
+		return from, to, errors.New("from must not be after to")
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return from, to, errors.New("The range must not span more than 366 days")
+	}
+	return from, to, nil
+}
+
+// rangeJSON is the range an analytics response covers.
+func rangeJSON(from, to time.Time) gin.H {
+	return gin.H{"from": from.Format(time.DateOnly), "to": to.Format(time.DateOnly)}
+}
+
+// AnalyticsTopLinksHandler lists the most clicked links in a date range.
+func AnalyticsTopLinksHandler(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultAnalyticsLimit, maxAnalyticsLimit)
+	if !ok {
+		return
+	}
+	links, err := db.GetTopLinks(from, to, limit)
+	if err != nil {
+		log.Printf("Error listing top links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"range": rangeJSON(from, to), "links": links})
+}
+
+// AnalyticsClicksHandler reports the clicks on all links per day of a date
+// range, with the range's totals.
+func AnalyticsClicksHandler(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	days, err := db.GetClicksPerDay(from, to)
+	if err != nil {
+		log.Printf("Error counting clicks per day: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var clicks, botClicks int64
+	for _, day := range days {
+		clicks += day.Clicks
+		botClicks += day.BotClicks
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"range":      rangeJSON(from, to),
+		"clicks":     clicks,
+		"bot_clicks": botClicks,
+		"days":       days,
+	})
+}
+
+// AnalyticsBotsHandler compares bot and human clicks in a date range and lists
+// the busiest crawlers.
+func AnalyticsBotsHandler(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultAnalyticsLimit, maxAnalyticsLimit)
+	if !ok {
+		return
+	}
+	days, err := db.GetClicksPerDay(from, to)
+	if err != nil {
+		log.Printf("Error counting clicks per day: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	crawlers, err := db.GetTopValues(db.DimensionBot, from, to, limit)
+	if err != nil {
+		log.Printf("Error listing top crawlers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var clicks, botClicks int64
+	for _, day := range days {
+		clicks += day.Clicks
+		botClicks += day.BotClicks
+	}
+	botRatio := 0.0
+	if clicks > 0 {
+		botRatio = float64(botClicks) / float64(clicks)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"range":        rangeJSON(from, to),
+		"bot_clicks":   botClicks,
+		"human_clicks": clicks - botClicks,
+		"bot_ratio":    botRatio,
+		"crawlers":     crawlers,
+	})
+}
+
+// AnalyticsRendersHandler reports how the renders of the links created in a
+// date range turned out.
+func AnalyticsRendersHandler(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	outcomes, err := db.GetRenderOutcomes(from, to)
+	if err != nil {
+		log.Printf("Error counting render outcomes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"range": rangeJSON(from, to), "renders": outcomes})
+}
+
+// Limits for the analytics purge audit trail.
+const (
+	defaultPurgesLimit = 100
+	maxPurgesLimit     = 1000
+)
+
+// AnalyticsPurgesHandler lists the latest purges of analytics data by the
+// retention job, newest first.
+func AnalyticsPurgesHandler(c *gin.Context) {
+	limit, ok := queryInt(c, "limit", defaultPurgesLimit, maxPurgesLimit)
+	if !ok {
+		return
+	}
+	purges, err := db.ListAnalyticsPurges(limit)
+	if err != nil {
+		log.Printf("Error listing analytics purges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	entries := make([]gin.H, 0, len(purges))
+	for _, purge := range purges {
+		entries = append(entries, gin.H{
+			"purged_at":    purge.PurgedAt,
+			"dataset":      purge.Dataset,
+			"cutoff":       purge.Cutoff,
+			"rows_deleted": purge.RowsDeleted,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"purges": entries})
+}
+
+// streamHeartbeat is how often an idle click stream sends a ping, so proxies
+// keep the connection open and the client learns about dropped events.
+var streamHeartbeat = 15 * time.Second
+
+// StreamedClick is a click event as sent to click stream subscribers, without
+// the visitor's IP hash.
+type StreamedClick struct {
+	ShortCode   string    `json:"short_code"`
+	ClickedAt   time.Time `json:"clicked_at"`
+	UAClass     string    `json:"ua_class"`
+	Referrer    string    `json:"referrer,omitempty"`
+	BotName     string    `json:"bot_name,omitempty"`
+	Browser     string    `json:"browser,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+	DeviceClass string    `json:"device_class,omitempty"`
+	Country     string    `json:"country,omitempty"`
+}
+
+// AnalyticsStreamHandler sends clicks as they are recorded, as server-sent
+// "click" events, until the client disconnects. ?short_code= (repeatable)
+// limits the stream to some links and ?ua_class= to bots or browsers. Idle
+// streams get a "ping" event every streamHeartbeat with the number of clicks
+// dropped because the client fell behind.
+func AnalyticsStreamHandler(c *gin.Context) {
+	filter := analytics.ClickFilter{ShortCodes: c.QueryArray("short_code"), UAClass: c.Query("ua_class")}
+	if filter.UAClass != "" && filter.UAClass != db.UAClassBrowser && filter.UAClass != db.UAClassBot {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ua_class must be browser or bot"})
+		return
+	}
+	sub := analytics.GlobalClickStream.Subscribe(filter)
+	defer sub.Close()
+	clearWriteDeadline(c)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Keeps nginx from buffering the stream
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	done := c.Request.Context().Done()
+	c.SSEvent("ping", gin.H{"dropped": 0}) // Sends the headers right away
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-sub.Events:
+			c.SSEvent("click", StreamedClick{
+				ShortCode:   e.ShortCode,
+				ClickedAt:   e.ClickedAt,
+				UAClass:     e.UAClass,
+				Referrer:    e.Referrer,
+				BotName:     e.BotName,
+				Browser:     e.Browser,
+				Platform:    e.Platform,
+				DeviceClass: e.DeviceClass,
+				Country:     e.Country,
+			})
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"dropped": sub.Dropped()})
+		case <-done:
+			return false
+		}
+		return true
+	})
+}
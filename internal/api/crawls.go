@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page size limits for a link's crawl history.
+const (
+	defaultCrawlsLimit = 100
+	maxCrawlsLimit     = 1000
+)
+
+// CrawlerDetails is the admin view of one crawler's visits to a link.
+type CrawlerDetails struct {
+	db.CrawlerStats
+	// Whether the crawler came back after the current snapshot was rendered
+	CrawledSinceRender bool `json:"crawled_since_render"`
+}
+
+// Crawl is one bot request for a link.
+type Crawl struct {
+	BotName   string    `json:"bot"`
+	CrawledAt time.Time `json:"crawled_at"`
+}
+
+// LinkCrawlsHandler returns which crawlers fetched a link and when, so SEO teams
+// can check that pages are recrawled after they are rendered again. Crawls are
+// recorded as click events, so they are only kept while click tracking is on.
+func LinkCrawlsHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	limit, ok := queryInt(c, "limit", defaultCrawlsLimit, maxCrawlsLimit)
+	if !ok {
+		return
+	}
+	link, err := db.GetLinkByShortCodeIncludingDeleted(shortCode)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	stats, err := db.GetCrawlerStats(shortCode)
+	if err != nil {
+		log.Printf("Error summing up crawls of %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	events, err := db.ListCrawls(shortCode, limit)
+	if err != nil {
+		log.Printf("Error listing crawls of %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	crawlers := make([]CrawlerDetails, 0, len(stats))
+	for _, s := range stats {
+		crawlers = append(crawlers, CrawlerDetails{
+			CrawlerStats:       s,
+			CrawledSinceRender: link.RenderedAt != nil && s.LastCrawledAt.After(*link.RenderedAt),
+		})
+	}
+	crawls := make([]Crawl, 0, len(events))
+	for _, e := range events {
+		crawls = append(crawls, Crawl{BotName: e.BotName, CrawledAt: e.ClickedAt})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"short_code":  shortCode,
+		"rendered_at": link.RenderedAt,
+		"crawlers":    crawlers,
+		"crawls":      crawls,
+	})
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/db"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Granularities of a click export.
+const (
+	exportDaily = "daily" // Clicks per link and UTC day, rolled up or not
+	exportRaw   = "raw"   // Click events not rolled up yet
+)
+
+// LinkStatsExportHandler streams the clicks on a link in a date range as CSV.
+func LinkStatsExportHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	if _, err := db.GetLinkByShortCodeIncludingDeleted(shortCode); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	exportClicks(c, shortCode)
+}
+
+// AnalyticsExportHandler streams the clicks on all links in a date range as
+// CSV.
+func AnalyticsExportHandler(c *gin.Context) {
+	exportClicks(c, "")
+}
+
+// exportClicks streams the clicks on shortCode, or on all links if it is empty,
+// as CSV: per day with ?granularity=daily, the default, or one row per click
+// event with ?granularity=raw. The range is read like the analytics endpoints'.
+func exportClicks(c *gin.Context, shortCode string) {
+	granularity := c.DefaultQuery("granularity", exportDaily)
+	if granularity != exportDaily && granularity != exportRaw {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be daily or raw"})
+		return
+	}
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+
+	name := "clicks"
+	if shortCode != "" {
+		name += "-" + shortCode
+	}
+	filename := fmt.Sprintf("%s-%s-%s-%s.csv", name, granularity, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	clearWriteDeadline(c)
+
+	// The status is sent with the first rows, so a failure midway can only cut
+	// the file short
+	if err := WriteClicksCSV(c.Writer, shortCode, granularity, from, to); err != nil {
+		log.Printf("Error exporting clicks of %q: %v", shortCode, err)
+	}
+}
+
+// clearWriteDeadline lifts the server's write timeout for a response that may
+// rightly take longer, such as a stream or a large export.
+func clearWriteDeadline(c *gin.Context) {
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Error lifting the write deadline of %s: %v", c.Request.URL.Path, err)
+	}
+}
+
+// WriteClicksCSV writes the clicks on shortCode, or on all links if it is
+// empty, from the UTC day of from to that of to as CSV in the given
+// granularity, daily or raw.
+func WriteClicksCSV(out io.Writer, shortCode, granularity string, from, to time.Time) error {
+	w := csv.NewWriter(out)
+	var err error
+	switch granularity {
+	case exportRaw:
+		w.Write([]string{"short_code", "clicked_at", "ua_class", "referrer", "bot_name", "browser", "platform", "device_class", "country"})
+		err = db.ExportClickEvents(shortCode, from, to, func(e db.ClickEvent) error {
+			return w.Write([]string{e.ShortCode, e.ClickedAt.UTC().Format(time.RFC3339), e.UAClass, e.Referrer, e.BotName,
+				e.Browser, e.Platform, e.DeviceClass, e.Country})
+		})
+	case exportDaily:
+		w.Write([]string{"short_code", "day", "clicks", "bot_clicks"})
+		err = db.ExportDailyClicks(shortCode, from, to, func(s db.DailyClickStat) error {
+			return w.Write([]string{s.ShortCode, s.Day, strconv.FormatInt(s.Clicks, 10), strconv.FormatInt(s.BotClicks, 10)})
+		})
+	default:
+		return fmt.Errorf("unknown granularity %q", granularity)
+	}
+	w.Flush()
+	if err != nil {
+		return err
+	}
+	return w.Error()
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/flags"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetFlagRequest is the body of PUT /admin/flags/:name.
+type SetFlagRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// ListFlagsHandler reports the state of every feature flag and where it comes from.
+func ListFlagsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"flags": flags.All()})
+}
+
+// SetFlagHandler switches a feature flag on or off for every replica,
+// overriding FEATURE_FLAGS until it is cleared.
+func SetFlagHandler(c *gin.Context) {
+	name := c.Param("name")
+	if !flags.Known(name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown feature flag"})
+		return
+	}
+	var req SetFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if err := flags.Set(name, *req.Enabled); err != nil {
+		log.Printf("Error setting feature flag %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: set feature flag %s to %t", name, *req.Enabled)
+	c.JSON(http.StatusOK, flags.Get(name))
+}
+
+// ClearFlagHandler returns a feature flag to the state configured for the
+// environment.
+func ClearFlagHandler(c *gin.Context) {
+	name := c.Param("name")
+	if err := flags.Clear(name); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feature flag not set at runtime"})
+			return
+		}
+		log.Printf("Error clearing feature flag %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: cleared feature flag %s", name)
+	c.JSON(http.StatusOK, flags.Get(name))
+}
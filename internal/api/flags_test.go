@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/flags"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagHandlers(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	config.Get().FeatureFlags = "browser_pool=on"
+
+	do := func(method, path, body string) (int, flags.State) {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var state flags.State
+		json.Unmarshal(w.Body.Bytes(), &state)
+		return w.Code, state
+	}
+
+	code, state := do("PUT", "/admin/flags/browser_pool", `{"enabled": false}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, flags.State{Name: flags.BrowserPool, Enabled: false, Source: flags.SourceDatabase}, state)
+
+	req := httptest.NewRequest("GET", "/admin/flags", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var list struct {
+		Flags []flags.State `json:"flags"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, []flags.State{state}, list.Flags)
+
+	code, state = do("DELETE", "/admin/flags/browser_pool", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, flags.State{Name: flags.BrowserPool, Enabled: true, Source: flags.SourceEnvironment}, state)
+
+	code, _ = do("DELETE", "/admin/flags/browser_pool", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do("PUT", "/admin/flags/bogus", `{"enabled": true}`)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do("PUT", "/admin/flags/browser_pool", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
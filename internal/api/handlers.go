@@ -1,265 +1,406 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"prerender-url-shortener/internal/analytics"
+	"prerender-url-shortener/internal/botdetect"
 	"prerender-url-shortener/internal/config"
 	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/geoip"
+	"prerender-url-shortener/internal/janitor"
 	"prerender-url-shortener/internal/renderer"
+	"prerender-url-shortener/internal/reputation"
 	"prerender-url-shortener/internal/shortener"
-	"slices"
+	"prerender-url-shortener/internal/version"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 )
 
 // GenerateRequest is the structure for the /generate endpoint request body.
 type GenerateRequest struct {
 	URL string `json:"url" binding:"required,url"`
+	// Optional render settings for localized pages; the RENDER_* defaults apply when empty.
+	// They only take effect when the link is first created.
+	AcceptLanguage string `json:"accept_language,omitempty" binding:"omitempty,max=255"`
+	Locale         string `json:"locale,omitempty" binding:"omitempty,bcp47_language_tag"`
+	Timezone       string `json:"timezone,omitempty" binding:"omitempty,max=64"`
+	Profile        string `json:"profile,omitempty"` // Name of a RENDER_PROFILES entry
+	// Optional X-Robots-Tag for the short URL, e.g. "all" to let it be indexed despite a noindex ROBOTS_TAG
+	RobotsTag string `json:"robots_tag,omitempty" binding:"omitempty,max=255,printascii"`
+	// Optional Cache-Control for the short URL's redirects and snapshots, e.g. "no-store" for a link
+	// whose visitors must all be counted, overriding REDIRECT_CACHE_CONTROL and SNAPSHOT_CACHE_CONTROL
+	CacheControl string `json:"cache_control,omitempty" binding:"omitempty,max=255,printascii"`
+	// Optional static mode: every visitor is served the snapshot instead of being redirected
+	Static bool `json:"static,omitempty"`
+	// Optional custom short code, validated against the SHORT_CODE_ALIAS_* rules
+	Alias string `json:"alias,omitempty"`
+	// Optional seconds to wait for the render before answering, 0 to answer right away;
+	// capped at GENERATE_MAX_WAIT_SECONDS, which is also the wait when omitted
+	WaitSeconds *int `json:"wait_seconds,omitempty" binding:"omitempty,min=0"`
 }
 
 // GenerateResponse is the structure for the /generate endpoint response body.
 type GenerateResponse struct {
 	ShortCode   string `json:"short_code"`
 	OriginalURL string `json:"original_url"`
+	// Render state at response time. LastRenderError explains a failed render.
+	RenderStatus    db.RenderStatus `json:"render_status"`
+	RenderAttempts  int             `json:"render_attempts"`
+	LastRenderError string          `json:"last_render_error,omitempty"`
+}
+
+// newGenerateResponse builds the /generate response for a link.
+func newGenerateResponse(link *db.Link) GenerateResponse {
+	return GenerateResponse{
+		ShortCode:       shortener.SignCode(link.ShortCode),
+		OriginalURL:     link.OriginalURL,
+		RenderStatus:    link.RenderStatus,
+		RenderAttempts:  link.RenderAttempts,
+		LastRenderError: link.LastRenderError,
+	}
+}
+
+// requestError is the error answer of a step shared by handlers, which write
+// it in their own format.
+type requestError struct {
+	status int
+	body   gin.H
 }
 
 // GenerateShortCodeHandler handles the creation of new short URLs.
 // It immediately saves the short code to the database and queues rendering.
 func GenerateShortCodeHandler(c *gin.Context) {
+	cfg := config.Get()
 	var req GenerateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	if reqErr := checkGenerateRequest(c, cfg, &req); reqErr != nil {
+		c.JSON(reqErr.status, reqErr.body)
+		return
+	}
+	newLink, created, reqErr := allocateLink(c, cfg, &req, true)
+	if reqErr != nil {
+		c.JSON(reqErr.status, reqErr.body)
+		return
+	}
+	wait := renderWait(cfg, &req)
+	if !created {
+		respondWithExistingLink(c, newLink, wait)
+		return
+	}
+	generatedShortCode := newLink.ShortCode
 
-	// Check if the domain is allowed
-	if config.AppConfig.AllowedDomains != "" {
-		parsedURL, err := url.Parse(req.URL)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL format: " + err.Error()})
-			return
-		}
-		hostname := parsedURL.Hostname()
+	log.Printf("Saved link to database: %s -> %s (status: pending)", generatedShortCode, req.URL)
 
-		allowedDomainsList := strings.Split(config.AppConfig.AllowedDomains, ",")
-		foundMatch := slices.IndexFunc(allowedDomainsList, func(allowedDomain string) bool {
-			return strings.TrimSpace(allowedDomain) == hostname
-		}) != -1
+	// Queue for rendering
+	renderer.GlobalRenderQueue.QueueRender(generatedShortCode, req.URL)
+	if wait == 0 {
+		c.JSON(http.StatusCreated, newGenerateResponse(newLink))
+		return
+	}
 
-		if !foundMatch {
-			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Domain '%s' is not allowed for shortening.", hostname)})
-			return
+	// Wait for rendering to complete before returning to client
+	log.Printf("Waiting up to %v for rendering to complete for %s before returning to client", wait, generatedShortCode)
+	if renderer.GlobalRenderQueue.WaitForRender(generatedShortCode, wait) {
+		// Fetch updated link after rendering
+		updatedLink, fetchErr := db.GetLinkByShortCode(generatedShortCode)
+		if fetchErr == nil {
+			if updatedLink.RenderStatus == db.RenderStatusCompleted {
+				log.Printf("Rendering completed successfully for %s, returning ready short code to client", generatedShortCode)
+				c.JSON(http.StatusCreated, newGenerateResponse(updatedLink))
+				return
+			} else if updatedLink.RenderStatus == db.RenderStatusFailed {
+				log.Printf("Rendering failed for %s, but returning short code anyway", generatedShortCode)
+				c.JSON(http.StatusCreated, newGenerateResponse(updatedLink))
+				return
+			}
+		} else {
+			log.Printf("Error fetching updated link after render wait for %s: %v", generatedShortCode, fetchErr)
 		}
+	} else {
+		log.Printf("Timeout waiting for render completion of %s, returning short code anyway", generatedShortCode)
 	}
 
-	// Check if URL already exists in database
-	existingLink, err := db.GetLinkByOriginalURL(req.URL)
-	if err == nil {
-		// URL already exists
-		log.Printf("URL %s already exists with short code %s (status: %s)", req.URL, existingLink.ShortCode, existingLink.RenderStatus)
-
-		// If it's already completed or failed, return immediately
-		if existingLink.RenderStatus == db.RenderStatusCompleted || existingLink.RenderStatus == db.RenderStatusFailed {
-			c.JSON(http.StatusOK, GenerateResponse{
-				ShortCode:   existingLink.ShortCode,
-				OriginalURL: existingLink.OriginalURL,
-			})
-			return
+	// Fallback: return the short code even if rendering didn't complete
+	// (This handles timeout cases or other issues)
+	c.JSON(http.StatusCreated, newGenerateResponse(newLink))
+}
+
+// renderWait is how long /generate waits for the render of the request's URL:
+// wait_seconds capped at GENERATE_MAX_WAIT_SECONDS, or the cap when omitted.
+func renderWait(cfg *config.Config, req *GenerateRequest) time.Duration {
+	limit := maxRenderWaitSeconds(cfg)
+	seconds := limit
+	if req.WaitSeconds != nil {
+		seconds = min(*req.WaitSeconds, limit)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// maxRenderWaitSeconds is the longest a request may wait for a render,
+// GENERATE_MAX_WAIT_SECONDS or else RENDER_TIMEOUT_SECONDS.
+func maxRenderWaitSeconds(cfg *config.Config) int {
+	if seconds := cfg.GenerateMaxWaitSeconds; seconds > 0 {
+		return seconds
+	}
+	return cfg.RenderTimeoutSeconds
+}
+
+// checkGenerateRequest validates and normalizes the URL and options of a
+// request for a short link, and screens the URL.
+func checkGenerateRequest(c *gin.Context, cfg *config.Config, req *GenerateRequest) *requestError {
+	var urlErr *shortener.URLError
+	if err := shortener.ValidateURL(req.URL, cfg.URLMaxLength); errors.As(err, &urlErr) {
+		status := http.StatusBadRequest
+		if urlErr.Code == shortener.URLSchemeNotAllowed {
+			// The URL is well-formed, we just won't shorten it
+			status = http.StatusUnprocessableEntity
 		}
+		return &requestError{status, gin.H{"error": "Invalid URL: " + urlErr.Reason, "code": urlErr.Code}}
+	}
 
-		// If it's pending or rendering, check if we should wait or queue a new render
-		if existingLink.RenderStatus == db.RenderStatusPending || existingLink.RenderStatus == db.RenderStatusRendering {
-			// Check if it's currently being rendered in our queue
-			if renderer.GlobalRenderQueue.IsInProgress(req.URL) {
-				log.Printf("URL %s is already being rendered, waiting for completion", req.URL)
-				// Wait for up to the configured timeout for rendering to complete
-				timeoutDuration := time.Duration(config.AppConfig.RenderTimeoutSeconds) * time.Second
-				if renderer.GlobalRenderQueue.WaitForRender(req.URL, timeoutDuration) {
-					// Fetch updated link after rendering
-					updatedLink, fetchErr := db.GetLinkByShortCode(existingLink.ShortCode)
-					if fetchErr == nil {
-						log.Printf("Existing URL rendering completed, returning ready short code to client")
-						c.JSON(http.StatusOK, GenerateResponse{
-							ShortCode:   updatedLink.ShortCode,
-							OriginalURL: updatedLink.OriginalURL,
-						})
-						return
-					}
-				}
-				// If waiting failed or timeout, just return the existing short code
-				log.Printf("Timeout waiting for render of %s, returning existing short code anyway", req.URL)
-			} else {
-				// Not currently in queue, re-queue for rendering and wait
-				log.Printf("URL %s exists but not in render queue, re-queuing and waiting", req.URL)
-				renderer.GlobalRenderQueue.QueueRender(existingLink.ShortCode, req.URL)
-
-				// Wait for the re-queued rendering to complete
-				timeoutDuration := time.Duration(config.AppConfig.RenderTimeoutSeconds) * time.Second
-				if renderer.GlobalRenderQueue.WaitForRender(req.URL, timeoutDuration) {
-					// Fetch updated link after rendering
-					updatedLink, fetchErr := db.GetLinkByShortCode(existingLink.ShortCode)
-					if fetchErr == nil {
-						log.Printf("Re-queued URL rendering completed, returning ready short code to client")
-						c.JSON(http.StatusOK, GenerateResponse{
-							ShortCode:   updatedLink.ShortCode,
-							OriginalURL: updatedLink.OriginalURL,
-						})
-						return
-					}
-				}
-				log.Printf("Timeout waiting for re-queued render of %s, returning existing short code anyway", req.URL)
-			}
+	normalizedURL, err := shortener.NormalizeURL(req.URL)
+	if err != nil {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "Invalid URL: " + err.Error()}}
+	}
+	req.URL = normalizedURL
 
-			c.JSON(http.StatusOK, GenerateResponse{
-				ShortCode:   existingLink.ShortCode,
-				OriginalURL: existingLink.OriginalURL,
-			})
-			return
+	if req.Alias != "" {
+		var aliasErr *shortener.AliasError
+		if req.Alias, err = shortener.ValidateAlias(req.Alias); errors.As(err, &aliasErr) {
+			return &requestError{http.StatusUnprocessableEntity, gin.H{"error": "Invalid alias: " + aliasErr.Reason}}
 		}
-	} else if !gorm.IsRecordNotFoundError(err) {
-		// Some other database error
-		log.Printf("Error checking existing URL %s: %v", req.URL, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error while checking existing URL"})
-		return
 	}
 
-	// Generate new short code
-	var generatedShortCode string
+	if req.Profile != "" {
+		if _, ok := renderer.LookupRenderProfile(req.Profile); !ok {
+			return &requestError{http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown render profile '%s'", req.Profile)}}
+		}
+	}
 
-	// Retry mechanism for short code generation in case of collision
-	for i := range [5]struct{}{} { // Max 5 retries
-		var genErr error
-		generatedShortCode, genErr = shortener.GenerateShortCode()
-		if genErr != nil {
-			log.Printf("Error generating short code: %v", genErr)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate short code"})
-			return
+	// Check if the domain is blocked or not allowed
+	if cfg.AllowedDomains != "" || cfg.BlockedDomains != "" {
+		parsedURL, err := url.Parse(req.URL)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Invalid URL format: " + err.Error()}}
 		}
+		hostname := parsedURL.Hostname()
 
-		// Check if short code already exists
-		_, dbErr := db.GetLinkByShortCode(generatedShortCode)
-		if dbErr != nil {
-			if gorm.IsRecordNotFoundError(dbErr) {
-				// Code is unique, break loop
-				break
-			}
-			// Other DB error
-			log.Printf("Error checking existing short code %s: %v", generatedShortCode, dbErr)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error while checking short code"})
-			return
+		if shortener.MatchDomain(hostname, cfg.BlockedDomains) {
+			log.Printf("Rejected blocked domain %s", hostname)
+			return &requestError{http.StatusForbidden, gin.H{"error": fmt.Sprintf("Domain '%s' is blocked from shortening.", hostname)}}
 		}
-		// Collision, try again
-		log.Printf("Short code collision for %s, retrying...", generatedShortCode)
-		if i == 4 { // Check against the last index of a 5-iteration loop (0-4)
-			log.Printf("Max retries reached for short code generation for URL: %s", req.URL)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate a unique short code after multiple attempts"})
-			return
+		if cfg.AllowedDomains != "" && !shortener.MatchDomain(hostname, cfg.AllowedDomains) {
+			return &requestError{http.StatusForbidden, gin.H{"error": fmt.Sprintf("Domain '%s' is not allowed for shortening.", hostname)}}
+		}
+	}
+
+	// Keep the renderer from fetching internal services on a client's behalf
+	if cfg.SSRFProtection {
+		var targetErr *shortener.TargetError
+		if err := shortener.CheckTarget(c.Request.Context(), req.URL, cfg.SSRFAllowedNetworks); errors.As(err, &targetErr) {
+			log.Printf("Rejected unsafe target %s: %s", req.URL, targetErr.Reason)
+			return &requestError{http.StatusForbidden, gin.H{"error": "URL is not allowed: " + targetErr.Reason}}
+		} else if err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Unable to resolve URL host: " + err.Error()}}
 		}
 	}
 
-	log.Printf("Generated unique short code %s for URL: %s", generatedShortCode, req.URL)
+	// Screen for malware and phishing; an unavailable checker doesn't block shortening
+	if threats, err := reputation.Check(c.Request.Context(), req.URL); err != nil {
+		log.Printf("URL screening of %s failed, allowing it: %v", req.URL, err)
+	} else if threat := threats[req.URL]; threat != "" {
+		log.Printf("Rejected %s flagged as %s", req.URL, threat)
+		return &requestError{http.StatusForbidden, gin.H{"error": fmt.Sprintf("URL is flagged as %s", threat)}}
+	}
+	return nil
+}
 
-	// Immediately save to database with pending status
+// allocateLink returns the tenant's link for the request's URL, creating it
+// under a new short code, or the alias, if there is none. created tells
+// whether the link is new. A new link whose render is to be queued right away
+// is refused while the render queue is full, see checkRenderQueue.
+func allocateLink(c *gin.Context, cfg *config.Config, req *GenerateRequest, queued bool) (link *db.Link, created bool, reqErr *requestError) {
+	// Check if URL already exists in database for this tenant
+	existingLink, err := db.GetLinkByOriginalURL(tenantID(c), req.URL)
+	if err == nil {
+		return existingLink, false, nil
+	} else if !errors.Is(err, db.ErrNotFound) {
+		// Some other database error
+		log.Printf("Error checking existing URL %s: %v", req.URL, err)
+		return nil, false, &requestError{http.StatusInternalServerError, gin.H{"error": "Database error while checking existing URL"}}
+	}
+	if queued {
+		if reqErr := checkRenderQueue(c, cfg, req.URL); reqErr != nil {
+			return nil, false, reqErr
+		}
+	}
+
+	// Immediately save to database with pending status, under a freshly generated short code
 	newLink := db.Link{
-		ShortCode:           generatedShortCode,
+		TenantID:            tenantID(c),
 		OriginalURL:         req.URL,
 		RenderedHTMLContent: "", // Empty initially
 		RenderStatus:        db.RenderStatusPending,
+		AcceptLanguage:      req.AcceptLanguage,
+		Locale:              req.Locale,
+		Timezone:            req.Timezone,
+		RenderProfile:       req.Profile,
+		RobotsTag:           req.RobotsTag,
+		CacheControl:        req.CacheControl,
+		StaticMode:          req.Static,
 	}
 
-	if err := db.CreateLink(&newLink); err != nil {
-		log.Printf("Error creating link in database for short code %s, URL %s: %v", generatedShortCode, req.URL, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save link to database"})
-		return
+	generated := 0
+	generator := shortener.CodeGenerator(db.URLKey(newLink.TenantID, newLink.OriginalURL), db.NextShortCodeID)
+	generate := func() (string, error) {
+		generated++
+		return generator()
+	}
+	attempts := shortener.MaxAttempts()
+	if req.Alias != "" {
+		generate = func() (string, error) { return req.Alias, nil }
+		attempts = 1
+	}
+	storedLink, created, err := db.AllocateLink(&newLink, generate, attempts)
+	if generated > 0 && err == nil {
+		shortener.RecordAllocation(generated-1, false)
+	} else if generated > 0 && errors.Is(err, db.ErrShortCodesExhausted) {
+		shortener.RecordAllocation(generated, true)
+	}
+	if errors.Is(err, db.ErrShortCodesExhausted) && req.Alias != "" {
+		return nil, false, &requestError{http.StatusConflict, gin.H{"error": fmt.Sprintf("Alias '%s' is already taken", req.Alias)}}
 	}
+	if errors.Is(err, db.ErrShortCodesExhausted) {
+		log.Printf("Max retries reached for short code generation for URL: %s", req.URL)
+		return nil, false, &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to generate a unique short code after multiple attempts"}}
+	}
+	if err != nil {
+		log.Printf("Error creating link in database for URL %s: %v", req.URL, err)
+		return nil, false, &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to save link to database"}}
+	}
+	if !created {
+		// Another request created a link for this URL since our lookup above
+		log.Printf("URL %s was shortened concurrently as %s", req.URL, storedLink.ShortCode)
+		return storedLink, false, nil
+	}
+	return &newLink, true, nil
+}
 
-	log.Printf("Saved link to database: %s -> %s (status: pending)", generatedShortCode, req.URL)
+// checkRenderQueue refuses a new link while the render queue is full, unless
+// RENDER_QUEUE_FULL_POLICY is defer and its render may wait in the database for
+// an idle worker. The answer is RENDER_QUEUE_FULL_STATUS, 503 or 429, with a
+// Retry-After header of RENDER_QUEUE_FULL_RETRY_AFTER_SECONDS.
+func checkRenderQueue(c *gin.Context, cfg *config.Config, originalURL string) *requestError {
+	if cfg.RenderQueueFullPolicy == "defer" || !renderer.GlobalRenderQueue.Saturated() {
+		return nil
+	}
+	status := http.StatusServiceUnavailable
+	if cfg.RenderQueueFullStatus == http.StatusTooManyRequests {
+		status = http.StatusTooManyRequests
+	}
+	if seconds := cfg.RenderQueueFullRetryAfterSeconds; seconds > 0 {
+		c.Header("Retry-After", strconv.Itoa(seconds))
+	}
+	log.Printf("Render queue is full, refusing to shorten %s", originalURL)
+	return &requestError{status, gin.H{"error": "The render queue is full, try again later"}}
+}
 
-	// Queue for rendering
-	renderer.GlobalRenderQueue.QueueRender(generatedShortCode, req.URL)
+// respondWithExistingLink answers /generate for a URL that already has a link,
+// re-queuing its render if it hasn't finished yet and waiting up to wait for it.
+func respondWithExistingLink(c *gin.Context, existingLink *db.Link, wait time.Duration) {
+	// URL already exists
+	log.Printf("URL %s already exists with short code %s (status: %s)", existingLink.OriginalURL, existingLink.ShortCode, existingLink.RenderStatus)
 
-	// Wait for rendering to complete before returning to client
-	log.Printf("Waiting for rendering to complete for %s before returning to client", generatedShortCode)
+	// If it's already completed or failed, return immediately
+	if existingLink.RenderStatus == db.RenderStatusCompleted || existingLink.RenderStatus == db.RenderStatusFailed {
+		c.JSON(http.StatusOK, newGenerateResponse(existingLink))
+		return
+	}
 
-	// Wait for up to the configured timeout for rendering to complete
-	timeoutDuration := time.Duration(config.AppConfig.RenderTimeoutSeconds) * time.Second
-	if renderer.GlobalRenderQueue.WaitForRender(req.URL, timeoutDuration) {
-		// Fetch updated link after rendering
-		updatedLink, fetchErr := db.GetLinkByShortCode(generatedShortCode)
-		if fetchErr == nil {
-			if updatedLink.RenderStatus == db.RenderStatusCompleted {
-				log.Printf("Rendering completed successfully for %s, returning ready short code to client", generatedShortCode)
-				c.JSON(http.StatusCreated, GenerateResponse{
-					ShortCode:   updatedLink.ShortCode,
-					OriginalURL: updatedLink.OriginalURL,
-				})
-				return
-			} else if updatedLink.RenderStatus == db.RenderStatusFailed {
-				log.Printf("Rendering failed for %s, but returning short code anyway", generatedShortCode)
-				c.JSON(http.StatusCreated, GenerateResponse{
-					ShortCode:   updatedLink.ShortCode,
-					OriginalURL: updatedLink.OriginalURL,
-				})
-				return
+	// If it's pending or rendering, check if we should wait or queue a new render
+	if existingLink.RenderStatus == db.RenderStatusPending || existingLink.RenderStatus == db.RenderStatusRendering {
+		// Check if it's currently being rendered in our queue
+		if renderer.GlobalRenderQueue.IsInProgress(existingLink.ShortCode) {
+			log.Printf("URL %s is already being rendered, waiting for completion", existingLink.OriginalURL)
+			if wait > 0 && renderer.GlobalRenderQueue.WaitForRender(existingLink.ShortCode, wait) {
+				// Fetch updated link after rendering
+				updatedLink, fetchErr := db.GetLinkByShortCode(existingLink.ShortCode)
+				if fetchErr == nil {
+					log.Printf("Existing URL rendering completed, returning ready short code to client")
+					c.JSON(http.StatusOK, newGenerateResponse(updatedLink))
+					return
+				}
 			}
+			// If waiting failed or timeout, just return the existing short code
+			log.Printf("Timeout waiting for render of %s, returning existing short code anyway", existingLink.OriginalURL)
 		} else {
-			log.Printf("Error fetching updated link after render wait for %s: %v", generatedShortCode, fetchErr)
+			// Not currently in queue, re-queue for rendering and wait
+			log.Printf("URL %s exists but not in render queue, re-queuing and waiting", existingLink.OriginalURL)
+			renderer.GlobalRenderQueue.QueueRender(existingLink.ShortCode, existingLink.OriginalURL)
+
+			// Wait for the re-queued rendering to complete
+			if wait > 0 && renderer.GlobalRenderQueue.WaitForRender(existingLink.ShortCode, wait) {
+				// Fetch updated link after rendering
+				updatedLink, fetchErr := db.GetLinkByShortCode(existingLink.ShortCode)
+				if fetchErr == nil {
+					log.Printf("Re-queued URL rendering completed, returning ready short code to client")
+					c.JSON(http.StatusOK, newGenerateResponse(updatedLink))
+					return
+				}
+			}
+			log.Printf("Timeout waiting for re-queued render of %s, returning existing short code anyway", existingLink.OriginalURL)
 		}
-	} else {
-		log.Printf("Timeout waiting for render completion of %s, returning short code anyway", generatedShortCode)
+
+		c.JSON(http.StatusOK, newGenerateResponse(existingLink))
+		return
 	}
 
-	// Fallback: return the short code even if rendering didn't complete
-	// (This handles timeout cases or other issues)
-	c.JSON(http.StatusCreated, GenerateResponse{
-		ShortCode:   newLink.ShortCode,
-		OriginalURL: newLink.OriginalURL,
-	})
+	c.JSON(http.StatusOK, newGenerateResponse(existingLink))
 }
 
 // RedirectHandler handles requests for short URLs.
 // It checks the User-Agent to either redirect to the original URL
 // or serve the pre-rendered HTML.
 func RedirectHandler(c *gin.Context) {
-	shortCode := c.Param("shortCode")
-	if shortCode == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Short code parameter is missing"})
+	cfg := config.Get()
+	link, ok := servedLink(c, c.Param("shortCode"))
+	if !ok {
 		return
 	}
+	shortCode := link.ShortCode
 
-	link, err := db.GetLinkByShortCode(shortCode)
-	if err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
-		} else {
-			log.Printf("Error retrieving link for short code %s: %v", shortCode, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		}
+	userAgent := c.GetHeader("User-Agent")
+	isBot := isBotRequest(c, cfg)
+	// ?_prerender=1 shows anyone the snapshot, but the click still counts as
+	// whatever the client is
+	serveSnapshot := isBot || prerenderForced(c)
+	// Links in static mode show people the snapshot too, rewritten to load its
+	// assets from the original site
+	staticPage := link.StaticMode && !serveSnapshot
+
+	if link.DisabledAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Short code has been disabled"})
 		return
 	}
 
-	userAgent := c.GetHeader("User-Agent")
-	// Basic check for common bot/crawler user agents. This list can be expanded.
-	// Consider using a library for more robust UA parsing and bot detection.
-	isBot := strings.Contains(strings.ToLower(userAgent), "bot") ||
-		strings.Contains(strings.ToLower(userAgent), "crawler") ||
-		strings.Contains(strings.ToLower(userAgent), "spider") ||
-		strings.Contains(strings.ToLower(userAgent), "googlebot") || // More specific
-		strings.Contains(strings.ToLower(userAgent), "bingbot") ||
-		strings.Contains(strings.ToLower(userAgent), "slurp") || // Yahoo
-		strings.Contains(strings.ToLower(userAgent), "duckduckbot") ||
-		strings.Contains(strings.ToLower(userAgent), "baiduspider") ||
-		strings.Contains(strings.ToLower(userAgent), "yandexbot") ||
-		strings.Contains(strings.ToLower(userAgent), "facebook") || // Facebook (covers facebot and facebookexternalhit)
-		strings.Contains(strings.ToLower(userAgent), "twitterbot") ||
-		strings.Contains(strings.ToLower(userAgent), "linkedinbot")
+	if robotsTag := robotsTagFor(cfg, link); robotsTag != "" {
+		c.Header("X-Robots-Tag", robotsTag)
+	}
 
-	if isBot {
+	recordClick(c, cfg, link, isBot)
+
+	if serveSnapshot || staticPage {
 		log.Printf("Bot request (UA: %s) for short code: %s (render status: %s)", userAgent, shortCode, link.RenderStatus)
 
 		// Check render status
@@ -267,10 +408,10 @@ func RedirectHandler(c *gin.Context) {
 		case db.RenderStatusCompleted:
 			if link.RenderedHTMLContent == "" {
 				log.Printf("Warning: Bot request for %s but no rendered HTML content despite completed status. Redirecting instead.", shortCode)
-				c.Redirect(http.StatusFound, link.OriginalURL)
+				redirectToTarget(c, cfg, link)
 				return
 			}
-			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(link.RenderedHTMLContent))
+			serveRenderedHTML(c, cfg, link, staticPage)
 
 		case db.RenderStatusPending, db.RenderStatusRendering:
 			// For bots, we can either wait a bit or redirect immediately
@@ -278,46 +419,278 @@ func RedirectHandler(c *gin.Context) {
 			log.Printf("Bot request for %s but rendering not complete (status: %s), waiting briefly", shortCode, link.RenderStatus)
 
 			// Wait for up to 5 seconds for rendering to complete
-			if renderer.GlobalRenderQueue.WaitForRender(link.OriginalURL, 5*time.Second) {
+			if renderer.GlobalRenderQueue.WaitForRender(shortCode, 5*time.Second) {
 				// Fetch updated link after rendering
 				updatedLink, fetchErr := db.GetLinkByShortCode(shortCode)
 				if fetchErr == nil && updatedLink.RenderStatus == db.RenderStatusCompleted && updatedLink.RenderedHTMLContent != "" {
 					log.Printf("Bot request: rendering completed during wait, serving HTML for %s", shortCode)
-					c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(updatedLink.RenderedHTMLContent))
+					serveRenderedHTML(c, cfg, updatedLink, staticPage)
 					return
 				}
 			}
 
 			// If waiting failed or rendering not complete, redirect instead
 			log.Printf("Bot request: rendering not ready for %s, redirecting instead", shortCode)
-			c.Redirect(http.StatusFound, link.OriginalURL)
+			redirectToTarget(c, cfg, link)
 
 		case db.RenderStatusFailed:
 			log.Printf("Bot request for %s but rendering failed, redirecting instead", shortCode)
-			c.Redirect(http.StatusFound, link.OriginalURL)
+			redirectToTarget(c, cfg, link)
 
 		default:
 			log.Printf("Bot request for %s with unknown render status %s, redirecting instead", shortCode, link.RenderStatus)
-			c.Redirect(http.StatusFound, link.OriginalURL)
+			redirectToTarget(c, cfg, link)
 		}
 	} else {
-		log.Printf("Redirecting user (UA: %s) for short code: %s to %s", userAgent, shortCode, link.OriginalURL)
-		c.Redirect(http.StatusFound, link.OriginalURL)
+		log.Printf("Redirecting user (UA: %s) for short code: %s to %s", userAgent, shortCode, redirectTarget(cfg, link))
+		redirectToTarget(c, cfg, link)
 	}
 }
 
+// servedLink looks up the link of a short code as served, signed or not,
+// answering the request itself if there is none on this host.
+func servedLink(c *gin.Context, served string) (*db.Link, bool) {
+	if served == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Short code parameter is missing"})
+		return nil, false
+	}
+	// Signed codes that fail verification look like unknown ones, so guessing
+	// codes reveals nothing
+	shortCode, ok := shortener.VerifyCode(served)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+		return nil, false
+	}
+
+	link, err := db.GetLinkByShortCode(shortCode)
+	if err == nil && !servesLink(c, link) {
+		err = db.ErrNotFound // Another tenant's link
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			if deleted, delErr := db.GetLinkByShortCodeIncludingDeleted(shortCode); delErr == nil && deleted.DeletedAt.Valid && servesLink(c, deleted) {
+				c.JSON(http.StatusGone, gin.H{"error": "Short code has been deleted"})
+				return nil, false
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+		} else {
+			log.Printf("Error retrieving link for short code %s: %v", shortCode, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+	return link, true
+}
+
+// recordClick queues a click event for the request, and forwards it to GA4 if
+// configured. It never blocks; events are written in batches by the click
+// writer.
+func recordClick(c *gin.Context, cfg *config.Config, link *db.Link, isBot bool) {
+	forwardGA4 := analytics.GlobalGA4Forwarder != nil && (!isBot || cfg.GA4ForwardBots)
+	if analytics.GlobalClickWriter == nil && !forwardGA4 {
+		return
+	}
+	event := db.ClickEvent{
+		ShortCode: link.ShortCode,
+		ClickedAt: time.Now().UTC(),
+		UAClass:   db.UAClassBrowser,
+		Referrer:  c.GetHeader("Referer"),
+		IPHash:    analytics.HashIP(c.ClientIP(), cfg.ClickIPHashSalt),
+		Country:   geoip.Country(c.ClientIP()),
+	}
+	userAgent := c.GetHeader("User-Agent")
+	if isBot {
+		event.UAClass, event.BotName = db.UAClassBot, botdetect.Name(userAgent)
+	} else {
+		hints := botdetect.ParseClientHints(c.Request.Header)
+		event.Browser, event.Platform = botdetect.BrowserInfo(userAgent, hints)
+		event.DeviceClass = botdetect.DeviceClass(userAgent, hints)
+	}
+	if analytics.GlobalClickWriter != nil {
+		analytics.GlobalClickWriter.Record(event)
+		analytics.GlobalClickStream.Publish(event)
+	}
+	if forwardGA4 {
+		analytics.GlobalGA4Forwarder.Forward(event, redirectTarget(cfg, link))
+	}
+}
+
+// redirectTarget returns the URL a short code redirects to. When REDIRECT_TO_FINAL_URL
+// is enabled and the original URL was seen redirecting during render, the final
+// destination is used so visitors skip the intermediate hops. OriginalURL itself is
+// left untouched because it is the key used to deduplicate /generate requests.
+func redirectTarget(cfg *config.Config, link *db.Link) string {
+	if cfg.RedirectToFinalURL && link.FinalURL != "" && link.RedirectChain != "" {
+		return link.FinalURL
+	}
+	return link.OriginalURL
+}
+
+// redirectToTarget redirects a request for a short URL to redirectTarget, with
+// the redirect Cache-Control.
+func redirectToTarget(c *gin.Context, cfg *config.Config, link *db.Link) {
+	setCacheControl(c, link, cfg.RedirectCacheControl)
+	c.Redirect(http.StatusFound, redirectTarget(cfg, link))
+}
+
+// setCacheControl sends the link's own Cache-Control, or policy when it has
+// none. "none" sends no header at all.
+func setCacheControl(c *gin.Context, link *db.Link, policy string) {
+	if link.CacheControl != "" {
+		policy = link.CacheControl
+	}
+	if policy != "" && !strings.EqualFold(policy, "none") {
+		c.Header("Cache-Control", policy)
+	}
+}
+
+// isBotRequest reports whether a request comes from a crawler or link preview
+// fetcher, which is served the snapshot instead of being redirected. The user
+// agent is judged along with its client hints. When the BOT_OVERRIDE_HEADER is
+// sent as 1 or 0, it decides instead, e.g. to check what crawlers see.
+// Responses vary on all of these headers. Requests with an _escaped_fragment_
+// parameter, from crawlers following Google's retired AJAX crawling scheme,
+// are bots whatever their user agent.
+func isBotRequest(c *gin.Context, cfg *config.Config) bool {
+	c.Writer.Header().Add("Vary", "User-Agent")
+	c.Writer.Header().Add("Vary", "Sec-CH-UA")
+	if header := cfg.BotOverrideHeader; header != "" {
+		c.Writer.Header().Add("Vary", header)
+		switch strings.ToLower(c.GetHeader(header)) {
+		case "1", "true":
+			return true
+		case "0", "false":
+			return false
+		}
+	}
+	if _, ok := c.GetQuery("_escaped_fragment_"); ok {
+		return true
+	}
+	return botdetect.IsBotWithHints(c.GetHeader("User-Agent"), botdetect.ParseClientHints(c.Request.Header))
+}
+
+// prerenderForced reports whether the request asks for the snapshot whatever its
+// user agent, with ?_prerender=1. QA and meta tag debuggers that don't send a
+// bot user agent use it to see what crawlers get.
+func prerenderForced(c *gin.Context) bool {
+	switch strings.ToLower(c.Query("_prerender")) {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// robotsTagFor returns the X-Robots-Tag served for a link: its own, or ROBOTS_TAG.
+func robotsTagFor(cfg *config.Config, link *db.Link) string {
+	if link.RobotsTag != "" {
+		return link.RobotsTag
+	}
+	return cfg.RobotsTag
+}
+
+// serveRenderedHTML writes a link's prerendered HTML to a bot, using the HTTP
+// status the target page returned (or declared via prerender-status-code) so
+// crawlers see soft 404s and errors the same way they would on the original site.
+// It is sent with Cache-Control and Last-Modified, and conditional requests may get a 304 instead.
+// Static pages for people are rewritten with staticSnapshot first.
+func serveRenderedHTML(c *gin.Context, cfg *config.Config, link *db.Link, static bool) {
+	setCacheControl(c, link, cfg.SnapshotCacheControl)
+	status := snapshotStatusCode(link)
+	if notModified(c, link, status) {
+		return
+	}
+	body := link.RenderedHTMLContent
+	if static {
+		body = staticSnapshot(body, snapshotURL(link))
+	}
+	c.Data(status, "text/html; charset=utf-8", []byte(body))
+}
+
+// notModified sets Last-Modified to when a link's snapshot was rendered, and
+// answers 304 when the request's If-Modified-Since shows the client already
+// has it. Crawlers revisit with conditional requests, and a 304 spares them
+// and us the snapshot. Only snapshots served as 200 are conditional.
+func notModified(c *gin.Context, link *db.Link, status int) bool {
+	if link.RenderedAt == nil {
+		return false
+	}
+	renderedAt := link.RenderedAt.UTC().Truncate(time.Second)
+	c.Header("Last-Modified", renderedAt.Format(http.TimeFormat))
+	if status != http.StatusOK {
+		return false
+	}
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	if err != nil || renderedAt.After(since) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// snapshotStatusCode maps the stored target status to the status served with a snapshot.
+// Unknown, informational, and redirect codes are served as 200 since the snapshot
+// already reflects the page the browser ended up on.
+func snapshotStatusCode(link *db.Link) int {
+	code := link.TargetStatusCode
+	if code < http.StatusOK || code > 599 || (code >= 300 && code < 400) {
+		return http.StatusOK
+	}
+	return code
+}
+
 // HealthCheckHandler provides a simple health check endpoint.
 func HealthCheckHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "UP"})
 }
 
+// VersionHandler reports the running build, to tell which one is answering.
+func VersionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
+
+// draining is set once the server is shutting down, see StartDraining.
+var draining atomic.Bool
+
+// StartDraining makes ReadinessHandler fail so load balancers stop sending new
+// traffic, while the server keeps answering the requests still reaching it.
+func StartDraining() {
+	draining.Store(true)
+}
+
+// ReadinessHandler reports whether the replica should receive traffic. Unlike
+// the health check it fails while the server drains before shutting down.
+func ReadinessHandler(c *gin.Context) {
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "DRAINING"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "READY"})
+}
+
 // StatusHandler provides detailed system status including render queue information.
 func StatusHandler(c *gin.Context) {
 	queueStatus := renderer.GlobalRenderQueue.GetStatus()
 
 	status := gin.H{
-		"status":       "UP",
-		"render_queue": queueStatus,
+		"status":         "UP",
+		"mode":           config.Get().ServerMode,
+		"build":          version.Get(),
+		"render_queue":   queueStatus,
+		"browser_pool":   renderer.GetBrowserPoolStatus(),
+		"janitor":        janitor.GetStatus(),
+		"scan_detection": scanStatus(),
+		"geoip":          geoip.GetStatus(),
+		"short_codes":    shortener.GetCollisionStats(),
+	}
+
+	if analytics.GlobalGA4Forwarder != nil {
+		status["ga4"] = analytics.GlobalGA4Forwarder.GetStatus()
+	}
+
+	if schema, err := db.GetSchemaStatus(); err != nil {
+		status["schema"] = gin.H{"error": err.Error()}
+	} else {
+		status["schema"] = schema
 	}
 
 	c.JSON(http.StatusOK, status)
@@ -2,20 +2,30 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	"prerender-url-shortener/internal/analytics"
 	"prerender-url-shortener/internal/config"
 	"prerender-url-shortener/internal/db"
 	"prerender-url-shortener/internal/renderer"
+	"prerender-url-shortener/internal/reputation"
+	"prerender-url-shortener/internal/shortener"
+	"prerender-url-shortener/internal/tenant"
+	"prerender-url-shortener/internal/version"
+	"prerender-url-shortener/internal/webhook"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func setupTestAPI(t *testing.T) *gin.Engine {
@@ -24,40 +34,98 @@ func setupTestAPI(t *testing.T) *gin.Engine {
 
 	// Setup test database
 	var err error
-	db.DB, err = gorm.Open("sqlite3", ":memory:")
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
-	err = db.DB.AutoMigrate(&db.Link{}).Error
+	// Each connection to :memory: opens a new, empty database
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	err = db.Migrate()
 	require.NoError(t, err)
 
 	// Setup test config
-	config.AppConfig = &config.Config{
+	config.Set(&config.Config{
 		ServerPort:           ":8080",
 		DatabaseURL:          "sqlite3://:memory:",
 		AllowedDomains:       "",
 		RenderWorkerCount:    1,
 		RenderTimeoutSeconds: 30,
-	}
+		// Long enough for teardownTestAPI to join a worker still rendering
+		RenderShutdownTimeoutSeconds: 35,
+	})
 
 	// Initialize render queue for testing
 	renderer.InitRenderQueue(1)
 
 	// Setup router
 	router := gin.New()
-	router.POST("/generate", GenerateShortCodeHandler)
-	router.GET("/:shortCode", RedirectHandler)
+	router.POST("/generate", managementAllowlist(), rateLimit("generate"), tenantAuth(), GenerateShortCodeHandler)
+	router.GET("/quick", managementAllowlist(), rateLimit("generate"), quickAuth(), QuickLinkHandler)
+	router.GET("/quick/done", QuickDoneHandler)
+	router.GET("/:shortCode", scanGuard(), RedirectHandler)
+	router.GET("/og/:shortCode", scanGuard(), OpenGraphHandler)
+	router.GET("/robots.txt", RobotsTxtHandler)
+	router.GET("/sitemap.xml", SitemapHandler)
+	router.GET("/.well-known/*path", WellKnownHandler)
+	router.GET("/links/search", managementAllowlist(), adminAuth(), SearchLinksHandler)
+	router.GET("/links/:shortCode/stats", managementAllowlist(), adminAuth(), LinkStatsHandler)
+	router.GET("/links/:shortCode/stats/export", managementAllowlist(), adminAuth(), LinkStatsExportHandler)
+	router.GET("/links/:shortCode/wait", managementAllowlist(), rateLimit("generate"), LinkWaitHandler)
+	router.POST("/admin/login", managementAllowlist(), rateLimit("login"), AdminLoginHandler)
+	router.POST("/admin/logout", managementAllowlist(), AdminLogoutHandler)
 	router.GET("/health", HealthCheckHandler)
-	router.GET("/status", StatusHandler)
+	router.GET("/ready", ReadinessHandler)
+	router.GET("/status", managementAllowlist(), StatusHandler)
+	router.GET("/version", managementAllowlist(), VersionHandler)
+	admin := router.Group("/admin", managementAllowlist(), adminAuth())
+	admin.GET("/links/:shortCode", GetLinkHandler)
+	admin.DELETE("/links/:shortCode", DeleteLinkHandler)
+	admin.POST("/links/:shortCode/restore", RestoreLinkHandler)
+	admin.POST("/links/:shortCode/disable", DisableLinkHandler)
+	admin.POST("/links/:shortCode/enable", EnableLinkHandler)
+	admin.POST("/links/:shortCode/rerender", RerenderLinkHandler)
+	admin.POST("/prewarm", PrewarmHandler)
+	admin.POST("/queue/pause", PauseQueueHandler)
+	admin.POST("/queue/resume", ResumeQueueHandler)
+	admin.GET("/links/:shortCode/versions", ListRenderVersionsHandler)
+	admin.GET("/links/:shortCode/crawls", LinkCrawlsHandler)
+	admin.POST("/links/:shortCode/versions/:versionID/rollback", RollbackRenderHandler)
+	admin.GET("/render-stats", RenderStatsHandler)
+	admin.GET("/analytics/top-links", AnalyticsTopLinksHandler)
+	admin.GET("/analytics/clicks", AnalyticsClicksHandler)
+	admin.GET("/analytics/bots", AnalyticsBotsHandler)
+	admin.GET("/analytics/renders", AnalyticsRendersHandler)
+	admin.GET("/analytics/export", AnalyticsExportHandler)
+	admin.GET("/analytics/stream", AnalyticsStreamHandler)
+	admin.GET("/analytics/purges", AnalyticsPurgesHandler)
+	admin.GET("/stale-links", StaleLinksHandler)
+	admin.GET("/tenants", TenantsHandler)
+	admin.POST("/config/reload", ReloadConfigHandler)
+	admin.GET("/flags", ListFlagsHandler)
+	admin.PUT("/flags/:name", SetFlagHandler)
+	admin.DELETE("/flags/:name", ClearFlagHandler)
+	admin.GET("/users", ListAdminUsersHandler)
+	admin.POST("/users", CreateAdminUserHandler)
+	admin.DELETE("/users/:username", DeleteAdminUserHandler)
+	admin.GET("/webhooks", ListWebhookSubscriptionsHandler)
+	admin.POST("/webhooks", CreateWebhookSubscriptionHandler)
+	admin.GET("/webhooks/:id", GetWebhookSubscriptionHandler)
+	admin.PUT("/webhooks/:id", UpdateWebhookSubscriptionHandler)
+	admin.DELETE("/webhooks/:id", DeleteWebhookSubscriptionHandler)
+	admin.GET("/webhooks/:id/deliveries", WebhookDeliveriesHandler)
 
 	return router
 }
 
 func teardownTestAPI(t *testing.T) {
-	if db.DB != nil {
-		db.DB.Close()
-	}
+	// The workers and webhook deliveries use the database, so stop them first
 	if renderer.GlobalRenderQueue != nil {
 		renderer.GlobalRenderQueue.Shutdown()
 	}
+	webhook.Drain()
+	if db.DB != nil {
+		db.Close()
+	}
 }
 
 func TestGenerateShortCodeHandler(t *testing.T) {
@@ -165,6 +233,578 @@ func TestGenerateShortCodeHandler(t *testing.T) {
 	}
 }
 
+func TestGenerateShortCodeHandlerConcurrentSameURL(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	// Differently cased spellings of the same URL, submitted at once
+	urls := []string{"https://race.com/page", "HTTPS://RACE.com/page", "https://Race.com/page", "https://race.com/page"}
+	codes := make(chan string, len(urls))
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			body, _ := json.Marshal(GenerateRequest{URL: u})
+			req := httptest.NewRequest("POST", "/generate", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response GenerateResponse
+			if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response)) {
+				codes <- response.ShortCode
+			}
+		}(u)
+	}
+	wg.Wait()
+	close(codes)
+
+	seen := make(map[string]bool)
+	for code := range codes {
+		seen[code] = true
+	}
+	assert.Len(t, seen, 1, "all requests get the same short code")
+
+	var count int64
+	require.NoError(t, db.DB.Model(&db.Link{}).Where("original_url = ?", "https://race.com/page").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestGenerateShortCodeHandlerRenderOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]string
+		expectedStatus int
+	}{
+		{
+			name: "locale options are stored on the link",
+			requestBody: map[string]string{
+				"url":             "https://localized.com",
+				"accept_language": "de-DE,de;q=0.9",
+				"locale":          "de-DE",
+				"timezone":        "Europe/Berlin",
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "profile is stored on the link",
+			requestBody: map[string]string{
+				"url":     "https://localized.com",
+				"profile": "de",
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "unknown profile",
+			requestBody: map[string]string{
+				"url":     "https://localized.com",
+				"profile": "fr",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid locale",
+			requestBody: map[string]string{
+				"url":    "https://localized.com",
+				"locale": "not a locale!",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupTestAPI(t)
+			defer teardownTestAPI(t)
+			config.Get().RenderProfiles = `{"de": {"locale": "de-DE", "geolocation": {"latitude": 52.52, "longitude": 13.405}}}`
+
+			body, err := json.Marshal(tt.requestBody)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest("POST", "/generate", bytes.NewBuffer(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			link, err := db.GetLinkByOriginalURL("", tt.requestBody["url"])
+			require.NoError(t, err)
+			assert.Equal(t, tt.requestBody["accept_language"], link.AcceptLanguage)
+			assert.Equal(t, tt.requestBody["locale"], link.Locale)
+			assert.Equal(t, tt.requestBody["timezone"], link.Timezone)
+			assert.Equal(t, tt.requestBody["profile"], link.RenderProfile)
+		})
+	}
+}
+
+func TestGenerateShortCodeHandlerHashMode(t *testing.T) {
+	require.NoError(t, shortener.SetMode(shortener.ModeHash))
+	defer shortener.SetMode(shortener.ModeRandom)
+
+	// The same URL gets the same code from separate databases
+	for i := 0; i < 2; i++ {
+		router := setupTestAPI(t)
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://hashed.com/page"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var resp GenerateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, shortener.HashShortCode("https://hashed.com/page", 0), resp.ShortCode)
+		teardownTestAPI(t)
+	}
+}
+
+func TestGenerateShortCodeHandlerSequentialMode(t *testing.T) {
+	require.NoError(t, shortener.SetMode(shortener.ModeSequential))
+	defer shortener.SetMode(shortener.ModeRandom)
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	// An older random code holding the next sequential one is skipped
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "B", OriginalURL: "https://random.com"}))
+
+	for _, expected := range []string{"A", "C"} {
+		body := `{"url": "https://sequential.com/` + expected + `"}`
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var resp GenerateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, expected, resp.ShortCode)
+	}
+}
+
+func TestGenerateShortCodeHandlerAlias(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	generate := func(body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	code, resp := generate(`{"url": "https://alias.com/sale", "alias": "spring-sale"}`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "spring-sale", resp["short_code"])
+
+	code, resp = generate(`{"url": "https://alias.com/other", "alias": "spring-sale"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Contains(t, resp["error"], "already taken")
+
+	code, resp = generate(`{"url": "https://alias.com/other", "alias": "admin"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, `Invalid alias: "admin" is reserved`, resp["error"])
+
+	code, _ = generate(`{"url": "https://alias.com/other", "alias": "no spaces"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+}
+
+func TestGenerateShortCodeHandlerWithBlockedDomains(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().BlockedDomains = "spam.com,.abuse.net"
+
+	generate := func(url string) int {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, generate("https://spam.com/offer"))
+	assert.Equal(t, http.StatusForbidden, generate("https://cdn.abuse.net/x"))
+	assert.Equal(t, http.StatusCreated, generate("https://www.spam.com/offer"), "only listed patterns are blocked")
+
+	// Blocking wins over allowing
+	config.Get().AllowedDomains = ".abuse.net,fine.org"
+	assert.Equal(t, http.StatusForbidden, generate("https://abuse.net/x"))
+	assert.Equal(t, http.StatusCreated, generate("https://fine.org/page"))
+}
+
+func TestGenerateShortCodeHandlerSSRFProtection(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().SSRFProtection = true
+
+	generate := func(url string) int {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, generate("http://169.254.169.254/latest/meta-data/"))
+	assert.Equal(t, http.StatusForbidden, generate("http://127.0.0.1:8080/admin"))
+	assert.Equal(t, http.StatusForbidden, generate("http://10.0.0.5/"))
+	assert.Equal(t, http.StatusUnprocessableEntity, generate("ftp://93.184.216.34/file"), "other schemes fail validation first")
+	assert.Equal(t, http.StatusCreated, generate("http://93.184.216.34/"))
+
+	config.Get().SSRFAllowedNetworks = "10.0.0.0/8"
+	assert.Equal(t, http.StatusCreated, generate("http://10.0.0.5/"))
+}
+
+// fakeChecker flags the URLs it maps to a threat type.
+type fakeChecker map[string]string
+
+func (f fakeChecker) Check(_ context.Context, urls []string) (map[string]string, error) {
+	threats := map[string]string{}
+	for _, u := range urls {
+		if threat, ok := f[u]; ok {
+			threats[u] = threat
+		}
+	}
+	return threats, nil
+}
+
+func TestGenerateShortCodeHandlerURLScreening(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	reputation.SetChecker(fakeChecker{"https://phish.com/login": "SOCIAL_ENGINEERING"})
+	defer reputation.SetChecker(nil)
+
+	generate := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := generate("https://phish.com/login")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "SOCIAL_ENGINEERING")
+	assert.Equal(t, http.StatusCreated, generate("https://phish.com/about").Code)
+}
+
+func TestGenerateShortCodeHandlerNormalizesURLs(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	shortener.SetNormalizeOptions(shortener.NormalizeOptions{StripFragment: true, SortQuery: true, StripParams: "utm_*"})
+	defer shortener.SetNormalizeOptions(shortener.NormalizeOptions{})
+
+	generate := func(url string) GenerateResponse {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Contains(t, []int{http.StatusOK, http.StatusCreated}, w.Code)
+		var resp GenerateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	first := generate("https://Shop.example.com:443/item?id=7&color=red")
+	second := generate("https://shop.example.com/item?color=red&id=7&utm_source=mail#reviews")
+	assert.Equal(t, first.ShortCode, second.ShortCode)
+	assert.Equal(t, "https://shop.example.com/item?color=red&id=7", second.OriginalURL)
+}
+
+func TestGenerateShortCodeHandlerURLValidation(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().URLMaxLength = 40
+
+	generate := func(url string) (int, map[string]string) {
+		body, _ := json.Marshal(map[string]string{"url": url})
+		req := httptest.NewRequest("POST", "/generate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	for url, code := range map[string]string{
+		"https://example.com/a-rather-long-path-to-a-page": shortener.URLTooLong,
+		"https://paypal.com@phish.example/":                shortener.URLHasCredentials,
+	} {
+		status, resp := generate(url)
+		assert.Equal(t, http.StatusBadRequest, status, url)
+		assert.Equal(t, code, resp["code"], url)
+	}
+
+	status, _ := generate("https://example.com/short")
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+func TestGenerateShortCodeHandlerSchemeAllowlist(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	defer shortener.SetAllowedSchemes(shortener.DefaultAllowedSchemes)
+
+	generate := func(url string) (int, map[string]string) {
+		body, _ := json.Marshal(map[string]string{"url": url})
+		req := httptest.NewRequest("POST", "/generate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	for _, url := range []string{"javascript:alert(document.cookie)", "file:///etc/passwd", "data:text/html,hi"} {
+		status, resp := generate(url)
+		assert.Equal(t, http.StatusUnprocessableEntity, status, url)
+		assert.Equal(t, shortener.URLSchemeNotAllowed, resp["code"], url)
+	}
+
+	require.NoError(t, shortener.SetAllowedSchemes("https"))
+	status, resp := generate("http://example.com/plain")
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, resp["error"], "only https")
+	status, _ = generate("HTTPS://example.com/secure")
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+func TestSignedShortCodes(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	require.NoError(t, shortener.SetSigningKey("secret", shortener.DefaultSignatureLength))
+	defer shortener.SetSigningKey("", shortener.DefaultSignatureLength)
+
+	req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://private.example.com/doc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	code, ok := shortener.VerifyCode(resp.ShortCode)
+	require.True(t, ok, "/generate serves the signed code")
+	_, err := db.GetLinkByShortCode(code)
+	require.NoError(t, err, "the link is stored under the bare code")
+
+	follow := func(served string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/"+served, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusFound, follow(resp.ShortCode))
+	assert.Equal(t, http.StatusNotFound, follow(code), "bare codes don't resolve")
+	assert.Equal(t, http.StatusNotFound, follow(code+"AAAA"))
+}
+
+func TestBotDetection(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().BotOverrideHeader = "X-Prerender-Bot"
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "BOTS01",
+		OriginalURL:         "https://bots.example.com",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: "<html>snapshot</html>",
+	}))
+
+	follow := func(userAgent, override string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/BOTS01", nil)
+		req.Header.Set("User-Agent", userAgent)
+		if override != "" {
+			req.Header.Set("X-Prerender-Bot", override)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	w := follow(chrome, "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, []string{"User-Agent", "Sec-CH-UA", "X-Prerender-Bot"}, w.Header().Values("Vary"))
+	assert.Equal(t, http.StatusOK, follow("Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "").Code)
+	assert.Equal(t, http.StatusOK, follow("WhatsApp/2.23.20.0", "").Code, "missed by the old keyword list")
+
+	// So does the AJAX crawling scheme's parameter, with or without a value
+	for _, query := range []string{"?_escaped_fragment_=", "?_escaped_fragment_=page=2", "?_escaped_fragment_"} {
+		req := httptest.NewRequest("GET", "/BOTS01"+query, nil)
+		req.Header.Set("User-Agent", chrome)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		assert.Equal(t, "<html>snapshot</html>", w.Body.String(), query)
+	}
+
+	// The override header decides over the user agent
+	assert.Equal(t, http.StatusOK, follow(chrome, "1").Code)
+	assert.Equal(t, http.StatusFound, follow("Googlebot/2.1", "0").Code)
+
+	config.Get().BotOverrideHeader = ""
+	assert.Equal(t, http.StatusFound, follow(chrome, "1").Code, "the override can be turned off")
+}
+
+func TestSnapshotLastModified(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	renderedAt := time.Date(2026, 10, 1, 12, 30, 45, 500, time.UTC)
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "LASTMD",
+		OriginalURL:         "https://modified.example.com",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: "<html>snapshot</html>",
+		RenderedAt:          &renderedAt,
+	}))
+
+	follow := func(userAgent, ifModifiedSince string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/LASTMD", nil)
+		req.Header.Set("User-Agent", userAgent)
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := follow("Googlebot/2.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Thu, 01 Oct 2026 12:30:45 GMT", w.Header().Get("Last-Modified"))
+
+	w = follow("Googlebot/2.1", "Thu, 01 Oct 2026 12:30:45 GMT")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, http.StatusNotModified, follow("Googlebot/2.1", "Fri, 02 Oct 2026 00:00:00 GMT").Code)
+	assert.Equal(t, http.StatusOK, follow("Googlebot/2.1", "Wed, 30 Sep 2026 00:00:00 GMT").Code, "rendered again since")
+	assert.Equal(t, http.StatusOK, follow("Googlebot/2.1", "yesterday").Code)
+
+	w = follow("Mozilla/5.0", "Thu, 01 Oct 2026 12:30:45 GMT")
+	assert.Equal(t, http.StatusFound, w.Code, "redirects aren't conditional")
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+}
+
+func TestCacheControl(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "CACHE1",
+		OriginalURL:         "https://cached.example.com",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: "<html>snapshot</html>",
+	}))
+
+	follow := func(code, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/"+code, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	config.Get().RedirectCacheControl = "private, max-age=60"
+	config.Get().SnapshotCacheControl = "public, max-age=300, s-maxage=86400"
+	w := follow("CACHE1", "Mozilla/5.0")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+	w = follow("CACHE1", "Googlebot/2.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=300, s-maxage=86400", w.Header().Get("Cache-Control"))
+	assert.Empty(t, follow("NOPE", "Mozilla/5.0").Header().Get("Cache-Control"), "errors aren't cached")
+
+	config.Get().RedirectCacheControl = "none"
+	assert.Empty(t, follow("CACHE1", "Mozilla/5.0").Header().Get("Cache-Control"))
+
+	// A link's own policy wins for both
+	req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://counted.example.com", "cache_control": "no-store"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	link, err := db.GetLinkByShortCode(resp.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "no-store", link.CacheControl)
+	assert.Equal(t, "no-store", follow(resp.ShortCode, "Mozilla/5.0").Header().Get("Cache-Control"))
+}
+
+func TestRobotsTagHeader(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "ROBOT1",
+		OriginalURL:         "https://robots.example.com",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: "<html>snapshot</html>",
+	}))
+
+	follow := func(code, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/"+code, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Empty(t, follow("ROBOT1", "Mozilla/5.0").Header().Get("X-Robots-Tag"), "none by default")
+
+	config.Get().RobotsTag = "noindex"
+	w := follow("ROBOT1", "Mozilla/5.0")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"))
+	w = follow("ROBOT1", "Googlebot/2.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"), "snapshots carry it too")
+
+	// A link's own tag wins
+	req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://indexed.example.com", "robots_tag": "all"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "all", follow(resp.ShortCode, "Mozilla/5.0").Header().Get("X-Robots-Tag"))
+
+	req = httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://bad.example.com", "robots_tag": "noindex\r\nSet-Cookie: x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	preflight := func(origins, origin string) string {
+		router := gin.New()
+		if handler := corsMiddleware(origins); handler != nil {
+			router.Use(handler)
+		}
+		router.GET("/health", HealthCheckHandler)
+		req := httptest.NewRequest("OPTIONS", "/health", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	assert.Equal(t, "*", preflight("*", "https://any.com"))
+	assert.Equal(t, "https://app.example.com", preflight("https://app.example.com, https://admin.example.com", "https://app.example.com"))
+	assert.Empty(t, preflight("https://app.example.com", "https://evil.com"))
+	assert.Empty(t, preflight("", "https://any.com"))
+}
+
 func TestGenerateShortCodeHandlerWithDomainRestriction(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -186,6 +826,16 @@ func TestGenerateShortCodeHandlerWithDomainRestriction(t *testing.T) {
 			url:            "https://forbidden.com/page",
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name:           "subdomain of a wildcard",
+			url:            "https://shop.customer.net/page",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "apex of a wildcard",
+			url:            "https://customer.net/page",
+			expectedStatus: http.StatusForbidden,
+		},
 	}
 
 	for _, tt := range tests {
@@ -194,7 +844,7 @@ func TestGenerateShortCodeHandlerWithDomainRestriction(t *testing.T) {
 			defer teardownTestAPI(t)
 
 			// Set allowed domains
-			config.AppConfig.AllowedDomains = "allowed.com,example.org"
+			config.Get().AllowedDomains = "allowed.com,example.org,*.customer.net"
 
 			requestBody := GenerateRequest{URL: tt.url}
 			body, err := json.Marshal(requestBody)
@@ -251,6 +901,22 @@ func TestRedirectHandler(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:      "serve HTML to bot with target status code",
+			shortCode: "GONE123",
+			userAgent: "Googlebot/2.1 (+http://www.google.com/bot.html)",
+			setupFunc: func() {
+				link := &db.Link{
+					ShortCode:           "GONE123",
+					OriginalURL:         "https://gone-test.com",
+					RenderedHTMLContent: "<html><body>Page Not Found</body></html>",
+					RenderStatus:        db.RenderStatusCompleted,
+					TargetStatusCode:    http.StatusNotFound,
+				}
+				db.CreateLink(link)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:           "short code not found",
 			shortCode:      "NOTFOUND",
@@ -368,6 +1034,201 @@ func TestRedirectHandlerBotDetection(t *testing.T) {
 	}
 }
 
+func TestRedirectHandlerRecordsClicks(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().ClickIPHashSalt = "salt"
+	analytics.GlobalClickWriter = analytics.NewClickWriter(10, 10, time.Hour, db.RecordClickEvents)
+	defer func() { analytics.GlobalClickWriter = nil }()
+
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:    "CLICK123",
+		OriginalURL:  "https://click-test.com",
+		RenderStatus: db.RenderStatusFailed,
+	}))
+
+	for _, userAgent := range []string{"Mozilla/5.0 (X11; Linux x86_64)", "Googlebot/2.1"} {
+		req := httptest.NewRequest("GET", "/CLICK123", nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Referer", "https://referrer.com/page")
+		req.RemoteAddr = "203.0.113.7:1234"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	// Unknown codes aren't recorded
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/MISSING", nil))
+
+	analytics.GlobalClickWriter.Close()
+	var clicks []db.ClickEvent
+	require.NoError(t, db.DB.Order("id").Find(&clicks).Error)
+	require.Len(t, clicks, 2)
+	assert.Equal(t, "CLICK123", clicks[0].ShortCode)
+	assert.Equal(t, db.UAClassBrowser, clicks[0].UAClass)
+	assert.Equal(t, db.UAClassBot, clicks[1].UAClass)
+	assert.Equal(t, "https://referrer.com/page", clicks[0].Referrer)
+	assert.Equal(t, analytics.HashIP("203.0.113.7", "salt"), clicks[0].IPHash)
+	assert.False(t, clicks[0].ClickedAt.IsZero())
+}
+
+func TestRedirectHandlerForcePrerender(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	analytics.GlobalClickWriter = analytics.NewClickWriter(10, 10, time.Hour, db.RecordClickEvents)
+	defer func() { analytics.GlobalClickWriter = nil }()
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "FORCE1",
+		OriginalURL:         "https://force.example.com",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: "<html>snapshot</html>",
+	}))
+
+	follow := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/121.0")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := follow("/FORCE1?_prerender=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>snapshot</html>", w.Body.String())
+	assert.Equal(t, http.StatusOK, follow("/FORCE1?_prerender=true").Code)
+	assert.Equal(t, http.StatusFound, follow("/FORCE1?_prerender=0").Code)
+	assert.Equal(t, http.StatusFound, follow("/FORCE1").Code)
+
+	// The parameter doesn't make the click a bot's
+	analytics.GlobalClickWriter.Close()
+	var clicks []db.ClickEvent
+	require.NoError(t, db.DB.Find(&clicks).Error)
+	require.Len(t, clicks, 4)
+	for _, click := range clicks {
+		assert.Equal(t, db.UAClassBrowser, click.UAClass)
+	}
+}
+
+func TestRedirectHandlerStaticMode(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://landing.example.com/promo/", "static": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	link, err := db.GetLinkByShortCode(resp.ShortCode)
+	require.NoError(t, err)
+	assert.True(t, link.StaticMode)
+
+	snapshot := `<!DOCTYPE html><html><head><title>Promo</title><script src="app.js"></script>` +
+		`<script type="application/ld+json">{"@type":"Product"}</script></head>` +
+		`<body><img src="hero.png"><script>boot()</script></body></html>`
+	require.NoError(t, db.DB.Model(&db.Link{}).Where("short_code = ?", resp.ShortCode).Updates(map[string]any{
+		"render_status":         db.RenderStatusCompleted,
+		"rendered_html_content": snapshot,
+	}).Error)
+
+	follow := func(userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// People get the snapshot with scripts removed and assets loading from the origin
+	w = follow("Mozilla/5.0 (X11; Linux x86_64) Firefox/121.0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `<!DOCTYPE html><html><head><base href="https://landing.example.com/promo/"><title>Promo</title>`+
+		`<script type="application/ld+json">{"@type":"Product"}</script></head>`+
+		`<body><img src="hero.png"></body></html>`, w.Body.String())
+
+	// Bots still get the snapshot as rendered
+	w = follow("Googlebot/2.1 (+http://www.google.com/bot.html)")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, snapshot, w.Body.String())
+}
+
+func TestRedirectHandlerClientHints(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	analytics.GlobalClickWriter = analytics.NewClickWriter(10, 10, time.Hour, db.RecordClickEvents)
+	defer func() { analytics.GlobalClickWriter = nil }()
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "HINTS1", OriginalURL: "https://hints.example.com"}))
+
+	// A reduced Chrome UA, whose hints tell the real brand and platform
+	req := httptest.NewRequest("GET", "/HINTS1", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36")
+	req.Header.Set("Sec-CH-UA", `"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`)
+	req.Header.Set("Sec-CH-UA-Platform", `"Linux"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	analytics.GlobalClickWriter.Close()
+	var clicks []db.ClickEvent
+	require.NoError(t, db.DB.Find(&clicks).Error)
+	require.Len(t, clicks, 1)
+	assert.Equal(t, "Edge", clicks[0].Browser)
+	assert.Equal(t, "Linux", clicks[0].Platform)
+}
+
+func TestRedirectHandlerFinalURL(t *testing.T) {
+	tests := []struct {
+		name               string
+		redirectToFinalURL bool
+		redirectChain      string
+		expectedLocation   string
+	}{
+		{
+			name:               "disabled uses original URL",
+			redirectToFinalURL: false,
+			redirectChain:      `["https://old.example.com","https://new.example.com"]`,
+			expectedLocation:   "https://old.example.com",
+		},
+		{
+			name:               "enabled uses final URL",
+			redirectToFinalURL: true,
+			redirectChain:      `["https://old.example.com","https://new.example.com"]`,
+			expectedLocation:   "https://new.example.com",
+		},
+		{
+			name:               "enabled without redirect chain uses original URL",
+			redirectToFinalURL: true,
+			redirectChain:      "",
+			expectedLocation:   "https://old.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupTestAPI(t)
+			defer teardownTestAPI(t)
+
+			config.Get().RedirectToFinalURL = tt.redirectToFinalURL
+			link := &db.Link{
+				ShortCode:     "HOPS123",
+				OriginalURL:   "https://old.example.com",
+				FinalURL:      "https://new.example.com",
+				RedirectChain: tt.redirectChain,
+				RenderStatus:  db.RenderStatusCompleted,
+			}
+			require.NoError(t, db.CreateLink(link))
+
+			req, err := http.NewRequest("GET", "/HOPS123", nil)
+			require.NoError(t, err)
+			req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
 func TestHealthCheckHandler(t *testing.T) {
 	router := setupTestAPI(t)
 	defer teardownTestAPI(t)
@@ -386,6 +1247,49 @@ func TestHealthCheckHandler(t *testing.T) {
 	assert.Equal(t, "UP", response["status"])
 }
 
+func TestReadinessHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	defer draining.Store(false)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Draining fails readiness but keeps the server answering
+	StartDraining()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"DRAINING"}`, w.Body.String())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestVersionHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = "v1.2.0"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var info version.Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "v1.2.0", info.Version)
+	assert.NotEmpty(t, info.GoVersion)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	var status struct {
+		Build version.Info `json:"build"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "v1.2.0", status.Build.Version)
+}
+
 func TestStatusHandler(t *testing.T) {
 	router := setupTestAPI(t)
 	defer teardownTestAPI(t)
@@ -410,6 +1314,15 @@ func TestStatusHandler(t *testing.T) {
 	assert.Contains(t, renderQueue, "worker_count")
 	assert.Contains(t, renderQueue, "queue_length")
 	assert.Contains(t, renderQueue, "in_progress_count")
+
+	shortCodes, ok := response["short_codes"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, shortCodes, "collision_rate")
+
+	schema, ok := response["schema"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, schema["latest"], schema["version"])
+	assert.Equal(t, false, schema["pending"])
 }
 
 func TestGenerateRequestValidation(t *testing.T) {
@@ -491,6 +1404,31 @@ func TestGenerateResponseFormat(t *testing.T) {
 	assert.Len(t, response.ShortCode, 6) // Default short code length
 }
 
+func TestGenerateResponseRenderError(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "FAIL01", OriginalURL: "https://failing.com"}))
+	_, err := db.ClaimLinkForRender("FAIL01", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, db.SaveRenderFailure("FAIL01", "navigation timeout", false))
+
+	body, err := json.Marshal(GenerateRequest{URL: "https://failing.com"})
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/generate", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "FAIL01", response.ShortCode)
+	assert.Equal(t, db.RenderStatusFailed, response.RenderStatus)
+	assert.Equal(t, 1, response.RenderAttempts)
+	assert.Equal(t, "navigation timeout", response.LastRenderError)
+}
+
 func BenchmarkGenerateShortCodeHandler(b *testing.B) {
 	router := setupTestAPI(&testing.T{})
 	defer teardownTestAPI(&testing.T{})
@@ -529,3 +1467,85 @@ func BenchmarkRedirectHandler(b *testing.B) {
 		router.ServeHTTP(w, req)
 	}
 }
+
+func TestGenerateRenderQueueFull(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "KNOWN1", OriginalURL: "https://known.example.com", RenderStatus: db.RenderStatusCompleted}))
+
+	// Fill the queue past its paused worker, which holds at most one job
+	queue := renderer.GlobalRenderQueue
+	require.True(t, queue.Pause())
+	queued := 0
+	require.Eventually(t, func() bool {
+		for ; !queue.Saturated(); queued++ {
+			queue.QueueRender(fmt.Sprintf("FULL%d", queued), fmt.Sprintf("https://full%d.example.com", queued))
+		}
+		time.Sleep(10 * time.Millisecond)
+		return queue.Saturated()
+	}, 2*time.Second, 10*time.Millisecond)
+
+	generate := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	config.Get().RenderQueueFullPolicy = "reject"
+	config.Get().RenderQueueFullStatus = http.StatusServiceUnavailable
+	config.Get().RenderQueueFullRetryAfterSeconds = 30
+	w := generate("https://refused.example.com")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	_, err := db.GetLinkByOriginalURL(tenant.Default, "https://refused.example.com")
+	assert.ErrorIs(t, err, db.ErrNotFound, "no link is left pending")
+
+	config.Get().RenderQueueFullStatus = http.StatusTooManyRequests
+	assert.Equal(t, http.StatusTooManyRequests, generate("https://refused.example.com").Code)
+	assert.Equal(t, http.StatusOK, generate("https://known.example.com").Code, "existing links are still answered")
+
+	// Deferred, the render waits in the database for an idle worker
+	config.Get().RenderQueueFullPolicy = "defer"
+	w = generate("https://deferred.example.com")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, db.RenderStatusPending, resp.RenderStatus)
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, resp.ShortCode, requests[0].ShortCode)
+}
+
+func TestGenerateWaitSeconds(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	seconds := func(n int) *int { return &n }
+	config.Get().RenderTimeoutSeconds = 90
+	assert.Equal(t, 90*time.Second, renderWait(config.Get(), &GenerateRequest{}), "RENDER_TIMEOUT_SECONDS by default")
+	assert.Equal(t, 5*time.Second, renderWait(config.Get(), &GenerateRequest{WaitSeconds: seconds(5)}))
+	assert.Equal(t, time.Duration(0), renderWait(config.Get(), &GenerateRequest{WaitSeconds: seconds(0)}))
+	assert.Equal(t, 90*time.Second, renderWait(config.Get(), &GenerateRequest{WaitSeconds: seconds(600)}), "capped")
+	config.Get().GenerateMaxWaitSeconds = 10
+	assert.Equal(t, 10*time.Second, renderWait(config.Get(), &GenerateRequest{}))
+	assert.Equal(t, 10*time.Second, renderWait(config.Get(), &GenerateRequest{WaitSeconds: seconds(30)}))
+
+	generate := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusBadRequest, generate(`{"url": "https://wait.example.com", "wait_seconds": -1}`).Code)
+
+	// Without waiting, the link is answered while its render is still to come
+	w := generate(`{"url": "https://wait.example.com", "wait_seconds": 0}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp GenerateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, db.RenderStatusPending, resp.RenderStatus)
+}
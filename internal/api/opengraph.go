@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	xhtml "golang.org/x/net/html"
+)
+
+// openGraphURLProperties are the Open Graph and Twitter card properties that
+// hold URLs. They are made absolute, since the tags are served from the short
+// domain rather than the page.
+var openGraphURLProperties = map[string]bool{
+	"og:url":                true,
+	"og:image":              true,
+	"og:image:url":          true,
+	"og:image:secure_url":   true,
+	"og:video":              true,
+	"og:video:url":          true,
+	"og:video:secure_url":   true,
+	"og:audio":              true,
+	"og:audio:url":          true,
+	"og:audio:secure_url":   true,
+	"twitter:image":         true,
+	"twitter:image:src":     true,
+	"twitter:player":        true,
+	"twitter:player:stream": true,
+}
+
+// OpenGraphHandler serves only the Open Graph and Twitter card tags of a
+// link's snapshot, for link preview fetchers that time out on the full
+// snapshot. Links without a snapshot redirect like the short URL does.
+func OpenGraphHandler(c *gin.Context) {
+	cfg := config.Get()
+	link, ok := servedLink(c, c.Param("shortCode"))
+	if !ok {
+		return
+	}
+	if link.DisabledAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Short code has been disabled"})
+		return
+	}
+	if robotsTag := robotsTagFor(cfg, link); robotsTag != "" {
+		c.Header("X-Robots-Tag", robotsTag)
+	}
+
+	recordClick(c, cfg, link, true)
+
+	if link.RenderStatus != db.RenderStatusCompleted || link.RenderedHTMLContent == "" {
+		redirectToTarget(c, cfg, link)
+		return
+	}
+	setCacheControl(c, link, cfg.SnapshotCacheControl)
+	status := snapshotStatusCode(link)
+	if notModified(c, link, status) {
+		return
+	}
+	document := openGraphDocument(link.RenderedHTMLContent, snapshotURL(link))
+	c.Data(status, "text/html; charset=utf-8", []byte(document))
+}
+
+// openGraphDocument returns an HTML document holding just the og: and
+// twitter: meta tags of a snapshot, with URLs in them resolved against pageURL.
+func openGraphDocument(snapshot, pageURL string) string {
+	base, _ := url.Parse(pageURL) // nil if unparsable, leaving URLs as they are
+
+	var tags strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(snapshot))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		if tt != xhtml.StartTagToken && tt != xhtml.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if string(name) != "meta" {
+			continue
+		}
+
+		var attr, property, content string
+		hasContent := false
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			switch string(key) {
+			case "property", "name":
+				if !isOpenGraphProperty(property) {
+					attr, property = string(key), string(val)
+				}
+			case "content":
+				content, hasContent = string(val), true
+			}
+		}
+		if !isOpenGraphProperty(property) || !hasContent {
+			continue
+		}
+		if openGraphURLProperties[strings.ToLower(property)] && base != nil {
+			if ref, err := base.Parse(strings.TrimSpace(content)); err == nil {
+				content = ref.String()
+			}
+		}
+		fmt.Fprintf(&tags, "<meta %s=\"%s\" content=\"%s\">\n", attr, html.EscapeString(property), html.EscapeString(content))
+	}
+
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n" + tags.String() + "</head>\n</html>\n"
+}
+
+// isOpenGraphProperty reports whether a meta tag's property or name is an Open
+// Graph or Twitter card one.
+func isOpenGraphProperty(property string) bool {
+	property = strings.ToLower(property)
+	return strings.HasPrefix(property, "og:") || strings.HasPrefix(property, "twitter:")
+}
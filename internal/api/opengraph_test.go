@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenGraphDocument(t *testing.T) {
+	snapshot := `<!DOCTYPE html><html><head>
+<title>Heavy page</title>
+<meta name="description" content="Not a card tag">
+<meta property="og:title" content="Caf&eacute; &quot;Menu&quot;">
+<meta property="og:image" content="/img/cover.png">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="https://cdn.example.com/card.png">
+<meta property="og:description">
+<script>document.write('<meta property="og:title" content="injected">')</script>
+</head><body><div>lots of markup</div></body></html>`
+
+	expected := "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n" +
+		"<meta property=\"og:title\" content=\"Café &#34;Menu&#34;\">\n" +
+		"<meta property=\"og:image\" content=\"https://example.com/img/cover.png\">\n" +
+		"<meta name=\"twitter:card\" content=\"summary_large_image\">\n" +
+		"<meta name=\"twitter:image\" content=\"https://cdn.example.com/card.png\">\n" +
+		"</head>\n</html>\n"
+	assert.Equal(t, expected, openGraphDocument(snapshot, "https://example.com/menu"))
+}
+
+func TestOpenGraphHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "OGTAGS",
+		OriginalURL:         "https://og.example.com",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: `<html><head><meta property="og:title" content="Hello"></head><body>big</body></html>`,
+	}))
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:    "OGWAIT",
+		OriginalURL:  "https://pending.example.com",
+		RenderStatus: db.RenderStatusPending,
+	}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", "facebookexternalhit/1.1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/og/OGTAGS")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<meta property="og:title" content="Hello">`)
+	assert.NotContains(t, w.Body.String(), "big")
+
+	w = get("/og/OGWAIT")
+	assert.Equal(t, http.StatusFound, w.Code, "no snapshot yet")
+	assert.Equal(t, "https://pending.example.com", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, get("/og/NOPE").Code)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/tenant"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrewarmRequest is the body of POST /admin/prewarm, with up to 1000 URLs.
+type PrewarmRequest struct {
+	URLs []string `json:"urls" binding:"required,min=1,max=1000"`
+	// Optional tenant the links belong to, the default tenant if empty
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// PrewarmResult reports what prewarming did with one URL.
+type PrewarmResult struct {
+	URL       string `json:"url"`
+	ShortCode string `json:"short_code,omitempty"`
+	Created   bool   `json:"created"`
+	Queued    bool   `json:"queued"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PrewarmHandler creates links for URLs that have none and requests a fresh
+// render of every link, so the first crawler hit after, say, a marketing push
+// already finds a snapshot. The renders are requested through the database,
+// where workers only pick them up while idle, so they wait behind renders of
+// links created through /generate. URLs go through the same checks as with
+// /generate; those rejected are reported and the rest still prewarmed.
+func PrewarmHandler(c *gin.Context) {
+	var req PrewarmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.Tenant != tenant.Default && !slices.Contains(tenant.IDs(), req.Tenant) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown tenant '" + req.Tenant + "'"})
+		return
+	}
+	c.Set(tenantKey, req.Tenant)
+
+	cfg := config.Get()
+	results := make([]PrewarmResult, len(req.URLs))
+	created, queued, failed := 0, 0, 0
+	for i, rawURL := range req.URLs {
+		results[i] = prewarmURL(c, cfg, rawURL)
+		switch {
+		case results[i].Error != "":
+			failed++
+		case results[i].Queued:
+			queued++
+		}
+		if results[i].Created {
+			created++
+		}
+	}
+	log.Printf("Admin: %s prewarmed %d URLs (%d links created, %d renders requested, %d failed)",
+		c.GetString(adminUserKey), len(req.URLs), created, queued, failed)
+	c.JSON(http.StatusOK, gin.H{"results": results, "created": created, "queued": queued, "failed": failed})
+}
+
+// prewarmURL creates or finds the link of one URL and requests its render.
+// Disabled links, and those rendering right now, aren't rendered again.
+func prewarmURL(c *gin.Context, cfg *config.Config, rawURL string) PrewarmResult {
+	result := PrewarmResult{URL: rawURL}
+	req := GenerateRequest{URL: rawURL}
+	if reqErr := checkGenerateRequest(c, cfg, &req); reqErr != nil {
+		result.Error, _ = reqErr.body["error"].(string)
+		return result
+	}
+	link, created, reqErr := allocateLink(c, cfg, &req, false)
+	if reqErr != nil {
+		result.Error, _ = reqErr.body["error"].(string)
+		return result
+	}
+	result.ShortCode, result.Created = link.ShortCode, created
+	if link.DisabledAt != nil || link.RenderStatus == db.RenderStatusRendering {
+		return result
+	}
+	if err := db.RequestRender(link.ShortCode); err != nil {
+		log.Printf("Error requesting a render of %s: %v", link.ShortCode, err)
+		result.Error = "Database error"
+		return result
+	}
+	result.Queued = true
+	return result
+}
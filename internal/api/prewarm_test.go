@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrewarm(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	config.Get().Tenants = `{"acme": {"api_keys": ["acme-key"]}}`
+	renderedAt := time.Now().Add(-time.Hour)
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:           "WARM01",
+		OriginalURL:         "https://landing.example.com/sale",
+		RenderStatus:        db.RenderStatusCompleted,
+		RenderedHTMLContent: "<html>old</html>",
+		RenderedAt:          &renderedAt,
+	}))
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:    "WARM02",
+		OriginalURL:  "https://landing.example.com/busy",
+		RenderStatus: db.RenderStatusRendering,
+	}))
+
+	prewarm := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/prewarm", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := prewarm(`{"urls": ["https://landing.example.com/sale", "https://landing.example.com/new", "https://landing.example.com/busy", "ftp://files.example.com"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Results []PrewarmResult `json:"results"`
+		Created int             `json:"created"`
+		Queued  int             `json:"queued"`
+		Failed  int             `json:"failed"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, PrewarmResult{URL: "https://landing.example.com/sale", ShortCode: "WARM01", Queued: true}, resp.Results[0])
+	assert.True(t, resp.Results[1].Created)
+	assert.True(t, resp.Results[1].Queued)
+	assert.Equal(t, PrewarmResult{URL: "https://landing.example.com/busy", ShortCode: "WARM02"}, resp.Results[2], "already rendering")
+	assert.NotEmpty(t, resp.Results[3].Error)
+	assert.Equal(t, 1, resp.Created)
+	assert.Equal(t, 2, resp.Queued)
+	assert.Equal(t, 1, resp.Failed)
+
+	// The renders are requested from the workers, the existing snapshot served meanwhile
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	var requested []string
+	for _, link := range requests {
+		requested = append(requested, link.ShortCode)
+	}
+	assert.ElementsMatch(t, []string{"WARM01", resp.Results[1].ShortCode}, requested)
+	link, err := db.GetLinkByShortCode("WARM01")
+	require.NoError(t, err)
+	assert.Equal(t, "<html>old</html>", link.RenderedHTMLContent)
+
+	// Links can be created for a tenant
+	w = prewarm(`{"urls": ["https://landing.example.com/sale"], "tenant": "acme"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Created, "each tenant gets its own link")
+	link, err = db.GetLinkByShortCode(resp.Results[0].ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", link.TenantID)
+
+	assert.Equal(t, http.StatusBadRequest, prewarm(`{"urls": ["https://a.com"], "tenant": "nobody"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, prewarm(`{"urls": []}`).Code)
+}
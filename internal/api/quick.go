@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/renderer"
+	"prerender-url-shortener/internal/shortener"
+	"prerender-url-shortener/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quickPage is the confirmation page of /quick, or its error page.
+var quickPage = template.Must(template.New("quick").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Error}}Link not shortened{{else}}Short link ready{{end}}</title>
+<style>body{font-family:system-ui,sans-serif;max-width:36rem;margin:3rem auto;padding:0 1rem}input{box-sizing:border-box;width:100%;font-size:1.1rem;padding:.4rem}p{overflow-wrap:anywhere}</style>
+</head>
+<body>
+{{if .Error}}<h1>Link not shortened</h1>
+<p>{{.Error}}</p>
+{{else}}<h1>Short link ready</h1>
+<input id="short" value="{{.ShortURL}}" readonly autofocus onfocus="this.select()">
+<p><button onclick="navigator.clipboard.writeText(document.getElementById('short').value)">Copy</button></p>
+<p>Points to <a href="{{.OriginalURL}}" rel="noopener noreferrer">{{.OriginalURL}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+type quickPageData struct {
+	ShortURL    string
+	OriginalURL string
+	Error       string
+}
+
+// renderQuickPage writes the confirmation or error page of /quick.
+func renderQuickPage(c *gin.Context, status int, data quickPageData) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := quickPage.Execute(c.Writer, data); err != nil {
+		log.Printf("Error writing /quick page: %v", err)
+	}
+}
+
+// quickAuth authenticates /quick, which a bookmarklet opens by navigating away
+// from the page to shorten, so it can't set headers: a tenant API key may be
+// passed as ?key= as well as in X-API-Key, creating the link for its tenant.
+// Otherwise an admin user's session is required, not a viewer's, and the link
+// belongs to the host's tenant as with /generate.
+func quickAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Query("key")
+		if key == "" {
+			key = c.GetHeader("X-API-Key")
+		}
+		if key != "" {
+			id, ok := tenant.FromAPIKey(key)
+			if !ok {
+				renderQuickPage(c, http.StatusUnauthorized, quickPageData{Error: "Invalid API key."})
+				c.Abort()
+				return
+			}
+			c.Set(tenantKey, id)
+			c.Next()
+			return
+		}
+
+		username, role, _ := adminCredentials(c)
+		if username == "" || role != db.AdminRoleAdmin {
+			renderQuickPage(c, http.StatusForbidden, quickPageData{Error: "Log in as an admin or pass an API key as ?key= to shorten links."})
+			c.Abort()
+			return
+		}
+		id := tenant.Default
+		if hostTenant, ok := tenant.FromHost(c.Request.Host); ok {
+			id = hostTenant
+		}
+		c.Set(adminUserKey, username)
+		c.Set(tenantKey, id)
+		c.Next()
+	}
+}
+
+// QuickLinkHandler shortens ?url= in one click, for bookmarklets and browser
+// extensions, and redirects to a page showing the short URL. The URL goes
+// through the same checks as with /generate, but the render isn't waited for.
+func QuickLinkHandler(c *gin.Context) {
+	cfg := config.Get()
+	req := GenerateRequest{URL: c.Query("url")}
+	if req.URL == "" {
+		renderQuickPage(c, http.StatusBadRequest, quickPageData{Error: "Missing the url parameter."})
+		return
+	}
+	if reqErr := checkGenerateRequest(c, cfg, &req); reqErr != nil {
+		renderQuickPage(c, reqErr.status, quickPageData{Error: reqErr.body["error"].(string)})
+		return
+	}
+	link, created, reqErr := allocateLink(c, cfg, &req, true)
+	if reqErr != nil {
+		renderQuickPage(c, reqErr.status, quickPageData{Error: reqErr.body["error"].(string)})
+		return
+	}
+	if created {
+		log.Printf("Saved link to database: %s -> %s (status: pending)", link.ShortCode, link.OriginalURL)
+		renderer.GlobalRenderQueue.QueueRender(link.ShortCode, link.OriginalURL)
+	}
+	c.Redirect(http.StatusFound, "/quick/done?code="+url.QueryEscape(shortener.SignCode(link.ShortCode)))
+}
+
+// QuickDoneHandler is the confirmation page /quick redirects to, showing the
+// short URL of ?code= on the host the request came to.
+func QuickDoneHandler(c *gin.Context) {
+	served := c.Query("code")
+	var link *db.Link
+	if shortCode, ok := shortener.VerifyCode(served); ok {
+		var err error
+		if link, err = db.GetLinkByShortCode(shortCode); err != nil && !errors.Is(err, db.ErrNotFound) {
+			log.Printf("Error loading link %s for /quick: %v", shortCode, err)
+		}
+	}
+	if link == nil || !servesLink(c, link) {
+		renderQuickPage(c, http.StatusNotFound, quickPageData{Error: "Short link not found."})
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	renderQuickPage(c, http.StatusOK, quickPageData{
+		ShortURL:    scheme + "://" + c.Request.Host + "/" + served,
+		OriginalURL: link.OriginalURL,
+	})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuickLink(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().Tenants = `{"acme": {"api_keys": ["acme-key"]}}`
+	_, err := db.CreateAdminUser("root", "correct horse", db.AdminRoleAdmin)
+	require.NoError(t, err)
+	_, err = db.CreateAdminUser("watcher", "battery staple", db.AdminRoleViewer)
+	require.NoError(t, err)
+
+	get := func(path, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "s.example.com"
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: adminSessionCookie, Value: session})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(username, password string) string {
+		req := httptest.NewRequest("POST", "/admin/login", bytes.NewBufferString(`{"username": "`+username+`", "password": "`+password+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["token"]
+	}
+	quick := "/quick?url=" + url.QueryEscape("https://bookmarked.com/page")
+
+	// An API key creates the link for its tenant
+	w := get(quick+"&key=acme-key", "")
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	location := w.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/quick/done?code="), location)
+	code := strings.TrimPrefix(location, "/quick/done?code=")
+	link, err := db.GetLinkByShortCode(code)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", link.TenantID)
+	assert.Equal(t, "https://bookmarked.com/page", link.OriginalURL)
+
+	w = get(location, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `value="http://s.example.com/`+code+`"`)
+
+	// Shortening the URL again shows the same link
+	w = get(quick+"&key=acme-key", "")
+	assert.Equal(t, location, w.Header().Get("Location"))
+
+	// An admin's session works without a key
+	w = get(quick, login("root", "correct horse"))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.NotEqual(t, location, w.Header().Get("Location"), "the default tenant gets its own link")
+
+	assert.Equal(t, http.StatusBadRequest, get("/quick?key=acme-key", "").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, get("/quick?key=acme-key&url=ftp://files.com", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(quick+"&key=made-up", "").Code)
+	assert.Equal(t, http.StatusForbidden, get(quick, "").Code)
+	assert.Equal(t, http.StatusForbidden, get(quick, login("watcher", "battery staple")).Code)
+	assert.Equal(t, http.StatusNotFound, get("/quick/done?code=NOPE", "").Code)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimit allows each client RATE_LIMIT_REQUESTS requests to the routes it
+// guards per RATE_LIMIT_WINDOW_SECONDS, answering 429 beyond that. scope keeps
+// the counters of differently limited routes apart. Nothing is limited while
+// RATE_LIMIT_REQUESTS is 0.
+func rateLimit(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Get()
+		limit := cfg.RateLimitRequests
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		window := time.Duration(cfg.RateLimitWindowSeconds) * time.Second
+		if window <= 0 {
+			window = time.Minute
+		}
+
+		res := ratelimit.Allow(scope+":"+clientIP(c), limit, window)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded, try again later"})
+			return
+		}
+		c.Next()
+	}
+}
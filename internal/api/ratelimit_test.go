@@ -0,0 +1,45 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	ratelimit.SetLimiter(ratelimit.NewLocal())
+	defer ratelimit.SetLimiter(ratelimit.NewLocal())
+	config.Get().RateLimitRequests = 2
+	config.Get().RateLimitWindowSeconds = 60
+
+	generate := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://limited.example.com/"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := generate("192.0.2.1:1234")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, generate("192.0.2.1:1234").Code)
+
+	w = generate("192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, generate("192.0.2.2:1234").Code, "other clients have their own limit")
+
+	config.Get().RateLimitRequests = 0
+	assert.Equal(t, http.StatusOK, generate("192.0.2.1:1234").Code, "0 disables the limit")
+}
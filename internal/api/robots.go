@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"prerender-url-shortener/internal/config"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRobotsTxt lets crawlers follow short links, which is what they are
+// prerendered for, while keeping them out of the API.
+const defaultRobotsTxt = `User-agent: *
+Disallow: /admin/
+Disallow: /generate
+Disallow: /links/
+Disallow: /status
+`
+
+// RobotsTxtHandler serves ROBOTS_TXT_FILE, or a default policy allowing only
+// short links when none is configured, pointing at the sitemap if enabled.
+func RobotsTxtHandler(c *gin.Context) {
+	body := []byte(defaultRobotsTxt)
+	if base, ok := sitemapBase(c); ok {
+		body = append(body, "Sitemap: "+base+"/sitemap.xml\n"...)
+	}
+	if path := config.Get().RobotsTxtFile; path != "" {
+		var err error
+		if body, err = os.ReadFile(path); err != nil {
+			log.Printf("Error reading ROBOTS_TXT_FILE %s: %v", path, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "robots.txt is unavailable"})
+			return
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", body)
+}
+
+// WellKnownHandler serves files from WELL_KNOWN_DIR under /.well-known/, such as
+// security.txt. Paths can't leave the directory, and directories aren't listed.
+func WellKnownHandler(c *gin.Context) {
+	dir := config.Get().WellKnownDir
+	name := strings.TrimPrefix(c.Param("path"), "/")
+	if dir == "" || name == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		log.Printf("Error opening WELL_KNOWN_DIR %s: %v", dir, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Well-known files are unavailable"})
+		return
+	}
+	defer root.Close()
+
+	file, err := root.Open(name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error opening well-known file %s: %v", name, err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRobotsTxtHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+		return w
+	}
+
+	w := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "Disallow: /admin/")
+
+	path := filepath.Join(t.TempDir(), "robots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("User-agent: *\nDisallow: /\n"), 0o644))
+	config.Get().RobotsTxtFile = path
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", get().Body.String())
+
+	config.Get().RobotsTxtFile = filepath.Join(t.TempDir(), "missing.txt")
+	assert.Equal(t, http.StatusInternalServerError, get().Code)
+}
+
+func TestWellKnownHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/security.txt").Code, "disabled without a directory")
+
+	base := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(base, "secret"), []byte("x"), 0o644))
+	dir := filepath.Join(base, "well-known")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "security.txt"), []byte("Contact: mailto:security@example.com\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o755))
+	config.Get().WellKnownDir = dir
+
+	w := get("/.well-known/security.txt")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Contact: mailto:security@example.com\n", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/missing.txt").Code)
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/nested").Code, "directories aren't listed")
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/").Code)
+	assert.Equal(t, http.StatusNotFound, get("/.well-known/..%2fsecret").Code, "paths can't leave the directory")
+}
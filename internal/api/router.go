@@ -1,27 +1,30 @@
 package api
 
 import (
+	"log"
+	"prerender-url-shortener/internal/config"
+	"strings"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRouter initializes and configures the Gin router.
 func SetupRouter() *gin.Engine {
-	r := gin.Default() // Logger and Recovery middleware included
+	r := newEngine()
 
-	// CORS middleware configuration
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	// You can customize other CORS options here if needed, for example:
-	// config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	// config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
-	r.Use(cors.New(config))
+	// CORS middleware configuration, none while CORS_ALLOWED_ORIGINS is empty
+	if corsHandler := corsMiddleware(config.Get().CORSAllowedOrigins); corsHandler != nil {
+		r.Use(corsHandler)
+	}
 
-	// Health check endpoint
+	// Health check endpoints
 	r.GET("/health", HealthCheckHandler)
+	r.GET("/ready", ReadinessHandler)
 
 	// Status endpoint with detailed information
-	r.GET("/status", StatusHandler)
+	r.GET("/status", managementAllowlist(), StatusHandler)
+	r.GET("/version", managementAllowlist(), VersionHandler)
 
 	// API v1 group (optional, but good practice)
 	// apiV1 := r.Group("/api/v1")
@@ -30,8 +33,124 @@ func SetupRouter() *gin.Engine {
 	// }
 
 	// Directly define routes for simplicity for now
-	r.POST("/generate", GenerateShortCodeHandler)
-	r.GET("/:shortCode", RedirectHandler)
+	r.POST("/generate", managementAllowlist(), rateLimit("generate"), tenantAuth(), GenerateShortCodeHandler)
+	r.GET("/quick", managementAllowlist(), rateLimit("generate"), quickAuth(), QuickLinkHandler)
+	r.GET("/quick/done", QuickDoneHandler)
+	r.GET("/:shortCode", scanGuard(), RedirectHandler)
+	r.GET("/og/:shortCode", scanGuard(), OpenGraphHandler)
+
+	// Crawler policy, served ahead of the short code route
+	r.GET("/robots.txt", RobotsTxtHandler)
+	r.GET("/sitemap.xml", SitemapHandler)
+	r.GET("/.well-known/*path", WellKnownHandler)
+
+	// Content search across all links, for admin users
+	r.GET("/links/search", managementAllowlist(), adminAuth(), SearchLinksHandler)
+
+	// Click stats of a link and their CSV export, for admin users
+	r.GET("/links/:shortCode/stats", managementAllowlist(), adminAuth(), LinkStatsHandler)
+	r.GET("/links/:shortCode/stats/export", managementAllowlist(), adminAuth(), LinkStatsExportHandler)
+
+	// Long-polling for the render of a link created with /generate
+	r.GET("/links/:shortCode/wait", managementAllowlist(), rateLimit("generate"), LinkWaitHandler)
+
+	// Admin sessions
+	r.POST("/admin/login", managementAllowlist(), rateLimit("login"), AdminLoginHandler)
+	r.POST("/admin/logout", managementAllowlist(), AdminLogoutHandler)
+
+	// Link management, for admin users
+	admin := r.Group("/admin", managementAllowlist(), adminAuth())
+	{
+		admin.GET("/links/:shortCode", GetLinkHandler)
+		admin.DELETE("/links/:shortCode", DeleteLinkHandler)
+		admin.POST("/links/:shortCode/restore", RestoreLinkHandler)
+		admin.POST("/links/:shortCode/disable", DisableLinkHandler)
+		admin.POST("/links/:shortCode/enable", EnableLinkHandler)
+		admin.POST("/links/:shortCode/rerender", RerenderLinkHandler)
+		admin.POST("/prewarm", PrewarmHandler)
+		admin.POST("/queue/pause", PauseQueueHandler)
+		admin.POST("/queue/resume", ResumeQueueHandler)
+		admin.GET("/links/:shortCode/versions", ListRenderVersionsHandler)
+		admin.GET("/links/:shortCode/crawls", LinkCrawlsHandler)
+		admin.POST("/links/:shortCode/versions/:versionID/rollback", RollbackRenderHandler)
+		admin.GET("/render-stats", RenderStatsHandler)
+		admin.GET("/analytics/top-links", AnalyticsTopLinksHandler)
+		admin.GET("/analytics/clicks", AnalyticsClicksHandler)
+		admin.GET("/analytics/bots", AnalyticsBotsHandler)
+		admin.GET("/analytics/renders", AnalyticsRendersHandler)
+		admin.GET("/analytics/export", AnalyticsExportHandler)
+		admin.GET("/analytics/stream", AnalyticsStreamHandler)
+		admin.GET("/analytics/purges", AnalyticsPurgesHandler)
+		admin.GET("/stale-links", StaleLinksHandler)
+		admin.GET("/tenants", TenantsHandler)
+		admin.POST("/config/reload", ReloadConfigHandler)
+		admin.GET("/flags", ListFlagsHandler)
+		admin.PUT("/flags/:name", SetFlagHandler)
+		admin.DELETE("/flags/:name", ClearFlagHandler)
+		admin.GET("/users", ListAdminUsersHandler)
+		admin.POST("/users", CreateAdminUserHandler)
+		admin.DELETE("/users/:username", DeleteAdminUserHandler)
+		admin.GET("/webhooks", ListWebhookSubscriptionsHandler)
+		admin.POST("/webhooks", CreateWebhookSubscriptionHandler)
+		admin.GET("/webhooks/:id", GetWebhookSubscriptionHandler)
+		admin.PUT("/webhooks/:id", UpdateWebhookSubscriptionHandler)
+		admin.DELETE("/webhooks/:id", DeleteWebhookSubscriptionHandler)
+		admin.GET("/webhooks/:id/deliveries", WebhookDeliveriesHandler)
+	}
+
+	return r
+}
 
+// SetupWorkerRouter serves the health, readiness, status and version endpoints of a replica in
+// worker mode, which renders links without serving them.
+func SetupWorkerRouter() *gin.Engine {
+	r := newEngine()
+	r.GET("/health", HealthCheckHandler)
+	r.GET("/ready", ReadinessHandler)
+	r.GET("/status", managementAllowlist(), StatusHandler)
+	r.GET("/version", managementAllowlist(), VersionHandler)
 	return r
 }
+
+// newEngine returns a Gin engine with the Logger and Recovery middleware that
+// only believes forwarded-for headers from TRUSTED_PROXIES when it is set.
+func newEngine() *gin.Engine {
+	r := gin.Default()
+	if proxies := config.Get().TrustedProxies; proxies != "" {
+		var list []string
+		for _, proxy := range strings.Split(proxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				list = append(list, proxy)
+			}
+		}
+		if err := r.SetTrustedProxies(list); err != nil {
+			log.Printf("Ignoring invalid TRUSTED_PROXIES: %v", err)
+		}
+	}
+	return r
+}
+
+// corsMiddleware allows cross-origin requests from the comma-separated origins,
+// from any origin for "*", or returns nil to allow none.
+func corsMiddleware(origins string) gin.HandlerFunc {
+	corsConfig := cors.DefaultConfig()
+	// You can customize other CORS options here if needed, for example:
+	// corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	// corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	for _, origin := range strings.Split(origins, ",") {
+		switch origin = strings.TrimSpace(origin); origin {
+		case "":
+		case "*":
+			corsConfig.AllowAllOrigins = true
+		default:
+			corsConfig.AllowOrigins = append(corsConfig.AllowOrigins, origin)
+		}
+	}
+	if !corsConfig.AllowAllOrigins && len(corsConfig.AllowOrigins) == 0 {
+		return nil
+	}
+	if corsConfig.AllowAllOrigins {
+		corsConfig.AllowOrigins = nil
+	}
+	return cors.New(corsConfig)
+}
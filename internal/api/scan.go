@@ -0,0 +1,88 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/ratelimit"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxScanTarpit bounds how long a blocked client's request is held, so a
+// misconfiguration can't tie up connections indefinitely.
+const maxScanTarpit = 30 * time.Second
+
+// scan detection stats accumulate since startup, for /status.
+var (
+	scanNotFound         atomic.Int64
+	scanClientsBlocked   atomic.Int64
+	scanRequestsRejected atomic.Int64
+)
+
+// scanGuard blunts short-code scanning: a client whose requests answer 404 more
+// than SCAN_NOT_FOUND_LIMIT times per SCAN_WINDOW_SECONDS is blocked for
+// SCAN_BLOCK_SECONDS. Requests from blocked clients are held for
+// SCAN_TARPIT_SECONDS, then answered 429. Nothing is tracked while
+// SCAN_NOT_FOUND_LIMIT is 0.
+func scanGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Get()
+		limit := cfg.ScanNotFoundLimit
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		ip := clientIP(c)
+		key := "scan:" + ip
+
+		if blocked := ratelimit.Blocked(key); blocked > 0 {
+			scanRequestsRejected.Add(1)
+			tarpit := min(time.Duration(cfg.ScanTarpitSeconds)*time.Second, maxScanTarpit)
+			if tarpit > 0 {
+				select {
+				case <-time.After(tarpit):
+				case <-c.Request.Context().Done():
+				}
+			}
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(blocked.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many unknown short codes requested, try again later"})
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() != http.StatusNotFound {
+			return
+		}
+		scanNotFound.Add(1)
+		window := time.Duration(cfg.ScanWindowSeconds) * time.Second
+		if window <= 0 {
+			window = time.Minute
+		}
+		if ratelimit.Allow(key, limit, window).Allowed {
+			return
+		}
+		blockFor := time.Duration(cfg.ScanBlockSeconds) * time.Second
+		if blockFor <= 0 {
+			blockFor = 10 * time.Minute
+		}
+		ratelimit.Block(key, blockFor)
+		scanClientsBlocked.Add(1)
+		log.Printf("Scan detection: Blocking %s for %s after more than %d unknown short codes in %s", ip, blockFor, limit, window)
+	}
+}
+
+// scanStatus returns what scan detection has seen since startup.
+func scanStatus() gin.H {
+	return gin.H{
+		"enabled":           config.Get().ScanNotFoundLimit > 0,
+		"not_found":         scanNotFound.Load(),
+		"clients_blocked":   scanClientsBlocked.Load(),
+		"requests_rejected": scanRequestsRejected.Load(),
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanGuard(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	ratelimit.SetLimiter(ratelimit.NewLocal())
+	defer ratelimit.SetLimiter(ratelimit.NewLocal())
+	config.Get().ScanNotFoundLimit = 3
+	config.Get().ScanWindowSeconds = 60
+	config.Get().ScanBlockSeconds = 600
+
+	get := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	blockedBefore := scanClientsBlocked.Load()
+	for _, code := range []string{"AAAA", "AAAB", "AAAC", "AAAD"} {
+		assert.Equal(t, http.StatusNotFound, get("/"+code, "198.51.100.9:1234").Code)
+	}
+	assert.Equal(t, blockedBefore+1, scanClientsBlocked.Load())
+
+	w := get("/AAAE", "198.51.100.9:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusNotFound, get("/AAAE", "198.51.100.10:1234").Code, "other clients aren't blocked")
+	assert.Equal(t, http.StatusOK, get("/health", "198.51.100.9:1234").Code, "only short codes are guarded")
+
+	config.Get().ScanNotFoundLimit = 0
+	assert.Equal(t, http.StatusNotFound, get("/AAAE", "198.51.100.9:1234").Code, "0 disables detection")
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/shortener"
+	"prerender-url-shortener/internal/tenant"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSitemapURLs is the most URLs a sitemap may list under the sitemaps.org
+// protocol, and so the largest SITEMAP_PAGE_SIZE.
+const maxSitemapURLs = 50000
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// sitemapBase returns the origin short URLs are listed under for the request:
+// SITEMAP_BASE_URL, with the request's host on a tenant's own host, which only
+// serves the tenant's links. ok is false while the sitemap is disabled.
+func sitemapBase(c *gin.Context) (base string, ok bool) {
+	base = strings.TrimSuffix(config.Get().SitemapBaseURL, "/")
+	if base == "" {
+		return "", false
+	}
+	if _, onTenantHost := tenant.FromHost(c.Request.Host); onTenantHost {
+		if u, err := url.Parse(base); err == nil {
+			u.Host = c.Request.Host
+			base = u.String()
+		}
+	}
+	return base, true
+}
+
+// SitemapHandler serves /sitemap.xml, listing the short URLs whose snapshots
+// are completed so search engines discover them. Past SITEMAP_PAGE_SIZE short
+// URLs it serves a sitemap index instead, pointing at /sitemap.xml?page=N for
+// each page. It answers 404 while SITEMAP_BASE_URL is empty.
+func SitemapHandler(c *gin.Context) {
+	base, ok := sitemapBase(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	hostTenant, onTenantHost := tenant.FromHost(c.Request.Host)
+	count, err := db.CountSitemapLinks(hostTenant, !onTenantHost)
+	if err != nil {
+		log.Printf("Error counting sitemap links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	pageSize := min(max(config.Get().SitemapPageSize, 1), maxSitemapURLs)
+	pages := max(int((count+int64(pageSize)-1)/int64(pageSize)), 1)
+
+	pageParam := c.Query("page")
+	if pageParam == "" && pages > 1 {
+		index := sitemapIndex{XMLNS: sitemapNamespace}
+		for page := 1; page <= pages; page++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: fmt.Sprintf("%s/sitemap.xml?page=%d", base, page)})
+		}
+		writeSitemap(c, index)
+		return
+	}
+	page := 1
+	if pageParam != "" {
+		if page, err = strconv.Atoi(pageParam); err != nil || page < 1 || page > pages {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+	}
+
+	links, err := db.ListSitemapLinks(hostTenant, !onTenantHost, (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Printf("Error listing sitemap links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	set := sitemapURLSet{XMLNS: sitemapNamespace, URLs: make([]sitemapURL, len(links))}
+	for i, link := range links {
+		set.URLs[i].Loc = base + "/" + shortener.SignCode(link.ShortCode)
+		if link.RenderedAt != nil {
+			set.URLs[i].LastMod = link.RenderedAt.UTC().Format(time.RFC3339)
+		}
+	}
+	writeSitemap(c, set)
+}
+
+func writeSitemap(c *gin.Context, sitemap interface{}) {
+	body, err := xml.Marshal(sitemap)
+	if err != nil {
+		log.Printf("Error encoding sitemap: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Sitemap is unavailable"})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
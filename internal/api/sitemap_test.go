@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSitemapHandler(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+
+	get := func(host, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, get("s.example.com", "/sitemap.xml").Code, "disabled without a base URL")
+
+	renderedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, l := range []struct{ code, tenant string }{{"MAP001", ""}, {"MAP002", "acme"}, {"MAP003", ""}} {
+		require.NoError(t, db.CreateLink(&db.Link{ShortCode: l.code, TenantID: l.tenant, OriginalURL: "https://map.com/" + l.code,
+			RenderStatus: db.RenderStatusCompleted, RenderedAt: &renderedAt}))
+	}
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "MAP004", OriginalURL: "https://map.com/MAP004", RenderStatus: db.RenderStatusPending}))
+	config.Get().SitemapBaseURL = "https://s.example.com/"
+	config.Get().SitemapPageSize = 10
+
+	w := get("s.example.com", "/sitemap.xml")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	var set sitemapURLSet
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &set))
+	require.Len(t, set.URLs, 3, "only completed snapshots")
+	assert.Equal(t, "https://s.example.com/MAP001", set.URLs[0].Loc)
+	assert.Equal(t, "2026-03-01T12:00:00Z", set.URLs[0].LastMod)
+
+	// Paginated behind an index
+	config.Get().SitemapPageSize = 2
+	var index sitemapIndex
+	require.NoError(t, xml.Unmarshal(get("s.example.com", "/sitemap.xml").Body.Bytes(), &index))
+	require.Len(t, index.Sitemaps, 2)
+	assert.Equal(t, "https://s.example.com/sitemap.xml?page=2", index.Sitemaps[1].Loc)
+	set = sitemapURLSet{}
+	require.NoError(t, xml.Unmarshal(get("s.example.com", "/sitemap.xml?page=2").Body.Bytes(), &set))
+	require.Len(t, set.URLs, 1)
+	assert.Equal(t, "https://s.example.com/MAP003", set.URLs[0].Loc)
+	assert.Equal(t, http.StatusNotFound, get("s.example.com", "/sitemap.xml?page=3").Code)
+	assert.Equal(t, http.StatusNotFound, get("s.example.com", "/sitemap.xml?page=x").Code)
+
+	// A tenant's host lists its own links, under that host
+	config.Get().Tenants = `{"acme": {"hosts": ["go.acme.com"]}}`
+	set = sitemapURLSet{}
+	require.NoError(t, xml.Unmarshal(get("go.acme.com", "/sitemap.xml").Body.Bytes(), &set))
+	require.Len(t, set.URLs, 1)
+	assert.Equal(t, "https://go.acme.com/MAP002", set.URLs[0].Loc)
+
+	assert.Contains(t, get("go.acme.com", "/robots.txt").Body.String(), "Sitemap: https://go.acme.com/sitemap.xml\n")
+}
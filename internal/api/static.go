@@ -0,0 +1,116 @@
+package api
+
+import (
+	"html"
+	"net/url"
+	"prerender-url-shortener/internal/db"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// snapshotURL returns the URL of the page a link's snapshot was rendered from.
+func snapshotURL(link *db.Link) string {
+	if link.FinalURL != "" {
+		return link.FinalURL
+	}
+	return link.OriginalURL
+}
+
+// staticSnapshot rewrites a snapshot for people viewing a link in static mode.
+// Scripts are removed, since the page is already rendered and a client-side
+// router would otherwise take over under the short URL, and a <base> pointing
+// at pageURL (or the page's own base, resolved against it) makes relative
+// stylesheets, images and links load from the original site. JSON-LD blocks
+// are data rather than code and are kept.
+func staticSnapshot(document, pageURL string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return document
+	}
+
+	var out strings.Builder
+	out.Grow(len(document) + len(pageURL) + 32)
+	insertAt := 0 // Where the <base> goes: after the doctype, <html> and <head>
+	inPreamble := true
+	skipScript := false
+	z := xhtml.NewTokenizer(strings.NewReader(document))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		raw := string(z.Raw())
+		name, hasAttr := z.TagName()
+		tag := string(name)
+
+		if skipScript {
+			if tt == xhtml.EndTagToken && tag == "script" {
+				skipScript = false
+			}
+			continue
+		}
+		switch tt {
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			switch tag {
+			case "html", "head":
+				out.WriteString(raw)
+				if inPreamble {
+					insertAt = out.Len()
+				}
+				continue
+			case "base":
+				// The page's own base is folded into the injected one
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					if string(key) == "href" {
+						if ref, err := base.Parse(string(val)); err == nil {
+							base = ref
+						}
+					}
+				}
+				continue
+			case "script":
+				if !isDataScript(z, hasAttr) {
+					skipScript = tt == xhtml.StartTagToken
+					continue
+				}
+			}
+			inPreamble = false
+		case xhtml.DoctypeToken:
+			out.WriteString(raw)
+			if inPreamble {
+				insertAt = out.Len()
+			}
+			continue
+		case xhtml.TextToken:
+			if strings.TrimSpace(raw) != "" {
+				inPreamble = false
+			}
+		case xhtml.EndTagToken:
+			inPreamble = false
+		}
+		out.WriteString(raw)
+	}
+
+	rewritten := out.String()
+	baseTag := `<base href="` + html.EscapeString(base.String()) + `">`
+	return rewritten[:insertAt] + baseTag + rewritten[insertAt:]
+}
+
+// isDataScript reports whether the script tag the tokenizer is on holds data,
+// like JSON-LD, rather than code.
+func isDataScript(z *xhtml.Tokenizer, hasAttr bool) bool {
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		if string(key) == "type" {
+			switch strings.ToLower(strings.TrimSpace(string(val))) {
+			case "application/ld+json", "application/json":
+				return true
+			}
+		}
+	}
+	return false
+}
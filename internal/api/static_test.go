@@ -0,0 +1,40 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		pageURL  string
+		expected string
+	}{
+		{
+			name:     "base goes after head",
+			document: `<html><head><title>x</title></head></html>`,
+			pageURL:  "https://example.com/a/b",
+			expected: `<html><head><base href="https://example.com/a/b"><title>x</title></head></html>`,
+		},
+		{
+			name:     "page base is resolved against the page URL",
+			document: `<html><head><base href="/assets/"><link rel="stylesheet" href="s.css"></head></html>`,
+			pageURL:  "https://example.com/a/b",
+			expected: `<html><head><base href="https://example.com/assets/"><link rel="stylesheet" href="s.css"></head></html>`,
+		},
+		{
+			name:     "fragment without head",
+			document: `<p>hi</p><script>alert(1)</script>`,
+			pageURL:  "https://example.com/?a=1&b=2",
+			expected: `<base href="https://example.com/?a=1&amp;b=2"><p>hi</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, staticSnapshot(tt.document, tt.pageURL))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/db"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits for the click stats of a link.
+const (
+	defaultStatsDays  = 30
+	maxStatsDays      = 366
+	defaultStatsLimit = 10
+	maxStatsLimit     = 100
+)
+
+// LinkStatsHandler sums up the clicks on a link over the last days UTC days,
+// today included, broken down by referrer host, device class, browser,
+// platform, country and crawler. Each breakdown lists its top limit values.
+func LinkStatsHandler(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	days, ok := queryInt(c, "days", defaultStatsDays, maxStatsDays)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultStatsLimit, maxStatsLimit)
+	if !ok {
+		return
+	}
+	if _, err := db.GetLinkByShortCodeIncludingDeleted(shortCode); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Short code not found"})
+			return
+		}
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+	stats, err := db.GetLinkClickStats(shortCode, since, limit)
+	if err != nil {
+		log.Printf("Error summing up clicks of %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"short_code": shortCode,
+		"since":      since.Format(time.DateOnly),
+		"clicks":     stats.Clicks,
+		"bot_clicks": stats.BotClicks,
+		"breakdowns": stats.Breakdowns,
+	})
+}
+
+// queryInt reads an optional positive query parameter of at most max, which is
+// def when absent. On a bad value it responds with 400 and returns false.
+func queryInt(c *gin.Context, name string, def, max int) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return def, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 || value > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be between 1 and %d", name, max)})
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/tenant"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantKey is the gin context key holding the tenant resolved by tenantAuth.
+const tenantKey = "tenant"
+
+// tenantAuth resolves the tenant creating links: the owner of the X-API-Key
+// header if one is sent, otherwise the tenant serving the request's host, and
+// the default tenant if neither matches. An unknown API key is rejected.
+func tenantAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := tenant.Default
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			var ok bool
+			if id, ok = tenant.FromAPIKey(key); !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+		} else if hostTenant, ok := tenant.FromHost(c.Request.Host); ok {
+			id = hostTenant
+		}
+		c.Set(tenantKey, id)
+		c.Next()
+	}
+}
+
+// tenantID returns the tenant resolved for the request by tenantAuth.
+func tenantID(c *gin.Context) string {
+	return c.GetString(tenantKey)
+}
+
+// servesLink reports whether a short link may be followed on the request's host.
+// Short codes are unique across tenants, so every link resolves on hosts not
+// assigned to a tenant, while a tenant's own hosts only serve its links.
+func servesLink(c *gin.Context, link *db.Link) bool {
+	hostTenant, ok := tenant.FromHost(c.Request.Host)
+	return !ok || link.TenantID == hostTenant
+}
+
+// TenantsHandler reports the usage of every tenant, including configured tenants
+// that have no links yet.
+func TenantsHandler(c *gin.Context) {
+	usage, err := db.GetTenantUsage()
+	if err != nil {
+		log.Printf("Error computing tenant usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	seen := make(map[string]bool, len(usage))
+	for _, u := range usage {
+		seen[u.TenantID] = true
+	}
+	for _, id := range tenant.IDs() {
+		if !seen[id] {
+			usage = append(usage, db.TenantUsage{TenantID: id})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].TenantID < usage[j].TenantID })
+	c.JSON(http.StatusOK, gin.H{"tenants": usage})
+}
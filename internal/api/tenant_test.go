@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantScoping(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+	config.Get().Tenants = `{"acme": {"api_keys": ["acme-key"], "hosts": ["go.acme.com"]}, "beta": {"api_keys": ["beta-key"]}}`
+
+	generate := func(host, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/generate", bytes.NewBufferString(`{"url": "https://shared.com"}`))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	shortCode := func(w *httptest.ResponseRecorder) string {
+		var resp GenerateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.ShortCode
+	}
+
+	w := generate("short.example.com", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	defaultCode := shortCode(w)
+	w = generate("short.example.com", "acme-key")
+	require.Equal(t, http.StatusCreated, w.Code, "each tenant gets its own link for a URL")
+	acmeCode := shortCode(w)
+	assert.NotEqual(t, defaultCode, acmeCode)
+	w = generate("go.acme.com:443", "")
+	require.Equal(t, http.StatusOK, w.Code, "the tenant's host resolves to its existing link")
+	assert.Equal(t, acmeCode, shortCode(w))
+	assert.Equal(t, http.StatusUnauthorized, generate("short.example.com", "wrong-key").Code)
+
+	link, err := db.GetLinkByShortCode(acmeCode)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", link.TenantID)
+
+	redirect := func(host, code string) int {
+		req := httptest.NewRequest("GET", "/"+code, nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusFound, redirect("go.acme.com", acmeCode))
+	assert.Equal(t, http.StatusNotFound, redirect("go.acme.com", defaultCode), "a tenant's host only serves its links")
+	assert.Equal(t, http.StatusFound, redirect("short.example.com", acmeCode))
+	require.NoError(t, db.DeleteLink(defaultCode))
+	assert.Equal(t, http.StatusNotFound, redirect("go.acme.com", defaultCode))
+	assert.Equal(t, http.StatusGone, redirect("short.example.com", defaultCode))
+
+	req := httptest.NewRequest("GET", "/admin/tenants", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		Tenants []db.TenantUsage `json:"tenants"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Tenants, 2)
+	assert.Equal(t, "acme", report.Tenants[0].TenantID)
+	assert.Equal(t, int64(1), report.Tenants[0].Links)
+	assert.Equal(t, db.TenantUsage{TenantID: "beta"}, report.Tenants[1], "configured tenants without links are listed")
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/renderer"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLinkWaitSeconds is how long GET /links/:shortCode/wait waits without ?timeout=.
+const defaultLinkWaitSeconds = 30
+
+// LinkWaitHandler long-polls a link's render: it answers like /generate once
+// the render is completed or failed, or with the current status after ?timeout=
+// seconds, capped at GENERATE_MAX_WAIT_SECONDS. Renders queued on this replica
+// are waited for with the render queue; renders requested through the database
+// or running on another replica are checked every RENDER_POLL_INTERVAL_SECONDS.
+// Waiting stops when the client disconnects.
+func LinkWaitHandler(c *gin.Context) {
+	cfg := config.Get()
+	limit := maxRenderWaitSeconds(cfg)
+	timeout, ok := queryInt(c, "timeout", min(defaultLinkWaitSeconds, limit), limit)
+	if !ok {
+		return
+	}
+	link, ok := servedLink(c, c.Param("shortCode"))
+	if !ok {
+		return
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	interval := time.Duration(max(cfg.RenderPollIntervalSeconds, 1)) * time.Second
+	for !renderFinished(link) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		if renderer.GlobalRenderQueue.IsInProgress(link.ShortCode) {
+			renderer.GlobalRenderQueue.WaitForRenderContext(c.Request.Context(), link.ShortCode, remaining)
+		} else {
+			select {
+			case <-time.After(min(interval, remaining)):
+			case <-c.Request.Context().Done():
+			}
+		}
+		if c.Request.Context().Err() != nil {
+			return // The client is gone
+		}
+
+		updated, err := db.GetLinkByShortCode(link.ShortCode)
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusGone, gin.H{"error": "Short code has been deleted"})
+			return
+		} else if err != nil {
+			log.Printf("Error reloading link %s while waiting for its render: %v", link.ShortCode, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		link = updated
+	}
+	c.JSON(http.StatusOK, newGenerateResponse(link))
+}
+
+// renderFinished reports whether a link's render reached a terminal state.
+func renderFinished(link *db.Link) bool {
+	return link.RenderStatus == db.RenderStatusCompleted || link.RenderStatus == db.RenderStatusFailed
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/ratelimit"
+	"prerender-url-shortener/internal/renderer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkWait(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().RenderPollIntervalSeconds = 1
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "DONE1", OriginalURL: "https://done.example.com", RenderStatus: db.RenderStatusCompleted}))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "SOON1", OriginalURL: "https://soon.example.com", RenderStatus: db.RenderStatusPending}))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "SLOW1", OriginalURL: "https://slow.example.com", RenderStatus: db.RenderStatusPending}))
+
+	wait := func(path string) (*httptest.ResponseRecorder, GenerateResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var resp GenerateResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	w, resp := wait("/links/DONE1/wait")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, db.RenderStatusCompleted, resp.RenderStatus, "finished renders are answered right away")
+
+	w, _ = wait("/links/NOPE/wait")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w, _ = wait("/links/DONE1/wait?timeout=0")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = wait("/links/DONE1/wait?timeout=31")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "capped at RENDER_TIMEOUT_SECONDS")
+
+	// A render finished elsewhere is noticed by checking the database
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		db.DB.Model(&db.Link{}).Where("short_code = ?", "SOON1").Update("render_status", db.RenderStatusCompleted)
+	}()
+	start := time.Now()
+	w, resp = wait("/links/SOON1/wait?timeout=10")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, db.RenderStatusCompleted, resp.RenderStatus)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// A render queued here that doesn't finish in time is answered as it stands
+	require.True(t, renderer.GlobalRenderQueue.Pause())
+	renderer.GlobalRenderQueue.QueueRender("SLOW1", "https://slow.example.com")
+	start = time.Now()
+	w, resp = wait("/links/SLOW1/wait?timeout=1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, db.RenderStatusPending, resp.RenderStatus)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// A client that disconnects doesn't keep the handler waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/links/SLOW1/wait?timeout=10", nil).WithContext(ctx))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Waiting counts against the /generate rate limit
+	ratelimit.SetLimiter(ratelimit.NewLocal())
+	defer ratelimit.SetLimiter(ratelimit.NewLocal())
+	config.Get().RateLimitRequests = 1
+	w, _ = wait("/links/DONE1/wait")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w, _ = wait("/links/DONE1/wait")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
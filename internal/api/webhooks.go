@@ -0,0 +1,264 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/webhook"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults and bounds of a webhook subscription's retry policy.
+const (
+	defaultWebhookMaxAttempts    = 5
+	maxWebhookMaxAttempts        = 10
+	defaultWebhookBackoffSeconds = 30
+	maxWebhookBackoffSeconds     = 3600
+	defaultWebhookDeliveryLimit  = 50
+	maxWebhookDeliveryLimit      = 500
+)
+
+// WebhookSubscriptionRequest is the body of POST /admin/webhooks and
+// PUT /admin/webhooks/:id. Omitted event types subscribe to every event, and an
+// omitted secret is generated on creation and kept on update.
+type WebhookSubscriptionRequest struct {
+	URL            string   `json:"url" binding:"required,max=2048"`
+	EventTypes     []string `json:"event_types"`
+	Secret         string   `json:"secret" binding:"omitempty,min=16,max=128"`
+	MaxAttempts    *int     `json:"max_attempts"`
+	BackoffSeconds *int     `json:"backoff_seconds"`
+	Enabled        *bool    `json:"enabled"`
+}
+
+// webhookSubscriptionResponse describes a subscription. The secret is only
+// included when it is set, by creating the subscription or replacing it.
+type webhookSubscriptionResponse struct {
+	db.WebhookSubscription
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+func newWebhookSubscriptionResponse(sub *db.WebhookSubscription, withSecret bool) webhookSubscriptionResponse {
+	resp := webhookSubscriptionResponse{WebhookSubscription: *sub, EventTypes: sub.Events()}
+	if resp.EventTypes == nil {
+		resp.EventTypes = []string{}
+	}
+	if withSecret {
+		resp.Secret = sub.Secret
+	}
+	return resp
+}
+
+// apply validates the request and sets the subscription's fields from it.
+func (req *WebhookSubscriptionRequest) apply(sub *db.WebhookSubscription) error {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	for _, eventType := range req.EventTypes {
+		if !knownEventType(eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	sub.MaxAttempts, sub.BackoffSeconds, sub.Enabled = defaultWebhookMaxAttempts, defaultWebhookBackoffSeconds, true
+	if req.MaxAttempts != nil {
+		if *req.MaxAttempts < 1 || *req.MaxAttempts > maxWebhookMaxAttempts {
+			return fmt.Errorf("max_attempts must be between 1 and %d", maxWebhookMaxAttempts)
+		}
+		sub.MaxAttempts = *req.MaxAttempts
+	}
+	if req.BackoffSeconds != nil {
+		if *req.BackoffSeconds < 1 || *req.BackoffSeconds > maxWebhookBackoffSeconds {
+			return fmt.Errorf("backoff_seconds must be between 1 and %d", maxWebhookBackoffSeconds)
+		}
+		sub.BackoffSeconds = *req.BackoffSeconds
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+	sub.URL, sub.EventTypes = req.URL, strings.Join(req.EventTypes, ",")
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	return nil
+}
+
+func knownEventType(eventType string) bool {
+	for _, known := range webhook.EventTypes {
+		if string(known) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookSecret returns a random secret for signing a subscription's deliveries.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// webhookSubscription loads the subscription in the :id parameter, answering
+// the request itself if it can't.
+func webhookSubscription(c *gin.Context) (*db.WebhookSubscription, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return nil, false
+	}
+	sub, err := db.GetWebhookSubscription(uint(id))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+			return nil, false
+		}
+		log.Printf("Error loading webhook subscription %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return sub, true
+}
+
+// ListWebhookSubscriptionsHandler lists the webhook subscriptions, without
+// their secrets.
+func ListWebhookSubscriptionsHandler(c *gin.Context) {
+	subs, err := db.ListWebhookSubscriptions()
+	if err != nil {
+		log.Printf("Error listing webhook subscriptions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	resp := make([]webhookSubscriptionResponse, len(subs))
+	for i := range subs {
+		resp[i] = newWebhookSubscriptionResponse(&subs[i], false)
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": resp})
+}
+
+// CreateWebhookSubscriptionHandler subscribes a URL to render events. The
+// response holds the secret deliveries are signed with, which isn't shown again.
+func CreateWebhookSubscriptionHandler(c *gin.Context) {
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	var sub db.WebhookSubscription
+	if err := req.apply(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if sub.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			log.Printf("Error generating a webhook secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate a secret"})
+			return
+		}
+		sub.Secret = secret
+	}
+	if err := db.CreateWebhookSubscription(&sub); err != nil {
+		log.Printf("Error creating webhook subscription for %s: %v", sub.URL, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: %s subscribed %s to webhooks (subscription %d)", c.GetString(adminUserKey), sub.URL, sub.ID)
+	c.JSON(http.StatusCreated, newWebhookSubscriptionResponse(&sub, true))
+}
+
+// GetWebhookSubscriptionHandler describes a webhook subscription, without its secret.
+func GetWebhookSubscriptionHandler(c *gin.Context) {
+	sub, ok := webhookSubscription(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookSubscriptionResponse(sub, false))
+}
+
+// UpdateWebhookSubscriptionHandler replaces a webhook subscription's settings.
+// A secret sent replaces the current one and is included in the response.
+func UpdateWebhookSubscriptionHandler(c *gin.Context) {
+	sub, ok := webhookSubscription(c)
+	if !ok {
+		return
+	}
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if err := req.apply(sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.UpdateWebhookSubscription(sub); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+			return
+		}
+		log.Printf("Error updating webhook subscription %d: %v", sub.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	sub.UpdatedAt = time.Now()
+	log.Printf("Admin: %s updated webhook subscription %d", c.GetString(adminUserKey), sub.ID)
+	c.JSON(http.StatusOK, newWebhookSubscriptionResponse(sub, req.Secret != ""))
+}
+
+// DeleteWebhookSubscriptionHandler removes a webhook subscription and its
+// delivery log. Retries already waiting are still attempted.
+func DeleteWebhookSubscriptionHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return
+	}
+	if err := db.DeleteWebhookSubscription(uint(id)); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+			return
+		}
+		log.Printf("Error deleting webhook subscription %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Admin: %s deleted webhook subscription %d", c.GetString(adminUserKey), id)
+	c.JSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
+
+// WebhookDeliveriesHandler lists a subscription's latest delivery attempts,
+// newest first, up to ?limit=.
+func WebhookDeliveriesHandler(c *gin.Context) {
+	sub, ok := webhookSubscription(c)
+	if !ok {
+		return
+	}
+	limit := defaultWebhookDeliveryLimit
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxWebhookDeliveryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveryLimit)})
+			return
+		}
+	}
+	deliveries, err := db.ListWebhookDeliveries(sub.ID, limit)
+	if err != nil {
+		log.Printf("Error listing deliveries of webhook subscription %d: %v", sub.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": sub.ID, "deliveries": deliveries})
+}
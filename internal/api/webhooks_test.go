@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSubscriptionHandlers(t *testing.T) {
+	router := setupTestAPI(t)
+	defer teardownTestAPI(t)
+	config.Get().AdminToken = "secret"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// Created with a generated secret, shown once, and the default retry policy
+	w := do("POST", "/admin/webhooks", `{"url": "https://hooks.example.com/renders", "event_types": ["render.failed"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	created := decode(w)
+	assert.True(t, strings.HasPrefix(created["secret"].(string), "whsec_"))
+	assert.Equal(t, []interface{}{"render.failed"}, created["event_types"])
+	assert.Equal(t, float64(5), created["max_attempts"])
+	assert.Equal(t, float64(30), created["backoff_seconds"])
+	assert.Equal(t, true, created["enabled"])
+	path := fmt.Sprintf("/admin/webhooks/%v", created["id"])
+
+	for _, body := range []string{
+		`{"url": "ftp://hooks.example.com"}`,
+		`{"url": "https://hooks.example.com", "event_types": ["link.created"]}`,
+		`{"url": "https://hooks.example.com", "max_attempts": 0}`,
+		`{"url": "https://hooks.example.com", "backoff_seconds": 7200}`,
+		`{"url": "https://hooks.example.com", "secret": "short"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/webhooks", body).Code, body)
+	}
+
+	// Secrets aren't listed
+	w = do("GET", "/admin/webhooks", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://hooks.example.com/renders")
+	assert.NotContains(t, w.Body.String(), "whsec_")
+	assert.NotContains(t, do("GET", path, "").Body.String(), "whsec_")
+
+	// Updating keeps the secret unless one is sent
+	w = do("PUT", path, `{"url": "https://hooks.example.com/v2", "max_attempts": 2, "backoff_seconds": 5, "enabled": false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	updated := decode(w)
+	assert.Equal(t, []interface{}{}, updated["event_types"], "every event type")
+	assert.Equal(t, false, updated["enabled"])
+	assert.Nil(t, updated["secret"])
+	sub, err := db.GetWebhookSubscription(uint(created["id"].(float64)))
+	require.NoError(t, err)
+	assert.Equal(t, created["secret"], sub.Secret)
+	assert.Equal(t, "https://hooks.example.com/v2", sub.URL)
+	assert.Equal(t, 2, sub.MaxAttempts)
+
+	require.NoError(t, db.RecordWebhookDelivery(&db.WebhookDelivery{SubscriptionID: sub.ID, EventType: "render.failed", ShortCode: "HOOK01", Attempt: 1, StatusCode: 502}))
+	w = do("GET", path+"/deliveries", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"short_code":"HOOK01"`)
+	assert.Equal(t, http.StatusBadRequest, do("GET", path+"/deliveries?limit=0", "").Code)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("PUT", path, `{"url": "https://hooks.example.com"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/admin/webhooks/abc", "").Code)
+}
@@ -0,0 +1,155 @@
+// Package botdetect tells crawlers and link preview fetchers, which are served
+// snapshots, from people, who are redirected. A user agent parser recognizes
+// self-declared bots, and regular expressions catch the ones it misses: a
+// built-in list, extended by BOT_PATTERNS_FILE.
+package botdetect
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"prerender-url-shortener/internal/config"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mssola/useragent"
+)
+
+//go:embed patterns_default.txt
+var defaultPatternsText string
+
+// defaultPatterns matches the user agents in patterns_default.txt.
+var defaultPatterns = mustParsePatterns(defaultPatternsText)
+
+func mustParsePatterns(text string) *regexp.Regexp {
+	re, _, err := parsePatterns(strings.NewReader(text))
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// parsePatterns reads one regular expression per line, skipping blank lines and
+// "#" comments, and combines them into one case-insensitive expression. It
+// returns nil if there are none.
+func parsePatterns(r io.Reader) (*regexp.Regexp, int, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		patterns = append(patterns, "(?:"+pattern+")")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(patterns) == 0 {
+		return nil, 0, nil
+	}
+	re, err := regexp.Compile("(?i)" + strings.Join(patterns, "|"))
+	return re, len(patterns), err
+}
+
+var (
+	customMutex  sync.Mutex
+	customSource string
+	customLoaded bool
+	customCached *regexp.Regexp
+)
+
+// customPatterns returns the expression combining BOT_PATTERNS_FILE, or nil if
+// none is configured. The parsed file is cached until the setting changes. A
+// file that can't be read or parsed is logged and ignored.
+func customPatterns() *regexp.Regexp {
+	customMutex.Lock()
+	defer customMutex.Unlock()
+
+	source := config.Get().BotPatternsFile
+	if customLoaded && customSource == source {
+		return customCached
+	}
+	customSource, customLoaded, customCached = source, true, nil
+	if source == "" {
+		return nil
+	}
+	re, count, err := LoadPatterns(source)
+	if err != nil {
+		log.Printf("Bot detection: Ignoring %v", err)
+		return nil
+	}
+	log.Printf("Bot detection: Loaded %d patterns from %s", count, source)
+	customCached = re
+	return re
+}
+
+// LoadPatterns parses the pattern file at path, for checking it at startup as
+// well as for use. It returns how many patterns it holds.
+func LoadPatterns(path string) (*regexp.Regexp, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bot patterns file %s: %w", path, err)
+	}
+	defer file.Close()
+	re, count, err := parsePatterns(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bot patterns file %s: %w", path, err)
+	}
+	return re, count, nil
+}
+
+// IsBot reports whether userAgent belongs to a crawler or link preview fetcher.
+// An empty user agent isn't taken for a bot.
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return false
+	}
+	if defaultPatterns.MatchString(userAgent) || useragent.New(userAgent).Bot() {
+		return true
+	}
+	custom := customPatterns()
+	return custom != nil && custom.MatchString(userAgent)
+}
+
+// maxNameLength caps the bot names Name returns.
+const maxNameLength = 64
+
+// Name returns the name of the crawler behind userAgent, such as "Googlebot" or
+// "facebookexternalhit": the first product token that bot detection matches,
+// or the user agent parser's browser name for a self-declared bot. It returns
+// "" if no name can be told.
+func Name(userAgent string) string {
+	custom := customPatterns()
+	for _, token := range strings.FieldsFunc(userAgent, func(r rune) bool {
+		return r == ' ' || r == ';' || r == '(' || r == ')' || r == ','
+	}) {
+		name, _, _ := strings.Cut(token, "/")
+		if name == "" || strings.ContainsAny(name, ":+@.") {
+			continue // URLs and e-mail addresses
+		}
+		if defaultPatterns.MatchString(token) || (custom != nil && custom.MatchString(token)) {
+			return truncateName(name)
+		}
+	}
+	if ua := useragent.New(userAgent); ua.Bot() {
+		if name, _ := ua.Browser(); name != "" && !strings.ContainsAny(name, ":/") {
+			return truncateName(name)
+		}
+	}
+	return ""
+}
+
+func truncateName(name string) string {
+	if len(name) > maxNameLength {
+		return name[:maxNameLength]
+	}
+	return name
+}
@@ -0,0 +1,95 @@
+package botdetect
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBot(t *testing.T) {
+	config.Set(&config.Config{})
+
+	bots := []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		"Twitterbot/1.0",
+		"LinkedInBot/1.0 (compatible; Mozilla/5.0; Apache-HttpClient +http://www.linkedin.com)",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+		"WhatsApp/2.23.20.0",
+		"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)",
+		"TelegramBot (like TwitterBot)",
+		"Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5",
+		"Embedly +support@embed.ly",
+		"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)",
+		"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
+		"Mozilla/5.0 (compatible; Applebot/0.1; +http://www.apple.com/go/applebot)",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Chrome-Lighthouse",
+		"Mozilla/5.0 (compatible; Qwantify/2.4w; +https://www.qwant.com/)/2.4w",
+	}
+	for _, ua := range bots {
+		assert.True(t, IsBot(ua), ua)
+	}
+
+	people := []string{
+		"",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [Pinterest/iOS]",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36 Telegram-Android/10.5.0",
+	}
+	for _, ua := range people {
+		assert.False(t, IsBot(ua), ua)
+	}
+}
+
+func TestCustomPatterns(t *testing.T) {
+	config.Set(&config.Config{})
+	ua := "InternalLinkChecker/3.1"
+	assert.False(t, IsBot(ua))
+
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# Our own tools\n^internallinkchecker/\n\nuptime-?probe\n"), 0o644))
+	config.Get().BotPatternsFile = path
+	assert.True(t, IsBot(ua), "patterns are case-insensitive")
+	assert.True(t, IsBot("Uptime-Probe 1.0"))
+
+	config.Get().BotPatternsFile = ""
+	assert.False(t, IsBot(ua))
+
+	require.NoError(t, os.WriteFile(path, []byte("fine\n(unclosed\n"), 0o644))
+	_, _, err := LoadPatterns(path)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "line 2"), err.Error())
+	config.Get().BotPatternsFile = path
+	assert.False(t, IsBot(ua), "an invalid file is ignored")
+}
+
+func TestName(t *testing.T) {
+	config.Set(&config.Config{})
+	names := map[string]string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                                                                         "Googlebot",
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/116.0.1938.76 Safari/537.36": "bingbot",
+		"Twitterbot/1.0": "Twitterbot",
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)": "facebookexternalhit",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)":                "Slackbot-LinkExpanding",
+		"WhatsApp/2.23.20.0": "WhatsApp",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0": "",
+	}
+	for ua, name := range names {
+		assert.Equal(t, name, Name(ua), ua)
+	}
+
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("^internallinkchecker/\n"), 0o644))
+	config.Get().BotPatternsFile = path
+	assert.Equal(t, "InternalLinkChecker", Name("InternalLinkChecker/3.1"))
+}
@@ -0,0 +1,185 @@
+package botdetect
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+// Brand is an entry of a Sec-CH-UA brand list, such as "Google Chrome" version
+// "124".
+type Brand struct {
+	Name    string
+	Version string
+}
+
+// ClientHints holds the low-entropy User-Agent Client Hints that Chromium
+// browsers send with every request over HTTPS. They carry what the reduced
+// User-Agent string no longer tells: the real browser brand and platform.
+type ClientHints struct {
+	Brands   []Brand // Sec-CH-UA, without GREASE entries
+	Mobile   bool    // Sec-CH-UA-Mobile
+	Platform string  // Sec-CH-UA-Platform, e.g. "Windows" or "macOS"
+}
+
+// ParseClientHints reads the client hints of a request. Clients that don't
+// send any get the zero value.
+func ParseClientHints(header http.Header) ClientHints {
+	return ClientHints{
+		Brands:   ParseBrands(header.Get("Sec-CH-UA")),
+		Mobile:   strings.TrimSpace(header.Get("Sec-CH-UA-Mobile")) == "?1",
+		Platform: unquote(strings.TrimSpace(header.Get("Sec-CH-UA-Platform"))),
+	}
+}
+
+// ParseBrands parses a Sec-CH-UA brand list, such as
+// `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`. The
+// made-up GREASE brands browsers add to keep servers from depending on the
+// list's exact shape are left out.
+func ParseBrands(header string) []Brand {
+	var brands []Brand
+	for _, item := range splitOutsideQuotes(header, ',') {
+		params := splitOutsideQuotes(item, ';')
+		brand := Brand{Name: unquote(strings.TrimSpace(params[0]))}
+		for _, param := range params[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "v" {
+				brand.Version = unquote(value)
+			}
+		}
+		if brand.Name == "" || isGreaseBrand(brand.Name) {
+			continue
+		}
+		brands = append(brands, brand)
+	}
+	return brands
+}
+
+// isGreaseBrand reports whether name is a GREASE brand like "Not)A;Brand".
+func isGreaseBrand(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "not") && strings.Contains(name, "brand")
+}
+
+// splitOutsideQuotes splits s at every sep that isn't inside a quoted string.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote strips the quotes off a structured header string.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(strings.ReplaceAll(s[1:len(s)-1], `\"`, `"`), `\\`, `\`)
+	}
+	return s
+}
+
+// IsBotWithHints reports whether a request with userAgent and hints comes from
+// a crawler or link preview fetcher. On top of IsBot, the brands of the client
+// hints are matched against the bot patterns, so automation that declares
+// itself there, e.g. as HeadlessChrome with a pattern for it in
+// BOT_PATTERNS_FILE, is caught even behind an ordinary User-Agent string.
+func IsBotWithHints(userAgent string, hints ClientHints) bool {
+	if IsBot(userAgent) {
+		return true
+	}
+	custom := customPatterns()
+	for _, brand := range hints.Brands {
+		if defaultPatterns.MatchString(brand.Name) || (custom != nil && custom.MatchString(brand.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// brandNames maps client hint brands to the names the User-Agent parser uses,
+// so clicks group the same whichever the browser sent.
+var brandNames = map[string]string{
+	"Google Chrome":  "Chrome",
+	"Microsoft Edge": "Edge",
+}
+
+// platformNames maps the User-Agent parser's operating systems to the names
+// Sec-CH-UA-Platform uses.
+var platformNames = map[string]string{
+	"Mac OS X":  "macOS",
+	"CrOS":      "Chrome OS",
+	"iPhone OS": "iOS",
+}
+
+// BrowserInfo returns the browser and platform of a client for analytics,
+// e.g. "Chrome" and "Windows". Client hints are preferred, since browsers
+// that send them freeze the details of their User-Agent string; the string is
+// parsed otherwise. Either is empty when unknown.
+func BrowserInfo(userAgent string, hints ClientHints) (browser, platform string) {
+	// Chromium is the engine, which Chromium-based browsers list next to their
+	// own brand
+	for _, brand := range hints.Brands {
+		if brand.Name != "Chromium" {
+			browser = brand.Name
+			break
+		}
+		browser = brand.Name
+	}
+	if name, ok := brandNames[browser]; ok {
+		browser = name
+	}
+	platform = hints.Platform
+	if userAgent != "" && (browser == "" || platform == "") {
+		ua := useragent.New(userAgent)
+		if browser == "" {
+			browser, _ = ua.Browser()
+		}
+		if platform == "" {
+			platform, _, _ = strings.Cut(ua.OSInfo().Name, " x86") // "CrOS x86_64"
+			if name, ok := platformNames[platform]; ok {
+				platform = name
+			}
+		}
+	}
+	return truncateName(browser), truncateName(platform)
+}
+
+// Device classes of people's clients.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// DeviceClass returns whether a person's client is a desktop, mobile or tablet
+// device, or "" without a user agent. Sec-CH-UA-Mobile is trusted when sent;
+// Android tablets are told apart by their User-Agent string leaving out
+// "Mobile". iPads asking for desktop sites pass for desktops.
+func DeviceClass(userAgent string, hints ClientHints) string {
+	if hints.Mobile {
+		return DeviceMobile
+	}
+	if userAgent == "" {
+		return ""
+	}
+	lower := strings.ToLower(userAgent)
+	if strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") ||
+		(strings.Contains(lower, "android") && !strings.Contains(lower, "mobile")) {
+		return DeviceTablet
+	}
+	if useragent.New(userAgent).Mobile() {
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
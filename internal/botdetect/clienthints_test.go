@@ -0,0 +1,85 @@
+package botdetect
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClientHints(t *testing.T) {
+	header := http.Header{}
+	header.Set("Sec-CH-UA", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`)
+	header.Set("Sec-CH-UA-Mobile", "?1")
+	header.Set("Sec-CH-UA-Platform", `"Android"`)
+	hints := ParseClientHints(header)
+	assert.Equal(t, []Brand{{"Chromium", "124"}, {"Google Chrome", "124"}}, hints.Brands)
+	assert.True(t, hints.Mobile)
+	assert.Equal(t, "Android", hints.Platform)
+
+	assert.Equal(t, []Brand{{"Microsoft Edge", "120"}}, ParseBrands(`"Not)A;Brand";v="8", "Microsoft Edge";v="120"`))
+	assert.Empty(t, ParseBrands(""))
+	assert.Equal(t, ClientHints{}, ParseClientHints(http.Header{}))
+}
+
+func TestIsBotWithHints(t *testing.T) {
+	config.Set(&config.Config{})
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	headless := ClientHints{Brands: []Brand{{"HeadlessChrome", "124"}, {"Chromium", "124"}}}
+	assert.False(t, IsBotWithHints(chrome, ClientHints{Brands: []Brand{{"Google Chrome", "124"}}}))
+	assert.True(t, IsBotWithHints("Googlebot/2.1", ClientHints{}))
+
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("headless\n"), 0o644))
+	assert.False(t, IsBotWithHints(chrome, headless))
+	config.Get().BotPatternsFile = path
+	assert.True(t, IsBotWithHints(chrome, headless))
+}
+
+func TestBrowserInfo(t *testing.T) {
+	reduced := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	tests := []struct {
+		name      string
+		userAgent string
+		hints     ClientHints
+		browser   string
+		platform  string
+	}{
+		{"hints win over the reduced UA", reduced, ClientHints{Brands: []Brand{{"Chromium", "124"}, {"Microsoft Edge", "124"}}, Platform: "macOS"}, "Edge", "macOS"},
+		{"Chromium alone", reduced, ClientHints{Brands: []Brand{{"Chromium", "124"}}}, "Chromium", "Windows"},
+		{"UA without hints", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", ClientHints{}, "Safari", "macOS"},
+		{"Chrome OS", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", ClientHints{}, "Chrome", "Chrome OS"},
+		{"nothing", "", ClientHints{}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser, platform := BrowserInfo(tt.userAgent, tt.hints)
+			assert.Equal(t, tt.browser, browser)
+			assert.Equal(t, tt.platform, platform)
+		})
+	}
+}
+
+func TestDeviceClass(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		hints     ClientHints
+		device    string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", ClientHints{}, DeviceDesktop},
+		{"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36", ClientHints{}, DeviceMobile},
+		{"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", ClientHints{}, DeviceTablet},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", ClientHints{}, DeviceMobile},
+		{"Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", ClientHints{}, DeviceTablet},
+		{"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", ClientHints{Mobile: true}, DeviceMobile},
+		{"", ClientHints{}, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.device, DeviceClass(tt.userAgent, tt.hints), tt.userAgent)
+	}
+}
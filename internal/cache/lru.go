@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"container/list"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process db.LinkCache holding at most size links, each for at most
+// ttl. Invalidations only reach the process that made them, so it suits
+// single-node deployments; the short TTL bounds staleness otherwise.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // Front is most recently used
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type lruEntry struct {
+	link    db.Link
+	expires time.Time
+}
+
+// NewLRU creates an LRU holding up to size links for ttl each.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+		now:     time.Now,
+	}
+}
+
+func (c *LRU) Get(shortCode string) (*db.Link, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[shortCode]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if c.now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, shortCode)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	link := entry.link // Callers get a copy they are free to modify
+	return &link, true
+}
+
+func (c *LRU) Set(link *db.Link) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &lruEntry{link: *link, expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[link.ShortCode]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[link.ShortCode] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).link.ShortCode)
+	}
+}
+
+func (c *LRU) Invalidate(shortCodes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, code := range shortCodes {
+		if el, ok := c.entries[code]; ok {
+			c.order.Remove(el)
+			delete(c.entries, code)
+		}
+	}
+}
+
+// Len returns the number of cached links, expired ones included until evicted.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Set(&db.Link{ShortCode: "A", OriginalURL: "https://a.com"})
+	c.Set(&db.Link{ShortCode: "B", OriginalURL: "https://b.com"})
+	_, ok := c.Get("A") // A is now more recently used than B
+	require.True(t, ok)
+	c.Set(&db.Link{ShortCode: "C", OriginalURL: "https://c.com"})
+
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("B")
+	assert.False(t, ok, "least recently used link is evicted")
+	link, ok := c.Get("A")
+	require.True(t, ok)
+	assert.Equal(t, "https://a.com", link.OriginalURL)
+
+	// Returned links are copies
+	link.OriginalURL = "https://changed.com"
+	link, _ = c.Get("A")
+	assert.Equal(t, "https://a.com", link.OriginalURL)
+
+	// Updating replaces the entry in place
+	c.Set(&db.Link{ShortCode: "A", OriginalURL: "https://a.com", RenderStatus: db.RenderStatusCompleted})
+	link, _ = c.Get("A")
+	assert.Equal(t, db.RenderStatusCompleted, link.RenderStatus)
+	assert.Equal(t, 2, c.Len())
+
+	c.Invalidate("A", "MISSING")
+	_, ok = c.Get("A")
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Get("C")
+	assert.False(t, ok, "entries expire after the TTL")
+	assert.Zero(t, c.Len())
+}
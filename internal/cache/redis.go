@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"prerender-url-shortener/internal/db"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces cached links in a Redis that may be shared with
+// other applications.
+const redisKeyPrefix = "prerender:link:"
+
+// redisTimeout bounds every cache call so a slow Redis degrades to database
+// lookups instead of stalling redirects.
+const redisTimeout = 100 * time.Millisecond
+
+// Redis is a db.LinkCache shared by all replicas. Entries expire after a TTL,
+// which bounds how long a link missed by invalidation can be served stale.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedis connects to the Redis at url, a redis:// or rediss:// URL, and checks
+// that it answers.
+func NewRedis(url string, ttl time.Duration) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Redis{client: client, ttl: ttl}, nil
+}
+
+func (r *Redis) Get(shortCode string) (*db.Link, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := r.client.Get(ctx, redisKeyPrefix+shortCode).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Cache: Redis get of %s failed: %v", shortCode, err)
+		}
+		return nil, false
+	}
+	var link db.Link
+	if err := json.Unmarshal(data, &link); err != nil {
+		log.Printf("Cache: Discarding undecodable entry for %s: %v", shortCode, err)
+		return nil, false
+	}
+	return &link, true
+}
+
+func (r *Redis) Set(link *db.Link) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Set(ctx, redisKeyPrefix+link.ShortCode, data, r.ttl).Err(); err != nil {
+		log.Printf("Cache: Redis set of %s failed: %v", link.ShortCode, err)
+	}
+}
+
+func (r *Redis) Invalidate(shortCodes ...string) {
+	keys := make([]string, len(shortCodes))
+	for i, code := range shortCodes {
+		keys[i] = redisKeyPrefix + code
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Cache: Redis invalidation of %d links failed: %v", len(keys), err)
+	}
+}
+
+// Close closes the connection pool.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/db"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := NewRedis("redis://"+mr.Addr(), time.Minute)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, ok := c.Get("REDIS1")
+	assert.False(t, ok)
+
+	c.Set(&db.Link{ShortCode: "REDIS1", OriginalURL: "https://redis.com", RenderStatus: db.RenderStatusCompleted})
+	link, ok := c.Get("REDIS1")
+	require.True(t, ok)
+	assert.Equal(t, "https://redis.com", link.OriginalURL)
+	assert.Equal(t, db.RenderStatusCompleted, link.RenderStatus)
+
+	c.Invalidate("REDIS1", "OTHER")
+	_, ok = c.Get("REDIS1")
+	assert.False(t, ok)
+
+	// Entries expire after the TTL
+	c.Set(&db.Link{ShortCode: "REDIS2", OriginalURL: "https://redis.com/2"})
+	mr.FastForward(2 * time.Minute)
+	_, ok = c.Get("REDIS2")
+	assert.False(t, ok)
+
+	// An unreachable Redis is a miss, not an error
+	mr.Close()
+	_, ok = c.Get("REDIS1")
+	assert.False(t, ok)
+}
+
+func TestNewRedisUnreachable(t *testing.T) {
+	_, err := NewRedis("redis://127.0.0.1:1", time.Minute)
+	assert.Error(t, err)
+	_, err = NewRedis("not a url", time.Minute)
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/shortener"
+	"strings"
+	"time"
+)
+
+// Providers CDN_PURGE_PROVIDER can name.
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderFastly     = "fastly"
+)
+
+// requestTimeout bounds a single purge request.
+const requestTimeout = 10 * time.Second
+
+// cloudflareBatchSize is the most URLs Cloudflare purges in one request.
+const cloudflareBatchSize = 30
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// API endpoints, replaced in tests.
+var (
+	cloudflareAPI = "https://api.cloudflare.com/client/v4"
+	fastlyAPI     = "https://api.fastly.com"
+)
+
+// Purge asks the CDN in front of the short URLs to drop its copies of
+// shortCodes' redirects, snapshots and /og/ documents, once they changed. It
+// returns right away; failures are logged, leaving the copies to expire.
+func Purge(shortCodes ...string) {
+	cfg := config.Get()
+	provider := strings.ToLower(cfg.CDNPurgeProvider)
+	if provider == "" || len(shortCodes) == 0 {
+		return
+	}
+	urls := purgeURLs(cfg.CDNPurgeBaseURLs, shortCodes)
+	if len(urls) == 0 {
+		log.Printf("CDN: Not purging %s, CDN_PURGE_BASE_URLS is empty", strings.Join(shortCodes, ", "))
+		return
+	}
+	zone, token := cfg.CDNPurgeZone, cfg.CDNPurgeToken
+	go func() {
+		if err := purge(provider, zone, token, urls); err != nil {
+			log.Printf("CDN: Failed to purge %s: %v", strings.Join(shortCodes, ", "), err)
+			return
+		}
+		log.Printf("CDN: Purged %d URLs of %s", len(urls), strings.Join(shortCodes, ", "))
+	}()
+}
+
+// purgeURLs returns the URLs a CDN may hold for shortCodes under each of the
+// comma-separated origins in baseURLs: the short URL, as served, and its /og/
+// document.
+func purgeURLs(baseURLs string, shortCodes []string) []string {
+	var urls []string
+	for _, base := range strings.Split(baseURLs, ",") {
+		base = strings.TrimRight(strings.TrimSpace(base), "/")
+		if base == "" {
+			continue
+		}
+		for _, code := range shortCodes {
+			served := shortener.SignCode(code)
+			urls = append(urls, base+"/"+served, base+"/og/"+served)
+		}
+	}
+	return urls
+}
+
+func purge(provider, zone, token string, urls []string) error {
+	switch provider {
+	case ProviderCloudflare:
+		for start := 0; start < len(urls); start += cloudflareBatchSize {
+			if err := purgeCloudflare(zone, token, urls[start:min(start+cloudflareBatchSize, len(urls))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ProviderFastly:
+		for _, u := range urls {
+			if err := purgeFastly(token, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown CDN_PURGE_PROVIDER %q", provider)
+	}
+}
+
+// purgeCloudflare purges urls from the Cloudflare zone with the given ID.
+func purgeCloudflare(zone, token string, urls []string) error {
+	body, err := json.Marshal(map[string][]string{"files": urls})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, cloudflareAPI+"/zones/"+url.PathEscape(zone)+"/purge_cache", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || !result.Success {
+		if err == nil && len(result.Errors) > 0 {
+			return fmt.Errorf("Cloudflare returned status %d: %s", resp.StatusCode, result.Errors[0].Message)
+		}
+		return fmt.Errorf("Cloudflare returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// purgeFastly purges a single URL from whichever Fastly service caches it.
+func purgeFastly(token, cachedURL string) error {
+	u, err := url.Parse(cachedURL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fastlyAPI+"/purge/"+u.Host+u.EscapedPath(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Fastly returned status %d for %s", resp.StatusCode, cachedURL)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeURLs(t *testing.T) {
+	config.Set(&config.Config{})
+	assert.Equal(t, []string{
+		"https://s.example.com/ABC", "https://s.example.com/og/ABC",
+		"https://s.example.com/DEF", "https://s.example.com/og/DEF",
+		"https://go.acme.com/ABC", "https://go.acme.com/og/ABC",
+		"https://go.acme.com/DEF", "https://go.acme.com/og/DEF",
+	}, purgeURLs("https://s.example.com/, https://go.acme.com", []string{"ABC", "DEF"}))
+	assert.Empty(t, purgeURLs("", []string{"ABC"}))
+}
+
+func TestPurgeCloudflare(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/zones/zone123/purge_cache", r.URL.Path)
+		assert.Equal(t, "Bearer cf-token", r.Header.Get("Authorization"))
+		var body struct {
+			Files []string `json:"files"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		mu.Lock()
+		batches = append(batches, body.Files)
+		mu.Unlock()
+		w.Write([]byte(`{"success": true, "errors": []}`))
+	}))
+	defer server.Close()
+	cloudflareAPI = server.URL
+
+	urls := make([]string, 35)
+	for i := range urls {
+		urls[i] = "https://s.example.com/" + string(rune('A'+i))
+	}
+	require.NoError(t, purge(ProviderCloudflare, "zone123", "cf-token", urls))
+	require.Len(t, batches, 2, "at most 30 URLs per request")
+	assert.Len(t, batches[0], 30)
+	assert.Equal(t, urls[30:], batches[1])
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}]}`))
+	})
+	err := purge(ProviderCloudflare, "zone123", "bad-token", urls[:1])
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Authentication error")
+}
+
+func TestPurgeFastly(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "fastly-token", r.Header.Get("Fastly-Key"))
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+	fastlyAPI = server.URL
+
+	require.NoError(t, purge(ProviderFastly, "", "fastly-token", []string{"https://s.example.com/ABC", "https://s.example.com/og/ABC"}))
+	assert.Equal(t, []string{"/purge/s.example.com/ABC", "/purge/s.example.com/og/ABC"}, paths)
+
+	assert.Error(t, purge("akamai", "", "token", []string{"https://s.example.com/ABC"}))
+}
@@ -1,58 +1,401 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/joho/godotenv"
 )
 
-// Config holds the application configuration.
-// We'll use struct tags for environment variable loading.
+// Config holds the application configuration. Each field is loaded from the
+// environment variable named by its env tag, see load.
 type Config struct {
-	ServerPort           string `env:"SERVER_PORT,default=:8080"`
+	AppEnv               string `env:"APP_ENV"`                                // development, staging or production, selecting a profile of defaults
+	ServerPort           string `env:"SERVER_PORT,reload,default=:8080"`       // TCP address, or unix:///path/to/socket; a reload moves the server there
+	ServerSocketMode     string `env:"SERVER_SOCKET_MODE,reload,default=0660"` // Permissions of a unix socket in SERVER_PORT, in octal
+	ServerSocketGroup    string `env:"SERVER_SOCKET_GROUP,reload"`             // Group owning a unix socket in SERVER_PORT, e.g. the proxy's, by name or ID
+	TLSCertFile          string `env:"TLS_CERT_FILE,reload"`                   // Serve HTTPS with this certificate chain (PEM), re-read on reload
+	TLSKeyFile           string `env:"TLS_KEY_FILE,reload"`                    // Private key of TLS_CERT_FILE (PEM)
 	DatabaseURL          string `env:"DATABASE_URL,required"`
-	RodBinPath           string `env:"ROD_BIN_PATH"`                      // Optional, if not in default PATH
-	AllowedDomains       string `env:"ALLOWED_DOMAINS"`                   // Comma-separated list of allowed domains
-	RenderWorkerCount    int    `env:"RENDER_WORKER_COUNT,default=3"`     // Number of render workers
-	RenderTimeoutSeconds int    `env:"RENDER_TIMEOUT_SECONDS,default=90"` // Timeout for Rod rendering in seconds
+	DatabaseBackend      string `env:"DATABASE_BACKEND,default=gorm"`            // Query layer: gorm or sql (hand-written SQL on prepared statements)
+	RodBinPath           string `env:"ROD_BIN_PATH"`                             // Optional, if not in default PATH
+	AllowedDomains       string `env:"ALLOWED_DOMAINS,reload"`                   // Comma-separated list of allowed domains
+	BlockedDomains       string `env:"BLOCKED_DOMAINS,reload"`                   // Comma-separated list of domains never shortened, checked before ALLOWED_DOMAINS
+	SSRFProtection       bool   `env:"SSRF_PROTECTION,reload,default=true"`      // Reject URLs whose host resolves to private, loopback or link-local addresses
+	SSRFAllowedNetworks  string `env:"SSRF_ALLOWED_NETWORKS,reload"`             // Comma-separated CIDR prefixes exempt from SSRF_PROTECTION, e.g. an intranet to render
+	RenderWorkerCount    int    `env:"RENDER_WORKER_COUNT,default=3"`            // Number of render workers
+	RenderTimeoutSeconds int    `env:"RENDER_TIMEOUT_SECONDS,reload,default=90"` // Timeout for Rod rendering in seconds
+
+	// /generate's wait for the render
+	GenerateMaxWaitSeconds int `env:"GENERATE_MAX_WAIT_SECONDS,reload"` // Longest wait for the render /generate allows with wait_seconds; 0 for RENDER_TIMEOUT_SECONDS
+
+	// Backpressure while the render queue is full
+	RenderQueueFullPolicy            string `env:"RENDER_QUEUE_FULL_POLICY,reload,default=reject"`          // reject refuses new links from /generate and /quick, defer creates them and renders once a worker is idle
+	RenderQueueFullStatus            int    `env:"RENDER_QUEUE_FULL_STATUS,reload,default=503"`             // Status refused links get, 503 or 429
+	RenderQueueFullRetryAfterSeconds int    `env:"RENDER_QUEUE_FULL_RETRY_AFTER_SECONDS,reload,default=30"` // Retry-After sent with refused links, 0 omits it
+
+	// Deployment modes
+	ServerMode                   string `env:"SERVER_MODE,default=all"`                    // all, api (HTTP only, renders left to worker replicas) or worker (renders only), overridden by --mode
+	RenderPollIntervalSeconds    int    `env:"RENDER_POLL_INTERVAL_SECONDS,default=2"`     // How often workers check the database for renders requested by other replicas
+	ShutdownGraceSeconds         int    `env:"SHUTDOWN_GRACE_SECONDS,default=15"`          // How long to keep serving with readiness failed after SIGTERM, before exiting
+	RenderShutdownTimeoutSeconds int    `env:"RENDER_SHUTDOWN_TIMEOUT_SECONDS,default=20"` // How long shutdown waits for started renders to finish before requesting them again
+
+	// HTTP server timeouts, fixed at startup
+	ServerReadHeaderTimeoutSeconds int `env:"SERVER_READ_HEADER_TIMEOUT_SECONDS,default=10"` // Time allowed to send the request headers, against slow-loris clients
+	ServerReadTimeoutSeconds       int `env:"SERVER_READ_TIMEOUT_SECONDS,default=30"`        // Time allowed to send the whole request
+	ServerWriteTimeoutSeconds      int `env:"SERVER_WRITE_TIMEOUT_SECONDS"`                  // Time allowed to answer a request; 0 for /generate's longest wait for the render plus 30s
+	ServerIdleTimeoutSeconds       int `env:"SERVER_IDLE_TIMEOUT_SECONDS,default=120"`       // How long idle keep-alive connections stay open
+
+	// Short codes
+	ShortCodeLength          int    `env:"SHORT_CODE_LENGTH,default=6"`              // Length of generated short codes, 4 to 32
+	ShortCodeAlphabet        string `env:"SHORT_CODE_ALPHABET"`                      // Characters of generated short codes, empty uses unambiguous uppercase letters and digits
+	ShortCodeMode            string `env:"SHORT_CODE_MODE,default=random"`           // random, hash to derive codes from the URL, or sequential to encode a counter
+	ShortCodeObfuscationKey  string `env:"SHORT_CODE_OBFUSCATION_KEY"`               // Shuffles sequential codes so they don't reveal their order
+	ShortCodeReserved        string `env:"SHORT_CODE_RESERVED"`                      // Comma-separated codes never handed out, on top of the route names
+	ShortCodeProfanityFilter bool   `env:"SHORT_CODE_PROFANITY_FILTER,default=true"` // Regenerate random and sequential codes containing offensive words
+	ShortCodeSigningKey      string `env:"SHORT_CODE_SIGNING_KEY"`                   // Append an HMAC to served short codes and reject codes without a valid one, empty disables
+	ShortCodeSignatureLength int    `env:"SHORT_CODE_SIGNATURE_LENGTH,default=4"`    // Characters of HMAC appended to signed short codes, 2 to 16
+	ShortCodeMaxAttempts     int    `env:"SHORT_CODE_MAX_ATTEMPTS,default=5"`        // Short codes tried for a new link before giving up, 1 to 100
+	ShortCodeGrowAfter       int    `env:"SHORT_CODE_GROW_AFTER,default=3"`          // Collisions of a new link after which each further random code is a character longer, 0 never
+
+	// Custom aliases
+	ShortCodeAliasMinLength int    `env:"SHORT_CODE_ALIAS_MIN_LENGTH,default=3"`    // Shortest alias accepted
+	ShortCodeAliasMaxLength int    `env:"SHORT_CODE_ALIAS_MAX_LENGTH,default=32"`   // Longest alias accepted, at most 64
+	ShortCodeAliasCharset   string `env:"SHORT_CODE_ALIAS_CHARSET"`                 // Characters aliases may contain, empty allows letters, digits, '-' and '_'
+	ShortCodeAliasPattern   string `env:"SHORT_CODE_ALIAS_PATTERN"`                 // Regular expression aliases must match in full
+	ShortCodeAliasFoldCase  bool   `env:"SHORT_CODE_ALIAS_FOLD_CASE,default=false"` // Lowercase aliases so they are case-insensitive
+
+	// URL validation
+	URLMaxLength      int    `env:"URL_MAX_LENGTH,reload,default=2048"`     // Longest URL accepted by /generate, 0 allows any length
+	URLAllowedSchemes string `env:"URL_ALLOWED_SCHEMES,default=http,https"` // Comma-separated schemes that may be shortened and rendered
+
+	// URL normalization, so different spellings of a page share one link
+	URLStripFragment bool   `env:"URL_STRIP_FRAGMENT,default=false"` // Drop "#..." fragments; keep them for sites routing on the fragment
+	URLSortQuery     bool   `env:"URL_SORT_QUERY,default=false"`     // Order query parameters by name
+	URLStripParams   string `env:"URL_STRIP_PARAMS"`                 // Comma-separated query parameters to drop, e.g. utm_*,fbclid,gclid
+
+	// Server
+	GinMode                   string `env:"GIN_MODE,default=debug"`                      // debug or release
+	LogFormat                 string `env:"LOG_FORMAT,default=text"`                     // text or json
+	LogLevel                  string `env:"LOG_LEVEL,default=info"`                      // debug, info, warn or error
+	CORSAllowedOrigins        string `env:"CORS_ALLOWED_ORIGINS,default=*"`              // Comma-separated origins allowed to call the API, * for any, empty for none
+	TrustedProxies            string `env:"TRUSTED_PROXIES"`                             // Comma-separated proxy addresses or CIDRs whose X-Forwarded-For is believed, empty believes any
+	RateLimitRequests         int    `env:"RATE_LIMIT_REQUESTS,reload,default=0"`        // Requests to /generate and /admin/login allowed per client and window, 0 disables
+	RateLimitWindowSeconds    int    `env:"RATE_LIMIT_WINDOW_SECONDS,reload,default=60"` // Length of the rate limit window
+	ScanNotFoundLimit         int    `env:"SCAN_NOT_FOUND_LIMIT,reload,default=0"`       // 404s on short codes allowed per client and window before blocking it, 0 disables
+	ScanWindowSeconds         int    `env:"SCAN_WINDOW_SECONDS,reload,default=60"`       // Window in which SCAN_NOT_FOUND_LIMIT applies
+	ScanBlockSeconds          int    `env:"SCAN_BLOCK_SECONDS,reload,default=600"`       // How long a scanning client is blocked
+	ScanTarpitSeconds         int    `env:"SCAN_TARPIT_SECONDS,reload,default=0"`        // Delay before answering a blocked client, at most 30
+	ManagementAllowedNetworks string `env:"MANAGEMENT_ALLOWED_NETWORKS,reload"`          // Comma-separated CIDRs allowed to reach /generate, /admin and /status, empty allows all
+
+	// Schema migrations
+	DatabaseAutoMigrate bool `env:"DATABASE_AUTO_MIGRATE,default=true"` // Apply pending migrations on startup, otherwise only warn
+
+	// Rendering
+	RenderStealth bool `env:"RENDER_STEALTH,default=false"` // Apply anti-bot-detection patches to rendering pages
+
+	// Locale emulation defaults, overridable per link
+	RenderAcceptLanguage string `env:"RENDER_ACCEPT_LANGUAGE,reload"` // Accept-Language header and navigator.languages
+	RenderLocale         string `env:"RENDER_LOCALE,reload"`          // JS/ICU locale, e.g. de-DE
+	RenderTimezone       string `env:"RENDER_TIMEZONE,reload"`        // IANA timezone, e.g. Europe/Berlin
+	RenderProfiles       string `env:"RENDER_PROFILES,reload"`        // JSON object of named profiles with locale and geolocation settings
+
+	// Tracker and ad blocking
+	RenderBlockTrackers bool   `env:"RENDER_BLOCK_TRACKERS,reload,default=false"` // Block analytics and ad requests while rendering
+	RenderBlocklistFile string `env:"RENDER_BLOCKLIST_FILE,reload"`               // EasyList-style filter list replacing the built-in one
+
+	// Debugging
+	RenderHeadful      bool   `env:"RENDER_HEADFUL,default=false"`    // Launch a visible browser with devtools open
+	RenderSlowMotionMs int    `env:"RENDER_SLOW_MOTION_MS,default=0"` // Delay between browser actions, traced to the log
+	RenderDebugDumpDir string `env:"RENDER_DEBUG_DUMP_DIR"`           // Write screenshots and console logs of failed renders here
+
+	// Browser pool
+	BrowserPoolEnabled   bool `env:"BROWSER_POOL_ENABLED,default=false"` // Share one long-lived browser between renders
+	BrowserMaxPages      int  `env:"BROWSER_MAX_PAGES,default=100"`      // Recycle the shared browser after this many pages, 0 disables
+	BrowserMaxAgeMinutes int  `env:"BROWSER_MAX_AGE_MINUTES,default=60"` // Recycle the shared browser after this many minutes, 0 disables
+	BrowserMaxRSSMB      int  `env:"BROWSER_MAX_RSS_MB,default=0"`       // Recycle the shared browser above this resident memory, 0 disables
+
+	// Resource guardrails
+	RenderMaxMemoryMB          int `env:"RENDER_MAX_MEMORY_MB,default=0"`          // Kill a browser whose processes exceed this memory, 0 disables
+	RenderMaxCPUPercent        int `env:"RENDER_MAX_CPU_PERCENT,default=0"`        // Kill a browser sustaining more CPU than this (100 = one core), 0 disables
+	RenderResourceCheckSeconds int `env:"RENDER_RESOURCE_CHECK_SECONDS,default=5"` // How often browser resource usage is sampled
+	RenderMaxRetries           int `env:"RENDER_MAX_RETRIES,reload,default=1"`     // Retries for renders failed by the resource guard
+
+	// URL screening
+	SafeBrowsingAPIKey        string `env:"SAFE_BROWSING_API_KEY"`                   // Google Safe Browsing key; checks URLs for malware and phishing, empty disables
+	URLScreeningIntervalHours int    `env:"URL_SCREENING_INTERVAL_HOURS,default=24"` // How often existing links are checked again, 0 only checks new URLs
+
+	// Crawler policy
+	RobotsTxtFile string `env:"ROBOTS_TXT_FILE,reload"` // Served as /robots.txt, empty serves a default keeping crawlers out of the API
+	WellKnownDir  string `env:"WELL_KNOWN_DIR,reload"`  // Directory served under /.well-known/, e.g. for security.txt, empty disables
+	RobotsTag     string `env:"ROBOTS_TAG,reload"`      // X-Robots-Tag sent with redirects and snapshots, e.g. noindex, empty sends none
+
+	// Sitemap
+	SitemapBaseURL  string `env:"SITEMAP_BASE_URL,reload"`                // Origin short URLs are listed under in /sitemap.xml, e.g. https://s.example.com, empty disables
+	SitemapPageSize int    `env:"SITEMAP_PAGE_SIZE,reload,default=50000"` // Short URLs per sitemap page, at most 50000
+
+	// Redirects
+	RedirectToFinalURL bool `env:"REDIRECT_TO_FINAL_URL,reload,default=false"` // Send users straight to the URL the original redirected to
+
+	// HTTP caching
+	RedirectCacheControl string `env:"REDIRECT_CACHE_CONTROL,reload,default=private, max-age=60"`                 // Cache-Control of redirects from short URLs, "none" sends none
+	SnapshotCacheControl string `env:"SNAPSHOT_CACHE_CONTROL,reload,default=public, max-age=300, s-maxage=86400"` // Cache-Control of snapshots and /og documents, "none" sends none
+
+	// Bot detection
+	BotPatternsFile   string `env:"BOT_PATTERNS_FILE,reload"`                           // Regular expressions of further bot user agents, one per line
+	BotOverrideHeader string `env:"BOT_OVERRIDE_HEADER,reload,default=X-Prerender-Bot"` // Request header forcing bot (1) or user (0) treatment, empty disables
+
+	// CDN purging
+	CDNPurgeProvider string `env:"CDN_PURGE_PROVIDER,reload"`  // cloudflare or fastly, purging changed short URLs from the CDN; empty disables
+	CDNPurgeZone     string `env:"CDN_PURGE_ZONE,reload"`      // Cloudflare zone ID of the short domain
+	CDNPurgeToken    string `env:"CDN_PURGE_TOKEN,reload"`     // Cloudflare API token with Cache Purge permission, or Fastly API token
+	CDNPurgeBaseURLs string `env:"CDN_PURGE_BASE_URLS,reload"` // Comma-separated origins short URLs are served from through the CDN, e.g. https://s.example.com
+
+	// Webhooks
+	RenderWebhookURL            string `env:"RENDER_WEBHOOK_URL,reload"`                        // Receives render.started/succeeded/failed events, empty disables
+	RenderWebhookTimeoutSeconds int    `env:"RENDER_WEBHOOK_TIMEOUT_SECONDS,reload,default=10"` // Timeout for a single webhook delivery
+
+	// Chat notifications
+	NotifyWebhookURL                 string `env:"NOTIFY_WEBHOOK_URL,reload"`                              // Slack or Discord incoming webhook notified of render failures, a full queue and flagged links, empty disables
+	NotifyRenderFailureThreshold     int    `env:"NOTIFY_RENDER_FAILURE_THRESHOLD,reload,default=5"`       // Failed renders within NOTIFY_RENDER_FAILURE_WINDOW_MINUTES that notify
+	NotifyRenderFailureWindowMinutes int    `env:"NOTIFY_RENDER_FAILURE_WINDOW_MINUTES,reload,default=15"` // Window render failures are counted over
+	NotifyCooldownMinutes            int    `env:"NOTIFY_COOLDOWN_MINUTES,reload,default=30"`              // Least time between two notifications of the same kind; the ones held back are counted in the next
+
+	// Admin API
+	AdminUsername             string `env:"ADMIN_USERNAME"`                            // Admin user created on startup while there are no admin users
+	AdminPassword             string `env:"ADMIN_PASSWORD"`                            // Password of ADMIN_USERNAME
+	AdminSessionTTLHours      int    `env:"ADMIN_SESSION_TTL_HOURS,reload,default=12"` // How long an admin login lasts
+	AdminToken                string `env:"ADMIN_TOKEN,reload"`                        // Deprecated shared bearer token with the admin role, empty disables it
+	DeletedLinkRetentionHours int    `env:"DELETED_LINK_RETENTION_HOURS,default=720"`  // How long deleted links can be restored, 0 keeps them restorable forever
+
+	// Click tracking
+	ClickTrackingEnabled      bool   `env:"CLICK_TRACKING_ENABLED,default=true"`    // Record a click event for every redirect
+	ClickBufferSize           int    `env:"CLICK_BUFFER_SIZE,default=10000"`        // Click events held in memory before new ones are dropped
+	ClickBatchSize            int    `env:"CLICK_BATCH_SIZE,default=500"`           // Click events written per INSERT batch
+	ClickFlushIntervalSeconds int    `env:"CLICK_FLUSH_INTERVAL_SECONDS,default=5"` // Maximum time a click event waits in the buffer
+	ClickIPHashSalt           string `env:"CLICK_IP_HASH_SALT"`                     // Salt mixed into hashed client IPs
+
+	// GeoIP
+	GeoIPDatabasePath string `env:"GEOIP_DATABASE_PATH"`                       // MaxMind country or city database to look up client countries in, empty disables
+	GeoIPRefreshHours int    `env:"GEOIP_REFRESH_HOURS,default=24"`            // How often the database is reloaded if changed, or downloaded, 0 disables
+	GeoIPAccountID    string `env:"GEOIP_ACCOUNT_ID"`                          // MaxMind account to download the database with
+	GeoIPLicenseKey   string `env:"GEOIP_LICENSE_KEY"`                         // MaxMind license key, empty leaves updating the file to e.g. geoipupdate
+	GeoIPEditionID    string `env:"GEOIP_EDITION_ID,default=GeoLite2-Country"` // MaxMind database edition to download
+
+	// GA4 Measurement Protocol forwarding
+	GA4MeasurementID string `env:"GA4_MEASUREMENT_ID"`                      // GA4 data stream to forward clicks to, e.g. G-XXXXXXX, empty disables
+	GA4APISecret     string `env:"GA4_API_SECRET"`                          // Measurement Protocol API secret of the data stream
+	GA4EventName     string `env:"GA4_EVENT_NAME,default=short_link_click"` // Name of the forwarded events
+	GA4ForwardBots   bool   `env:"GA4_FORWARD_BOTS,default=false"`          // Forward crawler hits too, not just people's clicks
+
+	// Click rollups
+	ClickRollupIntervalMinutes int `env:"CLICK_ROLLUP_INTERVAL_MINUTES,default=60"` // How often click events are rolled into daily stats, 0 disables
+
+	// Analytics retention
+	ClickRawRetentionDays       int `env:"CLICK_RAW_RETENTION_DAYS,default=0"`       // Keep raw click events this many days, rolled up or not; 0 deletes them once rolled up
+	ClickAggregateRetentionDays int `env:"CLICK_AGGREGATE_RETENTION_DAYS,default=0"` // Keep daily click stats and breakdowns this many days, 0 keeps them
+
+	// Content retention
+	ContentRetentionDays   int    `env:"CONTENT_RETENTION_DAYS,default=0"`       // Purge links not accessed for this many days, 0 disables
+	ContentRetentionMode   string `env:"CONTENT_RETENTION_MODE,default=content"` // content drops snapshots, rows deletes the links
+	JanitorIntervalMinutes int    `env:"JANITOR_INTERVAL_MINUTES,default=60"`    // How often the retention janitor runs
+
+	// Cold storage
+	ArchiveInactiveMonths int `env:"ARCHIVE_INACTIVE_MONTHS,default=0"` // Archive links not accessed for this many months, 0 disables
+
+	// Link cache
+	RedisURL              string `env:"REDIS_URL"`                               // redis:// URL of a cache for short-code lookups, empty disables
+	LinkCacheTTLSeconds   int    `env:"LINK_CACHE_TTL_SECONDS,default=300"`      // How long a cached link may be served
+	LinkCacheMaxHTMLBytes int    `env:"LINK_CACHE_MAX_HTML_BYTES,default=65536"` // Larger snapshots are cached without their HTML, 0 never caches HTML
+
+	// In-process link cache for single-node deployments, used when REDIS_URL is unset
+	LocalLinkCacheSize       int `env:"LOCAL_LINK_CACHE_SIZE,default=0"`         // Most recently used links kept in memory, 0 disables
+	LocalLinkCacheTTLSeconds int `env:"LOCAL_LINK_CACHE_TTL_SECONDS,default=10"` // How long an in-memory link may be served
+
+	// Render history
+	RenderHistoryVersions int `env:"RENDER_HISTORY_VERSIONS,default=0"` // Successful renders kept per link for rollback, 0 disables
+
+	// Click event partitions, PostgreSQL only
+	ClickPartitionRetentionMonths int `env:"CLICK_PARTITION_RETENTION_MONTHS,default=0"` // Drop raw click events older than this many months, 0 keeps them
+
+	// Encryption at rest
+	SnapshotEncryptionKey        string `env:"SNAPSHOT_ENCRYPTION_KEY"`         // Base64 AES-256 key encrypting stored snapshots
+	SnapshotEncryptionKeyCommand string `env:"SNAPSHOT_ENCRYPTION_KEY_COMMAND"` // Shell command printing the key instead, e.g. a KMS decrypt call
+
+	// Feature flags
+	FeatureFlags string `env:"FEATURE_FLAGS,reload"` // Comma-separated flag=on|off pairs, overridden at runtime through /admin/flags
+
+	// Multi-tenancy
+	Tenants string `env:"TENANTS,reload"` // JSON object mapping tenant IDs to their API keys and hosts, empty runs single-tenant
 }
 
-var AppConfig *Config
+// current holds the loaded configuration. Reload swaps in a new one while
+// requests are being served, so it is only accessed atomically.
+var current atomic.Pointer[Config]
+
+// Get returns the current configuration. Callers load it once per request or
+// job and read their settings from that, so they see one consistent version
+// even if Reload swaps it meanwhile. The returned Config must not be modified.
+func Get() *Config {
+	return current.Load()
+}
+
+// Set replaces the current configuration, e.g. with one built by a test.
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
 
 // LoadConfig loads configuration from environment variables.
 // It looks for a .env file in the current directory for development convenience.
 func LoadConfig() error {
 	// Attempt to load .env file, but don't fail if it's not there (for production)
+	rememberDotenv()
 	_ = godotenv.Load()
 
-	AppConfig = &Config{}
+	cfg := &Config{}
+	err := load(cfg)
+	Set(cfg)
+	return err
+}
+
+// envTag is a parsed env struct tag.
+type envTag struct {
+	name     string // Environment variable
+	fallback string // Value used when the variable is unset
+	required bool   // Fail loading when the variable is unset or empty
+	reload   bool   // Applied by Reload without a restart
+}
+
+// parseEnvTag parses a tag of the form NAME[,required][,reload][,default=X].
+// Options follow the name, with default last since its value may contain commas.
+func parseEnvTag(tag string) (envTag, error) {
+	name, options, _ := strings.Cut(tag, ",")
+	parsed := envTag{name: name}
+	for options != "" {
+		if value, ok := strings.CutPrefix(options, "default="); ok {
+			parsed.fallback = value
+			break
+		}
+		var option string
+		option, options, _ = strings.Cut(options, ",")
+		switch option {
+		case "required":
+			parsed.required = true
+		case "reload":
+			parsed.reload = true
+		default:
+			return envTag{}, fmt.Errorf("unknown env tag option %q", option)
+		}
+	}
+	return parsed, nil
+}
+
+// load sets every field of the struct cfg points to from the environment
+// variable named by its env tag, see parseEnvTag. The APP_ENV profile replaces
+// the defaults of the tags. Invalid numbers and booleans fall back to the
+// default with a warning.
+func load(cfg interface{}) error {
+	profile, err := profileDefaults()
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		parsed, err := parseEnvTag(tag)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.Field(i).Name, err)
+		}
+		name, fallback, required := parsed.name, parsed.fallback, parsed.required
+		if value, ok := profile[name]; ok {
+			fallback = value
+		}
+		if err := checkEnvFile(name); err != nil {
+			return err
+		}
 
-	// Basic manual loading for now, can be replaced with a library like 'envconfig' later
-	AppConfig.ServerPort = getEnv("SERVER_PORT", ":8080")
-	AppConfig.DatabaseURL = getEnv("DATABASE_URL", "") // Required, so empty default
-	AppConfig.RodBinPath = getEnv("ROD_BIN_PATH", "")
-	AppConfig.AllowedDomains = getEnv("ALLOWED_DOMAINS", "") // Empty means allow all
-	AppConfig.RenderWorkerCount = getEnvInt("RENDER_WORKER_COUNT", 3)
-	AppConfig.RenderTimeoutSeconds = getEnvInt("RENDER_TIMEOUT_SECONDS", 90)
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(getEnv(name, fallback))
+			if required && field.String() == "" {
+				return fmt.Errorf("%s environment variable is required", name)
+			}
+		case reflect.Int:
+			def, err := strconv.Atoi(fallback)
+			if fallback != "" && err != nil {
+				return fmt.Errorf("%s: invalid default %q", t.Field(i).Name, fallback)
+			}
+			field.SetInt(int64(getEnvInt(name, def)))
+		case reflect.Bool:
+			def, err := strconv.ParseBool(fallback)
+			if fallback != "" && err != nil {
+				return fmt.Errorf("%s: invalid default %q", t.Field(i).Name, fallback)
+			}
+			field.SetBool(getEnvBool(name, def))
+		default:
+			return fmt.Errorf("%s: unsupported type %s", t.Field(i).Name, field.Type())
+		}
+		if required && field.Kind() != reflect.String {
+			if _, set := lookupEnv(name); !set {
+				return fmt.Errorf("%s environment variable is required", name)
+			}
+		}
+	}
+	return nil
+}
 
-	if AppConfig.DatabaseURL == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
+// lookupEnv looks up the environment variable key or, if KEY_FILE is set
+// instead, reads the value from the file it names, such as a mounted Docker
+// secret, without a trailing newline. Secrets read this way never appear in the
+// environment, where child processes like the browser would inherit them.
+func lookupEnv(key string) (string, bool) {
+	path, ok := os.LookupEnv(key + "_FILE")
+	if !ok || path == "" {
+		return os.LookupEnv(key)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Warning: Failed to read %s_FILE: %v", key, err)
+		return "", false
 	}
+	return strings.TrimRight(string(data), "\r\n"), true
+}
 
+// checkEnvFile fails if both key and KEY_FILE are set, or KEY_FILE names a file
+// that can't be read, so that a missing secret stops startup.
+func checkEnvFile(key string) error {
+	path, ok := os.LookupEnv(key + "_FILE")
+	if !ok || path == "" {
+		return nil
+	}
+	if _, set := os.LookupEnv(key); set {
+		return fmt.Errorf("%s and %s_FILE are both set", key, key)
+	}
+	if _, err := os.ReadFile(path); err != nil {
+		return fmt.Errorf("%s_FILE: %w", key, err)
+	}
 	return nil
 }
 
 func getEnv(key string, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		return value
 	}
 	return fallback
 }
 
 func getEnvInt(key string, fallback int) int {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -60,3 +403,13 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, exists := lookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		log.Printf("Warning: Invalid boolean value for %s: %s, using default %t", key, value, fallback)
+	}
+	return fallback
+}
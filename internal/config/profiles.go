@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// profiles are the defaults APP_ENV switches to, by variable name. They replace
+// the defaults in the env tags; variables that are set still win.
+var profiles = map[string]map[string]string{
+	"development": {
+		"GIN_MODE":             "debug",
+		"LOG_FORMAT":           "text",
+		"LOG_LEVEL":            "debug",
+		"CORS_ALLOWED_ORIGINS": "*",
+		"RENDER_HEADFUL":       "true",
+	},
+	"staging": {
+		"GIN_MODE":             "release",
+		"LOG_FORMAT":           "json",
+		"LOG_LEVEL":            "info",
+		"CORS_ALLOWED_ORIGINS": "*",
+	},
+	"production": {
+		"GIN_MODE":             "release",
+		"LOG_FORMAT":           "json",
+		"LOG_LEVEL":            "info",
+		"CORS_ALLOWED_ORIGINS": "",
+	},
+}
+
+// profileDefaults returns the defaults of the APP_ENV profile, none if APP_ENV
+// is unset.
+func profileDefaults() (map[string]string, error) {
+	env, _ := lookupEnv("APP_ENV")
+	if env == "" {
+		return nil, nil
+	}
+	defaults, ok := profiles[strings.ToLower(env)]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown APP_ENV %q, expected one of %s", env, strings.Join(names, ", "))
+	}
+	return defaults, nil
+}
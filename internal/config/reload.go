@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+// dotenvFile is the file LoadConfig and Reload read settings from, besides the
+// environment.
+const dotenvFile = ".env"
+
+var (
+	reloadMu sync.Mutex
+	// processEnv holds the variables set in the environment the process was
+	// started with, which take precedence over the .env file.
+	processEnv map[string]bool
+	// dotenvKeys holds the variables last set from the .env file.
+	dotenvKeys map[string]bool
+	// reloadHooks run after each successful Reload, see OnReload.
+	reloadHooks []func()
+)
+
+// rememberDotenv records which variables come from the process environment and
+// which from the .env file, so that Reload can apply edits to the file.
+func rememberDotenv() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if processEnv != nil {
+		return // The .env file was loaded into the environment since
+	}
+	processEnv = map[string]bool{}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		processEnv[key] = true
+	}
+	dotenvKeys = map[string]bool{}
+	if values, err := godotenv.Read(dotenvFile); err == nil {
+		for key := range values {
+			if !processEnv[key] {
+				dotenvKeys[key] = true
+			}
+		}
+	}
+}
+
+// Reload re-reads the .env file and applies the settings whose env tag has the
+// reload option, such as ALLOWED_DOMAINS and RENDER_PROFILES, without a
+// restart. The environment of a running process can't change, so variables set
+// there keep their value. The current Config is replaced rather than modified,
+// so a reader holding the old one from Get sees it whole. Reload returns the names of the
+// settings that changed; other settings keep their value until the next restart.
+func Reload() ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	values, err := godotenv.Read(dotenvFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for key := range dotenvKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key) // Removed from the file, so the default applies again
+		}
+	}
+	dotenvKeys = map[string]bool{}
+	for key, value := range values {
+		if !processEnv[key] {
+			os.Setenv(key, value)
+			dotenvKeys[key] = true
+		}
+	}
+
+	fresh := &Config{}
+	if err := load(fresh); err != nil {
+		return nil, err
+	}
+	next := *Get()
+	changed := reloadInto(&next, fresh)
+	Set(&next)
+	for _, hook := range reloadHooks {
+		hook()
+	}
+	return changed, nil
+}
+
+// OnReload registers fn to run after each successful Reload, whichever way it
+// was triggered, for settings that take more than a new value in the Config to
+// apply. Hooks run one reload at a time and must not call Reload.
+func OnReload(fn func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// reloadInto copies the reloadable fields of src that differ into dst and
+// returns their variable names.
+func reloadInto(dst *Config, src *Config) []string {
+	var changed []string
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := 0; i < d.NumField(); i++ {
+		tag, err := parseEnvTag(d.Type().Field(i).Tag.Get("env"))
+		if err != nil || !tag.reload || d.Field(i).Equal(s.Field(i)) {
+			continue
+		}
+		d.Field(i).Set(s.Field(i))
+		changed = append(changed, tag.name)
+	}
+	return changed
+}
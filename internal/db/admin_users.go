@@ -0,0 +1,178 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Admin roles. Viewers can only read through the admin API.
+const (
+	AdminRoleAdmin  = "admin"
+	AdminRoleViewer = "viewer"
+)
+
+// ErrInvalidCredentials is returned by AuthenticateAdminUser when the username
+// or password is wrong. Which one isn't revealed.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrUsernameTaken is returned by CreateAdminUser when the username is in use.
+var ErrUsernameTaken = errors.New("username already in use")
+
+// AdminUser is a person allowed to use the admin API. Only a bcrypt hash of the
+// password is stored.
+type AdminUser struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"uniqueIndex;size:64;not null" json:"username"`
+	PasswordHash string    `gorm:"size:72;not null" json:"-"`
+	Role         string    `gorm:"size:16;not null" json:"role"`
+	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// AdminSession is a logged-in admin user. The token handed to the client is
+// only stored as its SHA-256 hash.
+type AdminSession struct {
+	TokenHash string    `gorm:"primaryKey;size:64"`
+	UserID    uint      `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// dummyPasswordHash is compared against when a username doesn't exist, so
+// failed logins take as long for unknown users as for wrong passwords.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// ValidAdminRole reports whether role is one of the admin roles.
+func ValidAdminRole(role string) bool {
+	return role == AdminRoleAdmin || role == AdminRoleViewer
+}
+
+// CreateAdminUser stores a new admin user with a bcrypt hash of password. It
+// returns ErrUsernameTaken if the username is in use.
+func CreateAdminUser(username, password, role string) (*AdminUser, error) {
+	if !ValidAdminRole(role) {
+		return nil, fmt.Errorf("unknown admin role %q", role)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &AdminUser{Username: username, PasswordHash: string(hash), Role: role}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUsernameTaken
+	}
+	return user, nil
+}
+
+// BootstrapAdminUser creates an admin with the given credentials if there are
+// no admin users yet, so a fresh deployment can log in. It reports whether the
+// user was created.
+func BootstrapAdminUser(username, password string) (bool, error) {
+	var count int64
+	if err := DB.Model(&AdminUser{}).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	if _, err := CreateAdminUser(username, password, AdminRoleAdmin); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListAdminUsers returns every admin user by username.
+func ListAdminUsers() ([]AdminUser, error) {
+	var users []AdminUser
+	err := DB.Order("username").Find(&users).Error
+	return users, err
+}
+
+// DeleteAdminUser deletes an admin user and logs them out. It returns
+// ErrNotFound if there is no such user.
+func DeleteAdminUser(username string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user AdminUser
+		if err := tx.Where("username = ?", username).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&AdminSession{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+}
+
+// AuthenticateAdminUser returns the admin user with username if password is
+// theirs, or ErrInvalidCredentials.
+func AuthenticateAdminUser(username, password string) (*AdminUser, error) {
+	var user AdminUser
+	err := DB.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// CreateAdminSession logs userID in for ttl and returns the session token.
+// Expired sessions are cleaned up along the way.
+func CreateAdminSession(userID uint, ttl time.Duration) (token string, expiresAt time.Time, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, err
+	}
+	token = base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now()
+	if err := DB.Where("expires_at <= ?", now).Delete(&AdminSession{}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	session := &AdminSession{TokenHash: sessionTokenHash(token), UserID: userID, ExpiresAt: now.Add(ttl), CreatedAt: now}
+	if err := DB.Create(session).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// GetAdminSessionUser returns the user logged in with token, or ErrNotFound if
+// the session doesn't exist or has expired.
+func GetAdminSessionUser(token string) (*AdminUser, error) {
+	var user AdminUser
+	err := DB.Joins("JOIN admin_sessions ON admin_sessions.user_id = admin_users.id").
+		Where("admin_sessions.token_hash = ? AND admin_sessions.expires_at > ?", sessionTokenHash(token), time.Now()).
+		First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteAdminSession logs the session with token out.
+func DeleteAdminSession(token string) error {
+	return DB.Where("token_hash = ?", sessionTokenHash(token)).Delete(&AdminSession{}).Error
+}
+
+// sessionTokenHash returns the hash a session token is stored under.
+func sessionTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminUsers(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	created, err := BootstrapAdminUser("root", "correct horse")
+	require.NoError(t, err)
+	assert.True(t, created)
+	created, err = BootstrapAdminUser("other", "battery staple")
+	require.NoError(t, err)
+	assert.False(t, created, "only an empty table is bootstrapped")
+
+	_, err = CreateAdminUser("alice", "password1", AdminRoleViewer)
+	require.NoError(t, err)
+	_, err = CreateAdminUser("alice", "password2", AdminRoleAdmin)
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	_, err = CreateAdminUser("bob", "password3", "superuser")
+	assert.Error(t, err)
+
+	users, err := ListAdminUsers()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "alice", users[0].Username)
+	assert.NotContains(t, users[0].PasswordHash, "password1")
+
+	user, err := AuthenticateAdminUser("alice", "password1")
+	require.NoError(t, err)
+	assert.Equal(t, AdminRoleViewer, user.Role)
+	_, err = AuthenticateAdminUser("alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = AuthenticateAdminUser("nobody", "password1")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Sessions
+	token, expiresAt, err := CreateAdminSession(user.ID, time.Hour)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+	var stored AdminSession
+	require.NoError(t, DB.First(&stored).Error)
+	assert.NotEqual(t, token, stored.TokenHash, "tokens are stored hashed")
+
+	sessionUser, err := GetAdminSessionUser(token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", sessionUser.Username)
+	_, err = GetAdminSessionUser("made-up")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	expired, _, err := CreateAdminSession(user.ID, -time.Minute)
+	require.NoError(t, err)
+	_, err = GetAdminSessionUser(expired)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, DeleteAdminSession(token))
+	_, err = GetAdminSessionUser(token)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a user logs them out
+	token, _, err = CreateAdminSession(user.ID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, DeleteAdminUser("alice"))
+	_, err = GetAdminSessionUser(token)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, DeleteAdminUser("alice"), ErrNotFound)
+}
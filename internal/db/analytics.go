@@ -0,0 +1,190 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+// Site-wide analytics over a range of UTC days, from the rolled-up daily stats
+// and the raw click events not rolled up yet.
+
+// dayRange returns the UTC dates of from and to, inclusive, as stored in the
+// daily tables, and the instants bounding them for raw events.
+func dayRange(from, to time.Time) (fromDay, toDay string, start, end time.Time) {
+	fromDay, toDay = from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly)
+	start, _ = time.Parse(time.DateOnly, fromDay)
+	end, _ = time.Parse(time.DateOnly, toDay)
+	return fromDay, toDay, start, end.AddDate(0, 0, 1)
+}
+
+// LinkClicks is how often a short code was clicked.
+type LinkClicks struct {
+	ShortCode string `json:"short_code"`
+	Clicks    int64  `json:"clicks"`
+	BotClicks int64  `json:"bot_clicks"`
+}
+
+// GetTopLinks returns the limit most clicked short codes from the UTC day of
+// from to that of to, most clicks first.
+func GetTopLinks(from, to time.Time, limit int) ([]LinkClicks, error) {
+	fromDay, toDay, start, end := dayRange(from, to)
+	rolled := DB.Model(&DailyClickStat{}).Select("short_code, clicks, bot_clicks").
+		Where("day >= ? AND day <= ?", fromDay, toDay)
+	raw := unrolledClicks().
+		Select("short_code, 1 AS clicks, CASE WHEN ua_class = ? THEN 1 ELSE 0 END AS bot_clicks", UAClassBot).
+		Where("clicked_at >= ? AND clicked_at < ?", start, end)
+	var top []LinkClicks
+	err := DB.Table("(? UNION ALL ?) AS clicks", rolled, raw).
+		Select("short_code, SUM(clicks) AS clicks, SUM(bot_clicks) AS bot_clicks").
+		Group("short_code").Order("clicks DESC, short_code").Limit(limit).Scan(&top).Error
+	if err != nil {
+		return nil, err
+	}
+	return top, nil
+}
+
+// DayClicks is how many clicks all links received on one UTC day.
+type DayClicks struct {
+	Day       string `json:"day"` // YYYY-MM-DD
+	Clicks    int64  `json:"clicks"`
+	BotClicks int64  `json:"bot_clicks"`
+}
+
+// GetClicksPerDay returns the clicks on all links for each UTC day from from
+// to to, days without clicks included.
+func GetClicksPerDay(from, to time.Time) ([]DayClicks, error) {
+	fromDay, toDay, start, end := dayRange(from, to)
+	var rolled []DayClicks
+	err := DB.Model(&DailyClickStat{}).Select("day, SUM(clicks) AS clicks, SUM(bot_clicks) AS bot_clicks").
+		Where("day >= ? AND day <= ?", fromDay, toDay).Group("day").Scan(&rolled).Error
+	if err != nil {
+		return nil, err
+	}
+	perDay := make(map[string]*DayClicks)
+	for i := range rolled {
+		perDay[rolled[i].Day] = &rolled[i]
+	}
+	days := []DayClicks{}
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		entry := DayClicks{Day: key}
+		if r, ok := perDay[key]; ok {
+			entry = *r
+		}
+		days = append(days, entry)
+	}
+
+	// Raw events are bucketed here, since databases disagree on how to truncate
+	// a timestamp to its day. Between rollups there are few of them.
+	rows, err := unrolledClicks().Select("clicked_at, ua_class").
+		Where("clicked_at >= ? AND clicked_at < ?", start, end).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var clickedAt time.Time
+		var uaClass string
+		if err := rows.Scan(&clickedAt, &uaClass); err != nil {
+			return nil, err
+		}
+		i := int(clickedAt.UTC().Sub(start) / (24 * time.Hour))
+		if i < 0 || i >= len(days) {
+			continue
+		}
+		days[i].Clicks++
+		if uaClass == UAClassBot {
+			days[i].BotClicks++
+		}
+	}
+	return days, rows.Err()
+}
+
+// GetTopValues returns the limit most clicked values of a dimension across all
+// links from the UTC day of from to that of to, such as the busiest crawlers
+// for DimensionBot, most clicks first.
+func GetTopValues(dimension string, from, to time.Time, limit int) ([]ClickCount, error) {
+	fromDay, toDay, start, end := dayRange(from, to)
+	counts := make(map[string]int64)
+	var rolled []ClickCount
+	err := DB.Model(&DailyClickBreakdown{}).Select("value, SUM(clicks) AS clicks").
+		Where("dimension = ? AND day >= ? AND day <= ?", dimension, fromDay, toDay).
+		Group("value").Scan(&rolled).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rolled {
+		counts[r.Value] += r.Clicks
+	}
+	for _, b := range breakdownColumns {
+		if b.dimension != dimension {
+			continue
+		}
+		query := unrolledClicks().Select("COALESCE("+b.column+", '') AS value, COUNT(*) AS clicks").
+			Where("clicked_at >= ? AND clicked_at < ?", start, end).Group("COALESCE(" + b.column + ", '')")
+		if b.uaClass != "" {
+			query = query.Where("ua_class = ?", b.uaClass)
+		}
+		var rows []ClickCount
+		if err := query.Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			value := row.Value
+			if dimension == DimensionReferrer {
+				value = referrerHost(value)
+			}
+			counts[value] += row.Clicks
+		}
+	}
+	return topCounts(counts, limit), nil
+}
+
+// topCounts orders counts by clicks, then value, and keeps the first limit.
+func topCounts(counts map[string]int64, limit int) []ClickCount {
+	top := make([]ClickCount, 0, len(counts))
+	for value, clicks := range counts {
+		top = append(top, ClickCount{Value: value, Clicks: clicks})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Clicks != top[j].Clicks {
+			return top[i].Clicks > top[j].Clicks
+		}
+		return top[i].Value < top[j].Value
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
+
+// RenderOutcomes counts how the renders of links created in a period turned
+// out.
+type RenderOutcomes struct {
+	Links       int64   `json:"links"`
+	Completed   int64   `json:"completed"`
+	Failed      int64   `json:"failed"`
+	Pending     int64   `json:"pending"` // Still queued or rendering
+	Attempts    int64   `json:"attempts"`
+	FailureRate float64 `json:"failure_rate"` // Failed out of the finished renders, 0 if none finished
+}
+
+// GetRenderOutcomes counts the render statuses of the links created from the
+// UTC day of from to that of to, deleted ones included.
+func GetRenderOutcomes(from, to time.Time) (*RenderOutcomes, error) {
+	_, _, start, end := dayRange(from, to)
+	var outcomes RenderOutcomes
+	err := DB.Unscoped().Model(&Link{}).Select(`COUNT(*) AS links,
+		COALESCE(SUM(CASE WHEN render_status = ? THEN 1 ELSE 0 END), 0) AS completed,
+		COALESCE(SUM(CASE WHEN render_status = ? THEN 1 ELSE 0 END), 0) AS failed,
+		COALESCE(SUM(render_attempts), 0) AS attempts`, RenderStatusCompleted, RenderStatusFailed).
+		Where("created_at >= ? AND created_at < ?", start, end).Scan(&outcomes).Error
+	if err != nil {
+		return nil, err
+	}
+	outcomes.Pending = outcomes.Links - outcomes.Completed - outcomes.Failed
+	if finished := outcomes.Completed + outcomes.Failed; finished > 0 {
+		outcomes.FailureRate = float64(outcomes.Failed) / float64(finished)
+	}
+	return &outcomes, nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteAnalytics(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "TOP1", ClickedAt: yesterday, UAClass: UAClassBrowser},
+		{ShortCode: "TOP1", ClickedAt: yesterday, UAClass: UAClassBot, BotName: "Googlebot"},
+		{ShortCode: "TOP2", ClickedAt: yesterday, UAClass: UAClassBot, BotName: "bingbot"},
+		{ShortCode: "TOP3", ClickedAt: now.AddDate(0, 0, -10), UAClass: UAClassBrowser},
+	}))
+	_, err := RollupClickEvents(now.Add(-time.Second), true)
+	require.NoError(t, err)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "TOP2", ClickedAt: now, UAClass: UAClassBot, BotName: "bingbot"},
+		{ShortCode: "TOP2", ClickedAt: now, UAClass: UAClassBrowser},
+	}))
+
+	from := now.AddDate(0, 0, -2)
+	top, err := GetTopLinks(from, now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []LinkClicks{{"TOP2", 3, 2}, {"TOP1", 2, 1}}, top, "TOP3 was clicked before the range")
+	top, err = GetTopLinks(from, now, 1)
+	require.NoError(t, err)
+	assert.Len(t, top, 1)
+
+	days, err := GetClicksPerDay(from, now)
+	require.NoError(t, err)
+	assert.Equal(t, []DayClicks{
+		{Day: from.Format(time.DateOnly)},
+		{Day: yesterday.Format(time.DateOnly), Clicks: 3, BotClicks: 2},
+		{Day: now.Format(time.DateOnly), Clicks: 2, BotClicks: 1},
+	}, days)
+
+	crawlers, err := GetTopValues(DimensionBot, from, now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []ClickCount{{"bingbot", 2}, {"Googlebot", 1}}, crawlers)
+}
+
+func TestGetRenderOutcomes(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for code, status := range map[string]RenderStatus{
+		"DONE1": RenderStatusCompleted, "DONE2": RenderStatusCompleted, "FAIL1": RenderStatusFailed, "WAIT1": RenderStatusPending,
+	} {
+		require.NoError(t, CreateLink(&Link{ShortCode: code, OriginalURL: "https://" + code + ".com", RenderStatus: status, RenderAttempts: 1}))
+	}
+	old := &Link{ShortCode: "OLD1", OriginalURL: "https://old.com", RenderStatus: RenderStatusFailed}
+	require.NoError(t, CreateLink(old))
+	require.NoError(t, DB.Model(old).Update("created_at", time.Now().AddDate(0, 0, -40)).Error)
+
+	now := time.Now().UTC()
+	outcomes, err := GetRenderOutcomes(now.AddDate(0, 0, -6), now)
+	require.NoError(t, err)
+	assert.Equal(t, &RenderOutcomes{Links: 4, Completed: 2, Failed: 1, Pending: 1, Attempts: 4, FailureRate: 1.0 / 3}, outcomes)
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ArchivedLink is a link moved out of the links table by ArchiveInactiveLinks.
+// The row is kept as JSON so the archive needs no changes when links gains
+// columns; the columns alongside it are what lookups and the janitor need.
+type ArchivedLink struct {
+	ID                  uint      `gorm:"primaryKey"`
+	TenantID            string    `gorm:"size:64;not null;default:''"`
+	ShortCode           string    `gorm:"uniqueIndex;not null"`
+	OriginalURL         string    `gorm:"not null;index"`
+	RenderedContentHash string    `gorm:"size:64;index"` // Keeps the shared snapshot from being purged while archived
+	Data                string    `gorm:"type:text;not null"`
+	ArchivedAt          time.Time `gorm:"not null;index"`
+}
+
+// archiveBatchSize is how many links ArchiveInactiveLinks moves per transaction.
+const archiveBatchSize = 500
+
+// rawLinks loads links exactly as stored, skipping AfterFind so archiving neither
+// loads nor decompresses their snapshots.
+func rawLinks() *gorm.DB {
+	return DB.Session(&gorm.Session{SkipHooks: true, NewDB: true})
+}
+
+// ArchiveInactiveLinks moves live links not accessed since cutoff into the
+// archive. Links never clicked count from their creation time, and links being
+// rendered are left alone. Soft-deleted links stay in place so their short codes
+// remain reserved. It returns the number of links archived.
+func ArchiveInactiveLinks(cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		var links []Link
+		err := rawLinks().Where("COALESCE(last_accessed_at, created_at) < ? AND render_status <> ?", cutoff, RenderStatusRendering).
+			Order("id").Limit(archiveBatchSize).Find(&links).Error
+		if err != nil {
+			return total, err
+		}
+		if len(links) == 0 {
+			return total, nil
+		}
+
+		archived := make([]ArchivedLink, len(links))
+		ids := make([]uint, len(links))
+		codes := make([]string, len(links))
+		now := time.Now()
+		for i, link := range links {
+			data, err := json.Marshal(link)
+			if err != nil {
+				return total, err
+			}
+			archived[i] = ArchivedLink{
+				TenantID:            link.TenantID,
+				ShortCode:           link.ShortCode,
+				OriginalURL:         link.OriginalURL,
+				RenderedContentHash: link.RenderedContentHash,
+				Data:                string(data),
+				ArchivedAt:          now,
+			}
+			ids[i] = link.ID
+			codes[i] = link.ShortCode
+		}
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.CreateInBatches(archived, 100).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Where("id IN ?", ids).Delete(&Link{}).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		invalidateLinks(codes...)
+		total += int64(len(links))
+		if len(links) < archiveBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// isArchived reports whether an archived link holds shortCode.
+func isArchived(shortCode string) (bool, error) {
+	var count int64
+	err := DB.Model(&ArchivedLink{}).Where("short_code = ?", shortCode).Count(&count).Error
+	return count > 0, err
+}
+
+// rehydrate moves the archived link matching query back into the links table. It
+// returns ErrNotFound if there is none. The link takes back ownership of its URL
+// unless another link was created for it in the meantime.
+func rehydrate(query string, args ...interface{}) error {
+	var archived ArchivedLink
+	if err := DB.Where(query, args...).Order("id").First(&archived).Error; err != nil {
+		return err
+	}
+	var link Link
+	if err := json.Unmarshal([]byte(archived.Data), &link); err != nil {
+		return err
+	}
+	link.ID = 0 // The old id may have been reused since
+	now := time.Now()
+	link.LastAccessedAt = &now
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		tx = tx.Session(&gorm.Session{SkipHooks: true})
+		key := URLKey(link.TenantID, link.OriginalURL)
+		link.URLKey = &key
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&link)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// The URL belongs to a newer link; keep working under the old short code
+			link.URLKey = nil
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&archived).Error
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Archive: Rehydrated %s (%s)", link.ShortCode, link.OriginalURL)
+	return nil
+}
+
+// withArchive runs lookup and, if the link isn't found, rehydrates it from the
+// archive and looks it up again.
+func withArchive(lookup func() (*Link, error), query string, args ...interface{}) (*Link, error) {
+	link, err := lookup()
+	if !errors.Is(err, ErrNotFound) {
+		return link, err
+	}
+	if rehydrateErr := rehydrate(query, args...); rehydrateErr != nil {
+		if errors.Is(rehydrateErr, ErrNotFound) {
+			return nil, err
+		}
+		// A concurrent request may have rehydrated the link first
+		log.Printf("Archive: Failed to rehydrate %v: %v", args, rehydrateErr)
+	}
+	return lookup()
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveAndRehydrate(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for _, code := range []string{"OLD001", "OLD002", "RECENT", "GONE01"} {
+		require.NoError(t, CreateLink(&Link{ShortCode: code, OriginalURL: "https://" + code + ".com"}))
+		require.NoError(t, SaveRenderResult(code, &RenderResult{HTMLContent: "<html>" + code + "</html>"}))
+	}
+	longAgo := time.Now().Add(-90 * 24 * time.Hour)
+	require.NoError(t, DB.Model(&Link{}).Where("short_code <> ?", "RECENT").Update("created_at", longAgo).Error)
+	require.NoError(t, DeleteLink("GONE01"))
+
+	archived, err := ArchiveInactiveLinks(time.Now().Add(-30 * 24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), archived, "recently created and soft-deleted links stay")
+	var live int64
+	require.NoError(t, DB.Unscoped().Model(&Link{}).Count(&live).Error)
+	assert.Equal(t, int64(2), live)
+
+	// Archived snapshots survive the orphan purge
+	deleted, _, err := purgeOrphanedContent(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	// Archived codes are never handed out again
+	codes := []string{"OLD001", "FRESH1"}
+	stored, created, err := AllocateLink(&Link{OriginalURL: "https://fresh.com"}, func() (string, error) {
+		code := codes[0]
+		codes = codes[1:]
+		return code, nil
+	}, 5)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "FRESH1", stored.ShortCode)
+
+	// Requesting an archived code moves it back with its snapshot
+	link, err := GetLinkByShortCode("OLD001")
+	require.NoError(t, err)
+	assert.Equal(t, "<html>OLD001</html>", link.RenderedHTMLContent)
+	assert.Equal(t, RenderStatusCompleted, link.RenderStatus)
+	assert.WithinDuration(t, longAgo, link.CreatedAt, time.Second)
+	require.NotNil(t, link.LastAccessedAt)
+	require.NotNil(t, link.URLKey)
+	var remaining int64
+	require.NoError(t, DB.Model(&ArchivedLink{}).Count(&remaining).Error)
+	assert.Equal(t, int64(1), remaining)
+
+	// So does looking up an archived URL
+	link, err = GetLinkByOriginalURL("", "https://OLD002.com")
+	require.NoError(t, err)
+	assert.Equal(t, "OLD002", link.ShortCode)
+
+	_, err = GetLinkByShortCode("MISSING")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRehydrateAfterURLReused(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	require.NoError(t, CreateLink(&Link{ShortCode: "OLD001", OriginalURL: "https://reused.com"}))
+	archived, err := ArchiveInactiveLinks(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), archived)
+
+	// A new link for the URL is created while the old one is archived
+	_, created, err := CreateLinkIfAbsent(&Link{ShortCode: "NEW001", OriginalURL: "https://reused.com"})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	old, err := GetLinkByShortCode("OLD001")
+	require.NoError(t, err)
+	assert.Nil(t, old.URLKey, "the newer link keeps the URL")
+	current, err := GetLinkByOriginalURL("", "https://reused.com")
+	require.NoError(t, err)
+	assert.Equal(t, "NEW001", current.ShortCode)
+}
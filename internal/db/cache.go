@@ -0,0 +1,72 @@
+package db
+
+// LinkCache caches links by short code in front of GetLinkByShortCode, taking
+// load off the database on the redirect path. Implementations must be safe for
+// concurrent use and treat their own failures as misses.
+type LinkCache interface {
+	Get(shortCode string) (*Link, bool)
+	Set(link *Link)
+	Invalidate(shortCodes ...string)
+}
+
+// linkCache is consulted by GetLinkByShortCode when set.
+var linkCache LinkCache
+
+// cacheMaxHTMLBytes is the largest snapshot cached along with its link.
+var cacheMaxHTMLBytes int
+
+// SetLinkCache installs c in front of GetLinkByShortCode; nil removes it. Links
+// whose snapshot exceeds maxHTMLBytes are cached without it, and the snapshot
+// is loaded from the content table on a hit.
+func SetLinkCache(c LinkCache, maxHTMLBytes int) {
+	linkCache = c
+	cacheMaxHTMLBytes = maxHTMLBytes
+}
+
+// cachedLink looks shortCode up in the cache, restoring a snapshot left out of
+// the cached entry.
+func cachedLink(shortCode string) (*Link, bool) {
+	if linkCache == nil {
+		return nil, false
+	}
+	link, ok := linkCache.Get(shortCode)
+	if !ok {
+		return nil, false
+	}
+	if link.RenderedHTMLContent == "" && link.RenderedContentHash != "" {
+		// Snapshots stored by hash are never empty, so this one was too large to cache
+		var content RenderedContent
+		if err := DB.Select("data", "encoding").Where("hash = ?", link.RenderedContentHash).First(&content).Error; err != nil {
+			return nil, false
+		}
+		link.RenderedHTMLCompressed = content.Data
+		link.HTMLEncoding = content.Encoding
+		if err := link.decodeHTML(); err != nil {
+			return nil, false
+		}
+	}
+	return link, true
+}
+
+// cacheLink stores a freshly loaded link, leaving out a snapshot over the size cap.
+func cacheLink(link *Link) {
+	if linkCache == nil {
+		return
+	}
+	if len(link.RenderedHTMLContent) > cacheMaxHTMLBytes {
+		if link.RenderedContentHash == "" {
+			return // Inline snapshots from before deduplication can't be restored by hash
+		}
+		stripped := *link
+		stripped.RenderedHTMLContent = ""
+		link = &stripped
+	}
+	linkCache.Set(link)
+}
+
+// invalidateLinks drops links from the cache after they change.
+func invalidateLinks(shortCodes ...string) {
+	if linkCache != nil && len(shortCodes) > 0 {
+		linkCache.Invalidate(shortCodes...)
+	}
+}
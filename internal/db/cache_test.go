@@ -0,0 +1,71 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapCache is a LinkCache that counts hits, for tests.
+type mapCache struct {
+	links map[string]Link
+	hits  int
+}
+
+func (m *mapCache) Get(shortCode string) (*Link, bool) {
+	link, ok := m.links[shortCode]
+	if ok {
+		m.hits++
+	}
+	return &link, ok
+}
+
+func (m *mapCache) Set(link *Link) { m.links[link.ShortCode] = *link }
+
+func (m *mapCache) Invalidate(shortCodes ...string) {
+	for _, code := range shortCodes {
+		delete(m.links, code)
+	}
+}
+
+func TestLinkCache(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+	c := &mapCache{links: make(map[string]Link)}
+	SetLinkCache(c, 100)
+	defer SetLinkCache(nil, 0)
+
+	require.NoError(t, CreateLink(&Link{ShortCode: "CACHE1", OriginalURL: "https://cache.com"}))
+	_, err := GetLinkByShortCode("CACHE1")
+	require.NoError(t, err)
+	assert.Contains(t, c.links, "CACHE1", "read-through fills the cache")
+	link, err := GetLinkByShortCode("CACHE1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.hits)
+	assert.Equal(t, RenderStatusPending, link.RenderStatus)
+
+	// Writes invalidate, so the next read sees the new state
+	require.NoError(t, SaveRenderResult("CACHE1", &RenderResult{HTMLContent: "<html>small</html>"}))
+	assert.NotContains(t, c.links, "CACHE1")
+	link, err = GetLinkByShortCode("CACHE1")
+	require.NoError(t, err)
+	assert.Equal(t, RenderStatusCompleted, link.RenderStatus)
+	assert.Equal(t, "<html>small</html>", c.links["CACHE1"].RenderedHTMLContent)
+
+	// Snapshots over the cap are cached without HTML and loaded on a hit
+	large := "<html>" + strings.Repeat("x", 200) + "</html>"
+	require.NoError(t, SaveRenderResult("CACHE1", &RenderResult{HTMLContent: large}))
+	_, err = GetLinkByShortCode("CACHE1")
+	require.NoError(t, err)
+	assert.Empty(t, c.links["CACHE1"].RenderedHTMLContent)
+	link, err = GetLinkByShortCode("CACHE1")
+	require.NoError(t, err)
+	assert.Equal(t, large, link.RenderedHTMLContent)
+
+	require.NoError(t, DeleteLink("CACHE1"))
+	_, err = GetLinkByShortCode("CACHE1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotContains(t, c.links, "CACHE1", "misses are not cached")
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Click dimensions broken down by GetLinkClickStats.
+const (
+	DimensionReferrer = "referrer" // Referring host, "" for direct visits
+	DimensionDevice   = "device"   // People's device class
+	DimensionBrowser  = "browser"  // People's browser
+	DimensionPlatform = "platform" // People's operating system
+	DimensionCountry  = "country"  // Country of the client IP
+	DimensionBot      = "bot"      // Crawler name of bots' clicks
+)
+
+// maxBreakdownValueLength caps the values stored in daily_click_breakdowns.
+const maxBreakdownValueLength = 255
+
+// DailyClickBreakdown is the number of clicks a short code received on one UTC
+// day with one value of a dimension, such as the referrer host example.com.
+// RollupClickEvents keeps these along with DailyClickStat.
+type DailyClickBreakdown struct {
+	ShortCode string `gorm:"primaryKey;size:64"`
+	Day       string `gorm:"primaryKey;size:10"` // UTC date as YYYY-MM-DD
+	Dimension string `gorm:"primaryKey;size:16"` // One of the Dimension constants
+	Value     string `gorm:"primaryKey;size:255"`
+	Clicks    int64  `gorm:"not null;default:0"`
+}
+
+// breakdownColumns maps each dimension to the click_events column it counts and
+// the clicks it covers, "" for all of them.
+var breakdownColumns = []struct {
+	dimension string
+	column    string
+	uaClass   string
+}{
+	{DimensionReferrer, "referrer", ""},
+	{DimensionDevice, "device_class", UAClassBrowser},
+	{DimensionBrowser, "browser", UAClassBrowser},
+	{DimensionPlatform, "platform", UAClassBrowser},
+	{DimensionCountry, "country", ""},
+	{DimensionBot, "bot_name", UAClassBot},
+}
+
+// breakdownValues returns the value of each dimension that covers e.
+func breakdownValues(e ClickEvent) map[string]string {
+	values := map[string]string{
+		DimensionReferrer: referrerHost(e.Referrer),
+		DimensionCountry:  e.Country,
+	}
+	if e.UAClass == UAClassBot {
+		values[DimensionBot] = e.BotName
+	} else {
+		values[DimensionDevice] = e.DeviceClass
+		values[DimensionBrowser] = e.Browser
+		values[DimensionPlatform] = e.Platform
+	}
+	for dimension, value := range values {
+		if len(value) > maxBreakdownValueLength {
+			values[dimension] = value[:maxBreakdownValueLength]
+		}
+	}
+	return values
+}
+
+// referrerHost returns the lowercased host of a Referer header, or the header
+// itself if it isn't a URL.
+func referrerHost(referrer string) string {
+	if u, err := url.Parse(referrer); err == nil && u.Host != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	return referrer
+}
+
+// ClickCount is how many clicks had one value of a dimension.
+type ClickCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// LinkClickStats sums up a link's clicks since a day, breaking them down by
+// each dimension, most clicks first.
+type LinkClickStats struct {
+	Clicks     int64                   `json:"clicks"`
+	BotClicks  int64                   `json:"bot_clicks"`
+	Breakdowns map[string][]ClickCount `json:"breakdowns"`
+}
+
+// GetLinkClickStats sums up the clicks on shortCode from the start of the UTC
+// day since on, both rolled up and raw. Each breakdown holds its top limit
+// values.
+func GetLinkClickStats(shortCode string, since time.Time, limit int) (*LinkClickStats, error) {
+	day := since.UTC().Format(time.DateOnly)
+	start, _ := time.Parse(time.DateOnly, day)
+	stats := &LinkClickStats{Breakdowns: make(map[string][]ClickCount)}
+
+	// Rolled-up days
+	var totals struct {
+		Clicks    int64
+		BotClicks int64
+	}
+	err := DB.Model(&DailyClickStat{}).Select("COALESCE(SUM(clicks), 0) AS clicks, COALESCE(SUM(bot_clicks), 0) AS bot_clicks").
+		Where("short_code = ? AND day >= ?", shortCode, day).Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Clicks, stats.BotClicks = totals.Clicks, totals.BotClicks
+	var rolled []DailyClickBreakdown
+	err = DB.Model(&DailyClickBreakdown{}).Select("dimension, value, SUM(clicks) AS clicks").
+		Where("short_code = ? AND day >= ?", shortCode, day).Group("dimension, value").Scan(&rolled).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]map[string]int64)
+	add := func(dimension, value string, clicks int64) {
+		if counts[dimension] == nil {
+			counts[dimension] = make(map[string]int64)
+		}
+		counts[dimension][value] += clicks
+	}
+	for _, r := range rolled {
+		add(r.Dimension, r.Value, r.Clicks)
+	}
+
+	// Raw events not rolled up yet
+	raw := func() *gorm.DB {
+		return unrolledClicks().Where("short_code = ? AND clicked_at >= ?", shortCode, start)
+	}
+	var rawTotals struct {
+		Clicks    int64
+		BotClicks int64
+	}
+	err = raw().Select("COUNT(*) AS clicks, COALESCE(SUM(CASE WHEN ua_class = ? THEN 1 ELSE 0 END), 0) AS bot_clicks", UAClassBot).
+		Scan(&rawTotals).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Clicks += rawTotals.Clicks
+	stats.BotClicks += rawTotals.BotClicks
+	for _, b := range breakdownColumns {
+		query := raw().Select("COALESCE(" + b.column + ", '') AS value, COUNT(*) AS clicks").
+			Group("COALESCE(" + b.column + ", '')")
+		if b.uaClass != "" {
+			query = query.Where("ua_class = ?", b.uaClass)
+		}
+		var rows []ClickCount
+		if err := query.Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			value := row.Value
+			if b.dimension == DimensionReferrer {
+				value = referrerHost(value)
+			}
+			add(b.dimension, value, row.Clicks)
+		}
+	}
+
+	for _, b := range breakdownColumns {
+		stats.Breakdowns[b.dimension] = topCounts(counts[b.dimension], limit)
+	}
+	return stats, nil
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLinkClickStats(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "STATS1", ClickedAt: yesterday, UAClass: UAClassBrowser, Referrer: "https://News.example.com/a",
+			DeviceClass: "mobile", Browser: "Chrome", Platform: "Android", Country: "DE"},
+		{ShortCode: "STATS1", ClickedAt: yesterday, UAClass: UAClassBot, BotName: "Googlebot", Country: "US"},
+		{ShortCode: "STATS1", ClickedAt: now.AddDate(0, 0, -40), UAClass: UAClassBrowser, Country: "FR"},
+		{ShortCode: "OTHER1", ClickedAt: yesterday, UAClass: UAClassBrowser, Country: "DE"},
+	}))
+	// Yesterday's events are rolled up, today's stay raw
+	_, err := RollupClickEvents(now.Add(-time.Second), false)
+	require.NoError(t, err)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "STATS1", ClickedAt: now, UAClass: UAClassBrowser, Referrer: "https://news.example.com/b",
+			DeviceClass: "desktop", Browser: "Firefox", Platform: "Linux", Country: "DE"},
+		{ShortCode: "STATS1", ClickedAt: now, UAClass: UAClassBrowser, DeviceClass: "mobile", Country: "DE"},
+	}))
+
+	stats, err := GetLinkClickStats("STATS1", now.AddDate(0, 0, -6), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Clicks, "the click 40 days ago is left out")
+	assert.Equal(t, int64(1), stats.BotClicks)
+	assert.Equal(t, []ClickCount{{"", 2}, {"news.example.com", 2}}, stats.Breakdowns[DimensionReferrer])
+	assert.Equal(t, []ClickCount{{"DE", 3}, {"US", 1}}, stats.Breakdowns[DimensionCountry])
+	assert.Equal(t, []ClickCount{{"mobile", 2}, {"desktop", 1}}, stats.Breakdowns[DimensionDevice], "bots have no device")
+	assert.Equal(t, []ClickCount{{"Googlebot", 1}}, stats.Breakdowns[DimensionBot])
+
+	stats, err = GetLinkClickStats("STATS1", now.AddDate(0, 0, -6), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []ClickCount{{"DE", 3}}, stats.Breakdowns[DimensionCountry])
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+// User agent classes recorded on click events.
+const (
+	UAClassBrowser = "browser"
+	UAClassBot     = "bot"
+)
+
+// ClickEvent records a single request for a short code.
+type ClickEvent struct {
+	ID          uint      `gorm:"primaryKey;index:idx_click_events_rolled_up,priority:2"`
+	ShortCode   string    `gorm:"size:64;not null;index"`
+	ClickedAt   time.Time `gorm:"not null;index"`
+	UAClass     string    `gorm:"size:16"` // UAClassBrowser or UAClassBot
+	Referrer    string    `gorm:"type:text"`
+	IPHash      string    `gorm:"size:64"` // Salted SHA-256 of the client IP, never the IP itself
+	BotName     string    `gorm:"size:64"` // Crawler that made the request, e.g. Googlebot, empty if unknown or a browser
+	Browser     string    `gorm:"size:64"` // Browser of a person's click, e.g. Chrome, empty for bots or if unknown
+	Platform    string    `gorm:"size:64"` // Operating system of a person's click, e.g. Windows, empty for bots or if unknown
+	DeviceClass string    `gorm:"size:16"` // Desktop, mobile or tablet for a person's click, empty for bots or if unknown
+	Country     string    `gorm:"size:2"`  // ISO country code of the client IP, empty without a GeoIP database
+
+	// Whether the daily stats count the event. Rolled up events are only kept
+	// with CLICK_RAW_RETENTION_DAYS set, until the retention job prunes them.
+	RolledUp bool `gorm:"not null;default:false;index:idx_click_events_rolled_up,priority:1"`
+}
+
+// RecordClickEvents inserts a batch of click events and advances the
+// last_accessed_at of the clicked links, in one transaction.
+func RecordClickEvents(events []ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return store.RecordClickEvents(events)
+}
+
+// lastAccess returns the latest click per short code in events, ordered by short
+// code so concurrent flushes update links in the same order.
+func lastAccess(events []ClickEvent) ([]string, map[string]time.Time) {
+	latest := make(map[string]time.Time)
+	for _, e := range events {
+		if e.ClickedAt.After(latest[e.ShortCode]) {
+			latest[e.ShortCode] = e.ClickedAt
+		}
+	}
+	codes := make([]string, 0, len(latest))
+	for code := range latest {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes, latest
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+// HTMLEncodingGzip marks rendered HTML stored gzip-compressed, either in a
+// RenderedContent row or, for links written before content deduplication, in the
+// link's RenderedHTMLCompressed. Links with an empty encoding keep it as plain
+// text in RenderedHTMLContent, which is how rows written before compression look.
+const HTMLEncodingGzip = "gzip"
+
+// compressHTML gzips rendered HTML for storage.
+func compressHTML(html string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, html); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// htmlColumns stores html in the shared content table and returns the link column
+// values that reference it. Empty content is stored as no reference at all so
+// failed renders stay recognisable by their empty content.
+func htmlColumns(w contentWriter, html string) (map[string]interface{}, error) {
+	hash := ""
+	if html != "" {
+		var err error
+		if hash, err = storeContent(w, html); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{
+		"rendered_content_hash":    hash,
+		"rendered_html_content":    "",
+		"rendered_html_compressed": nil,
+		"html_encoding":            "",
+	}, nil
+}
+
+// encodeHTML moves RenderedHTMLContent into the shared content table before the link is inserted.
+func (l *Link) encodeHTML(w contentWriter) error {
+	if l.RenderedHTMLContent == "" {
+		return nil
+	}
+	hash, err := storeContent(w, l.RenderedHTMLContent)
+	if err != nil {
+		return err
+	}
+	l.RenderedContentHash = hash
+	l.RenderedHTMLContent = ""
+	return nil
+}
+
+// decodeHTML restores RenderedHTMLContent from its stored encoding, so callers
+// never see compressed or encrypted content.
+func (l *Link) decodeHTML() error {
+	if l.HTMLEncoding == "" {
+		return nil
+	}
+	html, err := decodeContent(l.HTMLEncoding, l.RenderedHTMLCompressed)
+	if err != nil {
+		return fmt.Errorf("failed to decode rendered HTML of %s: %w", l.ShortCode, err)
+	}
+	l.RenderedHTMLContent = html
+	l.RenderedHTMLCompressed = nil
+	l.HTMLEncoding = ""
+	return nil
+}
+
+// decodeContent returns the HTML stored as data in encoding.
+func decodeContent(encoding string, data []byte) (string, error) {
+	switch encoding {
+	case HTMLEncodingGzipAESGCM:
+		var err error
+		if data, err = decryptSnapshot(data); err != nil {
+			return "", err
+		}
+		fallthrough
+	case HTMLEncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		html, err := io.ReadAll(zr)
+		if err != nil {
+			return "", err
+		}
+		return string(html), nil
+	default:
+		return "", fmt.Errorf("unknown HTML encoding %q", encoding)
+	}
+}
+
+// AfterFind loads and decompresses the rendered HTML of links loaded through GORM.
+func (l *Link) AfterFind(tx *gorm.DB) error {
+	if l.RenderedContentHash != "" {
+		var content RenderedContent
+		err := tx.Session(&gorm.Session{NewDB: true}).Select("data", "encoding").
+			Where("hash = ?", l.RenderedContentHash).First(&content).Error
+		if err != nil {
+			return fmt.Errorf("failed to load rendered content of %s: %w", l.ShortCode, err)
+		}
+		l.RenderedHTMLCompressed = content.Data
+		l.HTMLEncoding = content.Encoding
+	}
+	return l.decodeHTML()
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyHTMLEncodings(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	compressed, err := compressHTML("<html>inline gzip</html>")
+	require.NoError(t, err)
+	now := time.Now()
+
+	// Rows written before content deduplication stored HTML inline, plain or gzipped
+	require.NoError(t, DB.Exec(
+		"INSERT INTO links (created_at, updated_at, short_code, original_url, rendered_html_content, render_status) VALUES (?, ?, ?, ?, ?, ?)",
+		now, now, "PLAIN1", "https://plain.com", "<html>plain</html>", RenderStatusCompleted,
+	).Error)
+	require.NoError(t, DB.Exec(
+		"INSERT INTO links (created_at, updated_at, short_code, original_url, rendered_html_compressed, html_encoding, render_status) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		now, now, "GZIP1", "https://gzip.com", compressed, HTMLEncodingGzip, RenderStatusCompleted,
+	).Error)
+
+	sqlDB, err := DB.DB()
+	require.NoError(t, err)
+	sqlStore, err := newSQLStore(sqlDB)
+	require.NoError(t, err)
+	defer sqlStore.Close()
+
+	for _, s := range []Store{gormStore{}, sqlStore} {
+		link, err := s.GetLinkByShortCode("PLAIN1")
+		require.NoError(t, err)
+		assert.Equal(t, "<html>plain</html>", link.RenderedHTMLContent)
+
+		link, err = s.GetLinkByShortCode("GZIP1")
+		require.NoError(t, err)
+		assert.Equal(t, "<html>inline gzip</html>", link.RenderedHTMLContent)
+		assert.Empty(t, link.RenderedHTMLCompressed)
+	}
+}
+
+func TestCompressHTML(t *testing.T) {
+	html := "<html><body>" + strings.Repeat("<p>Hello, crawler!</p>", 500) + "</body></html>"
+	compressed, err := compressHTML(html)
+	require.NoError(t, err)
+	assert.Less(t, len(compressed), len(html)/2)
+
+	link := &Link{RenderedHTMLCompressed: compressed, HTMLEncoding: HTMLEncodingGzip}
+	require.NoError(t, link.decodeHTML())
+	assert.Equal(t, html, link.RenderedHTMLContent)
+}
+
+func TestDecodeHTMLUnknownEncoding(t *testing.T) {
+	link := &Link{ShortCode: "BROTLI1", HTMLEncoding: "br"}
+	assert.Error(t, link.decodeHTML())
+}
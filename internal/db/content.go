@@ -0,0 +1,68 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// RenderedContent is a deduplicated snapshot. Links reference it by the SHA-256 of
+// the uncompressed HTML, so identical snapshots, e.g. many links to the same landing
+// page, are stored once.
+type RenderedContent struct {
+	Hash      string `gorm:"primaryKey;size:64"` // Hex SHA-256 of the uncompressed HTML
+	Data      []byte // HTML encoded as Encoding
+	Encoding  string // HTMLEncodingGzip, or HTMLEncodingGzipAESGCM when encrypted
+	CreatedAt time.Time
+	// Visible text of the HTML for SearchLinksByContent, NULL until BackfillSearchText
+	// reaches snapshots stored before search was added
+	TextContent string `gorm:"type:text"`
+}
+
+// contentWriter stores snapshots in the rendered_contents table. Each Store
+// implements it with its own query layer.
+type contentWriter interface {
+	contentExists(hash string) (bool, error)
+	insertContent(content *RenderedContent) error
+}
+
+// contentHash returns the key html is stored under, keyed when snapshots are encrypted.
+func contentHash(html string) string {
+	if encryptionEnabled() {
+		return encryptedContentHash(html)
+	}
+	sum := sha256.Sum256([]byte(html))
+	return hex.EncodeToString(sum[:])
+}
+
+// storeContent saves html unless an identical snapshot already exists, and
+// returns its hash. Inserts ignore conflicts, so concurrent saves of the same
+// snapshot are harmless.
+func storeContent(w contentWriter, html string) (string, error) {
+	hash := contentHash(html)
+	exists, err := w.contentExists(hash)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return hash, nil
+	}
+	content := &RenderedContent{Hash: hash, Encoding: HTMLEncodingGzip, CreatedAt: time.Now()}
+	if content.Data, err = compressHTML(html); err != nil {
+		return "", err
+	}
+	if encryptionEnabled() {
+		// Encrypted snapshots stay out of the search index, which would hold their text in the clear
+		if content.Data, err = encryptSnapshot(content.Data); err != nil {
+			return "", err
+		}
+		content.Encoding = HTMLEncodingGzipAESGCM
+	} else {
+		content.TextContent = searchText(html)
+	}
+	err = w.insertContent(content)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentDeduplication(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{"gorm", func(t *testing.T) Store { return gormStore{} }},
+		{"sql", func(t *testing.T) Store {
+			sqlDB, err := DB.DB()
+			require.NoError(t, err)
+			s, err := newSQLStore(sqlDB)
+			require.NoError(t, err)
+			return s
+		}},
+	}
+
+	html := "<html><body>" + strings.Repeat("<p>Same landing page</p>", 500) + "</body></html>"
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			defer teardownTestDB(t)
+			s := tt.store(t)
+			defer s.Close()
+
+			require.NoError(t, s.CreateLink(&Link{ShortCode: "SAME1", OriginalURL: "https://landing.com/?utm=a"}))
+			require.NoError(t, s.CreateLink(&Link{ShortCode: "SAME2", OriginalURL: "https://landing.com/?utm=b"}))
+			require.NoError(t, s.SaveRenderResult("SAME1", &RenderResult{HTMLContent: html}))
+			require.NoError(t, s.SaveRenderResult("SAME2", &RenderResult{HTMLContent: html}))
+
+			// Created with content: the caller's struct keeps its plain HTML
+			created := &Link{ShortCode: "SAME3", OriginalURL: "https://landing.com/?utm=c", RenderedHTMLContent: html}
+			require.NoError(t, s.CreateLink(created))
+			assert.Equal(t, html, created.RenderedHTMLContent)
+
+			// All three share a single compressed snapshot
+			var contents []RenderedContent
+			require.NoError(t, DB.Find(&contents).Error)
+			require.Len(t, contents, 1)
+			assert.Equal(t, contentHash(html), contents[0].Hash)
+			assert.Equal(t, HTMLEncodingGzip, contents[0].Encoding)
+			assert.Less(t, len(contents[0].Data), len(html)/2)
+
+			for _, code := range []string{"SAME1", "SAME2", "SAME3"} {
+				link, err := s.GetLinkByShortCode(code)
+				require.NoError(t, err)
+				assert.Equal(t, html, link.RenderedHTMLContent)
+				assert.Equal(t, contents[0].Hash, link.RenderedContentHash)
+
+				var inline Link
+				require.NoError(t, DB.Table("links").Where("short_code = ?", code).Select("rendered_html_content").Scan(&inline).Error)
+				assert.Empty(t, inline.RenderedHTMLContent, "HTML is not stored on the link itself")
+			}
+
+			// Clearing a link's content drops its reference but keeps the shared snapshot
+			require.NoError(t, s.UpdateLinkContent("SAME1", "", RenderStatusFailed))
+			link, err := s.GetLinkByShortCode("SAME1")
+			require.NoError(t, err)
+			assert.Empty(t, link.RenderedHTMLContent)
+			assert.Empty(t, link.RenderedContentHash)
+			link, err = s.GetLinkByShortCode("SAME2")
+			require.NoError(t, err)
+			assert.Equal(t, html, link.RenderedHTMLContent)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+// CrawlerStats sums up one crawler's visits to a short code.
+type CrawlerStats struct {
+	BotName       string    `json:"bot"`
+	Hits          int64     `json:"hits"`
+	LastCrawledAt time.Time `json:"last_crawled_at"`
+}
+
+// ListCrawls returns up to limit of the latest bot clicks on shortCode, newest
+// first.
+func ListCrawls(shortCode string, limit int) ([]ClickEvent, error) {
+	var crawls []ClickEvent
+	err := DB.Where("short_code = ? AND ua_class = ?", shortCode, UAClassBot).
+		Order("clicked_at DESC").Order("id DESC").Limit(limit).Find(&crawls).Error
+	return crawls, err
+}
+
+// GetCrawlerStats returns each crawler's hits on shortCode and when it last
+// came, most recent first. Bots whose name is unknown are summed up under "".
+func GetCrawlerStats(shortCode string) ([]CrawlerStats, error) {
+	var stats []CrawlerStats
+	err := DB.Model(&ClickEvent{}).Select("COALESCE(bot_name, '') AS bot_name, COUNT(*) AS hits").
+		Where("short_code = ? AND ua_class = ?", shortCode, UAClassBot).
+		Group("COALESCE(bot_name, '')").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	// The latest crawl is looked up per crawler, since drivers disagree on how
+	// they return MAX() of a timestamp
+	for i := range stats {
+		var latest ClickEvent
+		query := DB.Where("short_code = ? AND ua_class = ?", shortCode, UAClassBot)
+		if stats[i].BotName == "" {
+			query = query.Where("bot_name IS NULL OR bot_name = ''")
+		} else {
+			query = query.Where("bot_name = ?", stats[i].BotName)
+		}
+		if err := query.Order("clicked_at DESC").Take(&latest).Error; err != nil {
+			return nil, err
+		}
+		stats[i].LastCrawledAt = latest.ClickedAt
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].LastCrawledAt.After(stats[j].LastCrawledAt) })
+	return stats, nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrawlHistory(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "SEO123", ClickedAt: start, UAClass: UAClassBot, BotName: "Googlebot"},
+		{ShortCode: "SEO123", ClickedAt: start.Add(time.Hour), UAClass: UAClassBot, BotName: "bingbot"},
+		{ShortCode: "SEO123", ClickedAt: start.Add(2 * time.Hour), UAClass: UAClassBot, BotName: "Googlebot"},
+		{ShortCode: "SEO123", ClickedAt: start.Add(3 * time.Hour), UAClass: UAClassBrowser},
+		{ShortCode: "SEO123", ClickedAt: start.Add(4 * time.Hour), UAClass: UAClassBot},
+		{ShortCode: "OTHER1", ClickedAt: start, UAClass: UAClassBot, BotName: "Googlebot"},
+	}))
+
+	crawls, err := ListCrawls("SEO123", 2)
+	require.NoError(t, err)
+	require.Len(t, crawls, 2)
+	assert.Equal(t, "", crawls[0].BotName)
+	assert.Equal(t, "Googlebot", crawls[1].BotName)
+
+	stats, err := GetCrawlerStats("SEO123")
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+	assert.Equal(t, "", stats[0].BotName)
+	assert.Equal(t, "Googlebot", stats[1].BotName)
+	assert.Equal(t, int64(2), stats[1].Hits)
+	assert.True(t, start.Add(2*time.Hour).Equal(stats[1].LastCrawledAt))
+	assert.Equal(t, "bingbot", stats[2].BotName)
+}
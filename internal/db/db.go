@@ -1,8 +1,18 @@
 package db
 
 import (
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/postgres" // PostgreSQL driver
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite" // Pure Go, so it works in the CGO_ENABLED=0 release build
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // RenderStatus represents the rendering status of a URL
@@ -18,63 +28,393 @@ const (
 // Link represents the data model for a shortened URL.
 type Link struct {
 	gorm.Model
-	ShortCode           string       `gorm:"unique_index;not null"`
+	TenantID            string       `gorm:"size:64;not null;default:'';index"` // Tenant the link belongs to, "" for the default tenant
+	ShortCode           string       `gorm:"uniqueIndex;not null"`              // Unique across all tenants
 	OriginalURL         string       `gorm:"not null;index"`
 	RenderedHTMLContent string       `gorm:"type:text"` // Use text for potentially large HTML
 	RenderStatus        RenderStatus `gorm:"type:varchar(20);default:'pending';not null"`
+	TargetStatusCode    int          `gorm:"default:0"` // HTTP status of the original URL at render time, 0 if unknown
+	FinalURL            string       // URL the original URL resolved to after redirects, empty if it didn't redirect
+	RedirectChain       string       `gorm:"type:text"` // JSON array of URLs visited while resolving OriginalURL
+	AcceptLanguage      string       // Accept-Language to render with, empty uses the global default
+	Locale              string       // Browser locale to render with, empty uses the global default
+	Timezone            string       // Browser timezone to render with, empty uses the global default
+	RenderProfile       string       // Name of a RENDER_PROFILES entry to render with, empty for none
+	RobotsTag           string       // X-Robots-Tag served for the short URL, empty uses the global default
+	CacheControl        string       // Cache-Control of the short URL's redirects and snapshots, empty uses the global defaults
+	StaticMode          bool         `gorm:"not null;default:false"` // Serve the snapshot to every visitor, not just bots
+	RenderClaimedAt     *time.Time   // When a worker last claimed the link for rendering
+	RenderRequestedAt   *time.Time   `gorm:"index"`       // When a render was requested from the workers of any replica, nil once claimed
+	LastAccessedAt      *time.Time   `gorm:"index"`       // Latest recorded click, nil if never clicked or click tracking is off
+	URLKey              *string      `gorm:"uniqueIndex"` // OriginalURL while this is the live link owning it, see CreateLinkIfAbsent
+	RenderAttempts      int          `gorm:"default:0"`   // Renders started by workers, counting retries
+	LastRenderError     string       `gorm:"type:text"`   // Why the latest render failed, empty once a render succeeds
+	RenderDurationMs    int64        `gorm:"default:0"`   // How long the latest successful render took
+	HTMLSizeBytes       int64        `gorm:"default:0"`   // Size of the latest successful render's HTML
+	RenderedAt          *time.Time   `gorm:"index"`       // When the latest successful render finished, nil if never rendered
+	DisabledAt          *time.Time   // When the link stopped redirecting, nil while it is enabled
+	DisabledReason      string       // Why the link was disabled, e.g. the threat URL screening found
+
+	// Where the rendered HTML is stored: a shared RenderedContent row for current
+	// renders, or inline in RenderedHTMLCompressed for rows written before content
+	// deduplication. Reads decode either back into RenderedHTMLContent, so the
+	// compressed bytes are always empty outside this package.
+	RenderedHTMLCompressed []byte
+	HTMLEncoding           string // "" for plain text in RenderedHTMLContent, HTMLEncodingGzip or HTMLEncodingGzipAESGCM
+	RenderedContentHash    string `gorm:"size:64;index"` // References the RenderedContent holding the HTML, if any
+}
+
+// RedirectHops decodes the stored redirect chain. It returns nil if the
+// original URL did not redirect.
+func (l *Link) RedirectHops() []string {
+	if l.RedirectChain == "" {
+		return nil
+	}
+	var hops []string
+	if err := json.Unmarshal([]byte(l.RedirectChain), &hops); err != nil {
+		return nil
+	}
+	return hops
+}
+
+// RenderResult is the outcome of a successful render to be stored on a Link.
+type RenderResult struct {
+	HTMLContent      string
+	TargetStatusCode int
+	FinalURL         string
+	RedirectChain    []string
+	Duration         time.Duration // Time spent rendering, for capacity planning
 }
 
 var DB *gorm.DB
 
-// InitDB initializes the database connection and migrates the schema.
-func InitDB(dataSourceName string) error {
-	var err error
-	DB, err = gorm.Open("postgres", dataSourceName)
+// Storage backends selectable with DATABASE_BACKEND. Both share the GORM-managed
+// schema; they differ only in how queries are issued.
+const (
+	BackendGORM = "gorm"
+	BackendSQL  = "sql"
+)
+
+// store serves the package-level query helpers. It defaults to GORM so tests that
+// only set DB keep working.
+var store Store = gormStore{}
+
+// ErrNotFound is returned by the query helpers when no link matches, whichever
+// backend is in use.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// Database drivers, selected from the scheme of DATABASE_URL.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection. WAL lets readers proceed
+// while a worker writes a render, and the busy timeout makes concurrent writers
+// wait for the lock instead of failing immediately.
+const sqlitePragmas = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+
+// dialectorFor picks the GORM driver for a DATABASE_URL. "sqlite://path/to/file.db",
+// "sqlite:path" and "file:path" URLs open SQLite and "mysql://" URLs open MySQL;
+// anything else, including "postgres://" URLs and key=value DSNs, is treated as
+// PostgreSQL.
+func dialectorFor(databaseURL string) (gorm.Dialector, string, error) {
+	if strings.HasPrefix(databaseURL, "mysql://") {
+		dialector, err := mysqlDialector(databaseURL)
+		return dialector, DriverMySQL, err
+	}
+	for _, prefix := range []string{"sqlite://", "sqlite:", "file:"} {
+		if !strings.HasPrefix(databaseURL, prefix) {
+			continue
+		}
+		dsn := "file:" + strings.TrimPrefix(databaseURL, prefix)
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + sqlitePragmas
+		} else {
+			dsn += "?" + sqlitePragmas
+		}
+		return sqlite.Open(dsn), DriverSQLite, nil
+	}
+	return postgres.Open(databaseURL), DriverPostgres, nil
+}
+
+// Connect opens the database connection without touching the schema.
+func Connect(dataSourceName string) error {
+	dialector, driver, err := dialectorFor(dataSourceName)
 	if err != nil {
 		return err
 	}
+	log.Printf("Using %s database driver", driver)
 
-	// Migrate the schema
-	DB.AutoMigrate(&Link{})
+	DB, err = gorm.Open(dialector, &gorm.Config{
+		PrepareStmt: true, // Cache prepared statements for the handful of queries we run repeatedly
+		Logger: logger.New(log.New(os.Stdout, "", log.LstdFlags), logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: true, // Lookups that miss are routine, e.g. short code collision checks
+		}),
+	})
+	return err
+}
 
+// InitDB initializes the database connection, brings the schema up to date unless
+// autoMigrate is off, and selects the storage backend used by the query helpers.
+func InitDB(dataSourceName string, backend string, autoMigrate bool) error {
+	if err := Connect(dataSourceName); err != nil {
+		return err
+	}
+
+	if autoMigrate {
+		if err := Migrate(); err != nil {
+			return err
+		}
+	} else if status, err := GetSchemaStatus(); err != nil {
+		return fmt.Errorf("failed to check schema version: %w", err)
+	} else if status.Pending {
+		log.Printf("Warning: Database schema is at version %d but version %d is available, run the migrate command", status.Version, status.Latest)
+	}
+
+	switch backend {
+	case "", BackendGORM:
+		store = gormStore{}
+	case BackendSQL:
+		if DB.Dialector.Name() == DriverMySQL {
+			return fmt.Errorf("the %s backend supports PostgreSQL and SQLite only", BackendSQL)
+		}
+		sqlDB, err := DB.DB()
+		if err != nil {
+			return err
+		}
+		sqlStore, err := newSQLStore(sqlDB)
+		if err != nil {
+			return fmt.Errorf("failed to prepare SQL statements: %w", err)
+		}
+		store = sqlStore
+	default:
+		return fmt.Errorf("unknown database backend %q", backend)
+	}
+	log.Printf("Using %s storage backend", backendName(store))
 	return nil
 }
 
-// GetLinkByShortCode retrieves a link by its short code.
+// Close releases the storage backend and closes the underlying connection pool.
+func Close() error {
+	if err := store.Close(); err != nil {
+		log.Printf("Error closing storage backend: %v", err)
+	}
+	store = gormStore{}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func backendName(s Store) string {
+	if _, ok := s.(*sqlStore); ok {
+		return BackendSQL
+	}
+	return BackendGORM
+}
+
+// GetLinkByShortCode retrieves a link by its short code, rehydrating it if it
+// has been archived. It is served from the link cache when one is set.
 func GetLinkByShortCode(shortCode string) (*Link, error) {
-	var link Link
-	if err := DB.Where("short_code = ?", shortCode).First(&link).Error; err != nil {
-		return nil, err
+	if link, ok := cachedLink(shortCode); ok {
+		return link, nil
 	}
-	return &link, nil
+	link, err := withArchive(func() (*Link, error) {
+		return store.GetLinkByShortCode(shortCode)
+	}, "short_code = ?", shortCode)
+	if err == nil {
+		cacheLink(link)
+	}
+	return link, err
 }
 
-// GetLinkByOriginalURL retrieves a link by its original URL.
-func GetLinkByOriginalURL(originalURL string) (*Link, error) {
-	var link Link
-	if err := DB.Where("original_url = ?", originalURL).First(&link).Error; err != nil {
-		return nil, err
+// GetLinkByShortCodeIncludingDeleted retrieves a link by its short code even if it
+// has been soft-deleted, so deleted codes can be told apart from unknown ones and
+// are never handed out again.
+func GetLinkByShortCodeIncludingDeleted(shortCode string) (*Link, error) {
+	return withArchive(func() (*Link, error) {
+		return store.GetLinkByShortCodeIncludingDeleted(shortCode)
+	}, "short_code = ?", shortCode)
+}
+
+// GetLinkByOriginalURL retrieves a tenant's link for an original URL,
+// rehydrating an archived link for it if there is no live one.
+func GetLinkByOriginalURL(tenantID string, originalURL string) (*Link, error) {
+	return withArchive(func() (*Link, error) {
+		return store.GetLinkByOriginalURL(tenantID, originalURL)
+	}, "tenant_id = ? AND original_url = ?", tenantID, originalURL)
+}
+
+// URLKey is the url_key of the link owning originalURL within a tenant, which
+// identifies the link among all tenants' links. Keys of the default tenant are
+// the bare URL; other tenants' are prefixed with the tenant ID and a space,
+// which a URL can't start with.
+func URLKey(tenantID string, originalURL string) string {
+	if tenantID == "" {
+		return originalURL
 	}
-	return &link, nil
+	return tenantID + " " + originalURL
 }
 
 // CreateLink creates a new link record in the database.
 func CreateLink(link *Link) error {
-	if err := DB.Create(link).Error; err != nil {
+	return store.CreateLink(link)
+}
+
+// ErrShortCodeTaken is returned by CreateLinkIfAbsent when the link's short code
+// is already in use.
+var ErrShortCodeTaken = errors.New("short code already in use")
+
+// CreateLinkIfAbsent atomically inserts link unless a live link for the same
+// original URL exists in its tenant, relying on the unique url_key index rather than a prior
+// lookup, so concurrent requests for a new URL can't both insert. It returns the
+// stored link, which is the existing one if created is false. Soft-deleted links
+// and restored ones don't own their URL, so they never block a new link.
+func CreateLinkIfAbsent(link *Link) (stored *Link, created bool, err error) {
+	return store.CreateLinkIfAbsent(link)
+}
+
+// ErrShortCodesExhausted is returned by AllocateLink when every generated short
+// code was already taken.
+var ErrShortCodesExhausted = errors.New("no free short code found")
+
+// AllocateLink inserts link under a fresh short code from generate, like
+// CreateLinkIfAbsent. Uniqueness is left to the short_code index: a code that
+// turns out to be taken, by a live or a soft-deleted link, is replaced and the
+// insert retried, up to attempts times in total. There is no lookup before the
+// insert, so replicas allocating at the same time can't both claim a code.
+// Archived links hold their codes outside the index, so the archive is checked
+// after the insert, which also catches a link archived while it ran.
+func AllocateLink(link *Link, generate func() (string, error), attempts int) (stored *Link, created bool, err error) {
+	for attempt := 1; attempt <= attempts; attempt++ {
+		link.ShortCode, err = generate()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to generate short code: %w", err)
+		}
+		stored, created, err = store.CreateLinkIfAbsent(link)
+		if created {
+			err = releaseIfArchived(link)
+		}
+		if !errors.Is(err, ErrShortCodeTaken) {
+			return stored, created, err
+		}
+		log.Printf("Short code collision for %s (attempt %d of %d)", link.ShortCode, attempt, attempts)
+	}
+	return nil, false, ErrShortCodesExhausted
+}
+
+// releaseIfArchived deletes a just-inserted link again if an archived link holds
+// its short code, returning ErrShortCodeTaken so AllocateLink tries another.
+func releaseIfArchived(link *Link) error {
+	archived, err := isArchived(link.ShortCode)
+	if err != nil || !archived {
 		return err
 	}
-	return nil
+	if err := DB.Unscoped().Delete(&Link{}, link.ID).Error; err != nil {
+		return err
+	}
+	return ErrShortCodeTaken
 }
 
 // UpdateLinkRenderStatus updates the render status of a link.
 func UpdateLinkRenderStatus(shortCode string, status RenderStatus) error {
-	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Update("render_status", status).Error
+	defer invalidateLinks(shortCode)
+	return store.UpdateLinkRenderStatus(shortCode, status)
+}
+
+// ClaimLinkForRender marks a link as rendering if no other worker holds it, so a
+// URL isn't rendered twice across restarts or replicas. The status transition is a
+// single conditional UPDATE, which makes the claim atomic without locks. A claim
+// older than staleAfter is assumed to belong to a worker that died mid-render and
+// may be taken over. It reports whether the caller now owns the render.
+func ClaimLinkForRender(shortCode string, staleAfter time.Duration) (bool, error) {
+	defer invalidateLinks(shortCode)
+	return store.ClaimLinkForRender(shortCode, staleAfter)
 }
 
 // UpdateLinkContent updates the rendered HTML content and status of a link.
 func UpdateLinkContent(shortCode string, htmlContent string, status RenderStatus) error {
-	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Updates(map[string]interface{}{
-		"rendered_html_content": htmlContent,
-		"render_status":         status,
-	}).Error
+	defer invalidateLinks(shortCode)
+	return store.UpdateLinkContent(shortCode, htmlContent, status)
+}
+
+// SaveRenderResult stores a successful render on a link, marks it completed and
+// clears any earlier render error. The render is added to the link's history
+// when one is kept.
+func SaveRenderResult(shortCode string, result *RenderResult) error {
+	defer invalidateLinks(shortCode)
+	if err := store.SaveRenderResult(shortCode, result); err != nil {
+		return err
+	}
+	if renderHistoryVersions > 0 {
+		if err := recordRenderVersion(shortCode); err != nil {
+			// The render itself is saved; only rolling back to it won't be possible
+			log.Printf("History: Failed to record render of %s: %v", shortCode, err)
+		}
+	}
+	return nil
+}
+
+// maxRenderErrorLength caps the stored render error; browser errors can embed
+// whole stack traces.
+const maxRenderErrorLength = 2000
+
+// SaveRenderFailure records why a render failed. A retrying link goes back to
+// pending and keeps its current snapshot; otherwise the snapshot is dropped and
+// the link marked failed.
+func SaveRenderFailure(shortCode string, renderErr string, retrying bool) error {
+	if len(renderErr) > maxRenderErrorLength {
+		renderErr = strings.ToValidUTF8(renderErr[:maxRenderErrorLength], "")
+	}
+	defer invalidateLinks(shortCode)
+	return store.SaveRenderFailure(shortCode, renderErr, retrying)
+}
+
+// DeleteLink soft-deletes a link. It keeps its short code reserved and can be
+// restored with RestoreLink within the retention window. It returns ErrNotFound
+// if there is no live link with the short code.
+func DeleteLink(shortCode string) error {
+	defer invalidateLinks(shortCode)
+	return store.DeleteLink(shortCode)
+}
+
+// ErrRetentionExpired is returned by RestoreLink for links deleted longer ago than
+// the retention window.
+var ErrRetentionExpired = errors.New("link was deleted outside the retention window")
+
+// RestoreLink undeletes a soft-deleted link if it was deleted less than retention
+// ago; a zero retention allows restoring regardless of age. Restoring a live link
+// is a no-op. It returns the restored link.
+func RestoreLink(shortCode string, retention time.Duration) (*Link, error) {
+	link, err := store.GetLinkByShortCodeIncludingDeleted(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !link.DeletedAt.Valid {
+		return link, nil
+	}
+	if retention > 0 && time.Since(link.DeletedAt.Time) > retention {
+		return nil, ErrRetentionExpired
+	}
+	if err := store.RestoreLink(shortCode); err != nil {
+		return nil, err
+	}
+	link.DeletedAt = gorm.DeletedAt{}
+	return link, nil
+}
+
+// encodeRedirectChain serializes a redirect chain for the redirect_chain column.
+func encodeRedirectChain(chain []string) (string, error) {
+	if len(chain) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(chain)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
 }
@@ -0,0 +1,45 @@
+package db
+
+import "time"
+
+// DisableLink stops a live link from redirecting and records why. The link keeps
+// its short code and snapshot so it can be enabled again. It returns ErrNotFound
+// if there is no live link with the short code.
+func DisableLink(shortCode, reason string) error {
+	defer invalidateLinks(shortCode)
+	result := DB.Model(&Link{}).Where("short_code = ?", shortCode).
+		Updates(map[string]interface{}{"disabled_at": time.Now(), "disabled_reason": reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EnableLink lets a disabled link redirect again. Enabling an enabled link is a
+// no-op. It returns ErrNotFound if there is no live link with the short code.
+func EnableLink(shortCode string) error {
+	defer invalidateLinks(shortCode)
+	result := DB.Model(&Link{}).Where("short_code = ?", shortCode).
+		Updates(map[string]interface{}{"disabled_at": nil, "disabled_reason": ""})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListEnabledLinks returns up to limit enabled live links with an ID above
+// afterID, in ID order, for jobs that walk every link in batches. Only the ID,
+// short code and URLs are loaded.
+func ListEnabledLinks(afterID uint, limit int) ([]Link, error) {
+	var links []Link
+	err := DB.Model(&Link{}).Select("id", "short_code", "original_url", "final_url").
+		Where("id > ? AND disabled_at IS NULL", afterID).
+		Order("id").Limit(limit).Find(&links).Error
+	return links, err
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// HTMLEncodingGzipAESGCM marks a snapshot that was gzip-compressed and then
+// encrypted with AES-256-GCM. The stored data is the nonce followed by the
+// sealed HTML.
+const HTMLEncodingGzipAESGCM = "gzip+aes-gcm"
+
+// SnapshotKeySize is the size of the key given to SetSnapshotKey, which selects AES-256.
+const SnapshotKeySize = 32
+
+// ErrSnapshotKeyMissing is returned when reading an encrypted snapshot while no
+// key is configured.
+var ErrSnapshotKeyMissing = errors.New("snapshot is encrypted but no encryption key is configured")
+
+// Encryption of new snapshots, enabled by SetSnapshotKey.
+var (
+	snapshotAEAD    cipher.AEAD
+	snapshotHashKey []byte
+)
+
+// SetSnapshotKey encrypts snapshots stored from now on with key, which must be
+// SnapshotKeySize bytes, and decrypts encrypted snapshots with it. A nil key
+// stores new snapshots unencrypted again.
+func SetSnapshotKey(key []byte) error {
+	if key == nil {
+		snapshotAEAD, snapshotHashKey = nil, nil
+		return nil
+	}
+	if len(key) != SnapshotKeySize {
+		return fmt.Errorf("snapshot encryption key must be %d bytes, got %d", SnapshotKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	// Snapshots are deduplicated by hash. A plain SHA-256 would let anyone reading
+	// the table confirm a guess of a page's content, so the hash is keyed too, with
+	// a key derived from the encryption key so the two are never the same.
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("snapshot content hash"))
+	snapshotAEAD, snapshotHashKey = aead, mac.Sum(nil)
+	return nil
+}
+
+// encryptionEnabled reports whether new snapshots are encrypted.
+func encryptionEnabled() bool {
+	return snapshotAEAD != nil
+}
+
+// encryptedContentHash is contentHash for snapshots stored encrypted.
+func encryptedContentHash(html string) string {
+	mac := hmac.New(sha256.New, snapshotHashKey)
+	mac.Write([]byte(html))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encryptSnapshot seals compressed HTML under a random nonce.
+func encryptSnapshot(data []byte) ([]byte, error) {
+	nonce := make([]byte, snapshotAEAD.NonceSize(), snapshotAEAD.NonceSize()+len(data)+snapshotAEAD.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return snapshotAEAD.Seal(nonce, nonce, data, nil), nil
+}
+
+// decryptSnapshot opens data sealed by encryptSnapshot.
+func decryptSnapshot(data []byte) ([]byte, error) {
+	if snapshotAEAD == nil {
+		return nil, ErrSnapshotKeyMissing
+	}
+	if len(data) < snapshotAEAD.NonceSize() {
+		return nil, errors.New("encrypted snapshot is truncated")
+	}
+	nonce, sealed := data[:snapshotAEAD.NonceSize()], data[snapshotAEAD.NonceSize():]
+	return snapshotAEAD.Open(nil, nonce, sealed, nil)
+}
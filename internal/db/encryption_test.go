@@ -0,0 +1,48 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotEncryption(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+	key := bytes.Repeat([]byte{7}, SnapshotKeySize)
+	require.NoError(t, SetSnapshotKey(key))
+	defer SetSnapshotKey(nil)
+
+	html := "<html><body>Confidential roadmap</body></html>"
+	require.NoError(t, CreateLink(&Link{ShortCode: "ENC001", OriginalURL: "https://internal.example.com/roadmap"}))
+	require.NoError(t, SaveRenderResult("ENC001", &RenderResult{HTMLContent: html}))
+
+	var content RenderedContent
+	require.NoError(t, DB.First(&content).Error)
+	assert.Equal(t, HTMLEncodingGzipAESGCM, content.Encoding)
+	assert.Empty(t, content.TextContent, "encrypted snapshots aren't indexed for search")
+	plainHash := contentHash(html)
+	require.NoError(t, SetSnapshotKey(nil))
+	assert.NotEqual(t, contentHash(html), plainHash, "the dedup hash is keyed")
+	compressed, err := compressHTML(html)
+	require.NoError(t, err)
+	assert.NotEqual(t, compressed, content.Data)
+
+	_, err = GetLinkByShortCode("ENC001")
+	assert.ErrorIs(t, err, ErrSnapshotKeyMissing)
+
+	require.NoError(t, SetSnapshotKey(key))
+	link, err := GetLinkByShortCode("ENC001")
+	require.NoError(t, err)
+	assert.Equal(t, html, link.RenderedHTMLContent)
+
+	// Tampered ciphertext is rejected
+	content.Data[len(content.Data)-1] ^= 1
+	require.NoError(t, DB.Model(&content).Update("data", content.Data).Error)
+	_, err = GetLinkByShortCode("ENC001")
+	assert.Error(t, err)
+
+	assert.Error(t, SetSnapshotKey([]byte("too short")))
+}
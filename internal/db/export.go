@@ -0,0 +1,124 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// forShortCode narrows query to the rows of shortCode, unless it is empty.
+func forShortCode(query *gorm.DB, shortCode string) *gorm.DB {
+	if shortCode != "" {
+		query = query.Where("short_code = ?", shortCode)
+	}
+	return query
+}
+
+// ExportClickEvents calls fn with each raw click event on shortCode, or on
+// every link if it is empty, from the UTC day of from to that of to, oldest
+// first. Events are read one at a time, so exports of any size stream. Events
+// that rolled up are only kept with CLICK_RAW_RETENTION_DAYS set; see
+// ExportDailyClicks. An error from fn stops the export and is returned.
+func ExportClickEvents(shortCode string, from, to time.Time, fn func(ClickEvent) error) error {
+	return exportClickEvents(DB.Model(&ClickEvent{}), shortCode, from, to, fn)
+}
+
+// exportClickEvents streams the click events query selects.
+func exportClickEvents(query *gorm.DB, shortCode string, from, to time.Time, fn func(ClickEvent) error) error {
+	_, _, start, end := dayRange(from, to)
+	rows, err := forShortCode(query, shortCode).
+		Where("clicked_at >= ? AND clicked_at < ?", start, end).Order("clicked_at, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event ClickEvent
+		if err := DB.ScanRows(rows, &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportDailyClicks calls fn with the clicks on shortCode, or on each link if it
+// is empty, per UTC day from from to to, ordered by day. Rolled up days are
+// streamed and the raw events not rolled up yet are added to them. Days without
+// clicks are left out. An error from fn stops the export and is returned.
+func ExportDailyClicks(shortCode string, from, to time.Time, fn func(DailyClickStat) error) error {
+	// Raw events are few between rollups, so they are summed up in memory
+	pending := make(map[DailyClickStat]*DailyClickStat)
+	err := exportClickEvents(unrolledClicks(), shortCode, from, to, func(e ClickEvent) error {
+		key := DailyClickStat{ShortCode: e.ShortCode, Day: e.ClickedAt.UTC().Format(time.DateOnly)}
+		stat, ok := pending[key]
+		if !ok {
+			stat = &DailyClickStat{ShortCode: key.ShortCode, Day: key.Day}
+			pending[key] = stat
+		}
+		stat.Clicks++
+		if e.UAClass == UAClassBot {
+			stat.BotClicks++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	raw := make([]DailyClickStat, 0, len(pending))
+	for _, stat := range pending {
+		raw = append(raw, *stat)
+	}
+	sort.Slice(raw, func(i, j int) bool {
+		if raw[i].Day != raw[j].Day {
+			return raw[i].Day < raw[j].Day
+		}
+		return raw[i].ShortCode < raw[j].ShortCode
+	})
+	// flushRaw passes on the raw sums of the days before day that no rolled-up
+	// row took in.
+	flushRaw := func(day string) error {
+		for len(raw) > 0 && raw[0].Day < day {
+			if _, ok := pending[DailyClickStat{ShortCode: raw[0].ShortCode, Day: raw[0].Day}]; ok {
+				if err := fn(raw[0]); err != nil {
+					return err
+				}
+			}
+			raw = raw[1:]
+		}
+		return nil
+	}
+
+	fromDay, toDay, _, _ := dayRange(from, to)
+	rows, err := forShortCode(DB.Model(&DailyClickStat{}), shortCode).
+		Where("day >= ? AND day <= ?", fromDay, toDay).Order("day").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stat DailyClickStat
+		if err := DB.ScanRows(rows, &stat); err != nil {
+			return err
+		}
+		if err := flushRaw(stat.Day); err != nil {
+			return err
+		}
+		key := DailyClickStat{ShortCode: stat.ShortCode, Day: stat.Day}
+		if sums, ok := pending[key]; ok {
+			stat.Clicks += sums.Clicks
+			stat.BotClicks += sums.BotClicks
+			delete(pending, key)
+		}
+		if err := fn(stat); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flushRaw("9999-12-31")
+}
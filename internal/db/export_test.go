@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportClicks(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	now := time.Now().UTC()
+	today, yesterday := now.Format(time.DateOnly), now.AddDate(0, 0, -1).Format(time.DateOnly)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "EXP1", ClickedAt: now.AddDate(0, 0, -1), UAClass: UAClassBrowser},
+		{ShortCode: "EXP2", ClickedAt: now.AddDate(0, 0, -1), UAClass: UAClassBot},
+	}))
+	_, err := RollupClickEvents(now.Add(-time.Second), false)
+	require.NoError(t, err)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "EXP2", ClickedAt: now.AddDate(0, 0, -1), UAClass: UAClassBrowser, Country: "DE"},
+		{ShortCode: "EXP1", ClickedAt: now, UAClass: UAClassBot, BotName: "Googlebot"},
+	}))
+
+	var daily []DailyClickStat
+	require.NoError(t, ExportDailyClicks("", now.AddDate(0, 0, -1), now, func(s DailyClickStat) error {
+		daily = append(daily, s)
+		return nil
+	}))
+	assert.Equal(t, []DailyClickStat{
+		{ShortCode: "EXP1", Day: yesterday, Clicks: 1},
+		{ShortCode: "EXP2", Day: yesterday, Clicks: 2, BotClicks: 1},
+		{ShortCode: "EXP1", Day: today, Clicks: 1, BotClicks: 1},
+	}, daily, "raw events are added to the rolled-up days")
+
+	daily = nil
+	require.NoError(t, ExportDailyClicks("EXP1", now, now, func(s DailyClickStat) error {
+		daily = append(daily, s)
+		return nil
+	}))
+	assert.Equal(t, []DailyClickStat{{ShortCode: "EXP1", Day: today, Clicks: 1, BotClicks: 1}}, daily)
+
+	var events []ClickEvent
+	require.NoError(t, ExportClickEvents("", now.AddDate(0, 0, -1), now, func(e ClickEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	require.Len(t, events, 2, "rolled-up events are gone")
+	assert.Equal(t, "DE", events[0].Country)
+	assert.Equal(t, "Googlebot", events[1].BotName)
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// FeatureFlag is a feature flag switched on or off at runtime, overriding the
+// state configured for the environment.
+type FeatureFlag struct {
+	Name      string    `gorm:"primaryKey;size:64"`
+	Enabled   bool      `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// GetFeatureFlags returns the state of every flag set at runtime by name.
+func GetFeatureFlags() (map[string]bool, error) {
+	var rows []FeatureFlag
+	if err := DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	flags := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		flags[row.Name] = row.Enabled
+	}
+	return flags, nil
+}
+
+// SetFeatureFlag switches a flag on or off at runtime.
+func SetFeatureFlag(name string, enabled bool) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&FeatureFlag{Name: name, Enabled: enabled, UpdatedAt: time.Now()}).Error
+}
+
+// DeleteFeatureFlag drops the runtime state of a flag, returning it to the state
+// configured for the environment. It returns ErrNotFound if the flag wasn't set.
+func DeleteFeatureFlag(name string) error {
+	result := DB.Where("name = ?", name).Delete(&FeatureFlag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
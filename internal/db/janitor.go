@@ -0,0 +1,128 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PurgeResult summarizes a PurgeStaleContent run.
+type PurgeResult struct {
+	LinksCleared    int64 `json:"links_cleared"`    // Links whose snapshot was dropped
+	LinksDeleted    int64 `json:"links_deleted"`    // Links removed entirely
+	ContentsDeleted int64 `json:"contents_deleted"` // Shared snapshots no link referenced any more
+	BytesReclaimed  int64 `json:"bytes_reclaimed"`  // Stored HTML freed, compressed size where compressed
+}
+
+// Content retention modes for PurgeStaleContent.
+const (
+	RetentionModeContent = "content" // Drop snapshots but keep the links
+	RetentionModeRows    = "rows"    // Delete the links themselves
+)
+
+// purgeBatchSize is how many links PurgeStaleContent clears per statement.
+const purgeBatchSize = 500
+
+// orphanGracePeriod keeps a freshly inserted snapshot from being purged in the
+// moment between storeContent inserting it and the link update referencing it.
+const orphanGracePeriod = time.Hour
+
+// staleLink holds the columns PurgeStaleContent needs to account for freed space.
+type staleLink struct {
+	ID                     uint
+	ShortCode              string
+	RenderedHTMLContent    string
+	RenderedHTMLCompressed []byte
+}
+
+// PurgeStaleContent frees the space of links not accessed since cutoff. Links
+// never clicked count from their creation time. In RetentionModeContent their
+// snapshots are dropped and they go back to pending, so a later /generate of the
+// URL renders them again; in RetentionModeRows the links are deleted outright,
+// soft-deleted ones included. Either way their render history is dropped. Shared
+// snapshots no longer referenced by any link are deleted afterwards.
+func PurgeStaleContent(cutoff time.Time, mode string) (*PurgeResult, error) {
+	result := &PurgeResult{}
+	stale := DB.Table("links").Where("COALESCE(last_accessed_at, created_at) < ?", cutoff)
+	if mode != RetentionModeRows {
+		stale = stale.Where("(rendered_content_hash <> '' OR rendered_html_compressed IS NOT NULL OR rendered_html_content <> '')")
+	}
+	stale = stale.Session(&gorm.Session{}) // Reused for every batch
+
+	for {
+		var links []staleLink
+		err := stale.Select("id", "short_code", "rendered_html_content", "rendered_html_compressed").
+			Order("id").Limit(purgeBatchSize).Find(&links).Error
+		if err != nil {
+			return result, err
+		}
+		if len(links) == 0 {
+			break
+		}
+
+		ids := make([]uint, len(links))
+		codes := make([]string, len(links))
+		var inlineBytes int64
+		for i, l := range links {
+			ids[i] = l.ID
+			codes[i] = l.ShortCode
+			inlineBytes += int64(len(l.RenderedHTMLContent) + len(l.RenderedHTMLCompressed))
+		}
+
+		if mode == RetentionModeRows {
+			res := DB.Unscoped().Where("id IN ?", ids).Delete(&Link{})
+			if res.Error != nil {
+				return result, res.Error
+			}
+			result.LinksDeleted += res.RowsAffected
+		} else {
+			res := DB.Table("links").Where("id IN ?", ids).Updates(map[string]interface{}{
+				"rendered_html_content":    "",
+				"rendered_html_compressed": nil,
+				"html_encoding":            "",
+				"rendered_content_hash":    "",
+				"render_status":            RenderStatusPending,
+				"updated_at":               time.Now(),
+			})
+			if res.Error != nil {
+				return result, res.Error
+			}
+			result.LinksCleared += res.RowsAffected
+		}
+		if err := deleteRenderVersions(codes); err != nil {
+			return result, err
+		}
+		result.BytesReclaimed += inlineBytes
+		invalidateLinks(codes...)
+
+		if len(links) < purgeBatchSize {
+			break
+		}
+	}
+
+	deleted, bytes, err := purgeOrphanedContent(time.Now().Add(-orphanGracePeriod))
+	result.ContentsDeleted = deleted
+	result.BytesReclaimed += bytes
+	return result, err
+}
+
+// purgeOrphanedContent deletes shared snapshots created before olderThan that no
+// link, live, soft-deleted or archived, nor any kept render version references. It returns the rows and bytes freed.
+func purgeOrphanedContent(olderThan time.Time) (int64, int64, error) {
+	referenced := DB.Table("links").Select("rendered_content_hash").Where("rendered_content_hash IS NOT NULL")
+	archived := DB.Table("archived_links").Select("rendered_content_hash").Where("rendered_content_hash IS NOT NULL")
+	versions := DB.Table("render_versions").Select("rendered_content_hash")
+	orphaned := DB.Model(&RenderedContent{}).
+		Where("created_at < ? AND hash NOT IN (?) AND hash NOT IN (?) AND hash NOT IN (?)", olderThan, referenced, archived, versions).
+		Session(&gorm.Session{})
+
+	var bytes int64
+	if err := orphaned.Select("COALESCE(SUM(LENGTH(data)), 0)").Scan(&bytes).Error; err != nil {
+		return 0, 0, err
+	}
+	res := orphaned.Delete(&RenderedContent{})
+	if res.Error != nil {
+		return 0, 0, res.Error
+	}
+	return res.RowsAffected, bytes, nil
+}
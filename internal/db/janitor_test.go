@@ -0,0 +1,93 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeStaleContent(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	// setup creates a link with a snapshot and backdates its creation and last access
+	setup := func(t *testing.T, shortCode string, lastAccessed *time.Time, html string) {
+		require.NoError(t, CreateLink(&Link{ShortCode: shortCode, OriginalURL: "https://" + shortCode + ".com"}))
+		require.NoError(t, SaveRenderResult(shortCode, &RenderResult{HTMLContent: html}))
+		require.NoError(t, DB.Model(&Link{}).Where("short_code = ?", shortCode).
+			UpdateColumns(map[string]interface{}{"created_at": old, "last_accessed_at": lastAccessed}).Error)
+	}
+	backdateContents := func(t *testing.T) {
+		require.NoError(t, DB.Model(&RenderedContent{}).Where("1 = 1").Update("created_at", old).Error)
+	}
+
+	t.Run("content mode", func(t *testing.T) {
+		setupTestDB(t)
+		defer teardownTestDB(t)
+		setup(t, "STALE", &old, "<html>stale</html>")
+		setup(t, "NEVER", nil, "<html>never clicked</html>")
+		setup(t, "FRESH", &recent, "<html>fresh</html>")
+		backdateContents(t)
+
+		result, err := PurgeStaleContent(time.Now().Add(-24*time.Hour), RetentionModeContent)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.LinksCleared)
+		assert.Zero(t, result.LinksDeleted)
+		assert.Equal(t, int64(2), result.ContentsDeleted)
+		assert.Positive(t, result.BytesReclaimed)
+
+		link, err := GetLinkByShortCode("STALE")
+		require.NoError(t, err, "the link itself is kept")
+		assert.Empty(t, link.RenderedHTMLContent)
+		assert.Equal(t, RenderStatusPending, link.RenderStatus)
+		link, err = GetLinkByShortCode("FRESH")
+		require.NoError(t, err)
+		assert.Equal(t, "<html>fresh</html>", link.RenderedHTMLContent)
+
+		var contents int64
+		require.NoError(t, DB.Model(&RenderedContent{}).Count(&contents).Error)
+		assert.Equal(t, int64(1), contents)
+
+		// Nothing is left to purge
+		result, err = PurgeStaleContent(time.Now().Add(-24*time.Hour), RetentionModeContent)
+		require.NoError(t, err)
+		assert.Equal(t, PurgeResult{}, *result)
+	})
+
+	t.Run("rows mode", func(t *testing.T) {
+		setupTestDB(t)
+		defer teardownTestDB(t)
+		setup(t, "STALE", &old, "<html>shared</html>")
+		setup(t, "FRESH", &recent, "<html>shared</html>")
+		require.NoError(t, DeleteLink("FRESH"))
+		setup(t, "GONE", &old, "<html>gone</html>")
+		require.NoError(t, DeleteLink("GONE"))
+		backdateContents(t)
+
+		result, err := PurgeStaleContent(time.Now().Add(-24*time.Hour), RetentionModeRows)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.LinksDeleted)
+		assert.Equal(t, int64(1), result.ContentsDeleted, "the shared snapshot is still referenced by a soft-deleted link")
+
+		_, err = GetLinkByShortCodeIncludingDeleted("STALE")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = GetLinkByShortCodeIncludingDeleted("GONE")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = GetLinkByShortCodeIncludingDeleted("FRESH")
+		assert.NoError(t, err)
+	})
+
+	t.Run("recent orphans are kept", func(t *testing.T) {
+		setupTestDB(t)
+		defer teardownTestDB(t)
+		require.NoError(t, DB.Create(&RenderedContent{Hash: "new", Data: []byte("x"), CreatedAt: time.Now()}).Error)
+		require.NoError(t, DB.Create(&RenderedContent{Hash: "old", Data: []byte("xyz"), CreatedAt: old}).Error)
+
+		result, err := PurgeStaleContent(time.Now().Add(-24*time.Hour), RetentionModeContent)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), result.ContentsDeleted)
+		assert.Equal(t, int64(3), result.BytesReclaimed)
+	})
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// migrations holds the versioned schema migrations, one directory per driver
+// since DDL differs between them. New schema changes go in a new numbered file
+// in each directory, never by editing an applied one.
+//
+//go:embed migrations
+var migrations embed.FS
+
+// SchemaStatus reports the schema version of the database against the newest
+// migration compiled into the binary.
+type SchemaStatus struct {
+	Version int64 `json:"version"`
+	Latest  int64 `json:"latest"`
+	Pending bool  `json:"pending"`
+}
+
+// MigrationState is the state of a single migration.
+type MigrationState struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+// newMigrationProvider returns a goose provider for DB's driver. On PostgreSQL
+// migrations take an advisory lock so replicas starting together apply them once.
+func newMigrationProvider() (*goose.Provider, error) {
+	var dialect goose.Dialect
+	var options []goose.ProviderOption
+	driver := DB.Dialector.Name()
+	switch driver {
+	case DriverPostgres:
+		dialect = goose.DialectPostgres
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, goose.WithSessionLocker(locker))
+	case DriverSQLite:
+		dialect = goose.DialectSQLite3
+	case DriverMySQL:
+		dialect = goose.DialectMySQL
+	default:
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+
+	fsys, err := fs.Sub(migrations, "migrations/"+driver)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(dialect, sqlDB, fsys, options...)
+}
+
+// Migrate applies all pending migrations to DB.
+func Migrate() error {
+	provider, err := newMigrationProvider()
+	if err != nil {
+		return err
+	}
+	results, err := provider.Up(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	for _, result := range results {
+		log.Printf("Applied migration %s in %s", result.Source.Path, result.Duration)
+	}
+	return nil
+}
+
+// MigrateDown rolls back the most recently applied migration.
+func MigrateDown() error {
+	provider, err := newMigrationProvider()
+	if err != nil {
+		return err
+	}
+	result, err := provider.Down(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to roll back migration: %w", err)
+	}
+	log.Printf("Rolled back migration %s in %s", result.Source.Path, result.Duration)
+	return nil
+}
+
+// GetSchemaStatus returns the current and latest schema versions.
+func GetSchemaStatus() (*SchemaStatus, error) {
+	provider, err := newMigrationProvider()
+	if err != nil {
+		return nil, err
+	}
+	current, latest, err := provider.GetVersions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaStatus{Version: current, Latest: latest, Pending: current < latest}, nil
+}
+
+// GetMigrationStates lists every known migration and whether it has been applied.
+func GetMigrationStates() ([]MigrationState, error) {
+	provider, err := newMigrationProvider()
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := provider.Status(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(statuses))
+	for i, status := range statuses {
+		states[i] = MigrationState{
+			Version: status.Source.Version,
+			Name:    status.Source.Path,
+			Applied: status.State == goose.StateApplied,
+		}
+	}
+	return states, nil
+}
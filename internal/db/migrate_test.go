@@ -0,0 +1,104 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMigrations(t *testing.T) {
+	require.NoError(t, InitDB("sqlite://"+filepath.Join(t.TempDir(), "links.db"), BackendGORM, false))
+	defer teardownTestDB(t)
+
+	status, err := GetSchemaStatus()
+	require.NoError(t, err)
+	assert.Zero(t, status.Version)
+	assert.Positive(t, status.Latest)
+	assert.True(t, status.Pending)
+	assert.False(t, DB.Migrator().HasTable("links"))
+
+	require.NoError(t, Migrate())
+	status, err = GetSchemaStatus()
+	require.NoError(t, err)
+	assert.Equal(t, status.Latest, status.Version)
+	assert.False(t, status.Pending)
+
+	states, err := GetMigrationStates()
+	require.NoError(t, err)
+	require.NotEmpty(t, states)
+	for _, state := range states {
+		assert.True(t, state.Applied, state.Name)
+	}
+
+	// Every migration can be rolled back and applied again
+	for range states {
+		require.NoError(t, MigrateDown())
+	}
+	assert.False(t, DB.Migrator().HasTable("links"))
+	require.NoError(t, Migrate())
+	require.NoError(t, CreateLink(&Link{ShortCode: "MIG123", OriginalURL: "https://migrated.com"}))
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for _, model := range []interface{}{&Link{}, &RenderedContent{}, &ClickEvent{}, &DailyClickStat{}, &DailyClickBreakdown{}, &AnalyticsPurge{}, &ArchivedLink{}, &RenderVersion{}, &ShortCodeID{}, &FeatureFlag{}, &AdminUser{}, &AdminSession{}, &WebhookSubscription{}, &WebhookDelivery{}} {
+		stmt := &gorm.Statement{DB: DB}
+		require.NoError(t, stmt.Parse(model))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, DB.Migrator().HasColumn(model, field.DBName), "%s.%s has no migration", stmt.Schema.Table, field.DBName)
+		}
+	}
+}
+
+func TestMigrateAdoptsAutoMigratedSchema(t *testing.T) {
+	var err error
+	DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	defer teardownTestDB(t)
+
+	// A database created by AutoMigrate before migrations were versioned, which
+	// predates the columns of later migrations and could hold duplicate URLs
+	require.NoError(t, DB.AutoMigrate(&Link{}, &RenderedContent{}, &ClickEvent{}, &DailyClickStat{}))
+	for _, index := range []string{"idx_links_url_key", "idx_links_rendered_at", "idx_links_tenant_id", "idx_links_render_requested_at"} {
+		require.NoError(t, DB.Migrator().DropIndex(&Link{}, index))
+	}
+	for _, column := range []string{"url_key", "render_attempts", "last_render_error",
+		"render_duration_ms", "html_size_bytes", "rendered_at", "tenant_id", "disabled_at", "disabled_reason", "robots_tag", "static_mode",
+		"render_requested_at", "cache_control"} {
+		require.NoError(t, DB.Migrator().DropColumn(&Link{}, column))
+	}
+	require.NoError(t, DB.Migrator().DropColumn(&RenderedContent{}, "text_content"))
+	require.NoError(t, DB.Migrator().DropIndex(&ClickEvent{}, "idx_click_events_rolled_up"))
+	for _, column := range []string{"bot_name", "browser", "platform", "device_class", "country", "rolled_up"} {
+		require.NoError(t, DB.Migrator().DropColumn(&ClickEvent{}, column))
+	}
+	for _, code := range []string{"OLD1", "OLD2"} {
+		require.NoError(t, DB.Exec("INSERT INTO links (short_code, original_url, render_status) VALUES (?, ?, ?)",
+			code, "https://old.com", RenderStatusCompleted).Error)
+	}
+
+	require.NoError(t, Migrate())
+
+	// Both links keep working; the first one owns the URL
+	old1, err := GetLinkByShortCode("OLD1")
+	require.NoError(t, err)
+	require.NotNil(t, old1.URLKey)
+	assert.Equal(t, "https://old.com", *old1.URLKey)
+	old2, err := GetLinkByShortCode("OLD2")
+	require.NoError(t, err)
+	assert.Nil(t, old2.URLKey)
+
+	stored, created, err := CreateLinkIfAbsent(&Link{ShortCode: "NEW1", OriginalURL: "https://old.com"})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "OLD1", stored.ShortCode)
+}
@@ -0,0 +1,68 @@
+-- Schema as last created by AutoMigrate. IF NOT EXISTS lets databases set up
+-- before versioned migrations adopt it unchanged. Indexes are declared inline
+-- because MySQL has no CREATE INDEX IF NOT EXISTS.
+--
+-- Strings are VARCHAR(191) so they can be indexed under utf8mb4. original_url
+-- is VARCHAR(768), the longest utf8mb4 VARCHAR InnoDB can still index, and
+-- snapshots are LONGTEXT since TEXT holds only 64 KB.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS links (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    deleted_at datetime(3) NULL,
+    short_code varchar(191) NOT NULL,
+    original_url varchar(768) NOT NULL,
+    rendered_html_content longtext,
+    render_status varchar(20) NOT NULL DEFAULT 'pending',
+    target_status_code bigint DEFAULT 0,
+    final_url text,
+    redirect_chain text,
+    accept_language varchar(191),
+    locale varchar(191),
+    timezone varchar(191),
+    render_profile varchar(191),
+    render_claimed_at datetime(3) NULL,
+    last_accessed_at datetime(3) NULL,
+    rendered_html_compressed longblob,
+    html_encoding varchar(191),
+    rendered_content_hash varchar(64),
+    UNIQUE INDEX idx_links_short_code (short_code),
+    INDEX idx_links_original_url (original_url),
+    INDEX idx_links_deleted_at (deleted_at),
+    INDEX idx_links_rendered_content_hash (rendered_content_hash),
+    INDEX idx_links_last_accessed_at (last_accessed_at)
+);
+
+CREATE TABLE IF NOT EXISTS rendered_contents (
+    hash varchar(64) PRIMARY KEY,
+    data longblob,
+    encoding varchar(191),
+    created_at datetime(3) NULL
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    short_code varchar(64) NOT NULL,
+    clicked_at datetime(3) NOT NULL,
+    ua_class varchar(16),
+    referrer text,
+    ip_hash varchar(64),
+    INDEX idx_click_events_short_code (short_code),
+    INDEX idx_click_events_clicked_at (clicked_at)
+);
+
+CREATE TABLE IF NOT EXISTS daily_click_stats (
+    short_code varchar(64),
+    day varchar(10),
+    clicks bigint NOT NULL DEFAULT 0,
+    bot_clicks bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_code, day)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS daily_click_stats;
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS rendered_contents;
+DROP TABLE IF EXISTS links;
@@ -0,0 +1,12 @@
+-- Render metrics for capacity planning: how long the latest successful render
+-- took, how large its HTML was and when it finished.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN render_duration_ms bigint DEFAULT 0;
+ALTER TABLE links ADD COLUMN html_size_bytes bigint DEFAULT 0;
+ALTER TABLE links ADD COLUMN rendered_at datetime(3) NULL;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN rendered_at;
+ALTER TABLE links DROP COLUMN html_size_bytes;
+ALTER TABLE links DROP COLUMN render_duration_ms;
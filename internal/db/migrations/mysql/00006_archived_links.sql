@@ -0,0 +1,20 @@
+-- Cold storage for links nobody has visited in a long time, so the links table
+-- and its indexes stay small. Each row holds the archived links row as JSON and
+-- is moved back into links when its short code or URL is requested again.
+
+-- +goose Up
+CREATE TABLE archived_links (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    short_code varchar(191) NOT NULL,
+    original_url varchar(768) NOT NULL,
+    rendered_content_hash varchar(64),
+    data longtext NOT NULL,
+    archived_at datetime(3) NOT NULL,
+    UNIQUE INDEX idx_archived_links_short_code (short_code),
+    INDEX idx_archived_links_original_url (original_url),
+    INDEX idx_archived_links_rendered_content_hash (rendered_content_hash),
+    INDEX idx_archived_links_archived_at (archived_at)
+);
+
+-- +goose Down
+DROP TABLE archived_links;
@@ -0,0 +1,20 @@
+-- Earlier successful renders of each link, so the served snapshot can be rolled
+-- back. The HTML stays in rendered_contents, referenced by hash.
+
+-- +goose Up
+CREATE TABLE render_versions (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    short_code varchar(64) NOT NULL,
+    rendered_content_hash varchar(64) NOT NULL,
+    target_status_code bigint DEFAULT 0,
+    final_url longtext,
+    redirect_chain longtext,
+    render_duration_ms bigint NOT NULL DEFAULT 0,
+    html_size_bytes bigint NOT NULL DEFAULT 0,
+    rendered_at datetime(3) NOT NULL,
+    INDEX idx_render_versions_short_code (short_code),
+    INDEX idx_render_versions_rendered_content_hash (rendered_content_hash)
+);
+
+-- +goose Down
+DROP TABLE render_versions;
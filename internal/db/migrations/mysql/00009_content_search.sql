@@ -0,0 +1,11 @@
+-- Full-text search over snapshots. text_content holds the visible text of the
+-- HTML, which is compressed in data; rows stored before this migration stay
+-- NULL until the server backfills them on startup.
+
+-- +goose Up
+ALTER TABLE rendered_contents ADD COLUMN text_content longtext;
+ALTER TABLE rendered_contents ADD FULLTEXT INDEX idx_rendered_contents_text_content (text_content);
+
+-- +goose Down
+DROP INDEX idx_rendered_contents_text_content ON rendered_contents;
+ALTER TABLE rendered_contents DROP COLUMN text_content;
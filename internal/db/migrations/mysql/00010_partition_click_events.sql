@@ -0,0 +1,8 @@
+-- Monthly partitioning of click_events is PostgreSQL-only. This migration keeps
+-- schema versions aligned across databases.
+
+-- +goose Up
+SELECT 1;
+
+-- +goose Down
+SELECT 1;
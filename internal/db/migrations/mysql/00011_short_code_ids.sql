@@ -0,0 +1,10 @@
+-- Counter handing out IDs for sequential short codes.
+
+-- +goose Up
+CREATE TABLE short_code_ids (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    created_at datetime(3) NOT NULL
+);
+
+-- +goose Down
+DROP TABLE short_code_ids;
@@ -0,0 +1,7 @@
+-- Per-link X-Robots-Tag, overriding the ROBOTS_TAG default for one short URL.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN robots_tag text;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN robots_tag;
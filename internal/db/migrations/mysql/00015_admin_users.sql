@@ -0,0 +1,26 @@
+-- Admin users logging in with a password, and their sessions. Sessions are
+-- stored by a hash of their token, so a database leak doesn't hand them out.
+
+-- +goose Up
+CREATE TABLE admin_users (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    username varchar(64) NOT NULL,
+    password_hash varchar(72) NOT NULL,
+    role varchar(16) NOT NULL,
+    created_at datetime(3) NOT NULL,
+    updated_at datetime(3) NOT NULL,
+    UNIQUE INDEX idx_admin_users_username (username)
+);
+
+CREATE TABLE admin_sessions (
+    token_hash varchar(64) PRIMARY KEY,
+    user_id bigint unsigned NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    created_at datetime(3) NOT NULL,
+    INDEX idx_admin_sessions_user_id (user_id),
+    INDEX idx_admin_sessions_expires_at (expires_at)
+);
+
+-- +goose Down
+DROP TABLE admin_sessions;
+DROP TABLE admin_users;
@@ -0,0 +1,8 @@
+-- Name of the crawler behind a bot's click, e.g. Googlebot, for per-link crawl
+-- history. Empty for browsers and for bots that couldn't be told apart.
+
+-- +goose Up
+ALTER TABLE click_events ADD COLUMN bot_name varchar(64);
+
+-- +goose Down
+ALTER TABLE click_events DROP COLUMN bot_name;
@@ -0,0 +1,21 @@
+-- Device class of people's clicks (desktop, mobile or tablet) and the country
+-- of every click, from the GeoIP database when one is configured. Rollups keep
+-- per-day click counts by these and the other click details in
+-- daily_click_breakdowns, so breakdowns outlive the raw events.
+
+-- +goose Up
+ALTER TABLE click_events ADD COLUMN device_class varchar(16);
+ALTER TABLE click_events ADD COLUMN country varchar(2);
+CREATE TABLE daily_click_breakdowns (
+    short_code varchar(64),
+    day varchar(10),
+    dimension varchar(16),
+    value varchar(255),
+    clicks bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_code, day, dimension, value)
+);
+
+-- +goose Down
+DROP TABLE daily_click_breakdowns;
+ALTER TABLE click_events DROP COLUMN country;
+ALTER TABLE click_events DROP COLUMN device_class;
@@ -0,0 +1,11 @@
+-- Links waiting for a render worker carry the time the render was requested,
+-- so the links table doubles as the render queue shared by the replicas. A
+-- worker clears it when it claims the link.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN render_requested_at datetime(3) NULL;
+CREATE INDEX idx_links_render_requested_at ON links (render_requested_at);
+
+-- +goose Down
+DROP INDEX idx_links_render_requested_at ON links;
+ALTER TABLE links DROP COLUMN render_requested_at;
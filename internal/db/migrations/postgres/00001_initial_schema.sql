@@ -0,0 +1,63 @@
+-- Schema as last created by AutoMigrate. IF NOT EXISTS lets databases set up
+-- before versioned migrations adopt it unchanged.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS links (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    short_code text NOT NULL,
+    original_url text NOT NULL,
+    rendered_html_content text,
+    render_status varchar(20) NOT NULL DEFAULT 'pending',
+    target_status_code bigint DEFAULT 0,
+    final_url text,
+    redirect_chain text,
+    accept_language text,
+    locale text,
+    timezone text,
+    render_profile text,
+    render_claimed_at timestamptz,
+    last_accessed_at timestamptz,
+    rendered_html_compressed bytea,
+    html_encoding text,
+    rendered_content_hash varchar(64)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_links_short_code ON links (short_code);
+CREATE INDEX IF NOT EXISTS idx_links_original_url ON links (original_url);
+CREATE INDEX IF NOT EXISTS idx_links_deleted_at ON links (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_links_rendered_content_hash ON links (rendered_content_hash);
+CREATE INDEX IF NOT EXISTS idx_links_last_accessed_at ON links (last_accessed_at);
+
+CREATE TABLE IF NOT EXISTS rendered_contents (
+    hash varchar(64) PRIMARY KEY,
+    data bytea,
+    encoding text,
+    created_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id bigserial PRIMARY KEY,
+    short_code varchar(64) NOT NULL,
+    clicked_at timestamptz NOT NULL,
+    ua_class varchar(16),
+    referrer text,
+    ip_hash varchar(64)
+);
+CREATE INDEX IF NOT EXISTS idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX IF NOT EXISTS idx_click_events_clicked_at ON click_events (clicked_at);
+
+CREATE TABLE IF NOT EXISTS daily_click_stats (
+    short_code varchar(64),
+    day varchar(10),
+    clicks bigint NOT NULL DEFAULT 0,
+    bot_clicks bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_code, day)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS daily_click_stats;
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS rendered_contents;
+DROP TABLE IF EXISTS links;
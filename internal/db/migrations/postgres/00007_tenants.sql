@@ -0,0 +1,13 @@
+-- Tenant of each link, from the API key or host it was created through. The
+-- default tenant is ''. Short codes stay unique across tenants; url_key is
+-- prefixed with the tenant, so each tenant has its own link per URL.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN tenant_id varchar(64) NOT NULL DEFAULT '';
+CREATE INDEX idx_links_tenant_id ON links (tenant_id);
+ALTER TABLE archived_links ADD COLUMN tenant_id varchar(64) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE archived_links DROP COLUMN tenant_id;
+DROP INDEX idx_links_tenant_id;
+ALTER TABLE links DROP COLUMN tenant_id;
@@ -0,0 +1,14 @@
+-- Full-text search over snapshots. text_content holds the visible text of the
+-- HTML, which is compressed in data; rows stored before this migration stay
+-- NULL until the server backfills them on startup.
+
+-- +goose Up
+ALTER TABLE rendered_contents ADD COLUMN text_content text;
+ALTER TABLE rendered_contents ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(text_content, ''))) STORED;
+CREATE INDEX idx_rendered_contents_search_vector ON rendered_contents USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX idx_rendered_contents_search_vector;
+ALTER TABLE rendered_contents DROP COLUMN search_vector;
+ALTER TABLE rendered_contents DROP COLUMN text_content;
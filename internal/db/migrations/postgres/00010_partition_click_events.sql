@@ -0,0 +1,62 @@
+-- Partition click_events by month of clicked_at, so a month of raw events can be
+-- pruned by dropping its partition instead of deleting row by row. Partitions
+-- are named click_events_YYYY_MM; the janitor creates upcoming months ahead of
+-- time, and events outside every monthly partition land in click_events_default.
+-- The primary key has to include the partition key.
+
+-- +goose Up
+CREATE TABLE click_events_partitioned (
+    id bigserial,
+    short_code varchar(64) NOT NULL,
+    clicked_at timestamptz NOT NULL,
+    ua_class varchar(16),
+    referrer text,
+    ip_hash varchar(64),
+    PRIMARY KEY (id, clicked_at)
+) PARTITION BY RANGE (clicked_at);
+CREATE TABLE click_events_default PARTITION OF click_events_partitioned DEFAULT;
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+    -- Month boundaries are computed in UTC, whatever the session time zone
+    part_start timestamp := date_trunc('month', COALESCE((SELECT MIN(clicked_at) FROM click_events), now()) AT TIME ZONE 'UTC');
+BEGIN
+    WHILE part_start < date_trunc('month', now() AT TIME ZONE 'UTC') + interval '3 months' LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF click_events_partitioned FOR VALUES FROM (%L) TO (%L)',
+            'click_events_' || to_char(part_start, 'YYYY_MM'),
+            part_start AT TIME ZONE 'UTC', (part_start + interval '1 month') AT TIME ZONE 'UTC');
+        part_start := part_start + interval '1 month';
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+INSERT INTO click_events_partitioned (id, short_code, clicked_at, ua_class, referrer, ip_hash)
+    SELECT id, short_code, clicked_at, ua_class, referrer, ip_hash FROM click_events;
+SELECT setval(pg_get_serial_sequence('click_events_partitioned', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM click_events_partitioned;
+DROP TABLE click_events;
+ALTER TABLE click_events_partitioned RENAME TO click_events;
+ALTER SEQUENCE click_events_partitioned_id_seq RENAME TO click_events_id_seq;
+ALTER INDEX click_events_partitioned_pkey RENAME TO click_events_pkey;
+CREATE INDEX idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX idx_click_events_clicked_at ON click_events (clicked_at);
+
+-- +goose Down
+CREATE TABLE click_events_unpartitioned (
+    id bigserial PRIMARY KEY,
+    short_code varchar(64) NOT NULL,
+    clicked_at timestamptz NOT NULL,
+    ua_class varchar(16),
+    referrer text,
+    ip_hash varchar(64)
+);
+INSERT INTO click_events_unpartitioned (id, short_code, clicked_at, ua_class, referrer, ip_hash)
+    SELECT id, short_code, clicked_at, ua_class, referrer, ip_hash FROM click_events;
+SELECT setval(pg_get_serial_sequence('click_events_unpartitioned', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM click_events_unpartitioned;
+DROP TABLE click_events;
+ALTER TABLE click_events_unpartitioned RENAME TO click_events;
+ALTER SEQUENCE click_events_unpartitioned_id_seq RENAME TO click_events_id_seq;
+ALTER INDEX click_events_unpartitioned_pkey RENAME TO click_events_pkey;
+CREATE INDEX idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX idx_click_events_clicked_at ON click_events (clicked_at);
@@ -0,0 +1,11 @@
+-- Feature flags switched at runtime, overriding FEATURE_FLAGS.
+
+-- +goose Up
+CREATE TABLE feature_flags (
+    name varchar(64) PRIMARY KEY,
+    enabled boolean NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+-- +goose Down
+DROP TABLE feature_flags;
@@ -0,0 +1,26 @@
+-- Admin users logging in with a password, and their sessions. Sessions are
+-- stored by a hash of their token, so a database leak doesn't hand them out.
+
+-- +goose Up
+CREATE TABLE admin_users (
+    id bigserial PRIMARY KEY,
+    username varchar(64) NOT NULL,
+    password_hash varchar(72) NOT NULL,
+    role varchar(16) NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX idx_admin_users_username ON admin_users (username);
+
+CREATE TABLE admin_sessions (
+    token_hash varchar(64) PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX idx_admin_sessions_user_id ON admin_sessions (user_id);
+CREATE INDEX idx_admin_sessions_expires_at ON admin_sessions (expires_at);
+
+-- +goose Down
+DROP TABLE admin_sessions;
+DROP TABLE admin_users;
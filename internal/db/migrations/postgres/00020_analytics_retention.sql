@@ -0,0 +1,20 @@
+-- Raw click events can be kept after rollups until the analytics retention job
+-- prunes them, so rollups flag the events they counted instead of deleting
+-- them. Every purge of analytics data is recorded in analytics_purges.
+
+-- +goose Up
+ALTER TABLE click_events ADD COLUMN rolled_up boolean NOT NULL DEFAULT false;
+CREATE INDEX idx_click_events_rolled_up ON click_events (rolled_up, id);
+CREATE TABLE analytics_purges (
+    id bigserial PRIMARY KEY,
+    purged_at timestamptz NOT NULL,
+    dataset varchar(64) NOT NULL,
+    cutoff timestamptz NOT NULL,
+    rows_deleted bigint NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_analytics_purges_purged_at ON analytics_purges (purged_at);
+
+-- +goose Down
+DROP TABLE analytics_purges;
+DROP INDEX idx_click_events_rolled_up;
+ALTER TABLE click_events DROP COLUMN rolled_up;
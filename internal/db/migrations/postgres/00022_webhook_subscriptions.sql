@@ -0,0 +1,33 @@
+-- Webhook subscriptions registered through the admin API, each receiving the
+-- event types it chose, and the log of their delivery attempts.
+
+-- +goose Up
+CREATE TABLE webhook_subscriptions (
+    id bigserial PRIMARY KEY,
+    url varchar(2048) NOT NULL,
+    event_types varchar(255) NOT NULL DEFAULT '',
+    secret varchar(128) NOT NULL,
+    max_attempts integer NOT NULL,
+    backoff_seconds integer NOT NULL,
+    enabled boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    subscription_id bigint NOT NULL,
+    event_type varchar(32) NOT NULL,
+    short_code varchar(64) NOT NULL DEFAULT '',
+    attempt integer NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    error text,
+    duration_ms bigint NOT NULL DEFAULT 0,
+    succeeded boolean NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, created_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_subscriptions;
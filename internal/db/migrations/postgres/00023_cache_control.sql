@@ -0,0 +1,8 @@
+-- Per-link Cache-Control, overriding the REDIRECT_CACHE_CONTROL and
+-- SNAPSHOT_CACHE_CONTROL defaults for one short URL.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN cache_control text;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN cache_control;
@@ -0,0 +1,63 @@
+-- Schema as last created by AutoMigrate. IF NOT EXISTS lets databases set up
+-- before versioned migrations adopt it unchanged.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS links (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    short_code text NOT NULL,
+    original_url text NOT NULL,
+    rendered_html_content text,
+    render_status varchar(20) NOT NULL DEFAULT 'pending',
+    target_status_code integer DEFAULT 0,
+    final_url text,
+    redirect_chain text,
+    accept_language text,
+    locale text,
+    timezone text,
+    render_profile text,
+    render_claimed_at datetime,
+    last_accessed_at datetime,
+    rendered_html_compressed blob,
+    html_encoding text,
+    rendered_content_hash text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_links_short_code ON links (short_code);
+CREATE INDEX IF NOT EXISTS idx_links_original_url ON links (original_url);
+CREATE INDEX IF NOT EXISTS idx_links_deleted_at ON links (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_links_rendered_content_hash ON links (rendered_content_hash);
+CREATE INDEX IF NOT EXISTS idx_links_last_accessed_at ON links (last_accessed_at);
+
+CREATE TABLE IF NOT EXISTS rendered_contents (
+    hash text PRIMARY KEY,
+    data blob,
+    encoding text,
+    created_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    short_code text NOT NULL,
+    clicked_at datetime NOT NULL,
+    ua_class text,
+    referrer text,
+    ip_hash text
+);
+CREATE INDEX IF NOT EXISTS idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX IF NOT EXISTS idx_click_events_clicked_at ON click_events (clicked_at);
+
+CREATE TABLE IF NOT EXISTS daily_click_stats (
+    short_code text,
+    day text,
+    clicks integer NOT NULL DEFAULT 0,
+    bot_clicks integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_code, day)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS daily_click_stats;
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS rendered_contents;
+DROP TABLE IF EXISTS links;
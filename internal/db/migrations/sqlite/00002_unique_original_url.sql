@@ -0,0 +1,14 @@
+-- url_key holds original_url for the one live link that owns the URL, making
+-- concurrent /generate calls for the same URL conflict instead of both inserting.
+-- It is NULL for soft-deleted links and for duplicates created before this
+-- constraint, which keep working under their own short codes.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN url_key text;
+UPDATE links SET url_key = original_url
+WHERE id IN (SELECT MIN(id) FROM links WHERE deleted_at IS NULL GROUP BY original_url);
+CREATE UNIQUE INDEX idx_links_url_key ON links (url_key);
+
+-- +goose Down
+DROP INDEX idx_links_url_key;
+ALTER TABLE links DROP COLUMN url_key;
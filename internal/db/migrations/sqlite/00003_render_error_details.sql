@@ -0,0 +1,11 @@
+-- Render failure details, so a failed link shows why it failed without digging
+-- through worker logs. render_attempts counts every render a worker started,
+-- including retries; last_render_error is cleared by the next successful render.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN render_attempts integer DEFAULT 0;
+ALTER TABLE links ADD COLUMN last_render_error text;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN last_render_error;
+ALTER TABLE links DROP COLUMN render_attempts;
@@ -0,0 +1,9 @@
+-- Indexes rendered_at for stale-snapshot queries. Links completed before render
+-- times were recorded are backfilled from updated_at, the closest known time.
+
+-- +goose Up
+UPDATE links SET rendered_at = updated_at WHERE rendered_at IS NULL AND render_status = 'completed';
+CREATE INDEX idx_links_rendered_at ON links (rendered_at);
+
+-- +goose Down
+DROP INDEX idx_links_rendered_at;
@@ -0,0 +1,20 @@
+-- Cold storage for links nobody has visited in a long time, so the links table
+-- and its indexes stay small. Each row holds the archived links row as JSON and
+-- is moved back into links when its short code or URL is requested again.
+
+-- +goose Up
+CREATE TABLE archived_links (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    short_code text NOT NULL,
+    original_url text NOT NULL,
+    rendered_content_hash varchar(64),
+    data text NOT NULL,
+    archived_at datetime NOT NULL
+);
+CREATE UNIQUE INDEX idx_archived_links_short_code ON archived_links (short_code);
+CREATE INDEX idx_archived_links_original_url ON archived_links (original_url);
+CREATE INDEX idx_archived_links_rendered_content_hash ON archived_links (rendered_content_hash);
+CREATE INDEX idx_archived_links_archived_at ON archived_links (archived_at);
+
+-- +goose Down
+DROP TABLE archived_links;
@@ -0,0 +1,20 @@
+-- Earlier successful renders of each link, so the served snapshot can be rolled
+-- back. The HTML stays in rendered_contents, referenced by hash.
+
+-- +goose Up
+CREATE TABLE render_versions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    short_code varchar(64) NOT NULL,
+    rendered_content_hash varchar(64) NOT NULL,
+    target_status_code integer DEFAULT 0,
+    final_url text,
+    redirect_chain text,
+    render_duration_ms integer NOT NULL DEFAULT 0,
+    html_size_bytes integer NOT NULL DEFAULT 0,
+    rendered_at datetime NOT NULL
+);
+CREATE INDEX idx_render_versions_short_code ON render_versions (short_code);
+CREATE INDEX idx_render_versions_rendered_content_hash ON render_versions (rendered_content_hash);
+
+-- +goose Down
+DROP TABLE render_versions;
@@ -0,0 +1,9 @@
+-- Full-text search over snapshots. text_content holds the visible text of the
+-- HTML, which is compressed in data; rows stored before this migration stay
+-- NULL until the server backfills them on startup. SQLite scans it with LIKE.
+
+-- +goose Up
+ALTER TABLE rendered_contents ADD COLUMN text_content text;
+
+-- +goose Down
+ALTER TABLE rendered_contents DROP COLUMN text_content;
@@ -0,0 +1,11 @@
+-- Counter handing out IDs for sequential short codes. AUTOINCREMENT keeps IDs
+-- from being reused once their rows are deleted.
+
+-- +goose Up
+CREATE TABLE short_code_ids (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime NOT NULL
+);
+
+-- +goose Down
+DROP TABLE short_code_ids;
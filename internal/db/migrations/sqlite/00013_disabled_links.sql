@@ -0,0 +1,10 @@
+-- Links can be disabled without deleting them, e.g. when URL screening flags
+-- their destination. disabled_reason records why for the admin and the logs.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN disabled_at datetime;
+ALTER TABLE links ADD COLUMN disabled_reason text;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN disabled_reason;
+ALTER TABLE links DROP COLUMN disabled_at;
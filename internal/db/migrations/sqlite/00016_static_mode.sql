@@ -0,0 +1,8 @@
+-- Static mode serves a link's snapshot to every visitor instead of redirecting
+-- them, turning the short URL into a hosted copy of the page.
+
+-- +goose Up
+ALTER TABLE links ADD COLUMN static_mode numeric NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN static_mode;
@@ -0,0 +1,10 @@
+-- Browser and platform of people's clicks, taken from User-Agent Client Hints
+-- when the browser sends them and from the User-Agent string otherwise.
+
+-- +goose Up
+ALTER TABLE click_events ADD COLUMN browser varchar(64);
+ALTER TABLE click_events ADD COLUMN platform varchar(64);
+
+-- +goose Down
+ALTER TABLE click_events DROP COLUMN platform;
+ALTER TABLE click_events DROP COLUMN browser;
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// clickPartitionPrefix starts the name of every monthly click_events partition,
+// which continues with the month as YYYY_MM.
+const clickPartitionPrefix = "click_events_"
+
+// ClickPartitionResult lists the partitions MaintainClickPartitions changed.
+type ClickPartitionResult struct {
+	Created []string `json:"created"`
+	Dropped []string `json:"dropped"`
+}
+
+// ClickEventsPartitioned reports whether click_events is partitioned by month,
+// which it is on PostgreSQL.
+func ClickEventsPartitioned() (bool, error) {
+	if DB.Dialector.Name() != DriverPostgres {
+		return false, nil
+	}
+	var count int64
+	err := DB.Raw(`SELECT COUNT(*) FROM pg_partitioned_table p JOIN pg_class c ON c.oid = p.partrelid
+		WHERE c.relname = 'click_events' AND pg_table_is_visible(c.oid)`).Scan(&count).Error
+	return count > 0, err
+}
+
+// MaintainClickPartitions creates the click_events partitions for the current
+// month and monthsAhead following ones, and drops the partitions of months that
+// ended before dropBefore, unless it is zero. Dropping a partition deletes its
+// raw events at once; counts already rolled up into daily_click_stats are kept.
+func MaintainClickPartitions(now time.Time, monthsAhead int, dropBefore time.Time) (*ClickPartitionResult, error) {
+	result := &ClickPartitionResult{}
+	var existing []string
+	err := DB.Raw(`SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'click_events'::regclass`).Scan(&existing).Error
+	if err != nil {
+		return result, err
+	}
+
+	create, drop := planClickPartitions(existing, now, monthsAhead, dropBefore)
+	for _, month := range create {
+		name := clickPartitionName(month)
+		// DDL takes no bind parameters; the name and bounds are generated here
+		err := DB.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF click_events FOR VALUES FROM ('%s') TO ('%s')",
+			name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))).Error
+		if err != nil {
+			return result, fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+		result.Created = append(result.Created, name)
+	}
+	for _, name := range drop {
+		if err := DB.Exec("DROP TABLE IF EXISTS " + name).Error; err != nil {
+			return result, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		result.Dropped = append(result.Dropped, name)
+	}
+	return result, nil
+}
+
+// planClickPartitions works out which monthly partitions MaintainClickPartitions
+// creates and drops, given the partitions that exist. Partitions not named after
+// a month, such as the default one, are left alone.
+func planClickPartitions(existing []string, now time.Time, monthsAhead int, dropBefore time.Time) (create []time.Time, drop []string) {
+	have := map[string]bool{}
+	for _, name := range existing {
+		have[name] = true
+		month, ok := parseClickPartitionName(name)
+		if ok && !dropBefore.IsZero() && !month.AddDate(0, 1, 0).After(dropBefore) {
+			drop = append(drop, name)
+		}
+	}
+	sort.Strings(drop)
+
+	now = now.UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= monthsAhead; i++ {
+		month := current.AddDate(0, i, 0)
+		if !have[clickPartitionName(month)] {
+			create = append(create, month)
+		}
+	}
+	return create, drop
+}
+
+// clickPartitionName names the partition holding the clicks of month.
+func clickPartitionName(month time.Time) string {
+	return clickPartitionPrefix + month.Format("2006_01")
+}
+
+// parseClickPartitionName returns the month a partition named by
+// clickPartitionName holds.
+func parseClickPartitionName(name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, clickPartitionPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	month, err := time.Parse("2006_01", suffix)
+	return month, err == nil
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanClickPartitions(t *testing.T) {
+	now := time.Date(2024, 11, 15, 12, 0, 0, 0, time.UTC)
+	existing := []string{"click_events_default", "click_events_2024_08", "click_events_2024_09",
+		"click_events_2024_10", "click_events_2024_11", "click_events_2024_12"}
+
+	create, drop := planClickPartitions(existing, now, 2, time.Time{})
+	assert.Equal(t, []time.Time{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}, create, "months that exist are skipped")
+	assert.Empty(t, drop, "nothing is dropped without a cutoff")
+
+	create, drop = planClickPartitions(existing, now, 0, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC))
+	assert.Empty(t, create)
+	assert.Equal(t, []string{"click_events_2024_08", "click_events_2024_09"}, drop, "only months that ended before the cutoff")
+
+	_, drop = planClickPartitions(existing, now, 0, time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, []string{"click_events_2024_08"}, drop)
+}
+
+func TestClickPartitionName(t *testing.T) {
+	name := clickPartitionName(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, "click_events_2024_03", name)
+	month, ok := parseClickPartitionName(name)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), month)
+	_, ok = parseClickPartitionName("click_events_default")
+	assert.False(t, ok)
+}
+
+func TestClickEventsPartitionedOnlyOnPostgres(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	partitioned, err := ClickEventsPartitioned()
+	require.NoError(t, err)
+	assert.False(t, partitioned)
+}
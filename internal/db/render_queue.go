@@ -0,0 +1,137 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The links table doubles as the render queue shared by all replicas: a link
+// whose render was requested carries RenderRequestedAt until a worker claims
+// it with ClaimRenderRequests or ClaimLinkForRender.
+
+// RequestRender asks the render workers of any replica to render a link. It
+// returns ErrNotFound if there is no live link with the short code.
+func RequestRender(shortCode string) error {
+	result := DB.Model(&Link{}).Where("short_code = ?", shortCode).Update("render_requested_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListRenderRequests returns the short codes and URLs of up to limit links
+// waiting for a render, oldest request first.
+func ListRenderRequests(limit int) ([]Link, error) {
+	var links []Link
+	err := DB.Select("id, short_code, original_url").Where("render_requested_at IS NOT NULL").
+		Order("render_requested_at, id").Limit(limit).Find(&links).Error
+	return links, err
+}
+
+// ClaimRenderRequests claims up to limit links waiting for a render, oldest
+// request first, exactly like ClaimLinkForRender does one at a time. Replicas
+// polling concurrently never claim the same link: on PostgreSQL and MySQL the
+// requests are selected FOR UPDATE SKIP LOCKED, so rows locked by another
+// replica's claim are passed over instead of waited for, and SQLite runs one
+// writing transaction at a time.
+func ClaimRenderRequests(limit int, staleAfter time.Duration) ([]Link, error) {
+	now := time.Now()
+	var links []Link
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Select("id, short_code, original_url").
+			Where("render_requested_at IS NOT NULL").
+			Where(claimableCondition, RenderStatusRendering, now.Add(-staleAfter)).
+			Order("render_requested_at, id").Limit(limit)
+		if tx.Dialector.Name() != DriverSQLite {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&links).Error; err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(links))
+		for i, link := range links {
+			ids[i] = link.ID
+		}
+		return tx.Model(&Link{}).Where("id IN ?", ids).Updates(claimColumns(now)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	shortCodes := make([]string, len(links))
+	for i, link := range links {
+		shortCodes[i] = link.ShortCode
+	}
+	invalidateLinks(shortCodes...)
+	return links, nil
+}
+
+// ReleaseRenderClaim puts a link claimed by ClaimRenderRequests that the
+// worker couldn't take back on the queue, as a pending render request.
+func ReleaseRenderClaim(shortCode string) error {
+	defer invalidateLinks(shortCode)
+	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Updates(map[string]interface{}{
+		"render_status":       RenderStatusPending,
+		"render_claimed_at":   nil,
+		"render_requested_at": time.Now(),
+	}).Error
+}
+
+// RecoverStuckRenders requests renders again for the links left rendering by a
+// worker that died, e.g. in a crash, which would otherwise stay without a
+// snapshot: those claimed more than stuckFor ago, or last updated then if the
+// claim time is unknown. They are set back to pending for the next poll to
+// claim. It returns the short codes of the recovered links.
+func RecoverStuckRenders(stuckFor time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-stuckFor)
+	stuck := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("render_status = ?", RenderStatusRendering).
+			Where("render_claimed_at < ? OR (render_claimed_at IS NULL AND updated_at < ?)", cutoff, cutoff)
+	}
+	var shortCodes []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := stuck(tx.Model(&Link{})).Pluck("short_code", &shortCodes).Error; err != nil {
+			return err
+		}
+		if len(shortCodes) == 0 {
+			return nil
+		}
+		// Checked again, in case a worker claimed one of the links meanwhile
+		return stuck(tx.Model(&Link{})).Where("short_code IN ?", shortCodes).Updates(map[string]interface{}{
+			"render_status":       RenderStatusPending,
+			"render_claimed_at":   nil,
+			"render_requested_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateLinks(shortCodes...)
+	return shortCodes, nil
+}
+
+// GetRenderStatuses returns the render status of each live link among
+// shortCodes. Codes of links that don't exist are left out. Unlike
+// GetLinkByShortCode it skips the link cache, so the statuses are current.
+func GetRenderStatuses(shortCodes []string) (map[string]RenderStatus, error) {
+	var rows []struct {
+		ShortCode    string
+		RenderStatus RenderStatus
+	}
+	err := DB.Model(&Link{}).Select("short_code, render_status").Where("short_code IN ?", shortCodes).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]RenderStatus, len(rows))
+	for _, row := range rows {
+		statuses[row.ShortCode] = row.RenderStatus
+	}
+	return statuses, nil
+}
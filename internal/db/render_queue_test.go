@@ -0,0 +1,141 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderRequests(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for _, code := range []string{"REQ001", "REQ002", "REQ003"} {
+		require.NoError(t, CreateLink(&Link{ShortCode: code, OriginalURL: "https://req.com/" + code}))
+	}
+	assert.ErrorIs(t, RequestRender("MISSING"), ErrNotFound)
+	require.NoError(t, RequestRender("REQ002"))
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, RequestRender("REQ001"))
+
+	requests, err := ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "REQ002", requests[0].ShortCode, "oldest request first")
+	assert.Equal(t, "https://req.com/REQ002", requests[0].OriginalURL)
+	assert.Equal(t, "REQ001", requests[1].ShortCode)
+
+	// Claiming a link takes it off the queue
+	claimed, err := ClaimLinkForRender("REQ002", time.Minute)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	requests, err = ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "REQ001", requests[0].ShortCode)
+
+	statuses, err := GetRenderStatuses([]string{"REQ001", "REQ002", "MISSING"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RenderStatus{"REQ001": RenderStatusPending, "REQ002": RenderStatusRendering}, statuses)
+}
+
+func TestClaimRenderRequests(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for _, code := range []string{"CLM001", "CLM002", "CLM003", "CLM004"} {
+		require.NoError(t, CreateLink(&Link{ShortCode: code, OriginalURL: "https://claim.com/" + code}))
+		require.NoError(t, RequestRender(code))
+		time.Sleep(2 * time.Millisecond)
+	}
+	// Held by a worker, so not claimable until the claim goes stale
+	require.NoError(t, DB.Model(&Link{}).Where("short_code = ?", "CLM001").Updates(map[string]interface{}{
+		"render_status": RenderStatusRendering, "render_claimed_at": time.Now(),
+	}).Error)
+
+	links, err := ClaimRenderRequests(2, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "CLM002", links[0].ShortCode)
+	assert.Equal(t, "https://claim.com/CLM002", links[0].OriginalURL)
+	assert.Equal(t, "CLM003", links[1].ShortCode)
+
+	link, err := GetLinkByShortCode("CLM002")
+	require.NoError(t, err)
+	assert.Equal(t, RenderStatusRendering, link.RenderStatus)
+	assert.NotNil(t, link.RenderClaimedAt)
+	assert.Nil(t, link.RenderRequestedAt)
+	assert.Equal(t, 1, link.RenderAttempts)
+
+	// Claimed links are off the queue
+	links, err = ClaimRenderRequests(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "CLM004", links[0].ShortCode)
+
+	// A stale claim is taken over
+	links, err = ClaimRenderRequests(10, 0)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "CLM001", links[0].ShortCode)
+
+	// Released claims are requested again
+	require.NoError(t, ReleaseRenderClaim("CLM003"))
+	link, err = GetLinkByShortCode("CLM003")
+	require.NoError(t, err)
+	assert.Equal(t, RenderStatusPending, link.RenderStatus)
+	assert.Nil(t, link.RenderClaimedAt)
+	links, err = ClaimRenderRequests(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "CLM003", links[0].ShortCode)
+	link, err = GetLinkByShortCode("CLM003")
+	require.NoError(t, err)
+	assert.Equal(t, 2, link.RenderAttempts)
+}
+
+func TestRecoverStuckRenders(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	long, recent := time.Now().Add(-10*time.Minute), time.Now()
+	links := []struct {
+		code      string
+		status    RenderStatus
+		claimedAt *time.Time
+	}{
+		{"STUCK1", RenderStatusRendering, &long},
+		{"STUCK2", RenderStatusRendering, nil}, // Claimed before claims were recorded
+		{"BUSY01", RenderStatusRendering, &recent},
+		{"DONE01", RenderStatusCompleted, &long},
+	}
+	for _, l := range links {
+		require.NoError(t, CreateLink(&Link{ShortCode: l.code, OriginalURL: "https://stuck.com/" + l.code}))
+		require.NoError(t, DB.Model(&Link{}).Where("short_code = ?", l.code).UpdateColumns(map[string]interface{}{
+			"render_status": l.status, "render_claimed_at": l.claimedAt, "updated_at": long,
+		}).Error)
+	}
+
+	recovered, err := RecoverStuckRenders(time.Minute)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"STUCK1", "STUCK2"}, recovered)
+
+	link, err := GetLinkByShortCode("STUCK1")
+	require.NoError(t, err)
+	assert.Equal(t, RenderStatusPending, link.RenderStatus)
+	assert.Nil(t, link.RenderClaimedAt)
+	link, err = GetLinkByShortCode("BUSY01")
+	require.NoError(t, err)
+	assert.Equal(t, RenderStatusRendering, link.RenderStatus, "still within the render timeout")
+
+	// Re-enqueued for the workers
+	requests, err := ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+
+	recovered, err = RecoverStuckRenders(time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, recovered)
+}
@@ -0,0 +1,62 @@
+package db
+
+import "strings"
+
+// RenderStats aggregates the metrics of the latest successful render of a set of
+// links, for capacity planning and per-site performance reports.
+type RenderStats struct {
+	Links          int64   `json:"links"`
+	AvgDurationMs  float64 `json:"avg_duration_ms"`
+	MaxDurationMs  int64   `json:"max_duration_ms"`
+	AvgSizeBytes   float64 `json:"avg_size_bytes"`
+	TotalSizeBytes int64   `json:"total_size_bytes"`
+}
+
+// GetRenderStats aggregates the render metrics of live, rendered links whose
+// original URL starts with urlPrefix, such as "https://example.com/". An empty
+// prefix covers every link.
+func GetRenderStats(urlPrefix string) (*RenderStats, error) {
+	query := DB.Model(&Link{}).Select(`COUNT(*) AS links,
+		COALESCE(AVG(render_duration_ms), 0) AS avg_duration_ms,
+		COALESCE(MAX(render_duration_ms), 0) AS max_duration_ms,
+		COALESCE(AVG(html_size_bytes), 0) AS avg_size_bytes,
+		COALESCE(SUM(html_size_bytes), 0) AS total_size_bytes`).
+		Where("rendered_at IS NOT NULL")
+	if urlPrefix != "" {
+		query = query.Where("original_url LIKE ? ESCAPE '!'", escapeLike(urlPrefix)+"%")
+	}
+	var stats RenderStats
+	if err := query.Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s using '!' as the escape character,
+// which unlike backslash needs no quoting on any of the supported databases.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// CountLinksByRenderStatus counts the live links in each render status, so the
+// render backlog can be checked from the database alone.
+func CountLinksByRenderStatus() (map[RenderStatus]int64, error) {
+	var rows []struct {
+		RenderStatus RenderStatus
+		Links        int64
+	}
+	err := DB.Model(&Link{}).Select("render_status, COUNT(*) AS links").Group("render_status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := map[RenderStatus]int64{
+		RenderStatusPending:   0,
+		RenderStatusRendering: 0,
+		RenderStatusCompleted: 0,
+		RenderStatusFailed:    0,
+	}
+	for _, row := range rows {
+		counts[row.RenderStatus] = row.Links
+	}
+	return counts, nil
+}
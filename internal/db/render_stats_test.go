@@ -0,0 +1,74 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRenderStats(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	renders := []struct {
+		shortCode string
+		url       string
+		html      string
+		duration  time.Duration
+	}{
+		{"SITE01", "https://site.com/a", "<html>a</html>", 100 * time.Millisecond},
+		{"SITE02", "https://site.com/b", "<html>bb</html>", 300 * time.Millisecond},
+		{"OTHER1", "https://site_com.org/", "<html></html>", time.Second},
+	}
+	for _, r := range renders {
+		require.NoError(t, CreateLink(&Link{ShortCode: r.shortCode, OriginalURL: r.url}))
+		require.NoError(t, SaveRenderResult(r.shortCode, &RenderResult{HTMLContent: r.html, Duration: r.duration}))
+	}
+	require.NoError(t, CreateLink(&Link{ShortCode: "SITE03", OriginalURL: "https://site.com/pending"}))
+
+	link, err := GetLinkByShortCode("SITE02")
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), link.RenderDurationMs)
+	assert.Equal(t, int64(len("<html>bb</html>")), link.HTMLSizeBytes)
+	require.NotNil(t, link.RenderedAt)
+	assert.WithinDuration(t, time.Now(), *link.RenderedAt, time.Minute)
+
+	stats, err := GetRenderStats("https://site.com/")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Links, "unrendered links and other sites are excluded")
+	assert.InDelta(t, 200, stats.AvgDurationMs, 0.01)
+	assert.Equal(t, int64(300), stats.MaxDurationMs)
+	assert.Equal(t, int64(len("<html>a</html>")+len("<html>bb</html>")), stats.TotalSizeBytes)
+
+	// '_' in the prefix is matched literally
+	stats, err = GetRenderStats("https://site_com")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Links)
+
+	stats, err = GetRenderStats("")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Links)
+	assert.Equal(t, int64(1000), stats.MaxDurationMs)
+}
+
+func TestCountLinksByRenderStatus(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	require.NoError(t, CreateLink(&Link{ShortCode: "QUEUE1", OriginalURL: "https://queue.com/1", RenderStatus: RenderStatusPending}))
+	require.NoError(t, CreateLink(&Link{ShortCode: "QUEUE2", OriginalURL: "https://queue.com/2", RenderStatus: RenderStatusPending}))
+	require.NoError(t, CreateLink(&Link{ShortCode: "QUEUE3", OriginalURL: "https://queue.com/3", RenderStatus: RenderStatusFailed}))
+	require.NoError(t, CreateLink(&Link{ShortCode: "QUEUE4", OriginalURL: "https://queue.com/4", RenderStatus: RenderStatusFailed}))
+	require.NoError(t, DeleteLink("QUEUE4"))
+
+	counts, err := CountLinksByRenderStatus()
+	require.NoError(t, err)
+	assert.Equal(t, map[RenderStatus]int64{
+		RenderStatusPending:   2,
+		RenderStatusRendering: 0,
+		RenderStatusCompleted: 0,
+		RenderStatusFailed:    1,
+	}, counts, "deleted links are left out")
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Analytics datasets pruned by the retention job.
+const (
+	DatasetClickEvents     = "click_events"
+	DatasetDailyStats      = "daily_click_stats"
+	DatasetDailyBreakdowns = "daily_click_breakdowns"
+)
+
+// AnalyticsPurge records one deletion of analytics data by the retention job,
+// as an audit trail of what was erased and when.
+type AnalyticsPurge struct {
+	ID          uint      `gorm:"primaryKey"`
+	PurgedAt    time.Time `gorm:"not null;index"`
+	Dataset     string    `gorm:"size:64;not null"` // One of the Dataset constants
+	Cutoff      time.Time `gorm:"not null"`         // Data from before this was deleted
+	RowsDeleted int64     `gorm:"not null;default:0"`
+}
+
+// pruneBatchSize is how many click events PruneClickEvents deletes per statement.
+const pruneBatchSize = 5000
+
+// PruneClickEvents deletes the raw click events recorded before cutoff, rolled
+// up or not, and returns how many it deleted. Deletes go in batches so the
+// table isn't locked for long.
+func PruneClickEvents(cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		err := DB.Model(&ClickEvent{}).Where("clicked_at < ?", cutoff).
+			Order("id").Limit(pruneBatchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return total, err
+		}
+		result := DB.Where("id IN ?", ids).Delete(&ClickEvent{})
+		total += result.RowsAffected
+		if result.Error != nil || len(ids) < pruneBatchSize {
+			return total, result.Error
+		}
+	}
+}
+
+// PruneClickAggregates deletes the daily stats and breakdowns of the UTC days
+// before that of cutoff and returns how many rows of each it deleted.
+func PruneClickAggregates(cutoff time.Time) (stats, breakdowns int64, err error) {
+	day := cutoff.UTC().Format(time.DateOnly)
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("day < ?", day).Delete(&DailyClickStat{})
+		if result.Error != nil {
+			return result.Error
+		}
+		stats = result.RowsAffected
+		result = tx.Where("day < ?", day).Delete(&DailyClickBreakdown{})
+		breakdowns = result.RowsAffected
+		return result.Error
+	})
+	return stats, breakdowns, err
+}
+
+// RecordAnalyticsPurge adds a purge to the audit trail.
+func RecordAnalyticsPurge(dataset string, cutoff time.Time, rows int64) error {
+	return DB.Create(&AnalyticsPurge{PurgedAt: time.Now().UTC(), Dataset: dataset, Cutoff: cutoff.UTC(), RowsDeleted: rows}).Error
+}
+
+// ListAnalyticsPurges returns the limit latest purges, newest first.
+func ListAnalyticsPurges(limit int) ([]AnalyticsPurge, error) {
+	var purges []AnalyticsPurge
+	err := DB.Order("purged_at DESC, id DESC").Limit(limit).Find(&purges).Error
+	return purges, err
+}
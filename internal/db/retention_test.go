@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneAnalytics(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	now := time.Now().UTC()
+	old := now.AddDate(0, 0, -100)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "RET1", ClickedAt: old, UAClass: UAClassBrowser, Country: "DE"},
+		{ShortCode: "RET1", ClickedAt: now, UAClass: UAClassBrowser, Country: "DE"},
+	}))
+	_, err := RollupClickEvents(now.Add(time.Second), true)
+	require.NoError(t, err)
+
+	pruned, err := PruneClickEvents(now.AddDate(0, 0, -90))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+	var remaining int64
+	require.NoError(t, DB.Model(&ClickEvent{}).Count(&remaining).Error)
+	assert.Equal(t, int64(1), remaining)
+
+	stats, breakdowns, err := PruneClickAggregates(now.AddDate(0, 0, -90))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats)
+	assert.Equal(t, int64(5), breakdowns, "the old day's referrer, country, device, browser and platform")
+	linkStats, err := GetLinkClickStats("RET1", old, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), linkStats.Clicks, "only today's aggregates are left")
+
+	require.NoError(t, RecordAnalyticsPurge(DatasetClickEvents, now.AddDate(0, 0, -90), pruned))
+	require.NoError(t, RecordAnalyticsPurge(DatasetDailyStats, now.AddDate(0, 0, -90), stats))
+	purges, err := ListAnalyticsPurges(10)
+	require.NoError(t, err)
+	require.Len(t, purges, 2)
+	assert.Equal(t, DatasetDailyStats, purges[0].Dataset, "newest first")
+	assert.Equal(t, int64(1), purges[1].RowsDeleted)
+}
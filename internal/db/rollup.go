@@ -0,0 +1,125 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DailyClickStat is the number of clicks a short code received on one UTC day.
+// Raw click events are folded into these rows by RollupClickEvents.
+type DailyClickStat struct {
+	ShortCode string `gorm:"primaryKey;size:64"`
+	Day       string `gorm:"primaryKey;size:10"` // UTC date as YYYY-MM-DD
+	Clicks    int64  `gorm:"not null;default:0"`
+	BotClicks int64  `gorm:"not null;default:0"` // Subset of Clicks from bots and crawlers
+}
+
+// rollupBatchSize is how many raw events RollupClickEvents aggregates per transaction.
+const rollupBatchSize = 5000
+
+// unrolledClicks selects the click events no rollup has counted yet, which the
+// daily stats leave out.
+func unrolledClicks() *gorm.DB {
+	return DB.Model(&ClickEvent{}).Where("rolled_up = ?", false)
+}
+
+// RollupClickEvents adds click events recorded before cutoff to their daily stats
+// and deletes them, or with keepEvents flags them as rolled up so they stay
+// around for the retention job to prune. Each batch is aggregated and pruned in
+// one transaction, so an event is never counted twice or lost if the rollup is
+// interrupted. Only one rollup should run at a time. It returns the number of
+// events rolled up.
+func RollupClickEvents(cutoff time.Time, keepEvents bool) (int64, error) {
+	var total int64
+	for {
+		var events []ClickEvent
+		err := unrolledClicks().Select("id", "short_code", "clicked_at", "ua_class", "referrer", "bot_name",
+			"browser", "platform", "device_class", "country").
+			Where("clicked_at < ?", cutoff).Order("id").Limit(rollupBatchSize).Find(&events).Error
+		if err != nil {
+			return total, err
+		}
+		if len(events) == 0 {
+			return total, nil
+		}
+
+		if err := DB.Transaction(func(tx *gorm.DB) error {
+			return rollupBatch(tx, events, keepEvents)
+		}); err != nil {
+			return total, err
+		}
+		total += int64(len(events))
+		if len(events) < rollupBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// rollupBatch folds events into daily_click_stats and daily_click_breakdowns
+// and deletes or flags them.
+func rollupBatch(tx *gorm.DB, events []ClickEvent, keepEvents bool) error {
+	stats := make(map[DailyClickStat]*DailyClickStat)
+	var order []DailyClickStat
+	breakdowns := make(map[DailyClickBreakdown]int64)
+	var breakdownOrder []DailyClickBreakdown
+	ids := make([]uint, 0, len(events))
+	for _, e := range events {
+		key := DailyClickStat{ShortCode: e.ShortCode, Day: e.ClickedAt.UTC().Format(time.DateOnly)}
+		stat, ok := stats[key]
+		if !ok {
+			stat = &DailyClickStat{ShortCode: key.ShortCode, Day: key.Day}
+			stats[key] = stat
+			order = append(order, key)
+		}
+		stat.Clicks++
+		if e.UAClass == UAClassBot {
+			stat.BotClicks++
+		}
+		for dimension, value := range breakdownValues(e) {
+			breakdownKey := DailyClickBreakdown{ShortCode: key.ShortCode, Day: key.Day, Dimension: dimension, Value: value}
+			if _, ok := breakdowns[breakdownKey]; !ok {
+				breakdownOrder = append(breakdownOrder, breakdownKey)
+			}
+			breakdowns[breakdownKey]++
+		}
+		ids = append(ids, e.ID)
+	}
+
+	for _, key := range order {
+		stat := stats[key]
+		result := tx.Model(&DailyClickStat{}).
+			Where("short_code = ? AND day = ?", stat.ShortCode, stat.Day).
+			Updates(map[string]interface{}{
+				"clicks":     gorm.Expr("clicks + ?", stat.Clicks),
+				"bot_clicks": gorm.Expr("bot_clicks + ?", stat.BotClicks),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := tx.Create(stat).Error; err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range breakdownOrder {
+		result := tx.Model(&DailyClickBreakdown{}).
+			Where("short_code = ? AND day = ? AND dimension = ? AND value = ?", key.ShortCode, key.Day, key.Dimension, key.Value).
+			UpdateColumn("clicks", gorm.Expr("clicks + ?", breakdowns[key]))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			row := key
+			row.Clicks = breakdowns[key]
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if keepEvents {
+		return tx.Model(&ClickEvent{}).Where("id IN ?", ids).UpdateColumn("rolled_up", true).Error
+	}
+	return tx.Where("id IN ?", ids).Delete(&ClickEvent{}).Error
+}
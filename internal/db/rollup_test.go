@@ -0,0 +1,83 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollupClickEvents(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	day1 := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+	day2 := day1.Add(time.Hour)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "A", ClickedAt: day1, UAClass: UAClassBrowser},
+		{ShortCode: "A", ClickedAt: day1, UAClass: UAClassBot},
+		{ShortCode: "A", ClickedAt: day2, UAClass: UAClassBrowser},
+		{ShortCode: "B", ClickedAt: day1, UAClass: UAClassBrowser},
+	}))
+
+	rolled, err := RollupClickEvents(day2.Add(time.Minute), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), rolled)
+
+	var remaining int64
+	require.NoError(t, DB.Model(&ClickEvent{}).Count(&remaining).Error)
+	assert.Zero(t, remaining, "rolled up events are pruned")
+
+	// A later rollup adds to the existing day, and leaves events after the cutoff alone
+	later := day2.Add(2 * time.Hour)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "A", ClickedAt: day2, UAClass: UAClassBot},
+		{ShortCode: "A", ClickedAt: later, UAClass: UAClassBrowser},
+	}))
+	rolled, err = RollupClickEvents(later, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rolled)
+	require.NoError(t, DB.Model(&ClickEvent{}).Count(&remaining).Error)
+	assert.Equal(t, int64(1), remaining)
+
+	var stats []DailyClickStat
+	require.NoError(t, DB.Order("short_code, day").Find(&stats).Error)
+	assert.Equal(t, []DailyClickStat{
+		{ShortCode: "A", Day: "2024-05-01", Clicks: 2, BotClicks: 1},
+		{ShortCode: "A", Day: "2024-05-02", Clicks: 2, BotClicks: 1},
+		{ShortCode: "B", Day: "2024-05-01", Clicks: 1, BotClicks: 0},
+	}, stats)
+
+	// Nothing left to roll up
+	rolled, err = RollupClickEvents(later, false)
+	require.NoError(t, err)
+	assert.Zero(t, rolled)
+}
+
+func TestRollupKeepsEvents(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "KEEP1", ClickedAt: day, UAClass: UAClassBrowser},
+		{ShortCode: "KEEP1", ClickedAt: day, UAClass: UAClassBot},
+	}))
+	rolled, err := RollupClickEvents(day.Add(time.Hour), true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), rolled)
+
+	var kept []ClickEvent
+	require.NoError(t, DB.Find(&kept).Error)
+	require.Len(t, kept, 2, "rolled up events are kept")
+	assert.True(t, kept[0].RolledUp)
+
+	// Kept events are neither rolled up again nor counted twice
+	rolled, err = RollupClickEvents(day.Add(time.Hour), true)
+	require.NoError(t, err)
+	assert.Zero(t, rolled)
+	stats, err := GetLinkClickStats("KEEP1", day, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Clicks)
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"log"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxSearchTextBytes caps the text indexed per snapshot, which keeps PostgreSQL's
+// tsvector well under its size limit.
+const maxSearchTextBytes = 256 << 10
+
+// searchBackfillBatchSize is how many snapshots BackfillSearchText indexes per query.
+const searchBackfillBatchSize = 100
+
+// searchText extracts the visible text of a snapshot for the content search,
+// leaving out markup, scripts and styles.
+func searchText(document string) string {
+	var text strings.Builder
+	skip := 0
+	z := html.NewTokenizer(strings.NewReader(document))
+	for text.Len() < maxSearchTextBytes {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.ToValidUTF8(truncateText(text.String()), "")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isInvisibleTag(name) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isInvisibleTag(name) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			if words := strings.Fields(string(z.Text())); len(words) > 0 {
+				if text.Len() > 0 {
+					text.WriteByte(' ')
+				}
+				text.WriteString(strings.Join(words, " "))
+			}
+		}
+	}
+	return strings.ToValidUTF8(truncateText(text.String()), "")
+}
+
+// isInvisibleTag reports whether the text inside an element isn't shown on the page.
+func isInvisibleTag(name []byte) bool {
+	switch string(name) {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
+
+// truncateText cuts text to maxSearchTextBytes.
+func truncateText(text string) string {
+	if len(text) > maxSearchTextBytes {
+		return text[:maxSearchTextBytes]
+	}
+	return text
+}
+
+// SearchLinksByContent returns up to limit live links whose current snapshot
+// mentions phrase. PostgreSQL matches the words of the phrase in order using the
+// full-text index, MySQL its FULLTEXT index, and SQLite does a case-insensitive
+// substring scan.
+func SearchLinksByContent(phrase string, limit int) ([]Link, error) {
+	query := DB.Model(&Link{}).Joins("JOIN rendered_contents c ON c.hash = links.rendered_content_hash")
+	switch DB.Dialector.Name() {
+	case DriverPostgres:
+		query = query.Where("c.search_vector @@ phraseto_tsquery('simple', ?)", phrase)
+	case DriverMySQL:
+		query = query.Where("MATCH (c.text_content) AGAINST (? IN BOOLEAN MODE)", `"`+strings.ReplaceAll(phrase, `"`, " ")+`"`)
+	default:
+		query = query.Where("c.text_content LIKE ? ESCAPE '!'", "%"+escapeLike(phrase)+"%")
+	}
+	var links []Link
+	columns := make([]string, len(staleLinkColumns))
+	for i, column := range staleLinkColumns {
+		columns[i] = "links." + column
+	}
+	err := query.Select(columns).Order("links.id").Limit(limit).Find(&links).Error
+	return links, err
+}
+
+// BackfillSearchText indexes the text of snapshots stored before content search
+// was added. It returns the number of snapshots indexed.
+func BackfillSearchText() (int64, error) {
+	var total int64
+	for {
+		var contents []RenderedContent
+		err := DB.Select("hash", "data", "encoding").Where("text_content IS NULL").
+			Limit(searchBackfillBatchSize).Find(&contents).Error
+		if err != nil || len(contents) == 0 {
+			return total, err
+		}
+		for _, content := range contents {
+			text := ""
+			if content.Encoding == HTMLEncodingGzipAESGCM {
+				// Encrypted snapshots are kept out of the index, which would hold their text in the clear
+			} else if document, err := decodeContent(content.Encoding, content.Data); err != nil {
+				log.Printf("Search: Not indexing snapshot %s: %v", content.Hash, err)
+			} else {
+				text = searchText(document)
+			}
+			err := DB.Model(&RenderedContent{}).Where("hash = ?", content.Hash).Update("text_content", text).Error
+			if err != nil {
+				return total, err
+			}
+			total++
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchText(t *testing.T) {
+	document := `<html><head><title>Spring Sale</title><style>body { color: red }</style>
+		<script>var hidden = "not indexed";</script></head>
+		<body><h1>Big   discounts</h1><p>On <b>all</b> shoes</p><noscript>Enable JS</noscript></body></html>`
+	assert.Equal(t, "Spring Sale Big discounts On all shoes", searchText(document))
+
+	long := "<p>" + strings.Repeat("word ", maxSearchTextBytes) + "</p>"
+	assert.LessOrEqual(t, len(searchText(long)), maxSearchTextBytes)
+}
+
+func TestSearchLinksByContent(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	pages := map[string]string{
+		"SALE01": "<html><body><h1>Spring sale</h1><p>50% off all shoes</p></body></html>",
+		"SALE02": "<html><body><p>Our spring SALE ends soon</p></body></html>",
+		"NEWS01": "<html><body><p>Company news</p><script>var spring_sale = true;</script></body></html>",
+	}
+	for code, html := range pages {
+		require.NoError(t, CreateLink(&Link{ShortCode: code, OriginalURL: "https://" + code + ".com"}))
+		require.NoError(t, SaveRenderResult(code, &RenderResult{HTMLContent: html}))
+	}
+
+	links, err := SearchLinksByContent("spring sale", 10)
+	require.NoError(t, err)
+	codes := []string{}
+	for _, link := range links {
+		codes = append(codes, link.ShortCode)
+	}
+	assert.ElementsMatch(t, []string{"SALE01", "SALE02"}, codes, "script contents aren't searchable")
+
+	links, err = SearchLinksByContent("50%", 10)
+	require.NoError(t, err)
+	require.Len(t, links, 1, "LIKE wildcards are matched literally")
+	assert.Equal(t, "SALE01", links[0].ShortCode)
+
+	links, err = SearchLinksByContent("spring sale", 1)
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	require.NoError(t, DeleteLink("SALE02"))
+	links, err = SearchLinksByContent("ends soon", 10)
+	require.NoError(t, err)
+	assert.Empty(t, links, "deleted links aren't found")
+}
+
+func TestBackfillSearchText(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	require.NoError(t, CreateLink(&Link{ShortCode: "OLD001", OriginalURL: "https://old.com"}))
+	require.NoError(t, SaveRenderResult("OLD001", &RenderResult{HTMLContent: "<p>Archived press release</p>"}))
+	// Snapshots stored before the search migration have no text yet
+	require.NoError(t, DB.Exec("UPDATE rendered_contents SET text_content = NULL").Error)
+	links, err := SearchLinksByContent("press release", 10)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	indexed, err := BackfillSearchText()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), indexed)
+	links, err = SearchLinksByContent("press release", 10)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "OLD001", links[0].ShortCode)
+
+	indexed, err = BackfillSearchText()
+	require.NoError(t, err)
+	assert.Zero(t, indexed)
+}
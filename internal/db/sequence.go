@@ -0,0 +1,25 @@
+package db
+
+import "time"
+
+// ShortCodeID is a row of the counter handing out IDs for sequential short
+// codes. The ID is taken before the link is inserted, so the link is created
+// under its final code and no one can see it without one.
+type ShortCodeID struct {
+	ID        uint64    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// NextShortCodeID returns a new ID from the auto-increment counter, never
+// returning the same ID twice. Only the latest row is kept, which stops the
+// database from handing out an ID again after a restart.
+func NextShortCodeID() (uint64, error) {
+	row := ShortCodeID{CreatedAt: time.Now()}
+	if err := DB.Create(&row).Error; err != nil {
+		return 0, err
+	}
+	if err := DB.Where("id < ?", row.ID).Delete(&ShortCodeID{}).Error; err != nil {
+		return 0, err
+	}
+	return row.ID, nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SitemapLink is a short link listed in the sitemap.
+type SitemapLink struct {
+	ShortCode  string
+	RenderedAt *time.Time
+}
+
+// CountSitemapLinks returns how many links ListSitemapLinks pages through.
+func CountSitemapLinks(tenantID string, allTenants bool) (int64, error) {
+	var count int64
+	err := sitemapLinks(tenantID, allTenants).Count(&count).Error
+	return count, err
+}
+
+// ListSitemapLinks returns up to limit links for the sitemap after skipping
+// offset of them, in the order they were created.
+func ListSitemapLinks(tenantID string, allTenants bool, offset, limit int) ([]SitemapLink, error) {
+	var links []SitemapLink
+	err := sitemapLinks(tenantID, allTenants).Select("short_code, rendered_at").
+		Order("id").Offset(offset).Limit(limit).Scan(&links).Error
+	return links, err
+}
+
+// sitemapLinks scopes a query to the live, enabled links with a completed
+// snapshot for crawlers to find, those of tenantID unless allTenants is set.
+func sitemapLinks(tenantID string, allTenants bool) *gorm.DB {
+	query := DB.Model(&Link{}).Where("render_status = ? AND disabled_at IS NULL", RenderStatusCompleted)
+	if !allTenants {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	return query
+}
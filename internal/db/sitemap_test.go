@@ -0,0 +1,50 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSitemapLinks(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	links := []struct {
+		code   string
+		tenant string
+		status RenderStatus
+	}{
+		{"SITE01", "", RenderStatusCompleted},
+		{"SITE02", "acme", RenderStatusCompleted},
+		{"SITE03", "", RenderStatusCompleted},
+		{"SITE04", "", RenderStatusPending},
+		{"SITE05", "", RenderStatusCompleted}, // Disabled below
+		{"SITE06", "", RenderStatusCompleted}, // Deleted below
+	}
+	for _, l := range links {
+		require.NoError(t, CreateLink(&Link{ShortCode: l.code, TenantID: l.tenant, OriginalURL: "https://site.com/" + l.code, RenderStatus: l.status}))
+	}
+	require.NoError(t, DisableLink("SITE05", "spam"))
+	require.NoError(t, DeleteLink("SITE06"))
+
+	count, err := CountSitemapLinks("", true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	page, err := ListSitemapLinks("", true, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "SITE02", page[0].ShortCode)
+	assert.Equal(t, "SITE03", page[1].ShortCode)
+
+	// A tenant's own links
+	page, err = ListSitemapLinks("acme", false, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "SITE02", page[0].ShortCode)
+	count, err = CountSitemapLinks("", false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -0,0 +1,344 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// selectLink selects every column scanLink reads, joining in the link's shared
+// snapshot so the redirect path needs a single query. Rows from before content
+// deduplication fall back to their inline compressed HTML.
+const selectLink = `SELECT l.id, l.created_at, l.updated_at, l.tenant_id, l.short_code, l.original_url,
+	COALESCE(l.rendered_html_content, ''), COALESCE(c.data, l.rendered_html_compressed),
+	COALESCE(c.encoding, l.html_encoding, ''), COALESCE(l.rendered_content_hash, ''),
+	l.render_status, COALESCE(l.target_status_code, 0), COALESCE(l.final_url, ''),
+	COALESCE(l.redirect_chain, ''), COALESCE(l.accept_language, ''), COALESCE(l.locale, ''),
+	COALESCE(l.timezone, ''), COALESCE(l.render_profile, ''), COALESCE(l.robots_tag, ''), COALESCE(l.cache_control, ''), l.static_mode, l.render_claimed_at, l.deleted_at,
+	l.last_accessed_at, l.url_key, COALESCE(l.render_attempts, 0), COALESCE(l.last_render_error, ''),
+	COALESCE(l.render_duration_ms, 0), COALESCE(l.html_size_bytes, 0), l.rendered_at,
+	l.disabled_at, COALESCE(l.disabled_reason, '')
+	FROM links l LEFT JOIN rendered_contents c ON c.hash = l.rendered_content_hash`
+
+// insertLink inserts every column a new link can set.
+const insertLink = `INSERT INTO links (created_at, updated_at, tenant_id, short_code, original_url, url_key,
+	rendered_html_content, rendered_content_hash, render_status,
+	target_status_code, final_url, redirect_chain, accept_language, locale, timezone,
+	render_profile, robots_tag, cache_control, static_mode, render_claimed_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`
+
+// sqlStore implements Store with hand-written SQL on prepared statements, skipping
+// GORM's reflection and query building. This matters most on the redirect path,
+// which is a single lookup by short code. Queries use $N placeholders, which both
+// PostgreSQL and SQLite understand.
+type sqlStore struct {
+	conn *sql.DB
+
+	getByShortCode   *sql.Stmt
+	getByOriginalURL *sql.Stmt
+	getWithDeleted   *sql.Stmt
+	deleteLink       *sql.Stmt
+	restoreLink      *sql.Stmt
+	insert           *sql.Stmt
+	insertIfAbsent   *sql.Stmt
+	getByURLKey      *sql.Stmt
+	updateStatus     *sql.Stmt
+	claim            *sql.Stmt
+	updateContent    *sql.Stmt
+	saveResult       *sql.Stmt
+	retryRender      *sql.Stmt
+	failRender       *sql.Stmt
+
+	contentCount      *sql.Stmt
+	insertContentStmt *sql.Stmt
+
+	insertClick *sql.Stmt
+	touchLink   *sql.Stmt
+}
+
+// newSQLStore prepares all statements against conn, whose schema must already be migrated.
+func newSQLStore(conn *sql.DB) (*sqlStore, error) {
+	s := &sqlStore{conn: conn}
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.getByShortCode, selectLink + `
+			WHERE l.short_code = $1 AND l.deleted_at IS NULL ORDER BY l.id LIMIT 1`},
+		{&s.getByOriginalURL, selectLink + `
+			WHERE l.tenant_id = $1 AND l.original_url = $2 AND l.deleted_at IS NULL ORDER BY l.id LIMIT 1`},
+		{&s.getWithDeleted, selectLink + `
+			WHERE l.short_code = $1 ORDER BY l.id LIMIT 1`},
+		{&s.getByURLKey, selectLink + `
+			WHERE l.url_key = $1 AND l.deleted_at IS NULL`},
+		{&s.deleteLink, `UPDATE links SET deleted_at = $1, url_key = NULL
+			WHERE short_code = $2 AND deleted_at IS NULL`},
+		{&s.restoreLink, `UPDATE links SET deleted_at = NULL, updated_at = $1
+			WHERE short_code = $2 AND deleted_at IS NOT NULL`},
+		{&s.insert, insertLink + ` RETURNING id`},
+		{&s.insertIfAbsent, insertLink + ` ON CONFLICT DO NOTHING RETURNING id`},
+		{&s.updateStatus, `UPDATE links SET render_status = $1, updated_at = $2
+			WHERE short_code = $3 AND deleted_at IS NULL`},
+		{&s.claim, `UPDATE links SET render_status = $1, render_claimed_at = $2, updated_at = $2,
+			render_requested_at = NULL, render_attempts = COALESCE(render_attempts, 0) + 1
+			WHERE short_code = $3 AND deleted_at IS NULL
+			AND (render_status <> $1 OR render_claimed_at IS NULL OR render_claimed_at < $4)`},
+		{&s.updateContent, `UPDATE links SET rendered_html_content = '', rendered_html_compressed = NULL,
+			html_encoding = '', rendered_content_hash = $1, render_status = $2, updated_at = $3
+			WHERE short_code = $4 AND deleted_at IS NULL`},
+		{&s.saveResult, `UPDATE links SET rendered_html_content = '', rendered_html_compressed = NULL,
+			html_encoding = '', rendered_content_hash = $1, target_status_code = $2, final_url = $3,
+			redirect_chain = $4, render_status = $5, last_render_error = '', updated_at = $6,
+			render_duration_ms = $7, html_size_bytes = $8, rendered_at = $6
+			WHERE short_code = $9 AND deleted_at IS NULL`},
+		{&s.retryRender, `UPDATE links SET render_status = $1, last_render_error = $2, updated_at = $3
+			WHERE short_code = $4 AND deleted_at IS NULL`},
+		{&s.failRender, `UPDATE links SET rendered_html_content = '', rendered_html_compressed = NULL,
+			html_encoding = '', rendered_content_hash = '', render_status = $1, last_render_error = $2,
+			updated_at = $3 WHERE short_code = $4 AND deleted_at IS NULL`},
+		{&s.contentCount, `SELECT COUNT(*) FROM rendered_contents WHERE hash = $1`},
+		{&s.insertContentStmt, `INSERT INTO rendered_contents (hash, data, encoding, created_at, text_content)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT (hash) DO NOTHING`},
+		{&s.insertClick, `INSERT INTO click_events (short_code, clicked_at, ua_class, referrer, ip_hash, bot_name,
+			browser, platform, device_class, country) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`},
+		{&s.touchLink, `UPDATE links SET last_accessed_at = $1
+			WHERE short_code = $2 AND (last_accessed_at IS NULL OR last_accessed_at < $1)`},
+	}
+	for _, st := range statements {
+		prepared, err := conn.Prepare(st.query)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		*st.stmt = prepared
+	}
+	return s, nil
+}
+
+// scanLink reads a row selected with linkColumns.
+func scanLink(row *sql.Row) (*Link, error) {
+	var link Link
+	var claimedAt, accessedAt, renderedAt, disabledAt sql.NullTime
+	var urlKey sql.NullString
+	err := row.Scan(&link.ID, &link.CreatedAt, &link.UpdatedAt, &link.TenantID, &link.ShortCode, &link.OriginalURL,
+		&link.RenderedHTMLContent, &link.RenderedHTMLCompressed, &link.HTMLEncoding, &link.RenderedContentHash,
+		&link.RenderStatus, &link.TargetStatusCode,
+		&link.FinalURL, &link.RedirectChain, &link.AcceptLanguage,
+		&link.Locale, &link.Timezone, &link.RenderProfile, &link.RobotsTag, &link.CacheControl, &link.StaticMode, &claimedAt, &link.DeletedAt,
+		&accessedAt, &urlKey, &link.RenderAttempts, &link.LastRenderError,
+		&link.RenderDurationMs, &link.HTMLSizeBytes, &renderedAt,
+		&disabledAt, &link.DisabledReason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if claimedAt.Valid {
+		link.RenderClaimedAt = &claimedAt.Time
+	}
+	if accessedAt.Valid {
+		link.LastAccessedAt = &accessedAt.Time
+	}
+	if renderedAt.Valid {
+		link.RenderedAt = &renderedAt.Time
+	}
+	if disabledAt.Valid {
+		link.DisabledAt = &disabledAt.Time
+	}
+	if urlKey.Valid {
+		link.URLKey = &urlKey.String
+	}
+	if err := link.decodeHTML(); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (s *sqlStore) GetLinkByShortCode(shortCode string) (*Link, error) {
+	return scanLink(s.getByShortCode.QueryRow(shortCode))
+}
+
+func (s *sqlStore) GetLinkByOriginalURL(tenantID string, originalURL string) (*Link, error) {
+	return scanLink(s.getByOriginalURL.QueryRow(tenantID, originalURL))
+}
+
+func (s *sqlStore) GetLinkByShortCodeIncludingDeleted(shortCode string) (*Link, error) {
+	return scanLink(s.getWithDeleted.QueryRow(shortCode))
+}
+
+func (s *sqlStore) CreateLink(link *Link) error {
+	return s.insertLink(s.insert, link)
+}
+
+func (s *sqlStore) CreateLinkIfAbsent(link *Link) (*Link, bool, error) {
+	err := s.insertLink(s.insertIfAbsent, link)
+	if err == nil {
+		return link, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// Nothing was inserted, so either the URL or the short code is taken
+	existing, err := scanLink(s.getByURLKey.QueryRow(URLKey(link.TenantID, link.OriginalURL)))
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, ErrShortCodeTaken
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+// insertLink runs an insert built on insertLink and sets the link's ID and
+// timestamps. An insert that did nothing returns sql.ErrNoRows.
+func (s *sqlStore) insertLink(insert *sql.Stmt, link *Link) error {
+	now := time.Now()
+	if link.RenderStatus == "" {
+		link.RenderStatus = RenderStatusPending
+	}
+	var claimedAt sql.NullTime
+	if link.RenderClaimedAt != nil {
+		claimedAt = sql.NullTime{Time: *link.RenderClaimedAt, Valid: true}
+	}
+	row := *link
+	if err := row.encodeHTML(s); err != nil {
+		return err
+	}
+	key := URLKey(link.TenantID, link.OriginalURL)
+	err := insert.QueryRow(now, now, row.TenantID, row.ShortCode, row.OriginalURL, key,
+		row.RenderedHTMLContent, row.RenderedContentHash, row.RenderStatus,
+		row.TargetStatusCode, row.FinalURL, row.RedirectChain, row.AcceptLanguage, row.Locale, row.Timezone,
+		row.RenderProfile, row.RobotsTag, row.CacheControl, row.StaticMode, claimedAt).Scan(&link.ID)
+	if err != nil {
+		return err
+	}
+	link.CreatedAt = now
+	link.UpdatedAt = now
+	link.URLKey = &key
+	return nil
+}
+
+func (s *sqlStore) UpdateLinkRenderStatus(shortCode string, status RenderStatus) error {
+	_, err := s.updateStatus.Exec(status, time.Now(), shortCode)
+	return err
+}
+
+func (s *sqlStore) ClaimLinkForRender(shortCode string, staleAfter time.Duration) (bool, error) {
+	now := time.Now()
+	result, err := s.claim.Exec(RenderStatusRendering, now, shortCode, now.Add(-staleAfter))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *sqlStore) UpdateLinkContent(shortCode string, htmlContent string, status RenderStatus) error {
+	columns, err := htmlColumns(s, htmlContent)
+	if err != nil {
+		return err
+	}
+	_, err = s.updateContent.Exec(columns["rendered_content_hash"], status, time.Now(), shortCode)
+	return err
+}
+
+func (s *sqlStore) SaveRenderResult(shortCode string, result *RenderResult) error {
+	redirectChain, err := encodeRedirectChain(result.RedirectChain)
+	if err != nil {
+		return err
+	}
+	columns, err := htmlColumns(s, result.HTMLContent)
+	if err != nil {
+		return err
+	}
+	_, err = s.saveResult.Exec(columns["rendered_content_hash"], result.TargetStatusCode, result.FinalURL,
+		redirectChain, RenderStatusCompleted, time.Now(), result.Duration.Milliseconds(), len(result.HTMLContent), shortCode)
+	return err
+}
+
+func (s *sqlStore) SaveRenderFailure(shortCode string, renderErr string, retrying bool) error {
+	var err error
+	if retrying {
+		_, err = s.retryRender.Exec(RenderStatusPending, renderErr, time.Now(), shortCode)
+	} else {
+		_, err = s.failRender.Exec(RenderStatusFailed, renderErr, time.Now(), shortCode)
+	}
+	return err
+}
+
+func (s *sqlStore) DeleteLink(shortCode string) error {
+	result, err := s.deleteLink.Exec(time.Now(), shortCode)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) RestoreLink(shortCode string) error {
+	_, err := s.restoreLink.Exec(time.Now(), shortCode)
+	return err
+}
+
+func (s *sqlStore) RecordClickEvents(events []ClickEvent) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	insert := tx.Stmt(s.insertClick)
+	for _, e := range events {
+		if _, err := insert.Exec(e.ShortCode, e.ClickedAt, e.UAClass, e.Referrer, e.IPHash, e.BotName,
+			e.Browser, e.Platform, e.DeviceClass, e.Country); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	touch := tx.Stmt(s.touchLink)
+	codes, latest := lastAccess(events)
+	for _, code := range codes {
+		if _, err := touch.Exec(latest[code], code); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) contentExists(hash string) (bool, error) {
+	var count int64
+	err := s.contentCount.QueryRow(hash).Scan(&count)
+	return count > 0, err
+}
+
+func (s *sqlStore) insertContent(content *RenderedContent) error {
+	_, err := s.insertContentStmt.Exec(content.Hash, content.Data, content.Encoding, content.CreatedAt, content.TextContent)
+	return err
+}
+
+// Close releases the prepared statements; the connection pool is closed by db.Close.
+func (s *sqlStore) Close() error {
+	var firstErr error
+	for _, stmt := range []*sql.Stmt{s.getByShortCode, s.getByOriginalURL, s.getWithDeleted,
+		s.insertIfAbsent, s.getByURLKey, s.deleteLink, s.restoreLink, s.insert,
+		s.updateStatus, s.claim, s.updateContent, s.saveResult, s.retryRender, s.failRender, s.contentCount, s.insertContentStmt,
+		s.insertClick, s.touchLink} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{"gorm", func(t *testing.T) Store { return gormStore{} }},
+		{"sql", func(t *testing.T) Store {
+			sqlDB, err := DB.DB()
+			require.NoError(t, err)
+			s, err := newSQLStore(sqlDB)
+			require.NoError(t, err)
+			return s
+		}},
+	}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			defer teardownTestDB(t)
+			s := tt.store(t)
+			defer s.Close()
+
+			link := &Link{ShortCode: "STORE1", OriginalURL: "https://store.com", Locale: "de-DE"}
+			require.NoError(t, s.CreateLink(link))
+			assert.NotZero(t, link.ID)
+			assert.Error(t, s.CreateLink(&Link{ShortCode: "STORE1", OriginalURL: "https://other.com"}), "short codes are unique")
+
+			stored, created, err := s.CreateLinkIfAbsent(&Link{ShortCode: "STORE2", OriginalURL: "https://store.com"})
+			require.NoError(t, err)
+			assert.False(t, created, "the URL already has a link")
+			assert.Equal(t, "STORE1", stored.ShortCode)
+			_, _, err = s.CreateLinkIfAbsent(&Link{ShortCode: "STORE1", OriginalURL: "https://new.com"})
+			assert.ErrorIs(t, err, ErrShortCodeTaken)
+			stored, created, err = s.CreateLinkIfAbsent(&Link{ShortCode: "STORE3", OriginalURL: "https://new.com"})
+			require.NoError(t, err)
+			assert.True(t, created)
+			assert.NotZero(t, stored.ID)
+
+			// URLs are unique per tenant, short codes across all of them
+			stored, created, err = s.CreateLinkIfAbsent(&Link{TenantID: "acme", ShortCode: "STORE5", OriginalURL: "https://store.com"})
+			require.NoError(t, err)
+			assert.True(t, created, "another tenant's link for the URL doesn't count")
+			assert.Equal(t, "acme", stored.TenantID)
+			_, _, err = s.CreateLinkIfAbsent(&Link{TenantID: "acme", ShortCode: "STORE1", OriginalURL: "https://acme.com"})
+			assert.ErrorIs(t, err, ErrShortCodeTaken)
+			got, err := s.GetLinkByOriginalURL("acme", "https://store.com")
+			require.NoError(t, err)
+			assert.Equal(t, "STORE5", got.ShortCode)
+			assert.Equal(t, "acme", got.TenantID)
+
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, link.ID, got.ID)
+			assert.Equal(t, "https://store.com", got.OriginalURL)
+			assert.Equal(t, "de-DE", got.Locale)
+			assert.Equal(t, RenderStatusPending, got.RenderStatus)
+
+			got, err = s.GetLinkByOriginalURL("", "https://store.com")
+			require.NoError(t, err)
+			assert.Equal(t, "STORE1", got.ShortCode)
+
+			_, err = s.GetLinkByShortCode("MISSING")
+			assert.True(t, errors.Is(err, ErrNotFound))
+			_, err = s.GetLinkByOriginalURL("", "https://missing.com")
+			assert.True(t, errors.Is(err, ErrNotFound))
+
+			claimed, err := s.ClaimLinkForRender("STORE1", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, claimed)
+			claimed, err = s.ClaimLinkForRender("STORE1", time.Minute)
+			require.NoError(t, err)
+			assert.False(t, claimed)
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, RenderStatusRendering, got.RenderStatus)
+			assert.NotNil(t, got.RenderClaimedAt)
+
+			require.NoError(t, s.SaveRenderResult("STORE1", &RenderResult{
+				HTMLContent:      "<html></html>",
+				TargetStatusCode: 200,
+				FinalURL:         "https://www.store.com/",
+				RedirectChain:    []string{"https://store.com", "https://www.store.com/"},
+			}))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, RenderStatusCompleted, got.RenderStatus)
+			assert.Equal(t, "<html></html>", got.RenderedHTMLContent)
+			assert.Equal(t, 200, got.TargetStatusCode)
+			assert.Equal(t, []string{"https://store.com", "https://www.store.com/"}, got.RedirectHops())
+
+			require.NoError(t, s.UpdateLinkContent("STORE1", "", RenderStatusFailed))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, RenderStatusFailed, got.RenderStatus)
+			assert.Empty(t, got.RenderedHTMLContent)
+
+			require.NoError(t, s.SaveRenderResult("STORE1", &RenderResult{HTMLContent: "<html>kept</html>"}))
+			require.NoError(t, s.SaveRenderFailure("STORE1", "resource limit", true))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, RenderStatusPending, got.RenderStatus)
+			assert.Equal(t, "resource limit", got.LastRenderError)
+			assert.Equal(t, "<html>kept</html>", got.RenderedHTMLContent, "a retry keeps the current snapshot")
+			require.NoError(t, s.SaveRenderFailure("STORE1", "timeout", false))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, RenderStatusFailed, got.RenderStatus)
+			assert.Equal(t, "timeout", got.LastRenderError)
+			assert.Empty(t, got.RenderedHTMLContent)
+			assert.Equal(t, 1, got.RenderAttempts)
+			require.NoError(t, s.SaveRenderResult("STORE1", &RenderResult{HTMLContent: "<html></html>"}))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Empty(t, got.LastRenderError, "success clears the error")
+			require.NoError(t, s.UpdateLinkContent("STORE1", "", RenderStatusFailed))
+
+			require.NoError(t, s.UpdateLinkRenderStatus("STORE1", RenderStatusPending))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.Equal(t, RenderStatusPending, got.RenderStatus)
+
+			require.NoError(t, s.DeleteLink("STORE1"))
+			assert.True(t, errors.Is(s.DeleteLink("STORE1"), ErrNotFound), "already deleted")
+			_, err = s.GetLinkByShortCode("STORE1")
+			assert.True(t, errors.Is(err, ErrNotFound))
+			got, err = s.GetLinkByShortCodeIncludingDeleted("STORE1")
+			require.NoError(t, err)
+			assert.True(t, got.DeletedAt.Valid)
+			// The deleted link no longer owns its URL, so it can be shortened again
+			stored, created, err = s.CreateLinkIfAbsent(&Link{ShortCode: "STORE4", OriginalURL: "https://store.com"})
+			require.NoError(t, err)
+			assert.True(t, created)
+			require.NoError(t, s.DeleteLink("STORE4"))
+			require.NoError(t, s.RestoreLink("STORE1"))
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			assert.False(t, got.DeletedAt.Valid)
+
+			now := time.Now().UTC()
+			require.NoError(t, s.RecordClickEvents([]ClickEvent{
+				{ShortCode: "STORE1", ClickedAt: now, UAClass: UAClassBrowser, Referrer: "https://ref.com", IPHash: "abc"},
+				{ShortCode: "STORE1", ClickedAt: now, UAClass: UAClassBot},
+			}))
+			var clicks []ClickEvent
+			require.NoError(t, DB.Order("id").Find(&clicks).Error)
+			require.Len(t, clicks, 2)
+			assert.Equal(t, "https://ref.com", clicks[0].Referrer)
+			assert.Equal(t, UAClassBot, clicks[1].UAClass)
+			got, err = s.GetLinkByShortCode("STORE1")
+			require.NoError(t, err)
+			require.NotNil(t, got.LastAccessedAt)
+			assert.WithinDuration(t, now, *got.LastAccessedAt, time.Second)
+		})
+	}
+}
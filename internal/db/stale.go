@@ -0,0 +1,34 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// staleLinkColumns are the columns loaded by ListStaleLinks. The snapshot itself
+// is left out since callers only need to know which links to re-render.
+var staleLinkColumns = []string{"id", "created_at", "updated_at", "short_code", "original_url",
+	"render_status", "rendered_at", "render_duration_ms", "html_size_bytes", "last_accessed_at"}
+
+// ListStaleLinks returns up to limit live links whose completed snapshot was
+// rendered before cutoff, oldest first. Pending, rendering and failed links are
+// not included since they have no current snapshot to refresh.
+func ListStaleLinks(cutoff time.Time, limit int) ([]Link, error) {
+	var links []Link
+	err := staleLinks(cutoff).Select(staleLinkColumns).
+		Order("rendered_at").Order("id").Limit(limit).Find(&links).Error
+	return links, err
+}
+
+// CountStaleLinks returns how many links ListStaleLinks would return without a limit.
+func CountStaleLinks(cutoff time.Time) (int64, error) {
+	var count int64
+	err := staleLinks(cutoff).Count(&count).Error
+	return count, err
+}
+
+// staleLinks scopes a query to links with a completed snapshot rendered before cutoff.
+func staleLinks(cutoff time.Time) *gorm.DB {
+	return DB.Model(&Link{}).Where("render_status = ? AND rendered_at < ?", RenderStatusCompleted, cutoff)
+}
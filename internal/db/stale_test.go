@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListStaleLinks(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	now := time.Now()
+	links := []struct {
+		shortCode  string
+		status     RenderStatus
+		renderedAt time.Time
+	}{
+		{"OLDEST", RenderStatusCompleted, now.Add(-72 * time.Hour)},
+		{"OLDER1", RenderStatusCompleted, now.Add(-48 * time.Hour)},
+		{"FRESH1", RenderStatusCompleted, now.Add(-time.Hour)},
+		{"FAILED", RenderStatusFailed, now.Add(-96 * time.Hour)},
+	}
+	for _, l := range links {
+		require.NoError(t, CreateLink(&Link{ShortCode: l.shortCode, OriginalURL: "https://" + l.shortCode + ".com"}))
+		require.NoError(t, SaveRenderResult(l.shortCode, &RenderResult{HTMLContent: "<html></html>"}))
+		require.NoError(t, DB.Model(&Link{}).Where("short_code = ?", l.shortCode).
+			Updates(map[string]interface{}{"rendered_at": l.renderedAt, "render_status": l.status}).Error)
+	}
+	require.NoError(t, CreateLink(&Link{ShortCode: "NEVER1", OriginalURL: "https://never.com"}))
+	require.NoError(t, CreateLink(&Link{ShortCode: "GONE01", OriginalURL: "https://gone.com"}))
+	require.NoError(t, SaveRenderResult("GONE01", &RenderResult{HTMLContent: "<html></html>"}))
+	require.NoError(t, DB.Model(&Link{}).Where("short_code = ?", "GONE01").Update("rendered_at", now.Add(-96*time.Hour)).Error)
+	require.NoError(t, DeleteLink("GONE01"))
+
+	cutoff := now.Add(-24 * time.Hour)
+	stale, err := ListStaleLinks(cutoff, 10)
+	require.NoError(t, err)
+	require.Len(t, stale, 2, "only live, completed snapshots older than the cutoff")
+	assert.Equal(t, "OLDEST", stale[0].ShortCode)
+	assert.Equal(t, "OLDER1", stale[1].ShortCode)
+	assert.Empty(t, stale[0].RenderedHTMLContent)
+
+	stale, err = ListStaleLinks(cutoff, 1)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+	assert.Equal(t, "OLDEST", stale[0].ShortCode)
+
+	count, err := CountStaleLinks(cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store is the set of queries the application runs against the links table.
+// gormStore is the default; sqlStore issues the same queries as hand-written SQL.
+type Store interface {
+	GetLinkByShortCode(shortCode string) (*Link, error)
+	GetLinkByShortCodeIncludingDeleted(shortCode string) (*Link, error)
+	GetLinkByOriginalURL(tenantID string, originalURL string) (*Link, error)
+	CreateLink(link *Link) error
+	CreateLinkIfAbsent(link *Link) (*Link, bool, error)
+	UpdateLinkRenderStatus(shortCode string, status RenderStatus) error
+	ClaimLinkForRender(shortCode string, staleAfter time.Duration) (bool, error)
+	UpdateLinkContent(shortCode string, htmlContent string, status RenderStatus) error
+	SaveRenderResult(shortCode string, result *RenderResult) error
+	SaveRenderFailure(shortCode string, renderErr string, retrying bool) error
+	DeleteLink(shortCode string) error
+	RestoreLink(shortCode string) error
+	RecordClickEvents(events []ClickEvent) error
+	Close() error
+}
+
+// gormStore implements Store with GORM on the global DB connection.
+type gormStore struct{}
+
+func (gormStore) GetLinkByShortCode(shortCode string) (*Link, error) {
+	var link Link
+	if err := DB.Where("short_code = ?", shortCode).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (gormStore) GetLinkByShortCodeIncludingDeleted(shortCode string) (*Link, error) {
+	var link Link
+	if err := DB.Unscoped().Where("short_code = ?", shortCode).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (gormStore) GetLinkByOriginalURL(tenantID string, originalURL string) (*Link, error) {
+	var link Link
+	if err := DB.Where("tenant_id = ? AND original_url = ?", tenantID, originalURL).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (gormStore) CreateLink(link *Link) error {
+	key := URLKey(link.TenantID, link.OriginalURL)
+	link.URLKey = &key
+	// Insert a copy so the caller's link keeps its plain HTML
+	row := *link
+	if err := row.encodeHTML(gormStore{}); err != nil {
+		return err
+	}
+	if err := DB.Create(&row).Error; err != nil {
+		return err
+	}
+	link.Model = row.Model
+	return nil
+}
+
+func (gormStore) CreateLinkIfAbsent(link *Link) (*Link, bool, error) {
+	key := URLKey(link.TenantID, link.OriginalURL)
+	link.URLKey = &key
+	row := *link
+	if err := row.encodeHTML(gormStore{}); err != nil {
+		return nil, false, err
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		link.Model = row.Model
+		return link, true, nil
+	}
+
+	var existing Link
+	err := DB.Where("url_key = ?", key).First(&existing).Error
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, ErrShortCodeTaken
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (gormStore) UpdateLinkRenderStatus(shortCode string, status RenderStatus) error {
+	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Update("render_status", status).Error
+}
+
+func (gormStore) ClaimLinkForRender(shortCode string, staleAfter time.Duration) (bool, error) {
+	now := time.Now()
+	result := DB.Model(&Link{}).
+		Where("short_code = ?", shortCode).
+		Where(claimableCondition, RenderStatusRendering, now.Add(-staleAfter)).
+		Updates(claimColumns(now))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// claimableCondition matches the links no worker holds: not rendering, or
+// claimed before the stale cutoff.
+const claimableCondition = "render_status <> ? OR render_claimed_at IS NULL OR render_claimed_at < ?"
+
+// claimColumns are the columns set on a link claimed for rendering at now.
+func claimColumns(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"render_status":       RenderStatusRendering,
+		"render_claimed_at":   now,
+		"render_requested_at": nil,
+		"render_attempts":     gorm.Expr("COALESCE(render_attempts, 0) + 1"),
+	}
+}
+
+func (gormStore) UpdateLinkContent(shortCode string, htmlContent string, status RenderStatus) error {
+	columns, err := htmlColumns(gormStore{}, htmlContent)
+	if err != nil {
+		return err
+	}
+	columns["render_status"] = status
+	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Updates(columns).Error
+}
+
+func (gormStore) SaveRenderResult(shortCode string, result *RenderResult) error {
+	redirectChain, err := encodeRedirectChain(result.RedirectChain)
+	if err != nil {
+		return err
+	}
+	columns, err := htmlColumns(gormStore{}, result.HTMLContent)
+	if err != nil {
+		return err
+	}
+	columns["target_status_code"] = result.TargetStatusCode
+	columns["final_url"] = result.FinalURL
+	columns["redirect_chain"] = redirectChain
+	columns["render_status"] = RenderStatusCompleted
+	columns["last_render_error"] = ""
+	columns["render_duration_ms"] = result.Duration.Milliseconds()
+	columns["html_size_bytes"] = len(result.HTMLContent)
+	columns["rendered_at"] = time.Now()
+	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Updates(columns).Error
+}
+
+func (gormStore) SaveRenderFailure(shortCode string, renderErr string, retrying bool) error {
+	columns := map[string]interface{}{"render_status": RenderStatusPending}
+	if !retrying {
+		var err error
+		if columns, err = htmlColumns(gormStore{}, ""); err != nil {
+			return err
+		}
+		columns["render_status"] = RenderStatusFailed
+	}
+	columns["last_render_error"] = renderErr
+	return DB.Model(&Link{}).Where("short_code = ?", shortCode).Updates(columns).Error
+}
+
+func (gormStore) DeleteLink(shortCode string) error {
+	result := DB.Model(&Link{}).Where("short_code = ?", shortCode).
+		UpdateColumns(map[string]interface{}{"deleted_at": time.Now(), "url_key": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (gormStore) RestoreLink(shortCode string) error {
+	return DB.Unscoped().Model(&Link{}).
+		Where("short_code = ? AND deleted_at IS NOT NULL", shortCode).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()}).Error
+}
+
+func (gormStore) RecordClickEvents(events []ClickEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(events, 500).Error; err != nil {
+			return err
+		}
+		codes, latest := lastAccess(events)
+		for _, code := range codes {
+			err := tx.Model(&Link{}).
+				Where("short_code = ? AND (last_accessed_at IS NULL OR last_accessed_at < ?)", code, latest[code]).
+				UpdateColumn("last_accessed_at", latest[code]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (gormStore) contentExists(hash string) (bool, error) {
+	var count int64
+	err := DB.Model(&RenderedContent{}).Where("hash = ?", hash).Count(&count).Error
+	return count > 0, err
+}
+
+func (gormStore) insertContent(content *RenderedContent) error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(content).Error
+}
+
+func (gormStore) Close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import "sort"
+
+// TenantUsage is what a tenant stores and how much its links are used, for
+// per-tenant quotas and billing.
+type TenantUsage struct {
+	TenantID      string `json:"tenant_id"`
+	Links         int64  `json:"links"`          // Live links
+	ArchivedLinks int64  `json:"archived_links"` // Links moved to cold storage
+	RenderedLinks int64  `json:"rendered_links"` // Live links with a successful render
+	SnapshotBytes int64  `json:"snapshot_bytes"` // Uncompressed size of their latest snapshots
+	Clicks        int64  `json:"clicks"`         // Clicks on live and deleted links, rolled up or not
+}
+
+// GetTenantUsage returns the usage of every tenant owning at least one link,
+// ordered by tenant ID. Clicks on archived links are not counted.
+func GetTenantUsage() ([]TenantUsage, error) {
+	usage := map[string]*TenantUsage{}
+	get := func(id string) *TenantUsage {
+		if usage[id] == nil {
+			usage[id] = &TenantUsage{TenantID: id}
+		}
+		return usage[id]
+	}
+
+	var links []TenantUsage
+	err := DB.Model(&Link{}).Select(`tenant_id,
+		COUNT(*) AS links,
+		COUNT(rendered_at) AS rendered_links,
+		COALESCE(SUM(html_size_bytes), 0) AS snapshot_bytes`).
+		Group("tenant_id").Scan(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range links {
+		u := get(row.TenantID)
+		u.Links, u.RenderedLinks, u.SnapshotBytes = row.Links, row.RenderedLinks, row.SnapshotBytes
+	}
+
+	var archived []TenantUsage
+	err = DB.Model(&ArchivedLink{}).Select("tenant_id, COUNT(*) AS archived_links").
+		Group("tenant_id").Scan(&archived).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range archived {
+		get(row.TenantID).ArchivedLinks = row.ArchivedLinks
+	}
+
+	// Clicks are recorded by short code; the daily stats and the raw events not
+	// rolled up yet are disjoint
+	for _, table := range []struct{ name, clicks, where string }{
+		{"daily_click_stats", "SUM(c.clicks)", ""},
+		{"click_events", "COUNT(*)", "WHERE c.rolled_up = ?"},
+	} {
+		var args []interface{}
+		if table.where != "" {
+			args = append(args, false)
+		}
+		var clicks []TenantUsage
+		err = DB.Raw(`SELECT l.tenant_id AS tenant_id, `+table.clicks+` AS clicks
+			FROM `+table.name+` c JOIN links l ON l.short_code = c.short_code
+			`+table.where+` GROUP BY l.tenant_id`, args...).Scan(&clicks).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range clicks {
+			get(row.TenantID).Clicks += row.Clicks
+		}
+	}
+
+	result := make([]TenantUsage, 0, len(usage))
+	for _, u := range usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].TenantID < result[j].TenantID })
+	return result, nil
+}
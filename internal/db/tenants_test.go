@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTenantUsage(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for _, link := range []Link{
+		{ShortCode: "DEF001", OriginalURL: "https://shared.com"},
+		{TenantID: "acme", ShortCode: "ACME01", OriginalURL: "https://shared.com"},
+		{TenantID: "acme", ShortCode: "ACME02", OriginalURL: "https://acme.com"},
+		{TenantID: "acme", ShortCode: "ACME03", OriginalURL: "https://old.acme.com"},
+	} {
+		require.NoError(t, CreateLink(&link))
+	}
+	require.NoError(t, SaveRenderResult("ACME01", &RenderResult{HTMLContent: "<html>acme</html>"}))
+	require.NoError(t, DB.Create(&DailyClickStat{ShortCode: "ACME01", Day: "2024-01-01", Clicks: 5}).Error)
+	require.NoError(t, RecordClickEvents([]ClickEvent{
+		{ShortCode: "ACME02", ClickedAt: time.Now()},
+		{ShortCode: "DEF001", ClickedAt: time.Now()},
+	}))
+	require.NoError(t, DB.Model(&Link{}).Where("short_code = ?", "ACME03").
+		Update("last_accessed_at", time.Now().Add(-48*time.Hour)).Error)
+	archived, err := ArchiveInactiveLinks(time.Now().Add(-24 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), archived)
+
+	usage, err := GetTenantUsage()
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	assert.Equal(t, TenantUsage{TenantID: "", Links: 1, Clicks: 1}, usage[0])
+	assert.Equal(t, TenantUsage{
+		TenantID:      "acme",
+		Links:         2,
+		ArchivedLinks: 1,
+		RenderedLinks: 1,
+		SnapshotBytes: int64(len("<html>acme</html>")),
+		Clicks:        6,
+	}, usage[1])
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"log"
+	"time"
+)
+
+// RenderVersion is an earlier successful render of a link, kept so the served
+// snapshot can be rolled back when a re-render captures a broken page. Its HTML
+// stays in the shared rendered_contents table, referenced by hash.
+type RenderVersion struct {
+	ID                  uint      `gorm:"primaryKey"`
+	ShortCode           string    `gorm:"size:64;not null;index"`
+	RenderedContentHash string    `gorm:"size:64;not null;index"`
+	TargetStatusCode    int       `gorm:"default:0"`
+	FinalURL            string    `gorm:"type:text"`
+	RedirectChain       string    `gorm:"type:text"`
+	RenderDurationMs    int64     `gorm:"not null;default:0"`
+	HTMLSizeBytes       int64     `gorm:"not null;default:0"`
+	RenderedAt          time.Time `gorm:"not null"`
+}
+
+// renderHistoryVersions is how many renders are kept per link, 0 keeping none.
+var renderHistoryVersions int
+
+// SetRenderHistory keeps the last versions successful renders of every link.
+func SetRenderHistory(versions int) {
+	renderHistoryVersions = versions
+}
+
+// recordRenderVersion adds the render just saved on a link to its history and
+// drops the versions beyond the configured number.
+func recordRenderVersion(shortCode string) error {
+	var link Link
+	if err := rawLinks().Where("short_code = ?", shortCode).First(&link).Error; err != nil {
+		return err
+	}
+	if link.RenderedContentHash == "" || link.RenderedAt == nil {
+		return nil
+	}
+	err := DB.Create(&RenderVersion{
+		ShortCode:           link.ShortCode,
+		RenderedContentHash: link.RenderedContentHash,
+		TargetStatusCode:    link.TargetStatusCode,
+		FinalURL:            link.FinalURL,
+		RedirectChain:       link.RedirectChain,
+		RenderDurationMs:    link.RenderDurationMs,
+		HTMLSizeBytes:       link.HTMLSizeBytes,
+		RenderedAt:          *link.RenderedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	var expired []uint
+	err = DB.Model(&RenderVersion{}).Where("short_code = ?", shortCode).
+		Order("id DESC").Offset(renderHistoryVersions).Pluck("id", &expired).Error
+	if err != nil || len(expired) == 0 {
+		return err
+	}
+	return DB.Where("id IN ?", expired).Delete(&RenderVersion{}).Error
+}
+
+// ListRenderVersions returns the kept renders of a link, newest first.
+func ListRenderVersions(shortCode string) ([]RenderVersion, error) {
+	var versions []RenderVersion
+	err := DB.Where("short_code = ?", shortCode).Order("id DESC").Find(&versions).Error
+	return versions, err
+}
+
+// RollbackRender serves the snapshot of an earlier render of a live link again,
+// until the link is next rendered. It returns ErrNotFound if the link or the
+// version doesn't exist.
+func RollbackRender(shortCode string, versionID uint) (*RenderVersion, error) {
+	var version RenderVersion
+	if err := DB.Where("id = ? AND short_code = ?", versionID, shortCode).First(&version).Error; err != nil {
+		return nil, err
+	}
+	defer invalidateLinks(shortCode)
+	res := DB.Model(&Link{}).Where("short_code = ?", shortCode).Updates(map[string]interface{}{
+		"rendered_content_hash":    version.RenderedContentHash,
+		"rendered_html_content":    "",
+		"rendered_html_compressed": nil,
+		"html_encoding":            "",
+		"target_status_code":       version.TargetStatusCode,
+		"final_url":                version.FinalURL,
+		"redirect_chain":           version.RedirectChain,
+		"render_status":            RenderStatusCompleted,
+		"last_render_error":        "",
+		"render_duration_ms":       version.RenderDurationMs,
+		"html_size_bytes":          version.HTMLSizeBytes,
+		"rendered_at":              version.RenderedAt,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	log.Printf("History: Rolled %s back to the render of %s", shortCode, version.RenderedAt.UTC().Format(time.RFC3339))
+	return &version, nil
+}
+
+// deleteRenderVersions drops the history of links whose snapshots were purged.
+func deleteRenderVersions(shortCodes []string) error {
+	return DB.Where("short_code IN ?", shortCodes).Delete(&RenderVersion{}).Error
+}
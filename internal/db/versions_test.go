@@ -0,0 +1,70 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderHistory(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+	SetRenderHistory(2)
+	defer SetRenderHistory(0)
+
+	require.NoError(t, CreateLink(&Link{ShortCode: "HIST01", OriginalURL: "https://history.com"}))
+	for _, html := range []string{"<html>v1</html>", "<html>v2</html>", "<html>broken</html>"} {
+		require.NoError(t, SaveRenderResult("HIST01", &RenderResult{HTMLContent: html, TargetStatusCode: 200}))
+	}
+
+	versions, err := ListRenderVersions("HIST01")
+	require.NoError(t, err)
+	require.Len(t, versions, 2, "only the last two renders are kept")
+	assert.Equal(t, contentHash("<html>broken</html>"), versions[0].RenderedContentHash)
+	assert.Equal(t, contentHash("<html>v2</html>"), versions[1].RenderedContentHash)
+	assert.Equal(t, int64(len("<html>v2</html>")), versions[1].HTMLSizeBytes)
+
+	rolledBack, err := RollbackRender("HIST01", versions[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, versions[1].ID, rolledBack.ID)
+	link, err := GetLinkByShortCode("HIST01")
+	require.NoError(t, err)
+	assert.Equal(t, "<html>v2</html>", link.RenderedHTMLContent)
+	assert.Equal(t, RenderStatusCompleted, link.RenderStatus)
+	assert.Equal(t, int64(len("<html>v2</html>")), link.HTMLSizeBytes)
+
+	_, err = RollbackRender("HIST01", 9999)
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, CreateLink(&Link{ShortCode: "OTHER1", OriginalURL: "https://other.com"}))
+	_, err = RollbackRender("OTHER1", versions[0].ID)
+	assert.ErrorIs(t, err, ErrNotFound, "versions belong to their link")
+
+	// Kept versions hold on to their snapshots until the link's content is purged
+	require.NoError(t, DB.Model(&RenderedContent{}).Where("1 = 1").Update("created_at", time.Now().Add(-2*orphanGracePeriod)).Error)
+	_, err = PurgeStaleContent(time.Now().Add(-time.Hour), RetentionModeContent)
+	require.NoError(t, err)
+	var contents int64
+	require.NoError(t, DB.Model(&RenderedContent{}).Count(&contents).Error)
+	assert.Equal(t, int64(2), contents, "v1 is no longer referenced")
+
+	_, err = PurgeStaleContent(time.Now().Add(time.Hour), RetentionModeContent)
+	require.NoError(t, err)
+	versions, err = ListRenderVersions("HIST01")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+	require.NoError(t, DB.Model(&RenderedContent{}).Count(&contents).Error)
+	assert.Zero(t, contents)
+}
+
+func TestRenderHistoryDisabled(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	require.NoError(t, CreateLink(&Link{ShortCode: "NOHIST", OriginalURL: "https://nohistory.com"}))
+	require.NoError(t, SaveRenderResult("NOHIST", &RenderResult{HTMLContent: "<html></html>"}))
+	versions, err := ListRenderVersions("NOHIST")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// webhookDeliveryRetention is how long the delivery log keeps an attempt.
+const webhookDeliveryRetention = 7 * 24 * time.Hour
+
+// WebhookSubscription is a consumer of render events registered through the
+// admin API. The secret signs the deliveries, so unlike admin passwords it is
+// stored as is, and never listed.
+type WebhookSubscription struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	URL            string    `gorm:"size:2048;not null" json:"url"`
+	EventTypes     string    `gorm:"size:255;not null;default:''" json:"-"` // Comma-separated, empty for every event type
+	Secret         string    `gorm:"size:128;not null" json:"-"`
+	MaxAttempts    int       `gorm:"not null" json:"max_attempts"`    // Deliveries tried per event, the first included
+	BackoffSeconds int       `gorm:"not null" json:"backoff_seconds"` // Wait before the first retry, doubling for each further one
+	Enabled        bool      `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt      time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// Events returns the event types the subscription receives, nil for all.
+func (s *WebhookSubscription) Events() []string {
+	if s.EventTypes == "" {
+		return nil
+	}
+	return strings.Split(s.EventTypes, ",")
+}
+
+// Wants reports whether the subscription receives events of eventType.
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	events := s.Events()
+	if events == nil {
+		return true
+	}
+	for _, event := range events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one attempt at delivering an event to a subscription.
+type WebhookDelivery struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"not null;index:idx_webhook_deliveries_subscription" json:"subscription_id"`
+	EventType      string    `gorm:"size:32;not null" json:"event_type"`
+	ShortCode      string    `gorm:"size:64;not null;default:''" json:"short_code"`
+	Attempt        int       `gorm:"not null" json:"attempt"`
+	StatusCode     int       `gorm:"not null;default:0" json:"status_code,omitempty"` // Response status, 0 if none was received
+	Error          string    `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64     `gorm:"not null;default:0" json:"duration_ms"`
+	Succeeded      bool      `gorm:"not null;default:false" json:"succeeded"`
+	CreatedAt      time.Time `gorm:"not null;index:idx_webhook_deliveries_subscription" json:"created_at"`
+}
+
+// CreateWebhookSubscription stores a new subscription, setting its ID.
+func CreateWebhookSubscription(sub *WebhookSubscription) error {
+	return DB.Create(sub).Error
+}
+
+// GetWebhookSubscription returns the subscription with id, or ErrNotFound.
+func GetWebhookSubscription(id uint) (*WebhookSubscription, error) {
+	var sub WebhookSubscription
+	if err := DB.First(&sub, id).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListWebhookSubscriptions returns every subscription, oldest first.
+func ListWebhookSubscriptions() ([]WebhookSubscription, error) {
+	var subs []WebhookSubscription
+	err := DB.Order("id").Find(&subs).Error
+	return subs, err
+}
+
+// ListEnabledWebhookSubscriptions returns the subscriptions events are
+// delivered to.
+func ListEnabledWebhookSubscriptions() ([]WebhookSubscription, error) {
+	var subs []WebhookSubscription
+	err := DB.Where("enabled = ?", true).Order("id").Find(&subs).Error
+	return subs, err
+}
+
+// UpdateWebhookSubscription saves every field of an existing subscription. It
+// returns ErrNotFound if there is no subscription with its ID.
+func UpdateWebhookSubscription(sub *WebhookSubscription) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// Checked first, as MySQL counts only the rows an update changed
+		if err := tx.Select("id").First(&WebhookSubscription{}, sub.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(sub).Select("url", "event_types", "secret", "max_attempts", "backoff_seconds", "enabled").Updates(sub).Error
+	})
+}
+
+// DeleteWebhookSubscription deletes a subscription and its delivery log. It
+// returns ErrNotFound if there is no such subscription.
+func DeleteWebhookSubscription(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&WebhookSubscription{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Where("subscription_id = ?", id).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+// RecordWebhookDelivery adds an attempt to the delivery log, dropping the
+// subscription's attempts older than a week.
+func RecordWebhookDelivery(delivery *WebhookDelivery) error {
+	if err := DB.Create(delivery).Error; err != nil {
+		return err
+	}
+	return DB.Where("subscription_id = ? AND created_at < ?", delivery.SubscriptionID, time.Now().Add(-webhookDeliveryRetention)).
+		Delete(&WebhookDelivery{}).Error
+}
+
+// ListWebhookDeliveries returns up to limit of a subscription's latest delivery
+// attempts, newest first.
+func ListWebhookDeliveries(subscriptionID uint, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := DB.Where("subscription_id = ?", subscriptionID).Order("created_at DESC, id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
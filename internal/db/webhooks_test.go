@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSubscriptions(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	all := &WebhookSubscription{URL: "https://hooks.example.com/all", Secret: "s1", MaxAttempts: 3, BackoffSeconds: 10, Enabled: true}
+	require.NoError(t, CreateWebhookSubscription(all))
+	failures := &WebhookSubscription{URL: "https://hooks.example.com/failures", EventTypes: "render.failed", Secret: "s2", MaxAttempts: 1, BackoffSeconds: 10, Enabled: true}
+	require.NoError(t, CreateWebhookSubscription(failures))
+	assert.True(t, all.Wants("render.started"))
+	assert.True(t, failures.Wants("render.failed"))
+	assert.False(t, failures.Wants("render.succeeded"))
+
+	// Disabled subscriptions get no events
+	failures.Enabled = false
+	failures.EventTypes = "render.failed,render.succeeded"
+	require.NoError(t, UpdateWebhookSubscription(failures))
+	got, err := GetWebhookSubscription(failures.ID)
+	require.NoError(t, err)
+	assert.False(t, got.Enabled)
+	assert.Equal(t, []string{"render.failed", "render.succeeded"}, got.Events())
+	enabled, err := ListEnabledWebhookSubscriptions()
+	require.NoError(t, err)
+	require.Len(t, enabled, 1)
+	assert.Equal(t, all.ID, enabled[0].ID)
+	assert.ErrorIs(t, UpdateWebhookSubscription(&WebhookSubscription{ID: 999}), ErrNotFound)
+
+	// The delivery log, newest first, keeps a week of attempts
+	require.NoError(t, RecordWebhookDelivery(&WebhookDelivery{SubscriptionID: all.ID, EventType: "render.failed", Attempt: 1,
+		CreatedAt: time.Now().Add(-8 * 24 * time.Hour)}))
+	require.NoError(t, RecordWebhookDelivery(&WebhookDelivery{SubscriptionID: all.ID, EventType: "render.failed", Attempt: 1, StatusCode: 500}))
+	require.NoError(t, RecordWebhookDelivery(&WebhookDelivery{SubscriptionID: all.ID, EventType: "render.failed", Attempt: 2, StatusCode: 204, Succeeded: true}))
+	deliveries, err := ListWebhookDeliveries(all.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, 2, deliveries[0].Attempt)
+	assert.True(t, deliveries[0].Succeeded)
+
+	require.NoError(t, DeleteWebhookSubscription(all.ID))
+	assert.ErrorIs(t, DeleteWebhookSubscription(all.ID), ErrNotFound)
+	deliveries, err = ListWebhookDeliveries(all.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+	subs, err := ListWebhookSubscriptions()
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+}
@@ -0,0 +1,184 @@
+// Package flags gates risky behaviors behind feature flags, so they can be
+// rolled out per environment without code changes. A flag's state comes from,
+// in order of precedence:
+//
+//  1. the feature_flags table, switched at runtime through the admin API
+//  2. FEATURE_FLAGS, e.g. "browser_pool=on,other=off", set per environment
+//  3. the flag's default, usually the setting that predates the flag
+package flags
+
+import (
+	"fmt"
+	"log"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Flags that can be switched.
+const (
+	BrowserPool = "browser_pool" // Share one long-lived browser between renders
+)
+
+// defaults gives the state of every known flag when neither the database nor
+// FEATURE_FLAGS sets it.
+var defaults = map[string]func() bool{
+	BrowserPool: func() bool { return config.Get().BrowserPoolEnabled },
+}
+
+// Where a flag's state comes from.
+const (
+	SourceDatabase    = "database"
+	SourceEnvironment = "environment"
+	SourceDefault     = "default"
+)
+
+// State is the current state of a flag.
+type State struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"` // SourceDatabase, SourceEnvironment or SourceDefault
+}
+
+// refreshInterval bounds how long a change made by another replica takes to
+// apply. Changes made through this process apply immediately.
+var refreshInterval = 30 * time.Second
+
+var (
+	mu        sync.Mutex
+	stored    map[string]bool // Flags set in the database
+	storedAt  time.Time
+	envRaw    string
+	envParsed map[string]bool
+)
+
+// Known reports whether name is a flag that can be switched.
+func Known(name string) bool {
+	_, ok := defaults[name]
+	return ok
+}
+
+// Enabled reports whether a flag is on. Unknown flags are off.
+func Enabled(name string) bool {
+	return Get(name).Enabled
+}
+
+// Get returns the state of a flag and where it comes from.
+func Get(name string) State {
+	mu.Lock()
+	defer mu.Unlock()
+	if enabled, ok := fromDatabase()[name]; ok {
+		return State{Name: name, Enabled: enabled, Source: SourceDatabase}
+	}
+	if enabled, ok := fromEnvironment()[name]; ok {
+		return State{Name: name, Enabled: enabled, Source: SourceEnvironment}
+	}
+	def, ok := defaults[name]
+	return State{Name: name, Enabled: ok && def(), Source: SourceDefault}
+}
+
+// All returns the state of every known flag, ordered by name.
+func All() []State {
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	states := make([]State, len(names))
+	for i, name := range names {
+		states[i] = Get(name)
+	}
+	return states
+}
+
+// Set switches a known flag on or off at runtime, for every replica.
+func Set(name string, enabled bool) error {
+	if !Known(name) {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if err := db.SetFeatureFlag(name, enabled); err != nil {
+		return err
+	}
+	invalidate()
+	return nil
+}
+
+// Clear drops the runtime state of a flag, returning it to the state configured
+// for the environment. It returns db.ErrNotFound if the flag wasn't set.
+func Clear(name string) error {
+	if err := db.DeleteFeatureFlag(name); err != nil {
+		return err
+	}
+	invalidate()
+	return nil
+}
+
+// invalidate makes the next check read the database again.
+func invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	storedAt = time.Time{}
+}
+
+// fromDatabase returns the flags set in the database, read at most once per
+// refreshInterval. If the database can't be read, the last known state is kept.
+func fromDatabase() map[string]bool {
+	if db.DB == nil || time.Since(storedAt) < refreshInterval {
+		return stored
+	}
+	flags, err := db.GetFeatureFlags()
+	if err != nil {
+		log.Printf("Flags: Failed to read feature flags, keeping the last known state: %v", err)
+	} else {
+		stored = flags
+	}
+	storedAt = time.Now()
+	return stored
+}
+
+// fromEnvironment returns the flags set in FEATURE_FLAGS, parsing it again only
+// when it changes. A flag listed without a value is on, and invalid entries are
+// ignored.
+func fromEnvironment() map[string]bool {
+	cfg := config.Get()
+	if cfg.FeatureFlags == envRaw && envParsed != nil {
+		return envParsed
+	}
+	envRaw = cfg.FeatureFlags
+	envParsed = map[string]bool{}
+	for _, entry := range strings.Split(envRaw, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(entry), "=")
+		if name == "" {
+			continue
+		}
+		enabled := true
+		if hasValue {
+			var err error
+			if enabled, err = parseState(value); err != nil {
+				log.Printf("Flags: Ignoring invalid FEATURE_FLAGS entry %q", entry)
+				continue
+			}
+		}
+		if !Known(name) {
+			log.Printf("Flags: Ignoring unknown flag %q in FEATURE_FLAGS", name)
+			continue
+		}
+		envParsed[name] = enabled
+	}
+	return envParsed
+}
+
+// parseState parses a flag value: on or off, or anything strconv.ParseBool takes.
+func parseState(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,63 @@
+package flags
+
+import (
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPrecedence(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+	invalidate()
+
+	config.Set(&config.Config{})
+	assert.Equal(t, State{Name: BrowserPool, Enabled: false, Source: SourceDefault}, Get(BrowserPool))
+	config.Get().BrowserPoolEnabled = true
+	assert.True(t, Enabled(BrowserPool), "the default follows BROWSER_POOL_ENABLED")
+
+	config.Get().FeatureFlags = "browser_pool=off, bogus=on, broken=maybe"
+	assert.Equal(t, State{Name: BrowserPool, Enabled: false, Source: SourceEnvironment}, Get(BrowserPool))
+	config.Get().FeatureFlags = "browser_pool"
+	assert.True(t, Enabled(BrowserPool), "a listed flag without a value is on")
+
+	require.NoError(t, Set(BrowserPool, false))
+	assert.Equal(t, State{Name: BrowserPool, Enabled: false, Source: SourceDatabase}, Get(BrowserPool))
+	assert.Equal(t, []State{{Name: BrowserPool, Enabled: false, Source: SourceDatabase}}, All())
+	assert.Error(t, Set("bogus", true))
+
+	require.NoError(t, Clear(BrowserPool))
+	assert.Equal(t, SourceEnvironment, Get(BrowserPool).Source)
+	assert.ErrorIs(t, Clear(BrowserPool), db.ErrNotFound)
+
+	assert.False(t, Enabled("bogus"), "unknown flags are off")
+}
+
+func TestDatabaseRefresh(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+	invalidate()
+	config.Set(&config.Config{})
+
+	assert.False(t, Enabled(BrowserPool))
+
+	// Changes made by another replica apply after the refresh interval
+	require.NoError(t, db.SetFeatureFlag(BrowserPool, true))
+	assert.False(t, Enabled(BrowserPool))
+	defer func(interval time.Duration) { refreshInterval = interval }(refreshInterval)
+	refreshInterval = 0
+	assert.True(t, Enabled(BrowserPool))
+}
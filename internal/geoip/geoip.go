@@ -0,0 +1,119 @@
+// Package geoip looks up the country of client IPs in a MaxMind database, such
+// as GeoLite2 Country or City, for click analytics and anything else that needs
+// to know where a client is.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// record is the part of a GeoLite2 or GeoIP2 record that is read.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+var (
+	mutex    sync.RWMutex
+	reader   *maxminddb.Reader
+	loadedAt time.Time
+	modTime  time.Time // Of the file the database was loaded from
+)
+
+// Lookup counters since startup, for /status.
+var lookups, found, failed atomic.Int64
+
+// Open loads the MaxMind database at path for Country, replacing the one loaded
+// before.
+func Open(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("GeoIP database %s: %w", path, err)
+	}
+	opened, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("GeoIP database %s: %w", path, err)
+	}
+	mutex.Lock()
+	previous := reader
+	reader, loadedAt, modTime = opened, time.Now(), info.ModTime()
+	mutex.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// Close unloads the database. Country finds nothing afterwards.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if reader != nil {
+		reader.Close()
+		reader = nil
+	}
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip is in, such as
+// "DE", or "" if no database is loaded or the address isn't in it.
+func Country(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if reader == nil {
+		return ""
+	}
+	lookups.Add(1)
+	var r record
+	if err := reader.Lookup(addr, &r); err != nil {
+		failed.Add(1)
+		return ""
+	}
+	if r.Country.ISOCode != "" {
+		found.Add(1)
+	}
+	return r.Country.ISOCode
+}
+
+// loadedModTime returns the modification time of the loaded database file, or
+// the zero time if none is loaded.
+func loadedModTime() time.Time {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if reader == nil {
+		return time.Time{}
+	}
+	return modTime
+}
+
+// GetStatus reports the loaded database and how lookups have fared since
+// startup.
+func GetStatus() map[string]interface{} {
+	mutex.RLock()
+	status := map[string]interface{}{"enabled": reader != nil}
+	if reader != nil {
+		status["database_type"] = reader.Metadata.DatabaseType
+		status["build_time"] = time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC()
+		status["loaded_at"] = loadedAt.UTC()
+	}
+	mutex.RUnlock()
+
+	status["lookups"] = lookups.Load()
+	status["found"] = found.Load()
+	status["failed"] = failed.Load()
+	for key, value := range refreshStatus() {
+		status[key] = value
+	}
+	return status
+}
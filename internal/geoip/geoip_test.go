@@ -0,0 +1,83 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestDB writes an IPv4 MaxMind database holding country for prefix
+// alone and returns its path.
+func writeTestDB(t *testing.T, prefix netip.Prefix, country string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, os.WriteFile(path, testDB(prefix, country), 0o644))
+	return path
+}
+
+// testDB builds an IPv4 MaxMind database holding country for prefix alone.
+func testDB(prefix netip.Prefix, country string) []byte {
+	str := func(s string) []byte { return append([]byte{0x40 | byte(len(s))}, s...) }
+	uint16Field := func(v uint16) []byte { return []byte{0xa2, byte(v >> 8), byte(v)} }
+
+	// One node per prefix bit: the prefix's side leads on, the other is empty
+	nodeCount := prefix.Bits()
+	addr := prefix.Addr().As4()
+	var tree []byte
+	for i := 0; i < nodeCount; i++ {
+		next := i + 1
+		if i == nodeCount-1 {
+			next = nodeCount + 16 // Pointer to the record at the start of the data section
+		}
+		records := [2]int{nodeCount, nodeCount}
+		records[addr[i/8]>>(7-i%8)&1] = next
+		for _, r := range records {
+			tree = append(tree, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	var db bytes.Buffer
+	db.Write(tree)
+	db.Write(make([]byte, 16))
+	db.WriteByte(0xe1) // {"country": {"iso_code": country}}
+	db.Write(str("country"))
+	db.WriteByte(0xe1)
+	db.Write(str("iso_code"))
+	db.Write(str(country))
+	db.WriteString("\xab\xcd\xefMaxMind.com")
+	db.WriteByte(0xe5) // Metadata map
+	db.Write(str("node_count"))
+	db.Write([]byte{0xc1, byte(nodeCount)}) // uint32
+	db.Write(str("record_size"))
+	db.Write(uint16Field(24))
+	db.Write(str("ip_version"))
+	db.Write(uint16Field(4))
+	db.Write(str("database_type"))
+	db.Write(str("Test-Country"))
+	db.Write(str("binary_format_major_version"))
+	db.Write(uint16Field(2))
+	return db.Bytes()
+}
+
+func TestCountry(t *testing.T) {
+	defer Close()
+	assert.Equal(t, "", Country("81.2.69.160"), "no database loaded")
+
+	require.NoError(t, Open(writeTestDB(t, netip.MustParsePrefix("81.2.69.0/24"), "GB")))
+	assert.Equal(t, "GB", Country("81.2.69.160"))
+	assert.Equal(t, "", Country("81.2.70.1"))
+	assert.Equal(t, "", Country("not an IP"))
+
+	// Opening another database replaces the first
+	require.NoError(t, Open(writeTestDB(t, netip.MustParsePrefix("2.125.160.0/20"), "DE")))
+	assert.Equal(t, "DE", Country("2.125.160.216"))
+	assert.Equal(t, "", Country("81.2.69.160"))
+
+	require.Error(t, Open(filepath.Join(t.TempDir(), "missing.mmdb")))
+	assert.Equal(t, "DE", Country("2.125.160.216"), "a failed open keeps the loaded database")
+}
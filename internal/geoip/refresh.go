@@ -0,0 +1,194 @@
+package geoip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloadURL is MaxMind's download endpoint, with the edition ID to fill in.
+// Tests point it elsewhere.
+var downloadURL = "https://download.maxmind.com/geoip/databases/%s/download?suffix=tar.gz"
+
+// downloadTimeout bounds a database download.
+const downloadTimeout = 5 * time.Minute
+
+// Source is a MaxMind account to download a database edition with.
+type Source struct {
+	AccountID  string
+	LicenseKey string
+	EditionID  string // e.g. GeoLite2-Country or GeoLite2-City
+}
+
+// Download fetches the latest database of the source's edition and replaces the
+// file at path with it, unless the file is already as new. The file is
+// replaced atomically, so a running server never reads half a database.
+func Download(ctx context.Context, source Source, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(downloadURL, source.EditionID), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(source.AccountID, source.LicenseKey)
+	if info, err := os.Stat(path); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", source.EditionID, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil
+	default:
+		return fmt.Errorf("downloading %s: %s", source.EditionID, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	if err := extractDatabase(resp.Body, tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("downloading %s: %w", source.EditionID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// The file's time is the release's, so the next download can ask for newer ones only
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(tmp.Name(), modified, modified)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// extractDatabase copies the .mmdb file out of a tar.gz archive into w.
+func extractDatabase(archive io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return errors.New("no .mmdb file in the archive")
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasSuffix(header.Name, ".mmdb") {
+			_, err := io.Copy(w, tr)
+			return err
+		}
+	}
+}
+
+// Refresh stats since startup, for /status.
+var (
+	refreshMu        sync.Mutex
+	refreshEnabled   bool
+	refreshes        int64
+	lastRefresh      time.Time
+	lastRefreshError string
+)
+
+// StartRefresh checks every interval whether the database file at path has
+// changed, e.g. after geoipupdate ran, and loads the new one. With a source,
+// the latest database is downloaded first. It returns a function that stops the
+// job and waits for a running refresh to finish.
+func StartRefresh(path string, interval time.Duration, source *Source) (stop func()) {
+	refreshMu.Lock()
+	refreshEnabled = true
+	refreshMu.Unlock()
+
+	log.Printf("GeoIP: Refreshing %s every %s", path, interval)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refresh(path, source)
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// refresh downloads the database if there is a source and reloads it if the
+// file changed.
+func refresh(path string, source *Source) {
+	err := func() error {
+		if source != nil {
+			if err := Download(context.Background(), *source, path); err != nil {
+				return err
+			}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Equal(loadedModTime()) {
+			return nil
+		}
+		if err := Open(path); err != nil {
+			return err
+		}
+		log.Printf("GeoIP: Loaded updated database %s", path)
+		return nil
+	}()
+
+	refreshMu.Lock()
+	refreshes++
+	lastRefresh = time.Now()
+	lastRefreshError = ""
+	if err != nil {
+		lastRefreshError = err.Error()
+	}
+	refreshMu.Unlock()
+
+	if err != nil {
+		log.Printf("GeoIP: Refresh failed, keeping the loaded database: %v", err)
+	}
+}
+
+// refreshStatus reports the refresh job for GetStatus.
+func refreshStatus() map[string]interface{} {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	status := map[string]interface{}{
+		"refresh_enabled": refreshEnabled,
+		"refreshes":       refreshes,
+	}
+	if !lastRefresh.IsZero() {
+		status["last_refresh"] = lastRefresh.UTC()
+	}
+	if lastRefreshError != "" {
+		status["last_refresh_error"] = lastRefreshError
+	}
+	return status
+}
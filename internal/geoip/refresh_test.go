@@ -0,0 +1,98 @@
+package geoip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testArchive packs a database the way MaxMind ships it.
+func testArchive(t *testing.T, db []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "GeoLite2-Country_20250301/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "GeoLite2-Country_20250301/GeoLite2-Country.mmdb", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(db))}))
+	_, err := tw.Write(db)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestDownload(t *testing.T) {
+	released := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	archive := testArchive(t, testDB(netip.MustParsePrefix("81.2.69.0/24"), "GB"))
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "1234" || pass != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/geoip/databases/GeoLite2-Country/download", r.URL.Path)
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !since.Before(released) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("Last-Modified", released.Format(http.TimeFormat))
+		w.Write(archive)
+	}))
+	defer server.Close()
+	defer func(url string) { downloadURL = url }(downloadURL)
+	downloadURL = server.URL + "/geoip/databases/%s/download?suffix=tar.gz"
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	source := Source{AccountID: "1234", LicenseKey: "key", EditionID: "GeoLite2-Country"}
+	require.NoError(t, Download(context.Background(), source, path))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, released.Equal(info.ModTime()))
+
+	defer Close()
+	require.NoError(t, Open(path))
+	assert.Equal(t, "GB", Country("81.2.69.1"))
+
+	// An unchanged release isn't downloaded again
+	require.NoError(t, Download(context.Background(), source, path))
+	assert.Equal(t, 1, downloads)
+
+	source.LicenseKey = "wrong"
+	require.Error(t, Download(context.Background(), source, path))
+}
+
+func TestRefreshReloadsChangedFile(t *testing.T) {
+	defer Close()
+	path := writeTestDB(t, netip.MustParsePrefix("81.2.69.0/24"), "GB")
+	require.NoError(t, Open(path))
+
+	// An unchanged file isn't reloaded
+	refresh(path, nil)
+	assert.Equal(t, "GB", Country("81.2.69.1"))
+
+	require.NoError(t, os.WriteFile(path, testDB(netip.MustParsePrefix("81.2.69.0/24"), "IE"), 0o644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	refresh(path, nil)
+	assert.Equal(t, "IE", Country("81.2.69.1"))
+
+	require.NoError(t, os.Remove(path))
+	refresh(path, nil)
+	assert.Equal(t, "IE", Country("81.2.69.1"), "a failed refresh keeps the loaded database")
+	status := GetStatus()
+	assert.Equal(t, true, status["enabled"])
+	assert.Equal(t, "Test-Country", status["database_type"])
+	assert.Contains(t, status["last_refresh_error"], "no such file")
+}
@@ -0,0 +1,68 @@
+package janitor
+
+import (
+	"log"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"time"
+)
+
+// archive stats accumulate what the archiver has moved since startup, for /status.
+var (
+	archiveMu        sync.Mutex
+	archiveEnabled   bool
+	archiveRuns      int64
+	archiveLastRun   time.Time
+	archiveLastError string
+	linksArchived    int64
+)
+
+// StartArchiving moves links not accessed for inactiveFor into the archive every
+// interval. Archived links are rehydrated when they are requested again. It
+// returns a function that stops the archiver and waits for a running pass.
+func StartArchiving(interval, inactiveFor time.Duration) (stop func()) {
+	archiveMu.Lock()
+	archiveEnabled = true
+	archiveMu.Unlock()
+
+	log.Printf("Janitor: Archiving links not accessed for %s, every %s", inactiveFor, interval)
+	return every(interval, func() { archive(inactiveFor) })
+}
+
+func archive(inactiveFor time.Duration) {
+	start := time.Now()
+	archived, err := db.ArchiveInactiveLinks(start.Add(-inactiveFor))
+
+	archiveMu.Lock()
+	archiveRuns++
+	archiveLastRun = start
+	archiveLastError = ""
+	if err != nil {
+		archiveLastError = err.Error()
+	}
+	linksArchived += archived
+	archiveMu.Unlock()
+
+	if err != nil {
+		log.Printf("Janitor: Archiving failed: %v", err)
+	}
+	log.Printf("Janitor: Archived %d inactive links in %s", archived, time.Since(start))
+}
+
+// archiveStatus returns what the archiver has moved since startup.
+func archiveStatus() map[string]interface{} {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	status := map[string]interface{}{
+		"enabled":        archiveEnabled,
+		"runs":           archiveRuns,
+		"links_archived": linksArchived,
+	}
+	if !archiveLastRun.IsZero() {
+		status["last_run"] = archiveLastRun.UTC()
+	}
+	if archiveLastError != "" {
+		status["last_error"] = archiveLastError
+	}
+	return status
+}
@@ -0,0 +1,108 @@
+package janitor
+
+import (
+	"log"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"time"
+)
+
+// stats accumulates what the janitor has reclaimed since startup, for /status.
+var (
+	statsMu   sync.Mutex
+	enabled   bool
+	runs      int64
+	lastRun   time.Time
+	lastError string
+	total     db.PurgeResult
+)
+
+// Start purges the content of links not accessed for retention every interval.
+// mode is db.RetentionModeContent or db.RetentionModeRows. It returns a function
+// that stops the janitor and waits for a running purge to finish.
+func Start(interval, retention time.Duration, mode string) (stop func()) {
+	if mode != db.RetentionModeContent && mode != db.RetentionModeRows {
+		log.Printf("Janitor: Unknown retention mode %q, using %q", mode, db.RetentionModeContent)
+		mode = db.RetentionModeContent
+	}
+	statsMu.Lock()
+	enabled = true
+	statsMu.Unlock()
+
+	log.Printf("Janitor: Purging %s of links not accessed for %s, every %s", mode, retention, interval)
+	return every(interval, func() { run(retention, mode) })
+}
+
+// every calls fn every interval until the returned function is called, which
+// waits for a running call to finish.
+func every(interval time.Duration, fn func()) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+func run(retention time.Duration, mode string) {
+	start := time.Now()
+	result, err := db.PurgeStaleContent(start.Add(-retention), mode)
+
+	statsMu.Lock()
+	runs++
+	lastRun = start
+	lastError = ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	if result != nil {
+		total.LinksCleared += result.LinksCleared
+		total.LinksDeleted += result.LinksDeleted
+		total.ContentsDeleted += result.ContentsDeleted
+		total.BytesReclaimed += result.BytesReclaimed
+	}
+	statsMu.Unlock()
+
+	if err != nil {
+		log.Printf("Janitor: Purge failed: %v", err)
+	}
+	if result != nil {
+		log.Printf("Janitor: Cleared %d links, deleted %d links and %d snapshots, reclaimed %d bytes in %s",
+			result.LinksCleared, result.LinksDeleted, result.ContentsDeleted, result.BytesReclaimed, time.Since(start))
+	}
+}
+
+// GetStatus returns what the janitor has reclaimed since startup.
+func GetStatus() map[string]interface{} {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	status := map[string]interface{}{
+		"enabled":             enabled,
+		"runs":                runs,
+		"totals":              total,
+		"archive":             archiveStatus(),
+		"click_partitions":    partitionStatus(),
+		"url_screening":       screeningStatus(),
+		"analytics_retention": retentionStatus(),
+	}
+	if !lastRun.IsZero() {
+		status["last_run"] = lastRun.UTC()
+	}
+	if lastError != "" {
+		status["last_error"] = lastError
+	}
+	return status
+}
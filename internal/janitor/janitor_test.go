@@ -0,0 +1,149 @@
+package janitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/reputation"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRunAccumulatesStatus(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "OLD", OriginalURL: "https://old.com"}))
+	require.NoError(t, db.SaveRenderResult("OLD", &db.RenderResult{HTMLContent: "<html>old</html>"}))
+
+	run(-time.Hour, db.RetentionModeContent) // Negative retention treats every link as stale
+	run(-time.Hour, db.RetentionModeContent)
+
+	status := GetStatus()
+	assert.Equal(t, int64(2), status["runs"])
+	assert.Equal(t, int64(1), status["totals"].(db.PurgeResult).LinksCleared)
+	assert.NotContains(t, status, "last_error")
+	assert.Contains(t, status, "last_run")
+}
+
+func TestArchiveAccumulatesStatus(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "IDLE", OriginalURL: "https://idle.com"}))
+
+	archive(-time.Hour) // Negative inactivity treats every link as inactive
+	archive(-time.Hour)
+
+	status := GetStatus()["archive"].(map[string]interface{})
+	assert.Equal(t, int64(2), status["runs"])
+	assert.Equal(t, int64(1), status["links_archived"])
+	assert.NotContains(t, status, "last_error")
+}
+
+func TestPartitionMaintenanceRecordsErrors(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+
+	maintainPartitions(0) // SQLite has no partition catalog to query
+
+	status := GetStatus()["click_partitions"].(map[string]interface{})
+	assert.Equal(t, int64(1), status["runs"])
+	assert.Equal(t, int64(0), status["partitions_created"])
+	assert.Contains(t, status, "last_error")
+}
+
+// fakeChecker flags the URLs it maps to a threat type.
+type fakeChecker map[string]string
+
+func (f fakeChecker) Check(_ context.Context, urls []string) (map[string]string, error) {
+	threats := map[string]string{}
+	for _, u := range urls {
+		if threat, ok := f[u]; ok {
+			threats[u] = threat
+		}
+	}
+	return threats, nil
+}
+
+func TestScreenDisablesFlaggedLinks(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+	reputation.SetChecker(fakeChecker{
+		"https://compromised.com":   "MALWARE",
+		"https://phish.com/landing": "SOCIAL_ENGINEERING",
+	})
+	defer reputation.SetChecker(nil)
+	config.Set(&config.Config{}) // No chat notifications
+
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "BAD", OriginalURL: "https://compromised.com"}))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "HOP", OriginalURL: "https://redirector.com"}))
+	require.NoError(t, db.SaveRenderResult("HOP", &db.RenderResult{HTMLContent: "<html></html>", FinalURL: "https://phish.com/landing"}))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "GOOD", OriginalURL: "https://fine.com"}))
+
+	screen()
+	screen() // Disabled links are not checked again
+
+	for code, reason := range map[string]string{"BAD": "Flagged as MALWARE", "HOP": "Flagged as SOCIAL_ENGINEERING", "GOOD": ""} {
+		link, err := db.GetLinkByShortCode(code)
+		require.NoError(t, err)
+		assert.Equal(t, reason, link.DisabledReason, code)
+		assert.Equal(t, reason != "", link.DisabledAt != nil, code)
+	}
+
+	status := GetStatus()["url_screening"].(map[string]interface{})
+	assert.Equal(t, int64(2), status["runs"])
+	assert.Equal(t, int64(4), status["links_screened"])
+	assert.Equal(t, int64(2), status["links_disabled"])
+	assert.NotContains(t, status, "last_error")
+}
+
+func TestAnalyticsRetentionAuditsPurges(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrate())
+	defer db.Close()
+
+	old := time.Now().AddDate(0, 0, -10)
+	require.NoError(t, db.RecordClickEvents([]db.ClickEvent{
+		{ShortCode: "GDPR1", ClickedAt: old, UAClass: db.UAClassBrowser},
+		{ShortCode: "GDPR1", ClickedAt: time.Now(), UAClass: db.UAClassBrowser},
+	}))
+	_, err = db.RollupClickEvents(time.Now().Add(time.Second), true)
+	require.NoError(t, err)
+
+	pruneAnalytics(7*24*time.Hour, 7*24*time.Hour)
+	pruneAnalytics(7*24*time.Hour, 0) // Nothing left to purge
+
+	purges, err := db.ListAnalyticsPurges(10)
+	require.NoError(t, err)
+	datasets := make(map[string]int64)
+	for _, purge := range purges {
+		datasets[purge.Dataset] = purge.RowsDeleted
+	}
+	assert.Equal(t, map[string]int64{db.DatasetClickEvents: 1, db.DatasetDailyStats: 1, db.DatasetDailyBreakdowns: 5}, datasets)
+
+	status := GetStatus()["analytics_retention"].(map[string]interface{})
+	assert.Equal(t, int64(2), status["runs"])
+	assert.Equal(t, int64(1), status["click_events_pruned"])
+	assert.NotContains(t, status, "last_error")
+}
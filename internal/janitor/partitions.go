@@ -0,0 +1,88 @@
+package janitor
+
+import (
+	"log"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"time"
+)
+
+// clickPartitionsAhead is how many months of click_events partitions are kept
+// created beyond the current one, so events never have to go to the default
+// partition while the janitor is briefly down.
+const clickPartitionsAhead = 2
+
+// partition stats accumulate what partition maintenance has done since startup, for /status.
+var (
+	partitionMu        sync.Mutex
+	partitionEnabled   bool
+	partitionRuns      int64
+	partitionLastRun   time.Time
+	partitionLastError string
+	partitionsCreated  int64
+	partitionsDropped  int64
+)
+
+// StartClickPartitions keeps the monthly click_events partitions ahead of time
+// every interval and, with retentionMonths above zero, drops the partitions of
+// months that ended more than retentionMonths ago. It returns a function that
+// stops the maintenance and waits for a running pass.
+func StartClickPartitions(interval time.Duration, retentionMonths int) (stop func()) {
+	partitionMu.Lock()
+	partitionEnabled = true
+	partitionMu.Unlock()
+
+	if retentionMonths > 0 {
+		log.Printf("Janitor: Maintaining click event partitions, keeping %d months, every %s", retentionMonths, interval)
+	} else {
+		log.Printf("Janitor: Maintaining click event partitions every %s", interval)
+	}
+	maintainPartitions(retentionMonths)
+	return every(interval, func() { maintainPartitions(retentionMonths) })
+}
+
+func maintainPartitions(retentionMonths int) {
+	start := time.Now()
+	var dropBefore time.Time
+	if retentionMonths > 0 {
+		dropBefore = start.AddDate(0, -retentionMonths, 0)
+	}
+	result, err := db.MaintainClickPartitions(start, clickPartitionsAhead, dropBefore)
+
+	partitionMu.Lock()
+	partitionRuns++
+	partitionLastRun = start
+	partitionLastError = ""
+	if err != nil {
+		partitionLastError = err.Error()
+	}
+	partitionsCreated += int64(len(result.Created))
+	partitionsDropped += int64(len(result.Dropped))
+	partitionMu.Unlock()
+
+	if err != nil {
+		log.Printf("Janitor: Partition maintenance failed: %v", err)
+	}
+	if len(result.Created) > 0 || len(result.Dropped) > 0 {
+		log.Printf("Janitor: Created click event partitions %v, dropped %v", result.Created, result.Dropped)
+	}
+}
+
+// partitionStatus returns what partition maintenance has done since startup.
+func partitionStatus() map[string]interface{} {
+	partitionMu.Lock()
+	defer partitionMu.Unlock()
+	status := map[string]interface{}{
+		"enabled":            partitionEnabled,
+		"runs":               partitionRuns,
+		"partitions_created": partitionsCreated,
+		"partitions_dropped": partitionsDropped,
+	}
+	if !partitionLastRun.IsZero() {
+		status["last_run"] = partitionLastRun.UTC()
+	}
+	if partitionLastError != "" {
+		status["last_error"] = partitionLastError
+	}
+	return status
+}
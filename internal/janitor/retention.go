@@ -0,0 +1,101 @@
+package janitor
+
+import (
+	"errors"
+	"log"
+	"prerender-url-shortener/internal/db"
+	"sync"
+	"time"
+)
+
+// analytics retention stats accumulate what has been pruned since startup, for /status.
+var (
+	retentionMu           sync.Mutex
+	retentionEnabled      bool
+	retentionRuns         int64
+	retentionLastRun      time.Time
+	retentionLastError    string
+	clickEventsPruned     int64
+	clickAggregatesPruned int64
+)
+
+// StartAnalyticsRetention deletes raw click events older than rawRetention and
+// daily click stats and breakdowns older than aggregateRetention every
+// interval, once right away. A zero retention keeps that data. Every purge is
+// logged and recorded in analytics_purges. It returns a function that stops the
+// job and waits for a running pass.
+func StartAnalyticsRetention(interval, rawRetention, aggregateRetention time.Duration) (stop func()) {
+	retentionMu.Lock()
+	retentionEnabled = true
+	retentionMu.Unlock()
+
+	log.Printf("Janitor: Keeping raw clicks for %s and click aggregates for %s (0s keeps them), pruning every %s",
+		rawRetention, aggregateRetention, interval)
+	pruneAnalytics(rawRetention, aggregateRetention)
+	return every(interval, func() { pruneAnalytics(rawRetention, aggregateRetention) })
+}
+
+func pruneAnalytics(rawRetention, aggregateRetention time.Duration) {
+	start := time.Now()
+	var rawPruned, aggregatesPruned int64
+	var errs []error
+	if rawRetention > 0 {
+		cutoff := start.Add(-rawRetention)
+		pruned, err := db.PruneClickEvents(cutoff)
+		// Whatever was deleted before an error is recorded too
+		errs = append(errs, err, auditPurge(db.DatasetClickEvents, cutoff, pruned))
+		rawPruned = pruned
+	}
+	if aggregateRetention > 0 {
+		cutoff := start.Add(-aggregateRetention)
+		stats, breakdowns, err := db.PruneClickAggregates(cutoff)
+		errs = append(errs, err, auditPurge(db.DatasetDailyStats, cutoff, stats),
+			auditPurge(db.DatasetDailyBreakdowns, cutoff, breakdowns))
+		aggregatesPruned = stats + breakdowns
+	}
+	err := errors.Join(errs...)
+
+	retentionMu.Lock()
+	retentionRuns++
+	retentionLastRun = start
+	retentionLastError = ""
+	if err != nil {
+		retentionLastError = err.Error()
+	}
+	clickEventsPruned += rawPruned
+	clickAggregatesPruned += aggregatesPruned
+	retentionMu.Unlock()
+
+	if err != nil {
+		log.Printf("Janitor: Analytics retention failed: %v", err)
+	}
+}
+
+// auditPurge logs a purge and records it in the audit trail, unless nothing was
+// deleted.
+func auditPurge(dataset string, cutoff time.Time, rows int64) error {
+	if rows == 0 {
+		return nil
+	}
+	log.Printf("Janitor: Purged %d rows of %s from before %s", rows, dataset, cutoff.UTC().Format(time.RFC3339))
+	return db.RecordAnalyticsPurge(dataset, cutoff, rows)
+}
+
+// retentionStatus returns what analytics retention has pruned since startup.
+func retentionStatus() map[string]interface{} {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+	status := map[string]interface{}{
+		"enabled":               retentionEnabled,
+		"runs":                  retentionRuns,
+		"click_events_pruned":   clickEventsPruned,
+		"aggregate_rows_pruned": clickAggregatesPruned,
+	}
+	if !retentionLastRun.IsZero() {
+		status["last_run"] = retentionLastRun.UTC()
+	}
+	if retentionLastError != "" {
+		status["last_error"] = retentionLastError
+	}
+	return status
+}
@@ -0,0 +1,124 @@
+package janitor
+
+import (
+	"context"
+	"log"
+	"prerender-url-shortener/internal/cdn"
+	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/notify"
+	"prerender-url-shortener/internal/reputation"
+	"sync"
+	"time"
+)
+
+// screeningBatchSize is how many links a screening pass loads and checks at once.
+const screeningBatchSize = 500
+
+// screening stats accumulate what URL screening has found since startup, for /status.
+var (
+	screeningMu        sync.Mutex
+	screeningEnabled   bool
+	screeningRuns      int64
+	screeningLastRun   time.Time
+	screeningLastError string
+	linksScreened      int64
+	linksDisabled      int64
+)
+
+// StartScreening re-checks every enabled link against the URL reputation checker
+// every interval, disabling links whose original or final URL has since been
+// flagged. It returns a function that stops the job and waits for a running pass.
+func StartScreening(interval time.Duration) (stop func()) {
+	screeningMu.Lock()
+	screeningEnabled = true
+	screeningMu.Unlock()
+
+	log.Printf("Janitor: Re-screening link destinations every %s", interval)
+	return every(interval, screen)
+}
+
+func screen() {
+	start := time.Now()
+	screened, disabled, err := screenLinks(context.Background())
+
+	screeningMu.Lock()
+	screeningRuns++
+	screeningLastRun = start
+	screeningLastError = ""
+	if err != nil {
+		screeningLastError = err.Error()
+	}
+	linksScreened += screened
+	linksDisabled += disabled
+	screeningMu.Unlock()
+
+	if err != nil {
+		log.Printf("Janitor: Screening failed: %v", err)
+	}
+	log.Printf("Janitor: Screened %d links, disabled %d in %s", screened, disabled, time.Since(start))
+}
+
+// screenLinks checks enabled links batch by batch and disables the flagged ones.
+// It returns how many links were checked and disabled before any error.
+func screenLinks(ctx context.Context) (screened, disabled int64, err error) {
+	var afterID uint
+	for {
+		links, err := db.ListEnabledLinks(afterID, screeningBatchSize)
+		if err != nil || len(links) == 0 {
+			return screened, disabled, err
+		}
+		afterID = links[len(links)-1].ID
+
+		urls := make([]string, 0, 2*len(links))
+		for _, link := range links {
+			urls = append(urls, link.OriginalURL)
+			if link.FinalURL != "" {
+				urls = append(urls, link.FinalURL)
+			}
+		}
+		threats, err := reputation.Check(ctx, urls...)
+		if err != nil {
+			return screened, disabled, err
+		}
+		screened += int64(len(links))
+
+		for _, link := range links {
+			threat, flaggedURL := threats[link.OriginalURL], link.OriginalURL
+			if threat == "" && link.FinalURL != "" {
+				threat, flaggedURL = threats[link.FinalURL], link.FinalURL
+			}
+			if threat == "" {
+				continue
+			}
+			if err := db.DisableLink(link.ShortCode, "Flagged as "+threat); err != nil {
+				return screened, disabled, err
+			}
+			disabled++
+			log.Printf("Janitor: Disabled %s, %s is flagged as %s", link.ShortCode, flaggedURL, threat)
+			notify.LinkFlagged(link.ShortCode, flaggedURL, threat)
+			cdn.Purge(link.ShortCode)
+		}
+		if len(links) < screeningBatchSize {
+			return screened, disabled, nil
+		}
+	}
+}
+
+// screeningStatus returns what URL screening has found since startup.
+func screeningStatus() map[string]interface{} {
+	screeningMu.Lock()
+	defer screeningMu.Unlock()
+	status := map[string]interface{}{
+		"enabled":        screeningEnabled,
+		"runs":           screeningRuns,
+		"links_screened": linksScreened,
+		"links_disabled": linksDisabled,
+	}
+	if !screeningLastRun.IsZero() {
+		status["last_run"] = screeningLastRun.UTC()
+	}
+	if screeningLastError != "" {
+		status["last_error"] = screeningLastError
+	}
+	return status
+}
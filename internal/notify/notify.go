@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"prerender-url-shortener/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies what a notification is about. Each kind has its own cooldown,
+// so a burst of one doesn't hold back the others.
+type Kind string
+
+const (
+	KindRenderFailures Kind = "render_failures"
+	KindQueueSaturated Kind = "queue_saturated"
+	KindLinkFlagged    Kind = "link_flagged"
+)
+
+// deliveryTimeout bounds a single delivery to the chat webhook.
+const deliveryTimeout = 10 * time.Second
+
+var client = &http.Client{Timeout: deliveryTimeout}
+
+// Notifications are rate limited per kind: one sent within NOTIFY_COOLDOWN_MINUTES
+// of the previous is held back and counted, and the count is reported with the
+// next one sent.
+var (
+	mu       sync.Mutex
+	failures []time.Time // Render failures within the failure window, oldest first
+	lastSent = map[Kind]time.Time{}
+	held     = map[Kind]int{}
+)
+
+// RenderFailed records a render that failed for good, notifying once
+// NOTIFY_RENDER_FAILURE_THRESHOLD of them fail within
+// NOTIFY_RENDER_FAILURE_WINDOW_MINUTES.
+func RenderFailed(shortCode, originalURL string, renderErr error) {
+	cfg := config.Get()
+	if cfg.NotifyWebhookURL == "" {
+		return
+	}
+	window := time.Duration(cfg.NotifyRenderFailureWindowMinutes) * time.Minute
+	now := time.Now()
+
+	mu.Lock()
+	cutoff := now.Add(-window)
+	kept := failures[:0]
+	for _, at := range failures {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	failures = append(kept, now)
+	count := len(failures)
+	mu.Unlock()
+
+	if count < max(cfg.NotifyRenderFailureThreshold, 1) {
+		return
+	}
+	send(KindRenderFailures, "Render failures",
+		fmt.Sprintf("%d renders failed in the last %s. Latest: %s (%s): %v", count, window, shortCode, originalURL, renderErr))
+}
+
+// QueueSaturated notifies that a render was deferred because the render queue
+// is full.
+func QueueSaturated(capacity int) {
+	send(KindQueueSaturated, "Render queue full",
+		fmt.Sprintf("The render queue is full at %d jobs, so new renders wait for an idle worker.", capacity))
+}
+
+// LinkFlagged notifies that a link was disabled because URL screening flagged
+// flaggedURL as threat.
+func LinkFlagged(shortCode, flaggedURL, threat string) {
+	send(KindLinkFlagged, "Link disabled",
+		fmt.Sprintf("%s was disabled, %s is flagged as %s.", shortCode, flaggedURL, threat))
+}
+
+// send posts a notification to NOTIFY_WEBHOOK_URL in the background, unless
+// one of the same kind was sent within the cooldown.
+func send(kind Kind, title, text string) {
+	cfg := config.Get()
+	webhookURL := cfg.NotifyWebhookURL
+	if webhookURL == "" {
+		return
+	}
+	cooldown := time.Duration(cfg.NotifyCooldownMinutes) * time.Minute
+	now := time.Now()
+
+	mu.Lock()
+	if last, ok := lastSent[kind]; ok && now.Sub(last) < cooldown {
+		held[kind]++
+		mu.Unlock()
+		return
+	}
+	if n := held[kind]; n > 0 {
+		text += fmt.Sprintf(" (%d more held back since the last notification)", n)
+	}
+	lastSent[kind], held[kind] = now, 0
+	if kind == KindRenderFailures {
+		failures = nil
+	}
+	mu.Unlock()
+
+	go func() {
+		if err := deliver(webhookURL, payload(webhookURL, title, text)); err != nil {
+			log.Printf("Notify: Failed to deliver %s notification: %v", kind, err)
+		}
+	}()
+}
+
+// payload formats a message for the chat service webhookURL belongs to:
+// Discord webhooks take a content field and Slack incoming webhooks a text
+// field, each with their own markup for the bold title.
+func payload(webhookURL, title, text string) map[string]string {
+	if isDiscord(webhookURL) {
+		return map[string]string{"content": "**" + title + "**\n" + text}
+	}
+	return map[string]string{"text": "*" + title + "*\n" + text}
+}
+
+// isDiscord reports whether webhookURL is a Discord webhook. Discord's
+// Slack-compatible endpoints, ending in /slack, take Slack payloads.
+func isDiscord(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	discord := host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com")
+	return discord && !strings.HasSuffix(u.Path, "/slack")
+}
+
+// deliver POSTs a message and treats any non-2xx response as a failure.
+func deliver(webhookURL string, message map[string]string) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupNotify points notifications at a test server and returns the messages
+// it receives.
+func setupNotify(t *testing.T) <-chan map[string]string {
+	received := make(chan map[string]string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&message); err == nil {
+			received <- message
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config.Set(&config.Config{
+		NotifyWebhookURL:                 server.URL,
+		NotifyRenderFailureThreshold:     3,
+		NotifyRenderFailureWindowMinutes: 15,
+		NotifyCooldownMinutes:            30,
+	})
+	mu.Lock()
+	failures, lastSent, held = nil, map[Kind]time.Time{}, map[Kind]int{}
+	mu.Unlock()
+	return received
+}
+
+func receive(t *testing.T, received <-chan map[string]string) map[string]string {
+	select {
+	case message := <-received:
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("notification was not delivered")
+		return nil
+	}
+}
+
+func TestRenderFailedThreshold(t *testing.T) {
+	received := setupNotify(t)
+
+	RenderFailed("FAIL01", "https://fail.com/1", errors.New("timeout"))
+	RenderFailed("FAIL02", "https://fail.com/2", errors.New("timeout"))
+	select {
+	case <-received:
+		t.Fatal("notified below the threshold")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	RenderFailed("FAIL03", "https://fail.com/3", errors.New("net::ERR_NAME_NOT_RESOLVED"))
+	message := receive(t, received)
+	assert.Equal(t, "*Render failures*\n3 renders failed in the last 15m0s. Latest: FAIL03 (https://fail.com/3): net::ERR_NAME_NOT_RESOLVED", message["text"])
+}
+
+func TestSendCooldown(t *testing.T) {
+	received := setupNotify(t)
+
+	QueueSaturated(100)
+	assert.Contains(t, receive(t, received)["text"], "full at 100 jobs")
+	QueueSaturated(100)
+	QueueSaturated(100)
+	LinkFlagged("BAD", "https://compromised.com", "MALWARE")
+	assert.Equal(t, "*Link disabled*\nBAD was disabled, https://compromised.com is flagged as MALWARE.", receive(t, received)["text"],
+		"kinds have their own cooldown")
+
+	// Once the cooldown is over, the held back ones are counted
+	mu.Lock()
+	lastSent[KindQueueSaturated] = time.Now().Add(-time.Hour)
+	mu.Unlock()
+	QueueSaturated(100)
+	assert.Contains(t, receive(t, received)["text"], "(2 more held back since the last notification)")
+}
+
+func TestPayload(t *testing.T) {
+	assert.Equal(t, map[string]string{"text": "*Title*\nBody"}, payload("https://hooks.slack.com/services/T0/B0/x", "Title", "Body"))
+	assert.Equal(t, map[string]string{"content": "**Title**\nBody"}, payload("https://discord.com/api/webhooks/1/x", "Title", "Body"))
+	assert.Equal(t, map[string]string{"content": "**Title**\nBody"}, payload("https://ptb.discord.com/api/webhooks/1/x", "Title", "Body"))
+	assert.Equal(t, map[string]string{"text": "*Title*\nBody"}, payload("https://discord.com/api/webhooks/1/x/slack", "Title", "Body"),
+		"Discord's Slack-compatible endpoint")
+}
+
+func TestDisabled(t *testing.T) {
+	setupNotify(t)
+	config.Get().NotifyWebhookURL = ""
+	QueueSaturated(100)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Empty(t, lastSent)
+}
@@ -0,0 +1,148 @@
+// Package ratelimit counts requests per client in fixed windows. Counters live
+// in memory by default, or in Redis so every replica behind a load balancer
+// enforces the same limit.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Result is the outcome of counting a request.
+type Result struct {
+	Allowed   bool
+	Remaining int           // Requests left in the current window
+	Reset     time.Duration // Time until the current window ends
+}
+
+// Limiter counts requests against a limit per window and keeps track of
+// temporarily blocked keys.
+type Limiter interface {
+	// Allow counts a request for key and reports whether it is within limit
+	// requests per window.
+	Allow(key string, limit int, window time.Duration) Result
+	// Block blocks key for d.
+	Block(key string, d time.Duration)
+	// Blocked returns how much longer key is blocked, or 0 if it isn't.
+	Blocked(key string) time.Duration
+}
+
+var (
+	limiterMu sync.RWMutex
+	limiter   Limiter = NewLocal()
+)
+
+// SetLimiter installs the limiter used by Allow.
+func SetLimiter(l Limiter) {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	limiter = l
+}
+
+// Allow counts a request for key with the installed limiter.
+func Allow(key string, limit int, window time.Duration) Result {
+	limiterMu.RLock()
+	l := limiter
+	limiterMu.RUnlock()
+	return l.Allow(key, limit, window)
+}
+
+// Block blocks key for d with the installed limiter.
+func Block(key string, d time.Duration) {
+	limiterMu.RLock()
+	l := limiter
+	limiterMu.RUnlock()
+	l.Block(key, d)
+}
+
+// Blocked returns how much longer key is blocked with the installed limiter.
+func Blocked(key string) time.Duration {
+	limiterMu.RLock()
+	l := limiter
+	limiterMu.RUnlock()
+	return l.Blocked(key)
+}
+
+// windowAt returns the index of the window containing now and how long until it ends.
+func windowAt(now time.Time, window time.Duration) (int64, time.Duration) {
+	index := now.UnixNano() / int64(window)
+	return index, time.Duration((index+1)*int64(window) - now.UnixNano())
+}
+
+// result turns the count of requests in a window into a Result.
+func result(count int64, limit int, reset time.Duration) Result {
+	remaining := int64(limit) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{Allowed: count <= int64(limit), Remaining: int(remaining), Reset: reset}
+}
+
+// Local is a Limiter keeping counters in process memory, so each replica
+// enforces the limit on its own.
+type Local struct {
+	mu       sync.Mutex
+	counters map[localKey]int64
+	blocked  map[string]time.Time
+	swept    int64
+}
+
+type localKey struct {
+	key    string
+	window time.Duration
+	index  int64
+}
+
+// NewLocal returns an in-memory limiter.
+func NewLocal() *Local {
+	return &Local{counters: map[localKey]int64{}, blocked: map[string]time.Time{}}
+}
+
+func (l *Local) Allow(key string, limit int, window time.Duration) Result {
+	now := time.Now()
+	index, reset := windowAt(now, window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	k := localKey{key, window, index}
+	l.counters[k]++
+	return result(l.counters[k], limit, reset)
+}
+
+func (l *Local) Block(key string, d time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	l.blocked[key] = now.Add(d)
+}
+
+func (l *Local) Blocked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if remaining := time.Until(l.blocked[key]); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// sweep drops counters of past windows and expired blocks, at most once a
+// second. l.mu must be held.
+func (l *Local) sweep(now time.Time) {
+	second := now.Unix()
+	if second == l.swept {
+		return
+	}
+	l.swept = second
+	for k := range l.counters {
+		if current, _ := windowAt(now, k.window); k.index < current {
+			delete(l.counters, k)
+		}
+	}
+	for key, until := range l.blocked {
+		if !until.After(now) {
+			delete(l.blocked, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	l := NewLocal()
+	for i := 2; i >= 0; i-- {
+		res := l.Allow("a", 3, time.Hour)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+		assert.LessOrEqual(t, res.Reset, time.Hour)
+	}
+	assert.False(t, l.Allow("a", 3, time.Hour).Allowed)
+	assert.True(t, l.Allow("b", 3, time.Hour).Allowed, "keys are counted separately")
+
+	// Counters start over in the next window
+	assert.True(t, l.Allow("c", 1, 50*time.Millisecond).Allowed)
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, l.Allow("c", 1, 50*time.Millisecond).Allowed)
+}
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	first, err := NewRedis("redis://" + mr.Addr())
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := NewRedis("redis://" + mr.Addr())
+	require.NoError(t, err)
+	defer second.Close()
+
+	// Replicas share the count
+	assert.True(t, first.Allow("a", 2, time.Hour).Allowed)
+	res := second.Allow("a", 2, time.Hour)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.False(t, first.Allow("a", 2, time.Hour).Allowed)
+
+	keys := mr.Keys()
+	require.Len(t, keys, 1)
+	assert.Greater(t, mr.TTL(keys[0]), time.Duration(0), "counters expire")
+
+	// Without Redis each replica counts on its own
+	mr.Close()
+	assert.True(t, first.Allow("a", 2, time.Hour).Allowed)
+	assert.True(t, first.Allow("a", 2, time.Hour).Allowed)
+	assert.False(t, first.Allow("a", 2, time.Hour).Allowed)
+}
+
+func TestNewRedisInvalidURL(t *testing.T) {
+	_, err := NewRedis("not a url")
+	assert.Error(t, err)
+}
+
+func TestBlock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	shared, err := NewRedis("redis://" + mr.Addr())
+	require.NoError(t, err)
+	defer shared.Close()
+	other, err := NewRedis("redis://" + mr.Addr())
+	require.NoError(t, err)
+	defer other.Close()
+
+	for name, l := range map[string]Limiter{"local": NewLocal(), "redis": shared} {
+		assert.Zero(t, l.Blocked("scanner"), name)
+		l.Block("scanner", time.Minute)
+		assert.Greater(t, l.Blocked("scanner"), 50*time.Second, name)
+		assert.Zero(t, l.Blocked("someone-else"), name)
+	}
+	assert.Greater(t, other.Blocked("scanner"), time.Duration(0), "replicas share blocks")
+
+	mr.Close()
+	assert.Greater(t, shared.Blocked("scanner"), time.Duration(0), "blocks are kept locally as well")
+	assert.Zero(t, other.Blocked("scanner"))
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces counters in a Redis that may be shared with the
+// link cache or other applications.
+const redisKeyPrefix = "prerender:ratelimit:"
+
+// redisTimeout bounds every counter update so a slow Redis falls back to local
+// counting instead of stalling requests.
+const redisTimeout = 100 * time.Millisecond
+
+// Redis is a Limiter whose counters are shared by all replicas. While Redis
+// can't be reached, requests are counted locally instead, so limits still
+// apply per replica rather than not at all.
+type Redis struct {
+	client   *redis.Client
+	fallback *Local
+	down     atomic.Bool
+}
+
+// NewRedis returns a limiter counting in the Redis at url, a redis:// or
+// rediss:// URL. Redis doesn't have to be reachable yet.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: redis.NewClient(opts), fallback: NewLocal()}, nil
+}
+
+func (r *Redis) Allow(key string, limit int, window time.Duration) Result {
+	index, reset := windowAt(time.Now(), window)
+	redisKey := fmt.Sprintf("%s%s:%d:%d", redisKeyPrefix, key, window.Milliseconds(), index)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	pipe := r.client.TxPipeline()
+	count := pipe.Incr(ctx, redisKey)
+	// The key names its window, so it only has to outlive it
+	pipe.PExpire(ctx, redisKey, reset+time.Second)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.failed(err)
+		return r.fallback.Allow(key, limit, window)
+	}
+	r.recovered()
+	return result(count.Val(), limit, reset)
+}
+
+func (r *Redis) Block(key string, d time.Duration) {
+	// Blocks are also kept locally, so they survive Redis going away
+	r.fallback.Block(key, d)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Set(ctx, redisKeyPrefix+"blocked:"+key, "1", d).Err(); err != nil {
+		r.failed(err)
+		return
+	}
+	r.recovered()
+}
+
+func (r *Redis) Blocked(key string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	ttl, err := r.client.PTTL(ctx, redisKeyPrefix+"blocked:"+key).Result()
+	if err != nil {
+		r.failed(err)
+		return r.fallback.Blocked(key)
+	}
+	r.recovered()
+	if ttl < 0 { // No such key, or one without expiry
+		return 0
+	}
+	return ttl
+}
+
+// failed switches to local counting, logging only the first failure.
+func (r *Redis) failed(err error) {
+	if !r.down.Swap(true) {
+		log.Printf("RateLimit: Redis unavailable, counting requests locally: %v", err)
+	}
+}
+
+// recovered switches back to counting in Redis.
+func (r *Redis) recovered() {
+	if r.down.Swap(false) {
+		log.Println("RateLimit: Redis is back, counting requests in Redis again")
+	}
+}
+
+// Close closes the connection pool.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,198 @@
+package renderer
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"prerender-url-shortener/internal/config"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// defaultBlocklist is used when RENDER_BLOCKLIST_FILE is not set. It covers the
+// most common analytics beacons and ad networks.
+//
+//go:embed blocklist_default.txt
+var defaultBlocklist string
+
+// blocklist is a parsed EasyList-style filter list. Only network rules are
+// supported: "||host^" domain anchors, "|" start/end anchors, "*" wildcards and
+// "^" separators, with "@@" marking exceptions. Rule options after "$" are
+// ignored, and cosmetic rules ("##", "#@#") are skipped since they don't affect
+// which requests are made.
+type blocklist struct {
+	blockedHosts   map[string]bool
+	blockedRules   []*regexp.Regexp
+	exceptionHosts map[string]bool
+	exceptionRules []*regexp.Regexp
+	ruleCount      int
+}
+
+// hostAnchorRule matches rules that block a whole host, e.g. "||example.com^".
+var hostAnchorRule = regexp.MustCompile(`^\|\|([a-z0-9.-]+)\^?$`)
+
+// parseBlocklist reads filter rules from r, skipping comments and unsupported rules.
+func parseBlocklist(r io.Reader) (*blocklist, error) {
+	bl := &blocklist{
+		blockedHosts:   make(map[string]bool),
+		exceptionHosts: make(map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		if strings.Contains(line, "##") || strings.Contains(line, "#@#") || strings.Contains(line, "#?#") {
+			continue
+		}
+
+		hosts, rules := bl.blockedHosts, &bl.blockedRules
+		if strings.HasPrefix(line, "@@") {
+			hosts, rules = bl.exceptionHosts, &bl.exceptionRules
+			line = line[2:]
+		}
+		if i := strings.LastIndexByte(line, '$'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.ToLower(line)
+		if line == "" || line == "*" {
+			continue
+		}
+
+		if m := hostAnchorRule.FindStringSubmatch(line); m != nil {
+			hosts[m[1]] = true
+		} else {
+			re, err := regexp.Compile(filterToRegexp(line))
+			if err != nil {
+				continue
+			}
+			*rules = append(*rules, re)
+		}
+		bl.ruleCount++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+// filterToRegexp converts a single network filter to an equivalent regular expression.
+func filterToRegexp(filter string) string {
+	var sb strings.Builder
+	switch {
+	case strings.HasPrefix(filter, "||"):
+		sb.WriteString(`^[a-z][a-z0-9+.-]*://([^/?#]*\.)?`)
+		filter = filter[2:]
+	case strings.HasPrefix(filter, "|"):
+		sb.WriteString("^")
+		filter = filter[1:]
+	}
+	anchoredEnd := strings.HasSuffix(filter, "|")
+	filter = strings.TrimSuffix(filter, "|")
+
+	for _, r := range filter {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '^':
+			sb.WriteString(`(?:[^a-z0-9_.%-]|$)`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if anchoredEnd {
+		sb.WriteString("$")
+	}
+	return sb.String()
+}
+
+// blocks reports whether a request to rawURL should be blocked.
+func (bl *blocklist) blocks(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	lowerURL := strings.ToLower(rawURL)
+	host := strings.ToLower(u.Hostname())
+
+	if !matchesHost(bl.blockedHosts, host) && !matchesAny(bl.blockedRules, lowerURL) {
+		return false
+	}
+	return !matchesHost(bl.exceptionHosts, host) && !matchesAny(bl.exceptionRules, lowerURL)
+}
+
+// matchesHost reports whether host or any of its parent domains is in hosts.
+func matchesHost(hosts map[string]bool, host string) bool {
+	for host != "" {
+		if hosts[host] {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i == -1 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return false
+}
+
+func matchesAny(rules []*regexp.Regexp, s string) bool {
+	for _, re := range rules {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	blocklistMutex  sync.Mutex
+	blocklistSource string
+	blocklistCached *blocklist
+)
+
+// activeBlocklist returns the blocklist renders should use, or nil when tracker
+// blocking is disabled. The parsed list is cached until RENDER_BLOCKLIST_FILE changes.
+func activeBlocklist() (*blocklist, error) {
+	cfg := config.Get()
+	if !cfg.RenderBlockTrackers {
+		return nil, nil
+	}
+
+	blocklistMutex.Lock()
+	defer blocklistMutex.Unlock()
+
+	source := cfg.RenderBlocklistFile
+	if blocklistCached != nil && blocklistSource == source {
+		return blocklistCached, nil
+	}
+
+	var bl *blocklist
+	if source == "" {
+		var err error
+		if bl, err = parseBlocklist(strings.NewReader(defaultBlocklist)); err != nil {
+			return nil, fmt.Errorf("failed to parse built-in blocklist: %w", err)
+		}
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open blocklist %s: %w", source, err)
+		}
+		defer file.Close()
+		if bl, err = parseBlocklist(file); err != nil {
+			return nil, fmt.Errorf("failed to parse blocklist %s: %w", source, err)
+		}
+		log.Printf("Rod: Loaded %d blocklist rules from %s", bl.ruleCount, source)
+	}
+
+	blocklistSource = source
+	blocklistCached = bl
+	return bl, nil
+}
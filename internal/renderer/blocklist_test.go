@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklistBlocks(t *testing.T) {
+	rules := `! comment
+[Adblock Plus 2.0]
+||tracker.com^
+||ads.example.org^$third-party
+/pixel.gif|
+|https://cdn.example.net/analytics/*.js
+@@||ok.tracker.com^
+example.com##.ad-banner
+`
+	bl, err := parseBlocklist(strings.NewReader(rules))
+	require.NoError(t, err)
+	assert.Equal(t, 5, bl.ruleCount)
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://tracker.com/t.js", true},
+		{"https://www.tracker.com/collect?id=1", true},
+		{"https://nottracker.com/t.js", false},
+		{"https://ok.tracker.com/t.js", false},
+		{"https://ads.example.org/banner.js", true},
+		{"https://example.org/ads.example.org", false},
+		{"https://site.com/img/pixel.gif", true},
+		{"https://site.com/img/pixel.gif?x=1", false},
+		{"https://cdn.example.net/analytics/v2.js", true},
+		{"https://cdn.example.net/app.js", false},
+		{"https://example.com/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.blocked, bl.blocks(tt.url))
+		})
+	}
+}
+
+func TestDefaultBlocklist(t *testing.T) {
+	bl, err := parseBlocklist(strings.NewReader(defaultBlocklist))
+	require.NoError(t, err)
+	assert.True(t, bl.blocks("https://www.google-analytics.com/analytics.js"))
+	assert.True(t, bl.blocks("https://securepubads.g.doubleclick.net/tag/js/gpt.js"))
+	assert.False(t, bl.blocks("https://example.com/app.js"))
+}
+
+func TestActiveBlocklist(t *testing.T) {
+	config.Set(&config.Config{})
+	bl, err := activeBlocklist()
+	require.NoError(t, err)
+	assert.Nil(t, bl, "blocking is disabled by default")
+
+	path := filepath.Join(t.TempDir(), "list.txt")
+	require.NoError(t, os.WriteFile(path, []byte("||custom-tracker.io^\n"), 0o644))
+	config.Set(&config.Config{RenderBlockTrackers: true, RenderBlocklistFile: path})
+
+	bl, err = activeBlocklist()
+	require.NoError(t, err)
+	assert.True(t, bl.blocks("https://custom-tracker.io/x.js"))
+	assert.False(t, bl.blocks("https://www.google-analytics.com/analytics.js"), "custom list replaces the built-in one")
+
+	config.Get().RenderBlocklistFile = filepath.Join(t.TempDir(), "missing.txt")
+	_, err = activeBlocklist()
+	assert.Error(t, err)
+}
@@ -0,0 +1,363 @@
+package renderer
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/flags"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// managedBrowser is a launched Chrome process together with the bookkeeping
+// needed to decide when it should be recycled.
+type managedBrowser struct {
+	browser     *rod.Browser
+	launcher    *launcher.Launcher
+	launchedAt  time.Time
+	pagesServed int
+	activePages int
+	dedicated   bool // Closed after a single render instead of being shared
+	retiring    bool // No new pages; closed once activePages drops to zero
+	stopGuard   chan struct{}
+	killMutex   sync.Mutex
+	killReason  string // Set when the resource guard killed the browser
+}
+
+// launchBrowser starts a new Chrome process configured from the current config and connects to it.
+func launchBrowser() (*managedBrowser, error) {
+	cfg := config.Get()
+	l := launcher.New()
+	// Check if a custom rod binary path is specified
+	rodBinPath := cfg.RodBinPath
+	if rodBinPath != "" {
+		log.Printf("Rod: Using custom binary path: %s", rodBinPath)
+		l = l.Bin(rodBinPath)
+	} else {
+		// Use default launcher (will download browser if not found)
+		log.Printf("Rod: Using default browser launcher")
+	}
+	if cfg.RenderStealth {
+		// Stops Chrome from advertising itself as automation-controlled.
+		l = l.Set("disable-blink-features", "AutomationControlled")
+	}
+
+	l = applyDebugLaunchOptions(l)
+
+	log.Printf("Rod: Launching browser")
+	u, err := l.Launch()
+	if err != nil {
+		if rodBinPath != "" {
+			return nil, fmt.Errorf("failed to launch rod with custom path %s: %w", rodBinPath, err)
+		}
+		return nil, fmt.Errorf("failed to launch rod browser: %w", err)
+	}
+	log.Printf("Rod: Browser launched successfully (pid: %d)", l.PID())
+
+	browser := applyDebugBrowserOptions(rod.New().ControlURL(u))
+	log.Printf("Rod: Connecting to browser")
+	if err := browser.Connect(); err != nil {
+		l.Kill()
+		l.Cleanup()
+		return nil, fmt.Errorf("failed to connect to rod browser: %w", err)
+	}
+	log.Printf("Rod: Successfully connected to browser")
+
+	mb := &managedBrowser{
+		browser:    browser,
+		launcher:   l,
+		launchedAt: time.Now(),
+	}
+	if resourceGuardEnabled() {
+		mb.stopGuard = make(chan struct{})
+		go mb.guardResources(mb.stopGuard)
+	}
+	return mb, nil
+}
+
+// close shuts the browser down and removes its user data directory.
+func (mb *managedBrowser) close() {
+	log.Printf("Rod: Closing browser (pid: %d, pages served: %d)", mb.launcher.PID(), mb.pagesServed)
+	if mb.stopGuard != nil {
+		close(mb.stopGuard)
+	}
+	if err := mb.browser.Close(); err != nil {
+		log.Printf("Rod: Error closing browser, killing process: %v", err)
+		mb.launcher.Kill()
+	}
+	// Cleanup waits for the browser process to exit.
+	mb.launcher.Cleanup()
+	log.Printf("Rod: Browser closed")
+}
+
+// browserPool keeps a long-lived shared browser for BROWSER_POOL_ENABLED and
+// replaces it according to the configured recycling policies, since long-lived
+// Chromium processes slowly creep in memory.
+type browserPool struct {
+	mutex         sync.Mutex
+	current       *managedBrowser
+	recycledCount int
+	lastRecycle   string
+}
+
+var sharedBrowserPool = &browserPool{}
+
+// acquireBrowser returns the browser a render should use: the shared pooled
+// browser when pooling is enabled, otherwise a freshly launched dedicated one.
+// Every successful call must be paired with releaseBrowser.
+func acquireBrowser() (*managedBrowser, error) {
+	if !flags.Enabled(flags.BrowserPool) {
+		mb, err := launchBrowser()
+		if err != nil {
+			return nil, err
+		}
+		mb.dedicated = true
+		return mb, nil
+	}
+	return sharedBrowserPool.acquire()
+}
+
+// releaseBrowser returns a browser obtained from acquireBrowser.
+func releaseBrowser(mb *managedBrowser) {
+	if mb.dedicated {
+		mb.close()
+		return
+	}
+	sharedBrowserPool.release(mb)
+}
+
+func (bp *browserPool) acquire() (*managedBrowser, error) {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	if bp.current != nil {
+		if reason := recycleReason(bp.current); reason != "" {
+			bp.retireLocked(reason)
+		}
+	}
+
+	if bp.current == nil {
+		mb, err := launchBrowser()
+		if err != nil {
+			return nil, err
+		}
+		bp.current = mb
+		log.Printf("BrowserPool: Launched new shared browser (pid: %d)", mb.launcher.PID())
+	}
+
+	bp.current.activePages++
+	return bp.current, nil
+}
+
+func (bp *browserPool) release(mb *managedBrowser) {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	mb.activePages--
+	mb.pagesServed++
+
+	if mb == bp.current {
+		if reason := recycleReason(mb); reason != "" {
+			bp.retireLocked(reason)
+		}
+		return
+	}
+
+	// A browser retired while this page was still open is closed by its last user.
+	if mb.retiring && mb.activePages == 0 {
+		go mb.close()
+	}
+}
+
+// retireLocked stops handing out the current browser. It is closed right away if
+// idle, otherwise when its last in-flight render releases it. Callers hold bp.mutex.
+func (bp *browserPool) retireLocked(reason string) {
+	mb := bp.current
+	bp.current = nil
+	mb.retiring = true
+	bp.recycledCount++
+	bp.lastRecycle = reason
+	log.Printf("BrowserPool: Recycling browser (pid: %d): %s", mb.launcher.PID(), reason)
+	if mb.activePages == 0 {
+		go mb.close()
+	}
+}
+
+// shutdown closes the shared browser, if any.
+func (bp *browserPool) shutdown() {
+	bp.mutex.Lock()
+	mb := bp.current
+	bp.current = nil
+	bp.mutex.Unlock()
+
+	if mb != nil {
+		mb.close()
+	}
+}
+
+// status reports the shared browser's state for the /status endpoint.
+func (bp *browserPool) status() map[string]interface{} {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	status := map[string]interface{}{
+		"enabled":        flags.Enabled(flags.BrowserPool),
+		"recycled_count": bp.recycledCount,
+		"last_recycle":   bp.lastRecycle,
+		"running":        bp.current != nil,
+	}
+	if bp.current != nil {
+		status["pid"] = bp.current.launcher.PID()
+		status["age_seconds"] = int(time.Since(bp.current.launchedAt).Seconds())
+		status["pages_served"] = bp.current.pagesServed
+		status["active_pages"] = bp.current.activePages
+	}
+	return status
+}
+
+// GetBrowserPoolStatus returns the state of the shared browser pool.
+func GetBrowserPoolStatus() map[string]interface{} {
+	return sharedBrowserPool.status()
+}
+
+// recycleReason checks a browser against the configured recycling policies and
+// returns a human-readable reason if it should be replaced, or "" otherwise.
+// A zero limit disables the corresponding policy.
+func recycleReason(mb *managedBrowser) string {
+	if reason := mb.killedReason(); reason != "" {
+		return "killed by resource guard: " + reason
+	}
+	cfg := config.Get()
+	if cfg.BrowserMaxPages > 0 && mb.pagesServed >= cfg.BrowserMaxPages {
+		return fmt.Sprintf("served %d pages (limit %d)", mb.pagesServed, cfg.BrowserMaxPages)
+	}
+	maxAge := time.Duration(cfg.BrowserMaxAgeMinutes) * time.Minute
+	if maxAge > 0 && time.Since(mb.launchedAt) >= maxAge {
+		return fmt.Sprintf("running for %v (limit %v)", time.Since(mb.launchedAt).Round(time.Second), maxAge)
+	}
+	if cfg.BrowserMaxRSSMB > 0 {
+		usage, err := processTreeUsage(mb.launcher.PID())
+		if err != nil {
+			log.Printf("BrowserPool: Unable to read browser memory usage: %v", err)
+		} else if rssMB := usage.RSSBytes / (1024 * 1024); rssMB >= int64(cfg.BrowserMaxRSSMB) {
+			return fmt.Sprintf("using %d MB RSS (limit %d MB)", rssMB, cfg.BrowserMaxRSSMB)
+		}
+	}
+	return ""
+}
+
+// processUsage is the combined resource usage of a process tree.
+type processUsage struct {
+	RSSBytes int64
+	CPUTicks int64 // user+system CPU time in clock ticks
+}
+
+// processTreeUsage sums the resident memory and CPU time of a process and all of
+// its descendants. Chrome spreads a browser across many processes, so the root
+// process alone badly understates its footprint. Only supported where /proc exists.
+func processTreeUsage(rootPID int) (processUsage, error) {
+	if rootPID <= 0 {
+		return processUsage{}, fmt.Errorf("invalid pid %d", rootPID)
+	}
+	statFiles, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil || len(statFiles) == 0 {
+		return processUsage{}, fmt.Errorf("process information unavailable")
+	}
+
+	children := make(map[int][]int)
+	cpuTicks := make(map[int]int64)
+	for _, statFile := range statFiles {
+		stat, ok := readProcStat(statFile)
+		if ok {
+			children[stat.ppid] = append(children[stat.ppid], stat.pid)
+			cpuTicks[stat.pid] = stat.cpuTicks
+		}
+	}
+
+	var usage processUsage
+	pending := []int{rootPID}
+	for len(pending) > 0 {
+		pid := pending[0]
+		pending = pending[1:]
+		rss, err := readRSS(pid)
+		if err == nil {
+			usage.RSSBytes += rss
+		}
+		usage.CPUTicks += cpuTicks[pid]
+		pending = append(pending, children[pid]...)
+	}
+	return usage, nil
+}
+
+// procStat holds the fields of /proc/<pid>/stat this package cares about.
+type procStat struct {
+	pid      int
+	ppid     int
+	cpuTicks int64
+}
+
+// readProcStat parses a /proc/<pid>/stat file.
+func readProcStat(statFile string) (procStat, bool) {
+	data, err := os.ReadFile(statFile)
+	if err != nil {
+		return procStat{}, false
+	}
+	// The command name is parenthesised and may contain spaces, so parse after it.
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end == -1 {
+		return procStat{}, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:strings.IndexByte(stat, ' ')]))
+	if err != nil {
+		return procStat{}, false
+	}
+	// Fields after the command start at field 3 (state); ppid is field 4,
+	// utime and stime are fields 14 and 15.
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return procStat{}, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, false
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	return procStat{pid: pid, ppid: ppid, cpuTicks: utime + stime}, true
+}
+
+// readRSS returns the resident set size of a process in bytes.
+func readRSS(pid int) (int64, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmRSS:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			break
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	return 0, fmt.Errorf("VmRSS not found for pid %d", pid)
+}
@@ -0,0 +1,101 @@
+package renderer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecycleReason(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxPages      int
+		maxAgeMinutes int
+		pagesServed   int
+		age           time.Duration
+		wantRecycle   bool
+	}{
+		{
+			name:          "within limits",
+			maxPages:      10,
+			maxAgeMinutes: 60,
+			pagesServed:   5,
+			age:           time.Minute,
+			wantRecycle:   false,
+		},
+		{
+			name:          "page limit reached",
+			maxPages:      10,
+			maxAgeMinutes: 60,
+			pagesServed:   10,
+			age:           time.Minute,
+			wantRecycle:   true,
+		},
+		{
+			name:          "age limit reached",
+			maxPages:      10,
+			maxAgeMinutes: 60,
+			pagesServed:   1,
+			age:           61 * time.Minute,
+			wantRecycle:   true,
+		},
+		{
+			name:          "limits disabled",
+			maxPages:      0,
+			maxAgeMinutes: 0,
+			pagesServed:   1000,
+			age:           24 * time.Hour,
+			wantRecycle:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{
+				BrowserMaxPages:      tt.maxPages,
+				BrowserMaxAgeMinutes: tt.maxAgeMinutes,
+			})
+			mb := &managedBrowser{
+				launchedAt:  time.Now().Add(-tt.age),
+				pagesServed: tt.pagesServed,
+			}
+
+			reason := recycleReason(mb)
+			if tt.wantRecycle {
+				assert.NotEmpty(t, reason)
+			} else {
+				assert.Empty(t, reason)
+			}
+		})
+	}
+}
+
+func TestProcessTreeUsage(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("/proc not available on this platform")
+	}
+
+	usage, err := processTreeUsage(os.Getpid())
+	assert.NoError(t, err)
+	assert.Greater(t, usage.RSSBytes, int64(0))
+	assert.GreaterOrEqual(t, usage.CPUTicks, int64(0))
+
+	_, err = processTreeUsage(0)
+	assert.Error(t, err)
+}
+
+func TestReadProcStat(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc not available on this platform")
+	}
+
+	stat, ok := readProcStat(fmt.Sprintf("/proc/%d/stat", os.Getpid()))
+	assert.True(t, ok)
+	assert.Equal(t, os.Getpid(), stat.pid)
+	assert.Equal(t, os.Getppid(), stat.ppid)
+}
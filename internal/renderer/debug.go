@@ -0,0 +1,133 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"prerender-url-shortener/internal/config"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// applyDebugLaunchOptions switches the launcher to a visible browser with devtools
+// open when RENDER_HEADFUL is set, for debugging problematic pages locally.
+func applyDebugLaunchOptions(l *launcher.Launcher) *launcher.Launcher {
+	if !config.Get().RenderHeadful {
+		return l
+	}
+	log.Printf("Rod: Launching headful browser with devtools for debugging")
+	return l.Headless(false).Devtools(true)
+}
+
+// applyDebugBrowserOptions slows every browser action down by RENDER_SLOW_MOTION_MS
+// so they can be followed by eye, and traces them to the log.
+func applyDebugBrowserOptions(browser *rod.Browser) *rod.Browser {
+	delay := time.Duration(config.Get().RenderSlowMotionMs) * time.Millisecond
+	if delay <= 0 {
+		return browser
+	}
+	log.Printf("Rod: Slow motion enabled (%v per action)", delay)
+	return browser.SlowMotion(delay).Trace(true)
+}
+
+// consoleRecorder collects a page's console output and uncaught exceptions so they
+// can be written out when a render fails.
+type consoleRecorder struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+// recordConsole starts collecting console messages from page until ctx is done.
+// It returns nil when RENDER_DEBUG_DUMP_DIR is not set, so nothing is collected.
+func recordConsole(ctx context.Context, page *rod.Page) *consoleRecorder {
+	if config.Get().RenderDebugDumpDir == "" {
+		return nil
+	}
+	recorder := &consoleRecorder{}
+	go page.Context(ctx).EachEvent(func(e *proto.RuntimeConsoleAPICalled) {
+		args := make([]string, 0, len(e.Args))
+		for _, arg := range e.Args {
+			if arg.Description != "" {
+				args = append(args, arg.Description)
+			} else {
+				args = append(args, arg.Value.String())
+			}
+		}
+		recorder.add(fmt.Sprintf("[%s] %s", e.Type, strings.Join(args, " ")))
+	}, func(e *proto.RuntimeExceptionThrown) {
+		text := e.ExceptionDetails.Text
+		if e.ExceptionDetails.Exception != nil && e.ExceptionDetails.Exception.Description != "" {
+			text = e.ExceptionDetails.Exception.Description
+		}
+		recorder.add("[exception] " + text)
+	})()
+	return recorder
+}
+
+func (cr *consoleRecorder) add(line string) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.lines = append(cr.lines, line)
+}
+
+func (cr *consoleRecorder) String() string {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	return strings.Join(cr.lines, "\n")
+}
+
+// dumpFailure writes a screenshot, the page's console output, and the error to a
+// new directory under RENDER_DEBUG_DUMP_DIR. Errors are logged, not returned,
+// since a failed dump must not mask the render failure itself.
+func dumpFailure(page *rod.Page, targetURL string, console *consoleRecorder, renderErr error) {
+	baseDir := config.Get().RenderDebugDumpDir
+	if baseDir == "" {
+		return
+	}
+
+	dir := filepath.Join(baseDir, dumpDirName(targetURL, time.Now()))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Rod: Failed to create debug dump directory %s: %v", dir, err)
+		return
+	}
+
+	errorText := fmt.Sprintf("URL: %s\nError: %v\n", targetURL, renderErr)
+	if err := os.WriteFile(filepath.Join(dir, "error.txt"), []byte(errorText), 0o644); err != nil {
+		log.Printf("Rod: Failed to write error dump for %s: %v", targetURL, err)
+	}
+
+	if console != nil {
+		if err := os.WriteFile(filepath.Join(dir, "console.log"), []byte(console.String()), 0o644); err != nil {
+			log.Printf("Rod: Failed to write console dump for %s: %v", targetURL, err)
+		}
+	}
+
+	screenshot, err := page.Timeout(10*time.Second).Screenshot(true, nil)
+	if err != nil {
+		log.Printf("Rod: Failed to capture failure screenshot for %s: %v", targetURL, err)
+	} else if err := os.WriteFile(filepath.Join(dir, "screenshot.png"), screenshot, 0o644); err != nil {
+		log.Printf("Rod: Failed to write failure screenshot for %s: %v", targetURL, err)
+	}
+
+	log.Printf("Rod: Wrote failure dump for %s to %s", targetURL, dir)
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// dumpDirName builds a sortable, filesystem-safe directory name for a failure dump.
+func dumpDirName(targetURL string, at time.Time) string {
+	host := "unknown"
+	if parsed, err := url.Parse(targetURL); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+	return at.UTC().Format("20060102T150405.000Z") + "-" + unsafePathChars.ReplaceAllString(host, "_")
+}
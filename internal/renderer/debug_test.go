@@ -0,0 +1,36 @@
+package renderer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpDirName(t *testing.T) {
+	at := time.Date(2024, 3, 15, 10, 30, 45, 123000000, time.UTC)
+
+	tests := []struct {
+		name      string
+		targetURL string
+		expected  string
+	}{
+		{"plain host", "https://example.com/page?q=1", "20240315T103045.123Z-example.com"},
+		{"host with port", "http://localhost:3000/", "20240315T103045.123Z-localhost"},
+		{"unparseable URL", "://bad url", "20240315T103045.123Z-unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, dumpDirName(tt.targetURL, at))
+		})
+	}
+}
+
+func TestConsoleRecorder(t *testing.T) {
+	recorder := &consoleRecorder{}
+	recorder.add("[log] hello")
+	recorder.add("[exception] TypeError: x is undefined")
+
+	assert.Equal(t, "[log] hello\n[exception] TypeError: x is undefined", recorder.String())
+}
@@ -0,0 +1,168 @@
+package renderer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// RenderOptions controls how the browser presents itself to the target page.
+// Empty fields leave the browser's defaults in place.
+type RenderOptions struct {
+	AcceptLanguage string // Accept-Language header and navigator.languages, e.g. "de-DE,de;q=0.9"
+	Locale         string // JS/ICU locale, e.g. "de-DE"
+	Timezone       string // IANA timezone, e.g. "Europe/Berlin"
+	Geolocation    *Geolocation
+}
+
+// Geolocation is the position reported to the page through navigator.geolocation.
+type Geolocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy"` // In meters; 0 is treated as 100
+}
+
+// RenderProfile is a named set of render options from RENDER_PROFILES, typically
+// one per target market, e.g.
+//
+//	{"de": {"accept_language": "de-DE,de;q=0.9", "locale": "de-DE",
+//	        "timezone": "Europe/Berlin", "geolocation": {"latitude": 52.52, "longitude": 13.405}}}
+type RenderProfile struct {
+	AcceptLanguage string       `json:"accept_language"`
+	Locale         string       `json:"locale"`
+	Timezone       string       `json:"timezone"`
+	Geolocation    *Geolocation `json:"geolocation"`
+}
+
+// LookupRenderProfile returns the RENDER_PROFILES entry with the given name.
+func LookupRenderProfile(name string) (RenderProfile, bool) {
+	cfg := config.Get()
+	if cfg.RenderProfiles == "" {
+		return RenderProfile{}, false
+	}
+	var profiles map[string]RenderProfile
+	if err := json.Unmarshal([]byte(cfg.RenderProfiles), &profiles); err != nil {
+		log.Printf("Rod: Ignoring invalid RENDER_PROFILES: %v", err)
+		return RenderProfile{}, false
+	}
+	profile, ok := profiles[name]
+	return profile, ok
+}
+
+// RenderOptionsForLink resolves the options a link should be rendered with:
+// values stored on the link win over its render profile, which wins over the
+// global RENDER_* defaults.
+func RenderOptionsForLink(link *db.Link) RenderOptions {
+	cfg := config.Get()
+	opts := RenderOptions{
+		AcceptLanguage: cfg.RenderAcceptLanguage,
+		Locale:         cfg.RenderLocale,
+		Timezone:       cfg.RenderTimezone,
+	}
+	if link == nil {
+		return opts
+	}
+	if link.RenderProfile != "" {
+		profile, ok := LookupRenderProfile(link.RenderProfile)
+		if !ok {
+			log.Printf("Rod: Render profile %q of link %s not found, using defaults", link.RenderProfile, link.ShortCode)
+		}
+		if profile.AcceptLanguage != "" {
+			opts.AcceptLanguage = profile.AcceptLanguage
+		}
+		if profile.Locale != "" {
+			opts.Locale = profile.Locale
+		}
+		if profile.Timezone != "" {
+			opts.Timezone = profile.Timezone
+		}
+		opts.Geolocation = profile.Geolocation
+	}
+	if link.AcceptLanguage != "" {
+		opts.AcceptLanguage = link.AcceptLanguage
+	}
+	if link.Locale != "" {
+		opts.Locale = link.Locale
+	}
+	if link.Timezone != "" {
+		opts.Timezone = link.Timezone
+	}
+	return opts
+}
+
+// applyEmulation configures the page's user agent, language, locale, timezone and
+// geolocation before navigation. In stealth mode the headless marker is also removed from the
+// user agent; otherwise the browser's own user agent is kept as-is.
+func applyEmulation(browser *rod.Browser, page *rod.Page, opts RenderOptions) error {
+	cfg := config.Get()
+	acceptLanguage := opts.AcceptLanguage
+	if acceptLanguage == "" && cfg.RenderStealth {
+		// A missing Accept-Language is itself a headless giveaway.
+		acceptLanguage = "en-US,en;q=0.9"
+	}
+
+	if acceptLanguage != "" || cfg.RenderStealth {
+		version, err := proto.BrowserGetVersion{}.Call(browser)
+		if err != nil {
+			return fmt.Errorf("failed to read browser version: %w", err)
+		}
+		userAgent := version.UserAgent
+		if cfg.RenderStealth {
+			userAgent = strings.ReplaceAll(userAgent, "HeadlessChrome", "Chrome")
+		}
+		err = page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+			UserAgent:      userAgent,
+			AcceptLanguage: acceptLanguage,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to override user agent: %w", err)
+		}
+	}
+
+	if opts.Locale != "" {
+		if err := (proto.EmulationSetLocaleOverride{Locale: opts.Locale}).Call(page); err != nil {
+			return fmt.Errorf("failed to set locale %q: %w", opts.Locale, err)
+		}
+	}
+
+	if opts.Timezone != "" {
+		if err := (proto.EmulationSetTimezoneOverride{TimezoneID: opts.Timezone}).Call(page); err != nil {
+			return fmt.Errorf("failed to set timezone %q: %w", opts.Timezone, err)
+		}
+	}
+
+	if geo := opts.Geolocation; geo != nil {
+		// Without the permission, navigator.geolocation would prompt and never resolve.
+		err := proto.BrowserGrantPermissions{
+			Permissions:      []proto.BrowserPermissionType{proto.BrowserPermissionTypeGeolocation},
+			BrowserContextID: browser.BrowserContextID,
+		}.Call(browser)
+		if err != nil {
+			return fmt.Errorf("failed to grant geolocation permission: %w", err)
+		}
+		accuracy := geo.Accuracy
+		if accuracy <= 0 {
+			accuracy = 100
+		}
+		err = proto.EmulationSetGeolocationOverride{
+			Latitude:  &geo.Latitude,
+			Longitude: &geo.Longitude,
+			Accuracy:  &accuracy,
+		}.Call(page)
+		if err != nil {
+			return fmt.Errorf("failed to set geolocation: %w", err)
+		}
+		log.Printf("Rod: Emulating geolocation %.4f,%.4f (accuracy %.0fm)", geo.Latitude, geo.Longitude, accuracy)
+	}
+
+	if opts.AcceptLanguage != "" || opts.Locale != "" || opts.Timezone != "" {
+		log.Printf("Rod: Emulating accept-language=%q locale=%q timezone=%q", acceptLanguage, opts.Locale, opts.Timezone)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package renderer
+
+import (
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderOptionsForLink(t *testing.T) {
+	config.Set(&config.Config{
+		RenderAcceptLanguage: "en-US,en;q=0.9",
+		RenderLocale:         "en-US",
+		RenderTimezone:       "America/New_York",
+		RenderProfiles:       `{"de": {"locale": "de-DE", "timezone": "Europe/Berlin", "geolocation": {"latitude": 52.52, "longitude": 13.405}}}`,
+	})
+
+	tests := []struct {
+		name     string
+		link     *db.Link
+		expected RenderOptions
+	}{
+		{
+			name: "no link uses global defaults",
+			link: nil,
+			expected: RenderOptions{
+				AcceptLanguage: "en-US,en;q=0.9",
+				Locale:         "en-US",
+				Timezone:       "America/New_York",
+			},
+		},
+		{
+			name: "link without overrides uses global defaults",
+			link: &db.Link{},
+			expected: RenderOptions{
+				AcceptLanguage: "en-US,en;q=0.9",
+				Locale:         "en-US",
+				Timezone:       "America/New_York",
+			},
+		},
+		{
+			name: "link overrides win",
+			link: &db.Link{
+				AcceptLanguage: "de-DE,de;q=0.9",
+				Locale:         "de-DE",
+			},
+			expected: RenderOptions{
+				AcceptLanguage: "de-DE,de;q=0.9",
+				Locale:         "de-DE",
+				Timezone:       "America/New_York",
+			},
+		},
+		{
+			name: "profile overrides global defaults",
+			link: &db.Link{RenderProfile: "de"},
+			expected: RenderOptions{
+				AcceptLanguage: "en-US,en;q=0.9",
+				Locale:         "de-DE",
+				Timezone:       "Europe/Berlin",
+				Geolocation:    &Geolocation{Latitude: 52.52, Longitude: 13.405},
+			},
+		},
+		{
+			name: "link overrides win over profile",
+			link: &db.Link{RenderProfile: "de", Locale: "de-AT", Timezone: "Europe/Vienna"},
+			expected: RenderOptions{
+				AcceptLanguage: "en-US,en;q=0.9",
+				Locale:         "de-AT",
+				Timezone:       "Europe/Vienna",
+				Geolocation:    &Geolocation{Latitude: 52.52, Longitude: 13.405},
+			},
+		},
+		{
+			name: "unknown profile uses global defaults",
+			link: &db.Link{RenderProfile: "fr"},
+			expected: RenderOptions{
+				AcceptLanguage: "en-US,en;q=0.9",
+				Locale:         "en-US",
+				Timezone:       "America/New_York",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RenderOptionsForLink(tt.link))
+		})
+	}
+}
+
+func TestLookupRenderProfile(t *testing.T) {
+	config.Set(&config.Config{RenderProfiles: `{"us": {"geolocation": {"latitude": 40.71, "longitude": -74.0, "accuracy": 50}}}`})
+
+	profile, ok := LookupRenderProfile("us")
+	assert.True(t, ok)
+	assert.Equal(t, &Geolocation{Latitude: 40.71, Longitude: -74.0, Accuracy: 50}, profile.Geolocation)
+
+	_, ok = LookupRenderProfile("de")
+	assert.False(t, ok)
+
+	config.Get().RenderProfiles = "not json"
+	_, ok = LookupRenderProfile("us")
+	assert.False(t, ok)
+}
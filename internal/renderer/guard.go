@@ -0,0 +1,112 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"prerender-url-shortener/internal/config"
+	"time"
+)
+
+// ErrResourceLimit marks renders that failed because their browser was killed for
+// exceeding RENDER_MAX_MEMORY_MB or RENDER_MAX_CPU_PERCENT. The page itself may be
+// fine, so workers retry these jobs instead of marking the link failed.
+var ErrResourceLimit = errors.New("browser killed for exceeding resource limits")
+
+// clockTicksPerSecond is Linux's USER_HZ, the unit of CPU times in /proc/<pid>/stat.
+const clockTicksPerSecond = 100
+
+// cpuLimitSamples is how many consecutive samples must exceed the CPU limit before
+// the browser is killed, so short bursts during page load don't trip the guard.
+const cpuLimitSamples = 3
+
+// resourceGuardEnabled reports whether any resource limit is configured.
+func resourceGuardEnabled() bool {
+	cfg := config.Get()
+	return cfg.RenderMaxMemoryMB > 0 || cfg.RenderMaxCPUPercent > 0
+}
+
+// guardResources samples the browser's process tree until stop is closed and kills
+// the browser if it exceeds the configured memory or CPU limits. Killing it makes
+// any in-flight CDP calls fail, which renderWithRod reports as ErrResourceLimit.
+func (mb *managedBrowser) guardResources(stop <-chan struct{}) {
+	interval := time.Duration(config.Get().RenderResourceCheckSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pid := mb.launcher.PID()
+	lastSample := time.Now()
+	lastTicks := int64(-1)
+	cpuViolations := 0
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		usage, err := processTreeUsage(pid)
+		if err != nil {
+			log.Printf("Guard: Unable to sample resource usage for browser pid %d, stopping guard: %v", pid, err)
+			return
+		}
+		now := time.Now()
+
+		if limit := config.Get().RenderMaxMemoryMB; limit > 0 {
+			if rssMB := usage.RSSBytes / (1024 * 1024); rssMB > int64(limit) {
+				mb.kill(fmt.Sprintf("memory usage %d MB exceeded limit of %d MB", rssMB, limit))
+				return
+			}
+		}
+
+		if limit := config.Get().RenderMaxCPUPercent; limit > 0 && lastTicks >= 0 {
+			elapsed := now.Sub(lastSample).Seconds()
+			cpuPercent := cpuPercentBetween(lastTicks, usage.CPUTicks, elapsed)
+			if cpuPercent > float64(limit) {
+				cpuViolations++
+				log.Printf("Guard: Browser pid %d using %.0f%% CPU (limit %d%%, %d/%d samples)", pid, cpuPercent, limit, cpuViolations, cpuLimitSamples)
+				if cpuViolations >= cpuLimitSamples {
+					mb.kill(fmt.Sprintf("CPU usage %.0f%% exceeded limit of %d%%", cpuPercent, limit))
+					return
+				}
+			} else {
+				cpuViolations = 0
+			}
+		}
+
+		lastSample = now
+		lastTicks = usage.CPUTicks
+	}
+}
+
+// cpuPercentBetween converts the CPU ticks consumed over a wall-clock interval into
+// a percentage of one core. Multi-process browsers can exceed 100%.
+func cpuPercentBetween(previousTicks, currentTicks int64, elapsedSeconds float64) float64 {
+	if elapsedSeconds <= 0 || currentTicks < previousTicks {
+		return 0
+	}
+	cpuSeconds := float64(currentTicks-previousTicks) / clockTicksPerSecond
+	return cpuSeconds / elapsedSeconds * 100
+}
+
+// kill terminates the browser process and records why, so renders using it fail
+// with ErrResourceLimit and the pool replaces it.
+func (mb *managedBrowser) kill(reason string) {
+	mb.killMutex.Lock()
+	mb.killReason = reason
+	mb.killMutex.Unlock()
+
+	log.Printf("Guard: Killing browser pid %d: %s", mb.launcher.PID(), reason)
+	mb.launcher.Kill()
+}
+
+// killedReason returns why the guard killed the browser, or "" if it didn't.
+func (mb *managedBrowser) killedReason() string {
+	mb.killMutex.Lock()
+	defer mb.killMutex.Unlock()
+	return mb.killReason
+}
@@ -0,0 +1,57 @@
+package renderer
+
+import (
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPUPercentBetween(t *testing.T) {
+	tests := []struct {
+		name          string
+		previousTicks int64
+		currentTicks  int64
+		elapsed       float64
+		expected      float64
+	}{
+		{"idle", 100, 100, 5, 0},
+		{"one core saturated", 0, 500, 5, 100},
+		{"two cores saturated", 0, 1000, 5, 200},
+		{"half a core", 200, 450, 5, 50},
+		{"no elapsed time", 0, 100, 0, 0},
+		{"counter went backwards", 500, 100, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, cpuPercentBetween(tt.previousTicks, tt.currentTicks, tt.elapsed), 0.001)
+		})
+	}
+}
+
+func TestResourceGuardEnabled(t *testing.T) {
+	config.Set(&config.Config{})
+	assert.False(t, resourceGuardEnabled())
+
+	config.Set(&config.Config{RenderMaxMemoryMB: 1024})
+	assert.True(t, resourceGuardEnabled())
+
+	config.Set(&config.Config{RenderMaxCPUPercent: 150})
+	assert.True(t, resourceGuardEnabled())
+}
+
+func TestKilledBrowserIsRecycled(t *testing.T) {
+	config.Set(&config.Config{})
+	mb := &managedBrowser{}
+	assert.Empty(t, mb.killedReason())
+	assert.Empty(t, recycleReason(mb))
+
+	mb.killMutex.Lock()
+	mb.killReason = "memory usage 2048 MB exceeded limit of 1024 MB"
+	mb.killMutex.Unlock()
+
+	assert.Equal(t, "memory usage 2048 MB exceeded limit of 1024 MB", mb.killedReason())
+	assert.Contains(t, recycleReason(mb), "killed by resource guard")
+}
@@ -0,0 +1,139 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/shortener"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ErrTargetNotAllowed marks renders whose page navigated, directly or through a
+// redirect, to an internal address while SSRF_PROTECTION is on.
+var ErrTargetNotAllowed = errors.New("target address is not allowed")
+
+// hostLookupTimeout bounds the DNS lookup made to check a request's host.
+const hostLookupTimeout = 5 * time.Second
+
+// requestFilter intercepts a page's requests, failing those to trackers on the
+// blocklist and those to internal addresses.
+type requestFilter struct {
+	router          *rod.HijackRouter
+	blocklist       *blocklist // nil when tracker blocking is disabled
+	checkHosts      bool
+	allowedNetworks string
+	targetHost      string
+
+	mutex      sync.Mutex
+	hostErrors map[string]error // shortener.CheckHost results, so each host is resolved once per render
+	refused    string           // First navigation refused for targeting an internal address
+}
+
+// filterRequests intercepts the page's requests. Those matching the blocklist
+// are failed so analytics and ad scripts neither run nor end up in the snapshot,
+// though navigations to the target's own host are never blocked. With
+// SSRF_PROTECTION, requests whose host resolves to an internal address are failed
+// too: checking each request rather than only the submitted URL also covers
+// redirects, subresources, fetches made by page scripts and hosts whose DNS
+// changed since the link was created. The returned filter must be stopped when
+// the render is done; it is nil when neither check is enabled.
+func filterRequests(page *rod.Page, targetURL string) (*requestFilter, error) {
+	cfg := config.Get()
+	bl, err := activeBlocklist()
+	if err != nil {
+		return nil, err
+	}
+	if bl == nil && !cfg.SSRFProtection {
+		return nil, nil
+	}
+
+	f := &requestFilter{
+		blocklist:       bl,
+		checkHosts:      cfg.SSRFProtection,
+		allowedNetworks: cfg.SSRFAllowedNetworks,
+		hostErrors:      make(map[string]error),
+	}
+	if parsed, err := url.Parse(targetURL); err == nil {
+		f.targetHost = parsed.Hostname()
+	}
+
+	f.router = page.HijackRequests()
+	if err := f.router.Add("*", "", f.handle); err != nil {
+		return nil, fmt.Errorf("failed to intercept requests: %w", err)
+	}
+	go f.router.Run()
+	return f, nil
+}
+
+// handle decides a single intercepted request. The router calls it concurrently.
+func (f *requestFilter) handle(ctx *rod.Hijack) {
+	reqURL := ctx.Request.URL()
+	if f.checkHosts {
+		if err := f.checkHost(reqURL); err != nil {
+			log.Printf("Rod: Refusing request to %s: %v", reqURL, err)
+			if ctx.Request.IsNavigation() {
+				f.mutex.Lock()
+				if f.refused == "" {
+					f.refused = reqURL.String()
+				}
+				f.mutex.Unlock()
+			}
+			ctx.Response.Fail(proto.NetworkErrorReasonAccessDenied)
+			return
+		}
+	}
+	if f.blocklist != nil && !(ctx.Request.IsNavigation() && reqURL.Hostname() == f.targetHost) && f.blocklist.blocks(reqURL.String()) {
+		ctx.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+		return
+	}
+	ctx.ContinueRequest(&proto.FetchContinueRequest{})
+}
+
+// checkHost returns the shortener.CheckHost verdict for reqURL's host. Hosts that
+// can't be resolved are refused as well. Only http and https requests reach the
+// network; data: and blob: URLs are served by the browser itself.
+func (f *requestFilter) checkHost(reqURL *url.URL) error {
+	if reqURL.Scheme != "http" && reqURL.Scheme != "https" {
+		return nil
+	}
+	host := reqURL.Hostname()
+
+	f.mutex.Lock()
+	err, checked := f.hostErrors[host]
+	f.mutex.Unlock()
+	if checked {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hostLookupTimeout)
+	defer cancel()
+	err = shortener.CheckHost(ctx, host, f.allowedNetworks)
+
+	f.mutex.Lock()
+	f.hostErrors[host] = err
+	f.mutex.Unlock()
+	return err
+}
+
+// refusedNavigation returns the first navigation refused for targeting an
+// internal address, or "" if there was none.
+func (f *requestFilter) refusedNavigation() string {
+	if f == nil {
+		return ""
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.refused
+}
+
+// stop ends the interception.
+func (f *requestFilter) stop() error {
+	return f.router.Stop()
+}
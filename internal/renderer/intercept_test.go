@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/shortener"
+
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestFilterCheckHost(t *testing.T) {
+	f := &requestFilter{checkHosts: true, allowedNetworks: "10.0.0.0/8", hostErrors: make(map[string]error)}
+
+	tests := []struct {
+		url     string
+		refused bool
+	}{
+		{"https://93.184.216.34/app.js", false},
+		{"http://127.0.0.1:8080/admin", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://[::1]/", true},
+		{"http://192.168.1.1/", true},
+		{"http://10.1.2.3/", false},
+		{"data:text/plain,hello", false},
+		{"blob:https://example.com/0b6a5f0e", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		require.NoError(t, err)
+		err = f.checkHost(u)
+		assert.Equal(t, tt.refused, errors.As(err, new(*shortener.TargetError)), "%s: %v", tt.url, err)
+	}
+	assert.Len(t, f.hostErrors, 6)
+}
+
+func TestRenderRefusesRedirectToInternalAddress(t *testing.T) {
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no Chrome or Chromium binary found")
+	}
+
+	// 127.0.0.2 stands in for an internal service, e.g. cloud metadata
+	internalListener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.2: %v", err)
+	}
+	var internalHit atomic.Bool
+	internal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalHit.Store(true)
+		w.Write([]byte("secret"))
+	}))
+	internal.Listener.Close()
+	internal.Listener = internalListener
+	internal.Start()
+	defer internal.Close()
+
+	public := httptest.NewServer(http.RedirectHandler(internal.URL+"/latest/meta-data/", http.StatusFound))
+	defer public.Close()
+
+	// The "public" site listens on loopback as well, so exempt exactly its address
+	config.Set(&config.Config{
+		RodBinPath:           bin,
+		RenderTimeoutSeconds: 60,
+		SSRFProtection:       true,
+		SSRFAllowedNetworks:  "127.0.0.1/32",
+	})
+	_, err = RenderPageWithRod(public.URL, RenderOptions{})
+	assert.ErrorIs(t, err, ErrTargetNotAllowed)
+	assert.False(t, internalHit.Load(), "the browser reached the internal server")
+}
@@ -1,8 +1,14 @@
 package renderer
 
 import (
+	"context"
+	"errors"
 	"log"
+	"prerender-url-shortener/internal/cdn"
+	"prerender-url-shortener/internal/config"
 	"prerender-url-shortener/internal/db"
+	"prerender-url-shortener/internal/notify"
+	"prerender-url-shortener/internal/webhook"
 	"sync"
 	"time"
 )
@@ -11,15 +17,35 @@ import (
 type RenderJob struct {
 	ShortCode   string
 	OriginalURL string
+	Attempt     int  // Number of earlier attempts that failed with a retryable error
+	Claimed     bool // Already claimed in the database, by pollRequests
 }
 
 // RenderQueue manages the rendering queue and prevents duplicate work
 type RenderQueue struct {
 	jobs        chan RenderJob
-	inProgress  map[string]bool        // Track URLs currently being rendered
-	waiting     map[string][]chan bool // Track goroutines waiting for specific URLs
+	inProgress  map[string]string      // URLs currently being rendered, by short code
+	waiting     map[string][]chan bool // Goroutines waiting for a render, by short code
 	mutex       sync.RWMutex
 	workerCount int
+	closed      bool // Set by StopAccepting; no more jobs may be sent once the channel is closed
+
+	// While paused, see Pause, resumed is the channel Resume closes to let the
+	// workers start jobs again. It is nil while not paused.
+	resumed  chan struct{}
+	pausedAt time.Time
+
+	// Shutdown waits for the workers, persisting the jobs they haven't started
+	// and, past RENDER_SHUTDOWN_TIMEOUT_SECONDS, the ones they are rendering.
+	workers   sync.WaitGroup
+	running   map[int]RenderJob // Job each worker is rendering, by worker ID
+	stopping  bool              // Set by Shutdown; queued jobs are persisted instead of rendered
+	abandoned bool              // Set when Shutdown gave up waiting; late results aren't saved
+
+	// Without workers, the short codes of the links in progress, whose renders
+	// were requested from other replicas. See InitRemoteRenderQueue.
+	remote map[string]bool
+	quit   chan struct{} // Closed by Shutdown to stop background polling
 }
 
 var GlobalRenderQueue *RenderQueue
@@ -28,34 +54,48 @@ var GlobalRenderQueue *RenderQueue
 func InitRenderQueue(workerCount int) {
 	GlobalRenderQueue = &RenderQueue{
 		jobs:        make(chan RenderJob, 100), // Buffer for 100 jobs
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: workerCount,
+		running:     make(map[int]RenderJob),
+		quit:        make(chan struct{}),
 	}
 
 	// Start worker goroutines
 	for i := 0; i < workerCount; i++ {
-		go GlobalRenderQueue.worker(i)
+		GlobalRenderQueue.startWorker(i)
 	}
 
 	log.Printf("Initialized render queue with %d workers", workerCount)
 }
 
-// QueueRender adds a job to the rendering queue or waits if already in progress
+// QueueRender adds a job to the rendering queue unless the link is already in
+// progress. Jobs are tracked by short code: links of different tenants, or
+// aliases, sharing a URL each get their own render.
 func (rq *RenderQueue) QueueRender(shortCode, originalURL string) {
+	if rq.remote != nil {
+		rq.requestRender(shortCode, originalURL)
+		return
+	}
+
 	rq.mutex.Lock()
 	defer rq.mutex.Unlock()
 
 	log.Printf("Queue: Attempting to queue render job for URL: %s (short code: %s)", originalURL, shortCode)
 
-	// Check if this URL is already being rendered
-	if rq.inProgress[originalURL] {
-		log.Printf("Queue: URL %s is already being rendered, not queuing duplicate", originalURL)
+	if rq.closed {
+		rq.persistRender(shortCode, originalURL)
+		return
+	}
+
+	// Check if this link is already being rendered
+	if _, ok := rq.inProgress[shortCode]; ok {
+		log.Printf("Queue: %s is already being rendered, not queuing duplicate", shortCode)
 		return
 	}
 
 	// Mark as in progress and queue the job
-	rq.inProgress[originalURL] = true
+	rq.inProgress[shortCode] = originalURL
 
 	queueLength := len(rq.jobs)
 	log.Printf("Queue: Current queue length: %d before adding new job", queueLength)
@@ -64,118 +104,220 @@ func (rq *RenderQueue) QueueRender(shortCode, originalURL string) {
 	case rq.jobs <- RenderJob{ShortCode: shortCode, OriginalURL: originalURL}:
 		log.Printf("Queue: Successfully queued rendering job for URL: %s (short code: %s)", originalURL, shortCode)
 	default:
-		log.Printf("Queue: Render queue is full (capacity: 100), dropping job for URL: %s", originalURL)
-		// Clean up in-progress status if we can't queue
-		delete(rq.inProgress, originalURL)
+		// Left in the database for the workers to poll once they are idle,
+		// rather than dropped with the link stuck in pending
+		delete(rq.inProgress, shortCode)
+		notify.QueueSaturated(cap(rq.jobs))
+		if err := db.RequestRender(shortCode); err != nil {
+			log.Printf("Queue: Render queue is full (capacity: %d), failed to request a render of URL: %s: %v", cap(rq.jobs), originalURL, err)
+			return
+		}
+		log.Printf("Queue: Render queue is full (capacity: %d), requested a render of URL: %s (short code: %s) for when a worker is idle", cap(rq.jobs), originalURL, shortCode)
 	}
 }
 
-// WaitForRender waits for a URL to be rendered if it's already in progress
-func (rq *RenderQueue) WaitForRender(originalURL string, timeout time.Duration) bool {
-	log.Printf("Queue: Checking if should wait for URL: %s (timeout: %v)", originalURL, timeout)
+// Saturated reports whether the render queue is full, so renders queued now
+// wait in the database until a worker is idle. Without workers, renders are
+// always requested through the database and the queue is never full.
+func (rq *RenderQueue) Saturated() bool {
+	if rq.remote != nil {
+		return false
+	}
+	return len(rq.jobs) == cap(rq.jobs)
+}
+
+// WaitForRender waits for the render of a link if it's already in progress
+func (rq *RenderQueue) WaitForRender(shortCode string, timeout time.Duration) bool {
+	return rq.WaitForRenderContext(context.Background(), shortCode, timeout)
+}
+
+// WaitForRenderContext is WaitForRender, except that it gives up once ctx is
+// done, e.g. when the client waiting for the render disconnected.
+func (rq *RenderQueue) WaitForRenderContext(ctx context.Context, shortCode string, timeout time.Duration) bool {
+	log.Printf("Queue: Checking if should wait for %s (timeout: %v)", shortCode, timeout)
 
 	rq.mutex.Lock()
 
 	// If not in progress, return immediately
-	if !rq.inProgress[originalURL] {
+	if _, ok := rq.inProgress[shortCode]; !ok {
 		rq.mutex.Unlock()
-		log.Printf("Queue: URL %s is not in progress, no need to wait", originalURL)
+		log.Printf("Queue: %s is not in progress, no need to wait", shortCode)
 		return false
 	}
 
 	// Create a channel to wait on
 	waitChan := make(chan bool, 1)
-	rq.waiting[originalURL] = append(rq.waiting[originalURL], waitChan)
-	currentWaiters := len(rq.waiting[originalURL])
+	rq.waiting[shortCode] = append(rq.waiting[shortCode], waitChan)
+	currentWaiters := len(rq.waiting[shortCode])
 	rq.mutex.Unlock()
 
-	log.Printf("Queue: Added to waiting list for URL %s (total waiters: %d), starting wait...", originalURL, currentWaiters)
+	log.Printf("Queue: Added to waiting list for %s (total waiters: %d), starting wait...", shortCode, currentWaiters)
 
-	// Wait for completion or timeout
+	// Wait for completion, timeout or cancellation
 	select {
 	case <-waitChan:
-		log.Printf("Queue: Wait completed successfully for URL: %s", originalURL)
+		log.Printf("Queue: Wait completed successfully for %s", shortCode)
 		return true
 	case <-time.After(timeout):
-		log.Printf("Queue: Wait timeout after %v for URL: %s, cleaning up", timeout, originalURL)
-		// Remove ourselves from the waiting list
-		rq.mutex.Lock()
-		waiters := rq.waiting[originalURL]
-		for i, ch := range waiters {
-			if ch == waitChan {
-				rq.waiting[originalURL] = append(waiters[:i], waiters[i+1:]...)
-				log.Printf("Queue: Removed timed-out waiter from list for URL: %s", originalURL)
-				break
-			}
+		log.Printf("Queue: Wait timeout after %v for %s, cleaning up", timeout, shortCode)
+	case <-ctx.Done():
+		log.Printf("Queue: Wait cancelled for %s (%v), cleaning up", shortCode, ctx.Err())
+	}
+
+	// Remove ourselves from the waiting list
+	rq.mutex.Lock()
+	waiters := rq.waiting[shortCode]
+	for i, ch := range waiters {
+		if ch == waitChan {
+			rq.waiting[shortCode] = append(waiters[:i], waiters[i+1:]...)
+			log.Printf("Queue: Removed waiter that gave up from list for %s", shortCode)
+			break
 		}
-		rq.mutex.Unlock()
-		return false
 	}
+	rq.mutex.Unlock()
+	return false
+}
+
+// startWorker starts a worker goroutine, counted for Shutdown to wait for.
+func (rq *RenderQueue) startWorker(id int) {
+	rq.workers.Add(1)
+	go rq.worker(id)
 }
 
 // worker processes rendering jobs
 func (rq *RenderQueue) worker(id int) {
+	defer rq.workers.Done()
 	log.Printf("Render worker %d started", id)
 
 	for job := range rq.jobs {
+		rq.waitWhilePaused()
+		rq.mutex.Lock()
+		if rq.stopping {
+			rq.persistQueuedLocked(id, job)
+			rq.mutex.Unlock()
+			continue
+		}
+		rq.running[id] = job
+		rq.mutex.Unlock()
+
 		startTime := time.Now()
 		log.Printf("Worker %d: Starting job for URL: %s (short code: %s)", id, job.OriginalURL, job.ShortCode)
 
-		// Update status to rendering
-		log.Printf("Worker %d: Updating database status to 'rendering' for %s", id, job.ShortCode)
-		if err := db.UpdateLinkRenderStatus(job.ShortCode, db.RenderStatusRendering); err != nil {
-			log.Printf("Worker %d: Failed to update status to rendering for %s: %v", id, job.ShortCode, err)
+		// Claim the link in the database so another replica, or this one after a
+		// restart, doesn't render the same URL concurrently
+		if job.Claimed {
+			log.Printf("Worker %d: %s was claimed when polled, status is 'rendering'", id, job.ShortCode)
+		} else if claimed, err := db.ClaimLinkForRender(job.ShortCode, renderClaimTimeout()); err != nil {
+			log.Printf("Worker %d: Failed to claim %s, rendering anyway: %v", id, job.ShortCode, err)
+		} else if !claimed {
+			log.Printf("Worker %d: %s is already being rendered elsewhere, skipping", id, job.ShortCode)
+			rq.mutex.Lock()
+			rq.finishLocked(id, job.ShortCode)
+			rq.mutex.Unlock()
+			continue
+		} else {
+			log.Printf("Worker %d: Successfully claimed %s, status is now 'rendering'", id, job.ShortCode)
+		}
+
+		webhook.Send(webhook.Event{
+			Type:        webhook.EventRenderStarted,
+			ShortCode:   job.ShortCode,
+			OriginalURL: job.OriginalURL,
+			WorkerID:    id,
+		})
+
+		// Per-link render options are read at render time so the latest values are used
+		var opts RenderOptions
+		rendered := false // Whether a snapshot the CDN may hold is replaced
+		if link, linkErr := db.GetLinkByShortCode(job.ShortCode); linkErr == nil {
+			opts = RenderOptionsForLink(link)
+			rendered = link.RenderedAt != nil
 		} else {
-			log.Printf("Worker %d: Successfully updated status to 'rendering' for %s", id, job.ShortCode)
+			log.Printf("Worker %d: Failed to load render options for %s, using defaults: %v", id, job.ShortCode, linkErr)
+			opts = RenderOptionsForLink(nil)
 		}
 
 		// Perform the actual rendering
 		log.Printf("Worker %d: Starting Rod rendering for URL: %s", id, job.OriginalURL)
 		renderStartTime := time.Now()
-		htmlContent, err := RenderPageWithRod(job.OriginalURL)
+		result, err := RenderPageWithRod(job.OriginalURL, opts)
 		renderDuration := time.Since(renderStartTime)
 
+		if err != nil && errors.Is(err, ErrResourceLimit) && job.Attempt < config.Get().RenderMaxRetries {
+			log.Printf("Worker %d: Render of %s hit resource limits after %v (attempt %d), retrying: %v", id, job.OriginalURL, renderDuration, job.Attempt+1, err)
+			if rq.retry(id, job, err) {
+				webhook.Send(webhook.Event{
+					Type:             webhook.EventRenderFailed,
+					ShortCode:        job.ShortCode,
+					OriginalURL:      job.OriginalURL,
+					WorkerID:         id,
+					RenderDurationMs: renderDuration.Milliseconds(),
+					TotalDurationMs:  time.Since(startTime).Milliseconds(),
+					Error:            err.Error(),
+					WillRetry:        true,
+				})
+				continue
+			}
+			log.Printf("Worker %d: Could not requeue %s for retry, marking as failed", id, job.OriginalURL)
+		}
+
 		rq.mutex.Lock()
 
+		if rq.abandoned {
+			log.Printf("Worker %d: Finished %s after the shutdown timeout, leaving it to be rendered again", id, job.OriginalURL)
+			rq.finishLocked(id, job.ShortCode)
+			rq.mutex.Unlock()
+			continue
+		}
+
 		if err != nil {
 			log.Printf("Worker %d: Failed to render %s after %v: %v", id, job.OriginalURL, renderDuration, err)
-			// Update status to failed
+			// Update status to failed, keeping the error for the API
 			log.Printf("Worker %d: Updating database status to 'failed' for %s", id, job.ShortCode)
-			if dbErr := db.UpdateLinkContent(job.ShortCode, "", db.RenderStatusFailed); dbErr != nil {
+			if dbErr := db.SaveRenderFailure(job.ShortCode, err.Error(), false); dbErr != nil {
 				log.Printf("Worker %d: Failed to update status to failed for %s: %v", id, job.ShortCode, dbErr)
 			} else {
 				log.Printf("Worker %d: Successfully updated status to 'failed' for %s", id, job.ShortCode)
 			}
+			notify.RenderFailed(job.ShortCode, job.OriginalURL, err)
 		} else {
-			log.Printf("Worker %d: Successfully rendered %s in %v (HTML length: %d)", id, job.OriginalURL, renderDuration, len(htmlContent))
+			log.Printf("Worker %d: Successfully rendered %s in %v (HTML length: %d, status: %d)", id, job.OriginalURL, renderDuration, len(result.HTML), result.StatusCode)
 			// Update with rendered content
 			log.Printf("Worker %d: Saving rendered content to database for %s", id, job.ShortCode)
-			if dbErr := db.UpdateLinkContent(job.ShortCode, htmlContent, db.RenderStatusCompleted); dbErr != nil {
+			if dbErr := db.SaveRenderResult(job.ShortCode, &db.RenderResult{
+				HTMLContent:      result.HTML,
+				TargetStatusCode: result.StatusCode,
+				FinalURL:         result.FinalURL,
+				RedirectChain:    result.RedirectChain,
+				Duration:         renderDuration,
+			}); dbErr != nil {
 				log.Printf("Worker %d: Failed to save rendered content for %s: %v", id, job.ShortCode, dbErr)
 			} else {
 				log.Printf("Worker %d: Successfully saved rendered content for %s", id, job.ShortCode)
-			}
-		}
-
-		// Notify waiting goroutines
-		waiters := rq.waiting[job.OriginalURL]
-		if len(waiters) > 0 {
-			log.Printf("Worker %d: Notifying %d waiting goroutines for URL %s", id, len(waiters), job.OriginalURL)
-			for i, waitChan := range waiters {
-				select {
-				case waitChan <- true:
-					log.Printf("Worker %d: Notified waiter %d for URL %s", id, i+1, job.OriginalURL)
-				default:
-					log.Printf("Worker %d: Failed to notify waiter %d for URL %s (channel full)", id, i+1, job.OriginalURL)
+				if rendered {
+					cdn.Purge(job.ShortCode)
 				}
 			}
 		}
-		delete(rq.waiting, job.OriginalURL)
 
-		// Mark as no longer in progress
-		delete(rq.inProgress, job.OriginalURL)
-		log.Printf("Worker %d: Marked URL %s as no longer in progress", id, job.OriginalURL)
+		event := webhook.Event{
+			ShortCode:        job.ShortCode,
+			OriginalURL:      job.OriginalURL,
+			WorkerID:         id,
+			RenderDurationMs: renderDuration.Milliseconds(),
+			TotalDurationMs:  time.Since(startTime).Milliseconds(),
+		}
+		if err != nil {
+			event.Type = webhook.EventRenderFailed
+			event.Error = err.Error()
+		} else {
+			event.Type = webhook.EventRenderSucceeded
+			event.TargetStatusCode = result.StatusCode
+			event.HTMLLength = len(result.HTML)
+		}
+		webhook.Send(event)
 
+		rq.finishLocked(id, job.ShortCode)
 		rq.mutex.Unlock()
 
 		totalDuration := time.Since(startTime)
@@ -185,11 +327,72 @@ func (rq *RenderQueue) worker(id int) {
 	log.Printf("Render worker %d stopped (jobs channel closed)", id)
 }
 
-// IsInProgress checks if a URL is currently being rendered
-func (rq *RenderQueue) IsInProgress(originalURL string) bool {
+// finishLocked notifies goroutines waiting on a link and marks it as no longer
+// in progress. Callers hold rq.mutex.
+func (rq *RenderQueue) finishLocked(id int, shortCode string) {
+	// Notify waiting goroutines
+	waiters := rq.waiting[shortCode]
+	if len(waiters) > 0 {
+		log.Printf("Worker %d: Notifying %d waiting goroutines for %s", id, len(waiters), shortCode)
+		for i, waitChan := range waiters {
+			select {
+			case waitChan <- true:
+				log.Printf("Worker %d: Notified waiter %d for %s", id, i+1, shortCode)
+			default:
+				log.Printf("Worker %d: Failed to notify waiter %d for %s (channel full)", id, i+1, shortCode)
+			}
+		}
+	}
+	delete(rq.waiting, shortCode)
+
+	// Mark as no longer in progress
+	delete(rq.inProgress, shortCode)
+	delete(rq.running, id)
+	log.Printf("Worker %d: Marked %s as no longer in progress", id, shortCode)
+}
+
+// renderClaimTimeout is how long a worker's claim on a link is honoured. It
+// comfortably exceeds the render timeout so only claims of dead workers expire.
+func renderClaimTimeout() time.Duration {
+	return 2 * time.Duration(config.Get().RenderTimeoutSeconds) * time.Second
+}
+
+// retry puts a job back on the queue after a retryable failure, recording the
+// failure on the link. The link stays marked in progress so waiters keep
+// waiting for the retried render. Once the queue stopped accepting jobs, the
+// retry is requested through the database instead and the link is done here.
+func (rq *RenderQueue) retry(id int, job RenderJob, renderErr error) bool {
+	job.Attempt++
+	job.Claimed = false // The link is pending again until the retry claims it
+	if err := db.SaveRenderFailure(job.ShortCode, renderErr.Error(), true); err != nil {
+		log.Printf("Queue: Failed to reset status to pending for retry of %s: %v", job.ShortCode, err)
+	}
+
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	if rq.closed {
+		if !rq.persistRender(job.ShortCode, job.OriginalURL) {
+			return false
+		}
+		rq.finishLocked(id, job.ShortCode)
+		return true
+	}
+	select {
+	case rq.jobs <- job:
+		delete(rq.running, id)
+		log.Printf("Queue: Requeued %s for retry (attempt %d)", job.OriginalURL, job.Attempt+1)
+		return true
+	default:
+		return false
+	}
+}
+
+// IsInProgress checks if a link is currently being rendered
+func (rq *RenderQueue) IsInProgress(shortCode string) bool {
 	rq.mutex.RLock()
 	defer rq.mutex.RUnlock()
-	return rq.inProgress[originalURL]
+	_, ok := rq.inProgress[shortCode]
+	return ok
 }
 
 // GetStatus returns the current status of the render queue
@@ -198,7 +401,7 @@ func (rq *RenderQueue) GetStatus() map[string]interface{} {
 	defer rq.mutex.RUnlock()
 
 	inProgressURLs := make([]string, 0, len(rq.inProgress))
-	for url := range rq.inProgress {
+	for _, url := range rq.inProgress {
 		inProgressURLs = append(inProgressURLs, url)
 	}
 
@@ -207,17 +410,158 @@ func (rq *RenderQueue) GetStatus() map[string]interface{} {
 		waitingCount += len(waiters)
 	}
 
-	return map[string]interface{}{
+	mode := "local"
+	if rq.remote != nil {
+		mode = "remote"
+	}
+	status := map[string]interface{}{
+		"mode":               mode,
 		"worker_count":       rq.workerCount,
 		"queue_length":       len(rq.jobs),
 		"in_progress_count":  len(rq.inProgress),
 		"in_progress_urls":   inProgressURLs,
 		"waiting_goroutines": waitingCount,
+		"paused":             rq.resumed != nil,
+	}
+	if rq.resumed != nil {
+		status["paused_since"] = rq.pausedAt
 	}
+	return status
 }
 
-// Shutdown gracefully shuts down the render queue
-func (rq *RenderQueue) Shutdown() {
+// Pause stops the workers from starting render jobs, e.g. while the sites
+// they render are being deployed, without shutting down. Renders already
+// running finish. New jobs are still queued, and renders requested through the
+// database left there, until Resume. It reports false if the queue was already
+// paused.
+func (rq *RenderQueue) Pause() bool {
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	if rq.resumed != nil {
+		return false
+	}
+	rq.resumed, rq.pausedAt = make(chan struct{}), time.Now()
+	log.Println("Render queue paused")
+	return true
+}
+
+// Resume lets the workers start render jobs again after Pause. It reports
+// false if the queue wasn't paused.
+func (rq *RenderQueue) Resume() bool {
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	if rq.resumed == nil {
+		return false
+	}
+	close(rq.resumed)
+	log.Printf("Render queue resumed after %v", time.Since(rq.pausedAt).Round(time.Second))
+	rq.resumed, rq.pausedAt = nil, time.Time{}
+	return true
+}
+
+// HasWorkers reports whether the queue renders with workers of its own, rather
+// than requesting renders from other replicas.
+func (rq *RenderQueue) HasWorkers() bool {
+	return rq.remote == nil
+}
+
+// waitWhilePaused holds a worker back while the queue is paused, until Resume
+// or Shutdown.
+func (rq *RenderQueue) waitWhilePaused() {
+	rq.mutex.RLock()
+	resumed := rq.resumed
+	rq.mutex.RUnlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-rq.quit:
+	}
+}
+
+// StopAccepting closes the queue to new jobs while the workers finish the ones
+// already queued, e.g. while the replica drains before exiting. Renders queued
+// from then on are requested from other replicas through the database, or from
+// this one after a restart.
+func (rq *RenderQueue) StopAccepting() {
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	if rq.closed {
+		return
+	}
+	rq.closed = true
 	close(rq.jobs)
+	log.Println("Render queue stopped accepting jobs")
+}
+
+// Shutdown gracefully shuts down the render queue, so that no job is lost on a
+// deploy: the jobs still queued are handed back to the database as render
+// requests, and the workers get up to RENDER_SHUTDOWN_TIMEOUT_SECONDS to finish
+// the renders they started. Renders still running then are requested again
+// too, before the browsers are closed.
+func (rq *RenderQueue) Shutdown() {
+	rq.StopAccepting()
+	rq.mutex.Lock()
+	rq.stopping = true
+	rq.mutex.Unlock()
+	if rq.quit != nil {
+		close(rq.quit)
+	}
 	log.Println("Render queue shutdown initiated")
+
+	if rq.workerCount > 0 {
+		done := make(chan struct{})
+		go func() {
+			rq.workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			log.Println("Render queue: All workers finished")
+		case <-time.After(time.Duration(config.Get().RenderShutdownTimeoutSeconds) * time.Second):
+			rq.abandonRunning()
+		}
+	}
+	sharedBrowserPool.shutdown()
+}
+
+// persistQueuedLocked hands a job a worker hasn't started by shutdown back to
+// the database, as a pending render request. Callers hold rq.mutex.
+func (rq *RenderQueue) persistQueuedLocked(id int, job RenderJob) {
+	if job.Claimed {
+		if err := db.ReleaseRenderClaim(job.ShortCode); err != nil {
+			log.Printf("Queue: Shutting down, failed to release the claim on %s: %v", job.ShortCode, err)
+		} else {
+			log.Printf("Queue: Shutting down, released queued render of URL: %s (short code: %s)", job.OriginalURL, job.ShortCode)
+		}
+	} else {
+		rq.persistRender(job.ShortCode, job.OriginalURL)
+	}
+	rq.finishLocked(id, job.ShortCode)
+}
+
+// abandonRunning releases the links the workers are still rendering after the
+// shutdown timeout, setting them back to pending render requests.
+func (rq *RenderQueue) abandonRunning() {
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	rq.abandoned = true
+	for id, job := range rq.running {
+		log.Printf("Queue: Worker %d still rendering %s at the shutdown timeout, requesting it again", id, job.OriginalURL)
+		if err := db.ReleaseRenderClaim(job.ShortCode); err != nil {
+			log.Printf("Queue: Failed to release the claim on %s: %v", job.ShortCode, err)
+		}
+	}
+}
+
+// persistRender requests a render from the database rather than this closed
+// queue, so the job survives the shutdown.
+func (rq *RenderQueue) persistRender(shortCode, originalURL string) bool {
+	if err := db.RequestRender(shortCode); err != nil {
+		log.Printf("Queue: Shutting down, failed to persist render job for URL: %s: %v", originalURL, err)
+		return false
+	}
+	log.Printf("Queue: Shutting down, requested a render of URL: %s (short code: %s) from other replicas", originalURL, shortCode)
+	return true
 }
@@ -1,12 +1,19 @@
 package renderer
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // Mock renderer function for testing
@@ -31,14 +38,15 @@ func TestInitRenderQueue(t *testing.T) {
 			// Create a new queue for each test
 			queue := &RenderQueue{
 				jobs:        make(chan RenderJob, 100),
-				inProgress:  make(map[string]bool),
+				inProgress:  make(map[string]string),
 				waiting:     make(map[string][]chan bool),
 				workerCount: tt.workerCount,
+				running:     make(map[int]RenderJob),
 			}
 
 			// Start workers (without using the global variable)
 			for i := 0; i < tt.workerCount; i++ {
-				go queue.worker(i)
+				queue.startWorker(i)
 			}
 
 			assert.Equal(t, tt.workerCount, queue.workerCount)
@@ -55,7 +63,7 @@ func TestInitRenderQueue(t *testing.T) {
 func TestQueueRender(t *testing.T) {
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 10),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 1,
 	}
@@ -75,13 +83,18 @@ func TestQueueRender(t *testing.T) {
 			setup:       func() {},
 		},
 		{
-			name:        "skip duplicate URL",
-			shortCode:   "DEF456",
-			originalURL: "https://example.com", // Same URL as above
+			name:        "skip duplicate link",
+			shortCode:   "ABC123",
+			originalURL: "https://example.com", // Same link as above
 			shouldQueue: false,
-			setup: func() {
-				queue.inProgress["https://example.com"] = true
-			},
+			setup:       func() {},
+		},
+		{
+			name:        "queue other link to the same URL",
+			shortCode:   "DEF456",
+			originalURL: "https://example.com", // Another tenant's link
+			shouldQueue: true,
+			setup:       func() {},
 		},
 	}
 
@@ -94,7 +107,7 @@ func TestQueueRender(t *testing.T) {
 
 			if tt.shouldQueue {
 				assert.Equal(t, initialQueueLength+1, len(queue.jobs))
-				assert.True(t, queue.inProgress[tt.originalURL])
+				assert.Equal(t, tt.originalURL, queue.inProgress[tt.shortCode])
 			} else {
 				assert.Equal(t, initialQueueLength, len(queue.jobs))
 			}
@@ -105,57 +118,107 @@ func TestQueueRender(t *testing.T) {
 	close(queue.jobs)
 }
 
+func TestQueueRenderSameURLForTwoTenants(t *testing.T) {
+	queue := &RenderQueue{
+		jobs:        make(chan RenderJob, 10),
+		inProgress:  make(map[string]string),
+		waiting:     make(map[string][]chan bool),
+		workerCount: 1,
+		running:     make(map[int]RenderJob),
+	}
+	defer close(queue.jobs)
+
+	// Each tenant has its own link to the URL, queued at the same time
+	var wg sync.WaitGroup
+	for _, shortCode := range []string{"ACME01", "BETA01"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queue.QueueRender(shortCode, "https://shared.com")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, len(queue.jobs), "neither link is dropped as a duplicate")
+	assert.True(t, queue.IsInProgress("ACME01"))
+	assert.True(t, queue.IsInProgress("BETA01"))
+
+	// Waiters of one link aren't released by the other's render
+	released := make(chan bool, 1)
+	go func() { released <- queue.WaitForRender("BETA01", 5*time.Second) }()
+	require.Eventually(t, func() bool {
+		queue.mutex.RLock()
+		defer queue.mutex.RUnlock()
+		return len(queue.waiting["BETA01"]) == 1
+	}, time.Second, time.Millisecond)
+
+	queue.mutex.Lock()
+	queue.finishLocked(0, "ACME01")
+	queue.mutex.Unlock()
+	select {
+	case <-released:
+		t.Fatal("the waiter was released by the other tenant's render")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.True(t, queue.IsInProgress("BETA01"))
+
+	queue.mutex.Lock()
+	queue.finishLocked(0, "BETA01")
+	queue.mutex.Unlock()
+	assert.True(t, <-released)
+}
+
 func TestIsInProgress(t *testing.T) {
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 10),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 1,
 	}
 
-	testURL := "https://test.com"
+	testCode := "TEST01"
 
 	// Initially not in progress
-	assert.False(t, queue.IsInProgress(testURL))
+	assert.False(t, queue.IsInProgress(testCode))
 
 	// Mark as in progress
 	queue.mutex.Lock()
-	queue.inProgress[testURL] = true
+	queue.inProgress[testCode] = "https://test.com"
 	queue.mutex.Unlock()
 
-	assert.True(t, queue.IsInProgress(testURL))
+	assert.True(t, queue.IsInProgress(testCode))
+	assert.False(t, queue.IsInProgress("TEST02"), "other links to the same URL are not")
 
 	// Remove from progress
 	queue.mutex.Lock()
-	delete(queue.inProgress, testURL)
+	delete(queue.inProgress, testCode)
 	queue.mutex.Unlock()
 
-	assert.False(t, queue.IsInProgress(testURL))
+	assert.False(t, queue.IsInProgress(testCode))
 }
 
 func TestWaitForRender(t *testing.T) {
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 10),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 1,
 	}
 
-	testURL := "https://waittest.com"
+	testCode := "WAIT01"
 
 	t.Run("not in progress", func(t *testing.T) {
-		result := queue.WaitForRender(testURL, 100*time.Millisecond)
+		result := queue.WaitForRender(testCode, 100*time.Millisecond)
 		assert.False(t, result)
 	})
 
 	t.Run("timeout while waiting", func(t *testing.T) {
 		// Mark as in progress
 		queue.mutex.Lock()
-		queue.inProgress[testURL] = true
+		queue.inProgress[testCode] = "https://waittest.com"
 		queue.mutex.Unlock()
 
 		start := time.Now()
-		result := queue.WaitForRender(testURL, 50*time.Millisecond)
+		result := queue.WaitForRender(testCode, 50*time.Millisecond)
 		elapsed := time.Since(start)
 
 		assert.False(t, result)
@@ -164,11 +227,11 @@ func TestWaitForRender(t *testing.T) {
 	})
 
 	t.Run("wait completes successfully", func(t *testing.T) {
-		testURL2 := "https://waittest2.com"
+		testCode2 := "WAIT02"
 
 		// Mark as in progress
 		queue.mutex.Lock()
-		queue.inProgress[testURL2] = true
+		queue.inProgress[testCode2] = "https://waittest2.com"
 		queue.mutex.Unlock()
 
 		// Start waiting in a goroutine
@@ -177,31 +240,49 @@ func TestWaitForRender(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			result = queue.WaitForRender(testURL2, 1*time.Second)
+			result = queue.WaitForRender(testCode2, 1*time.Second)
 		}()
 
 		// Wait a bit, then simulate completion
 		time.Sleep(10 * time.Millisecond)
 		queue.mutex.Lock()
-		waiters := queue.waiting[testURL2]
+		waiters := queue.waiting[testCode2]
 		if len(waiters) > 0 {
 			for _, waiter := range waiters {
 				waiter <- true
 			}
-			delete(queue.waiting, testURL2)
+			delete(queue.waiting, testCode2)
 		}
-		delete(queue.inProgress, testURL2)
+		delete(queue.inProgress, testCode2)
 		queue.mutex.Unlock()
 
 		wg.Wait()
 		assert.True(t, result)
 	})
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		testCode3 := "WAIT03"
+		queue.mutex.Lock()
+		queue.inProgress[testCode3] = "https://waittest3.com"
+		queue.mutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		result := queue.WaitForRenderContext(ctx, testCode3, time.Minute)
+
+		assert.False(t, result)
+		assert.Less(t, time.Since(start), time.Second)
+		queue.mutex.RLock()
+		assert.Empty(t, queue.waiting[testCode3], "the waiter is removed")
+		queue.mutex.RUnlock()
+	})
 }
 
 func TestGetStatus(t *testing.T) {
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 10),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 3,
 	}
@@ -210,10 +291,10 @@ func TestGetStatus(t *testing.T) {
 	queue.jobs <- RenderJob{ShortCode: "ABC", OriginalURL: "https://example1.com"}
 	queue.jobs <- RenderJob{ShortCode: "DEF", OriginalURL: "https://example2.com"}
 
-	queue.inProgress["https://inprogress1.com"] = true
-	queue.inProgress["https://inprogress2.com"] = true
+	queue.inProgress["GHI"] = "https://inprogress1.com"
+	queue.inProgress["JKL"] = "https://inprogress2.com"
 
-	queue.waiting["https://waiting.com"] = make([]chan bool, 2)
+	queue.waiting["MNO"] = make([]chan bool, 2)
 
 	status := queue.GetStatus()
 
@@ -243,9 +324,11 @@ func TestRenderJob(t *testing.T) {
 }
 
 func TestConcurrentQueueOperations(t *testing.T) {
+	setupSharedQueueDB(t) // Renders past the capacity are requested through it
+	config.Set(&config.Config{})
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 100),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 5,
 	}
@@ -265,7 +348,7 @@ func TestConcurrentQueueOperations(t *testing.T) {
 				url := fmt.Sprintf("https://example%d_%d.com", id, j)
 
 				queue.QueueRender(shortCode, url)
-				queue.IsInProgress(url)
+				queue.IsInProgress(shortCode)
 
 				// Simulate some work
 				time.Sleep(time.Millisecond)
@@ -284,36 +367,180 @@ func TestConcurrentQueueOperations(t *testing.T) {
 }
 
 func TestQueueCapacity(t *testing.T) {
+	setupSharedQueueDB(t)
+	config.Set(&config.Config{})
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "CODE3", OriginalURL: "https://example3.com", RenderStatus: db.RenderStatusPending}))
+
 	// Create queue with small capacity
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 2), // Small capacity
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 1,
 	}
 
 	// Fill the queue
 	queue.QueueRender("CODE1", "https://example1.com")
+	assert.False(t, queue.Saturated())
 	queue.QueueRender("CODE2", "https://example2.com")
 
 	assert.Equal(t, 2, len(queue.jobs))
 	assert.Equal(t, 2, len(queue.inProgress))
+	assert.True(t, queue.Saturated())
 
-	// Try to add one more (should be dropped)
+	// Try to add one more (should be requested through the database)
 	queue.QueueRender("CODE3", "https://example3.com")
 
-	// Queue should still be full, but the URL shouldn't be marked as in progress
+	// Queue should still be full, but the link shouldn't be marked as in progress
 	assert.Equal(t, 2, len(queue.jobs))
-	assert.False(t, queue.inProgress["https://example3.com"])
+	assert.False(t, queue.IsInProgress("CODE3"))
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1, "left for a worker to poll once idle")
+	assert.Equal(t, "CODE3", requests[0].ShortCode)
 
 	// Clean up
 	close(queue.jobs)
 }
 
+func TestRetry(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Migrate())
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:    "RETRY1",
+		OriginalURL:  "https://retry.com",
+		RenderStatus: db.RenderStatusRendering,
+	}))
+
+	queue := &RenderQueue{
+		jobs:        make(chan RenderJob, 1),
+		inProgress:  map[string]string{"RETRY1": "https://retry.com"},
+		waiting:     make(map[string][]chan bool),
+		workerCount: 1,
+	}
+
+	// Requeued with the attempt counter bumped and the link back to pending
+	assert.True(t, queue.retry(0, RenderJob{ShortCode: "RETRY1", OriginalURL: "https://retry.com"}, ErrResourceLimit))
+	job := <-queue.jobs
+	assert.Equal(t, 1, job.Attempt)
+	assert.True(t, queue.IsInProgress("RETRY1"))
+	link, err := db.GetLinkByShortCode("RETRY1")
+	require.NoError(t, err)
+	assert.Equal(t, db.RenderStatusPending, link.RenderStatus)
+	assert.Equal(t, ErrResourceLimit.Error(), link.LastRenderError)
+
+	// A full queue can't take the retry
+	queue.jobs <- RenderJob{ShortCode: "OTHER", OriginalURL: "https://other.com"}
+	assert.False(t, queue.retry(0, RenderJob{ShortCode: "RETRY1", OriginalURL: "https://retry.com"}, ErrResourceLimit))
+	<-queue.jobs
+
+	// A queue that stopped accepting jobs requests the retry through the
+	// database and lets the link go
+	queue.StopAccepting()
+	assert.True(t, queue.retry(0, RenderJob{ShortCode: "RETRY1", OriginalURL: "https://retry.com"}, ErrResourceLimit))
+	assert.False(t, queue.IsInProgress("RETRY1"))
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "RETRY1", requests[0].ShortCode)
+}
+
+func TestWorkerSkipsLinkClaimedElsewhere(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Migrate())
+	config.Set(&config.Config{RenderTimeoutSeconds: 90})
+
+	// Another replica claimed the link moments ago
+	claimedAt := time.Now()
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:       "CLAIMED1",
+		OriginalURL:     "https://claimed.com",
+		RenderStatus:    db.RenderStatusRendering,
+		RenderClaimedAt: &claimedAt,
+	}))
+
+	queue := &RenderQueue{
+		jobs:        make(chan RenderJob, 1),
+		inProgress:  make(map[string]string),
+		waiting:     make(map[string][]chan bool),
+		workerCount: 1,
+		running:     make(map[int]RenderJob),
+	}
+	defer close(queue.jobs)
+
+	queue.QueueRender("CLAIMED1", "https://claimed.com")
+	released := make(chan bool, 1)
+	go func() { released <- queue.WaitForRender("CLAIMED1", 5*time.Second) }()
+	require.Eventually(t, func() bool {
+		queue.mutex.RLock()
+		defer queue.mutex.RUnlock()
+		return len(queue.waiting["CLAIMED1"]) == 1
+	}, time.Second, time.Millisecond)
+
+	// Start the worker only once the waiter is registered
+	queue.startWorker(0)
+	assert.True(t, <-released, "waiters are released when the job is skipped")
+	assert.False(t, queue.IsInProgress("CLAIMED1"))
+
+	link, err := db.GetLinkByShortCode("CLAIMED1")
+	require.NoError(t, err)
+	assert.Equal(t, db.RenderStatusRendering, link.RenderStatus)
+	assert.WithinDuration(t, claimedAt, *link.RenderClaimedAt, time.Second, "the other replica's claim is left alone")
+}
+
+func TestPauseResume(t *testing.T) {
+	setupSharedQueueDB(t)
+	config.Set(&config.Config{RenderTimeoutSeconds: 90})
+	claimedAt := time.Now()
+	require.NoError(t, db.CreateLink(&db.Link{
+		ShortCode:       "PAUSE1",
+		OriginalURL:     "https://paused.com",
+		RenderStatus:    db.RenderStatusRendering,
+		RenderClaimedAt: &claimedAt,
+	}))
+
+	queue := &RenderQueue{
+		jobs:        make(chan RenderJob, 1),
+		inProgress:  make(map[string]string),
+		waiting:     make(map[string][]chan bool),
+		workerCount: 1,
+		running:     make(map[int]RenderJob),
+		quit:        make(chan struct{}),
+	}
+	defer close(queue.jobs)
+
+	assert.True(t, queue.Pause())
+	assert.False(t, queue.Pause(), "already paused")
+	status := queue.GetStatus()
+	assert.Equal(t, true, status["paused"])
+	assert.Contains(t, status, "paused_since")
+
+	// Jobs are queued but not started
+	queue.QueueRender("PAUSE1", "https://paused.com")
+	queue.startWorker(0)
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, queue.IsInProgress("PAUSE1"))
+	queue.mutex.RLock()
+	assert.Empty(t, queue.running)
+	queue.mutex.RUnlock()
+
+	// The worker picks the job up once resumed; claimed elsewhere, it's skipped
+	assert.True(t, queue.Resume())
+	assert.False(t, queue.Resume(), "not paused")
+	assert.Eventually(t, func() bool { return !queue.IsInProgress("PAUSE1") }, time.Second, time.Millisecond)
+	assert.Equal(t, false, queue.GetStatus()["paused"])
+}
+
 func BenchmarkQueueRender(b *testing.B) {
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 1000),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 1,
 	}
@@ -331,19 +558,94 @@ func BenchmarkQueueRender(b *testing.B) {
 func BenchmarkIsInProgress(b *testing.B) {
 	queue := &RenderQueue{
 		jobs:        make(chan RenderJob, 100),
-		inProgress:  make(map[string]bool),
+		inProgress:  make(map[string]string),
 		waiting:     make(map[string][]chan bool),
 		workerCount: 1,
 	}
 
-	// Add some URLs to the in-progress map
+	// Add some links to the in-progress map
 	for i := 0; i < 100; i++ {
-		queue.inProgress[fmt.Sprintf("https://bench%d.com", i)] = true
+		queue.inProgress[fmt.Sprintf("BENCH%d", i)] = fmt.Sprintf("https://bench%d.com", i)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		url := fmt.Sprintf("https://bench%d.com", i%100)
-		queue.IsInProgress(url)
+		shortCode := fmt.Sprintf("BENCH%d", i%100)
+		queue.IsInProgress(shortCode)
+	}
+}
+
+func TestQueueRenderAfterStopAccepting(t *testing.T) {
+	setupSharedQueueDB(t)
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "DRAIN1", OriginalURL: "https://drain.com", RenderStatus: db.RenderStatusPending}))
+
+	queue := &RenderQueue{
+		jobs:       make(chan RenderJob, 1),
+		inProgress: make(map[string]string),
+		waiting:    make(map[string][]chan bool),
+	}
+	queue.StopAccepting()
+	queue.StopAccepting() // Idempotent
+
+	// The job is left to whichever replica polls the database next
+	queue.QueueRender("DRAIN1", "https://drain.com")
+	assert.False(t, queue.IsInProgress("DRAIN1"))
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "DRAIN1", requests[0].ShortCode)
+}
+
+func TestShutdownPersistsQueuedJobs(t *testing.T) {
+	setupSharedQueueDB(t)
+	config.Set(&config.Config{RenderTimeoutSeconds: 90, RenderShutdownTimeoutSeconds: 5})
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "QUEUED", OriginalURL: "https://queued.com", RenderStatus: db.RenderStatusPending}))
+	claimedAt := time.Now()
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "POLLED", OriginalURL: "https://polled.com", RenderStatus: db.RenderStatusRendering, RenderClaimedAt: &claimedAt}))
+
+	queue := &RenderQueue{
+		jobs:        make(chan RenderJob, 2),
+		inProgress:  map[string]string{"QUEUED": "https://queued.com", "POLLED": "https://polled.com"},
+		waiting:     make(map[string][]chan bool),
+		workerCount: 1,
+		running:     make(map[int]RenderJob),
+		stopping:    true, // So the worker started below doesn't render the jobs
+	}
+	queue.jobs <- RenderJob{ShortCode: "QUEUED", OriginalURL: "https://queued.com"}
+	queue.jobs <- RenderJob{ShortCode: "POLLED", OriginalURL: "https://polled.com", Claimed: true}
+	queue.startWorker(0)
+	queue.Shutdown()
+
+	// Both are handed back to the database, for whichever replica polls next
+	assert.False(t, queue.IsInProgress("QUEUED"))
+	assert.False(t, queue.IsInProgress("POLLED"))
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	link, err := db.GetLinkByShortCode("POLLED")
+	require.NoError(t, err)
+	assert.Equal(t, db.RenderStatusPending, link.RenderStatus)
+	assert.Nil(t, link.RenderClaimedAt)
+}
+
+func TestAbandonRunning(t *testing.T) {
+	setupSharedQueueDB(t)
+	claimedAt := time.Now()
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "SLOW01", OriginalURL: "https://slow.com", RenderStatus: db.RenderStatusRendering, RenderClaimedAt: &claimedAt}))
+
+	queue := &RenderQueue{
+		inProgress: map[string]string{"SLOW01": "https://slow.com"},
+		waiting:    make(map[string][]chan bool),
+		running:    map[int]RenderJob{0: {ShortCode: "SLOW01", OriginalURL: "https://slow.com"}},
 	}
+	queue.abandonRunning()
+	assert.True(t, queue.abandoned, "the late result is not saved")
+
+	link, err := db.GetLinkByShortCode("SLOW01")
+	require.NoError(t, err)
+	assert.Equal(t, db.RenderStatusPending, link.RenderStatus)
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "SLOW01", requests[0].ShortCode)
 }
@@ -2,41 +2,157 @@ package renderer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/shortener"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
+	"github.com/go-rod/stealth"
 )
 
+// RenderResult holds the output of a single page render.
+type RenderResult struct {
+	HTML string
+	// StatusCode is the HTTP status of the main document, overridden by a
+	// prerender-status-code meta tag when the page declares one. Zero if unknown.
+	StatusCode int
+	// FinalURL is the URL the browser ended up on after following redirects.
+	FinalURL string
+	// RedirectChain lists every URL visited for the main document, starting with
+	// the requested URL and ending with FinalURL. Empty if no redirect happened.
+	RedirectChain []string
+}
+
+// navigationRecorder follows the main frame's document navigations to tell the
+// URLs the browser went through before the final one. Redirect responses add
+// hops to the navigation in flight, but only a committed navigation, a new
+// document, counts: history.pushState, replaceState and fragment changes don't
+// commit one, and a navigation that never commits, e.g. one answered with a
+// download, leaves the page where it was. Callers serialize the calls.
+type navigationRecorder struct {
+	pending []string // URLs of the navigation in flight, starting with its request
+	visited []string // URLs of committed navigations and their redirects, in order
+}
+
+// requestSent records a main-frame document request. redirectedFrom is the URL
+// whose redirect response led to it, or "" for a new navigation.
+func (n *navigationRecorder) requestSent(reqURL, redirectedFrom string) {
+	if redirectedFrom == "" || len(n.pending) == 0 {
+		n.pending = nil
+		if redirectedFrom != "" {
+			n.pending = append(n.pending, withoutFragment(redirectedFrom))
+		}
+	}
+	n.pending = append(n.pending, withoutFragment(reqURL))
+}
+
+// committed records that the main frame navigated to a new document at docURL.
+func (n *navigationRecorder) committed(docURL string) {
+	hops := n.pending
+	n.pending = nil
+	docURL = withoutFragment(docURL)
+	if len(hops) == 0 || hops[len(hops)-1] != docURL {
+		if docURL == "about:blank" {
+			return
+		}
+		hops = []string{docURL}
+	}
+	for _, hop := range hops {
+		if len(n.visited) == 0 || n.visited[len(n.visited)-1] != hop {
+			n.visited = append(n.visited, hop)
+		}
+	}
+}
+
+// finalURL returns the URL of the last committed document, or "" if none was seen.
+func (n *navigationRecorder) finalURL() string {
+	if len(n.visited) == 0 {
+		return ""
+	}
+	return n.visited[len(n.visited)-1]
+}
+
+// redirectChain returns every URL visited, starting with the requested one and
+// ending with finalURL, or nil if there was no redirect.
+func (n *navigationRecorder) redirectChain() []string {
+	if len(n.visited) < 2 {
+		return nil
+	}
+	return append([]string(nil), n.visited...)
+}
+
+// withoutFragment strips the #fragment from rawURL.
+func withoutFragment(rawURL string) string {
+	if i := strings.IndexByte(rawURL, '#'); i != -1 {
+		return rawURL[:i]
+	}
+	return rawURL
+}
+
+// ErrSchemeNotAllowed marks URLs the renderer refused to open because their scheme
+// isn't allowed, such as file: or javascript: URLs stored before the scheme
+// allowlist was enforced or inserted behind the API's back.
+var ErrSchemeNotAllowed = errors.New("URL scheme is not allowed")
+
+// prerenderStatusMeta matches <meta name="prerender-status-code" content="404">,
+// the convention SPAs use to signal soft errors to prerender services.
+var prerenderStatusMeta = regexp.MustCompile(`(?i)<meta\s+[^>]*name=["']prerender-status-code["'][^>]*content=["'](\d{3})["']|<meta\s+[^>]*content=["'](\d{3})["'][^>]*name=["']prerender-status-code["']`)
+
+// statusCodeFromMeta extracts the status code declared by a prerender-status-code meta tag.
+func statusCodeFromMeta(html string) (int, bool) {
+	match := prerenderStatusMeta.FindStringSubmatch(html)
+	if match == nil {
+		return 0, false
+	}
+	value := match[1]
+	if value == "" {
+		value = match[2]
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 100 || code > 599 {
+		return 0, false
+	}
+	return code, true
+}
+
 // RenderPageWithRod fetches a URL using Rod, waits for JavaScript to render (basic wait),
-// and returns the full HTML content.
-func RenderPageWithRod(url string) (string, error) {
+// and returns the full HTML content along with the main document's HTTP status.
+func RenderPageWithRod(url string, opts RenderOptions) (*RenderResult, error) {
+	if err := checkScheme(url); err != nil {
+		log.Printf("Rod: Refusing to render %s: %v", url, err)
+		return nil, err
+	}
 	log.Printf("Rod rendering started for URL: %s", url)
 
 	// Set overall timeout for the entire rendering process
-	timeoutDuration := time.Duration(config.AppConfig.RenderTimeoutSeconds) * time.Second
+	timeoutDuration := time.Duration(config.Get().RenderTimeoutSeconds) * time.Second
 	log.Printf("Rod: Using render timeout of %v for URL: %s", timeoutDuration, url)
 	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
 	defer cancel()
 
 	// Create a channel to handle the result
 	resultChan := make(chan struct {
-		html string
-		err  error
+		result *RenderResult
+		err    error
 	}, 1)
 
 	// Run the rendering in a goroutine to enable timeout
 	go func() {
-		html, err := renderWithRod(url)
+		result, err := renderWithRod(url, opts)
 		select {
 		case resultChan <- struct {
-			html string
-			err  error
-		}{html, err}:
+			result *RenderResult
+			err    error
+		}{result, err}:
 		case <-ctx.Done():
 			log.Printf("Rod: Rendering goroutine cancelled for URL: %s", url)
 		}
@@ -50,58 +166,74 @@ func RenderPageWithRod(url string) (string, error) {
 		} else {
 			log.Printf("Rod: Rendering completed successfully for URL: %s", url)
 		}
-		return result.html, result.err
+		return result.result, result.err
 	case <-ctx.Done():
 		log.Printf("Rod: Rendering timeout after %v for URL: %s", timeoutDuration, url)
-		return "", fmt.Errorf("rendering timeout after %v for URL: %s", timeoutDuration, url)
+		return nil, fmt.Errorf("rendering timeout after %v for URL: %s", timeoutDuration, url)
+	}
+}
+
+// checkScheme returns ErrSchemeNotAllowed unless rawURL has one of the schemes
+// the shortener accepts. Validation at creation time isn't enough on its own,
+// since the browser would happily open whatever a stored row contains.
+func checkScheme(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemeNotAllowed, err)
+	}
+	if !shortener.SchemeAllowed(parsed.Scheme) {
+		return fmt.Errorf("%w: %q", ErrSchemeNotAllowed, parsed.Scheme)
 	}
+	return nil
+}
+
+// newStealthPage creates a page with the go-rod/stealth evasions (navigator.webdriver,
+// plugins, WebGL vendor, etc.) injected before any site script runs. The headless
+// user agent is fixed separately in applyEmulation. Some sites serve a bot
+// interstitial otherwise.
+func newStealthPage(browser *rod.Browser) (*rod.Page, error) {
+	return stealth.Page(browser)
 }
 
 // renderWithRod is the actual rendering implementation
-func renderWithRod(url string) (string, error) {
-	var browser *rod.Browser
-	var err error
-
-	// Check if a custom rod binary path is specified
-	rodBinPath := config.AppConfig.RodBinPath
-	if rodBinPath != "" {
-		log.Printf("Rod: Using custom binary path: %s for URL: %s", rodBinPath, url)
-		l := launcher.New().Bin(rodBinPath)
-		//nolint:errcheck
-		defer l.Cleanup() // rod's Cleanup() doesn't return an error that we need to handle here.
-
-		log.Printf("Rod: Launching browser with custom path for URL: %s", url)
-		u, err := l.Launch()
-		if err != nil {
-			return "", fmt.Errorf("failed to launch rod with custom path %s: %w", rodBinPath, err)
-		}
-		log.Printf("Rod: Browser launched successfully with custom path for URL: %s", url)
-		browser = rod.New().ControlURL(u)
-	} else {
-		// Use default launcher (will download browser if not found)
-		log.Printf("Rod: Using default browser launcher for URL: %s", url)
-		browser = rod.New()
+func renderWithRod(url string, opts RenderOptions) (result *RenderResult, err error) {
+	cfg := config.Get()
+	mb, err := acquireBrowser()
+	if err != nil {
+		return nil, err
 	}
+	defer releaseBrowser(mb)
+	// Whatever error the dying browser caused, report the guard's kill as the cause.
+	defer func() {
+		if reason := mb.killedReason(); reason != "" {
+			result = nil
+			err = fmt.Errorf("%w: %s", ErrResourceLimit, reason)
+		}
+	}()
 
-	log.Printf("Rod: Connecting to browser for URL: %s", url)
-	err = browser.Connect()
+	// Each render gets its own incognito context so cookies, storage and service
+	// workers from one site can't leak into another's snapshot on a shared browser.
+	browser, err := mb.browser.Incognito()
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to rod browser: %w", err)
+		return nil, fmt.Errorf("failed to create browser context for %s: %w", url, err)
 	}
-	log.Printf("Rod: Successfully connected to browser for URL: %s", url)
-	//nolint:errcheck
 	defer func() {
-		log.Printf("Rod: Closing browser for URL: %s", url)
-		browser.MustClose() // MustClose panics on error, no return to check.
-		log.Printf("Rod: Browser closed for URL: %s", url)
+		if closeErr := browser.Close(); closeErr != nil {
+			log.Printf("Rod: Error disposing browser context for %s: %v", url, closeErr)
+		}
 	}()
 
 	log.Printf("Rod: Creating new page for URL: %s", url)
-	page, err := browser.Page(proto.TargetCreateTarget{URL: url})
+	var page *rod.Page
+	if cfg.RenderStealth {
+		page, err = newStealthPage(browser)
+	} else {
+		page, err = browser.Page(proto.TargetCreateTarget{})
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create page for %s: %w", url, err)
+		return nil, fmt.Errorf("failed to create page for %s: %w", url, err)
 	}
-	log.Printf("Rod: Page created successfully for URL: %s", url)
+	log.Printf("Rod: Page created successfully for URL: %s (stealth: %t)", url, cfg.RenderStealth)
 	//nolint:errcheck
 	defer func() {
 		log.Printf("Rod: Closing page for URL: %s", url)
@@ -109,6 +241,75 @@ func renderWithRod(url string) (string, error) {
 		log.Printf("Rod: Page closed for URL: %s", url)
 	}()
 
+	if err := applyEmulation(browser, page, opts); err != nil {
+		return nil, err
+	}
+
+	filter, err := filterRequests(page, url)
+	if err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		defer func() {
+			if stopErr := filter.stop(); stopErr != nil {
+				log.Printf("Rod: Error stopping request interception for %s: %v", url, stopErr)
+			}
+		}()
+	}
+
+	// Record the main document's response status and the URLs it went through,
+	// server-side redirects as well as client-side ones (location.href, meta
+	// refresh). Subscribing before navigating ensures the first response isn't missed.
+	var eventMutex sync.Mutex
+	statusCode := 0
+	responseURL := ""
+	var navigations navigationRecorder
+	mainFrameID := proto.PageFrameID(page.TargetID)
+	eventCtx, cancelEvents := context.WithCancel(context.Background())
+	defer cancelEvents()
+	console := recordConsole(eventCtx, page)
+	defer func() {
+		if err != nil && mb.killedReason() == "" {
+			dumpFailure(page, url, console, err)
+		}
+	}()
+	go page.Context(eventCtx).EachEvent(func(e *proto.NetworkRequestWillBeSent) {
+		if e.Type != proto.NetworkResourceTypeDocument || e.FrameID != mainFrameID {
+			return
+		}
+		redirectedFrom := ""
+		if e.RedirectResponse != nil {
+			redirectedFrom = e.RedirectResponse.URL
+			log.Printf("Rod: Main document redirected (%d) from %s to %s", e.RedirectResponse.Status, e.RedirectResponse.URL, e.Request.URL)
+		}
+		eventMutex.Lock()
+		navigations.requestSent(e.Request.URL, redirectedFrom)
+		eventMutex.Unlock()
+	}, func(e *proto.NetworkResponseReceived) {
+		if e.Type != proto.NetworkResourceTypeDocument || e.FrameID != mainFrameID {
+			return
+		}
+		eventMutex.Lock()
+		statusCode = e.Response.Status
+		responseURL = e.Response.URL
+		eventMutex.Unlock()
+	}, func(e *proto.PageFrameNavigated) {
+		if e.Frame == nil || e.Frame.ID != mainFrameID {
+			return
+		}
+		eventMutex.Lock()
+		navigations.committed(e.Frame.URL)
+		eventMutex.Unlock()
+	})()
+
+	log.Printf("Rod: Navigating to URL: %s", url)
+	if err := page.Navigate(url); err != nil {
+		if refused := filter.refusedNavigation(); refused != "" {
+			return nil, fmt.Errorf("%w: %s", ErrTargetNotAllowed, refused)
+		}
+		return nil, fmt.Errorf("failed to navigate to %s: %w", url, err)
+	}
+
 	// A common strategy is to wait for DOMContentLoaded and then a short delay for JS
 	log.Printf("Rod: Waiting for page load event for URL: %s", url)
 	err = page.WaitLoad() // Waits for the 'load' event
@@ -130,12 +331,34 @@ func renderWithRod(url string) (string, error) {
 	time.Sleep(2 * time.Second)
 	log.Printf("Rod: Additional wait completed for URL: %s", url)
 
+	// A later navigation that was refused leaves the page on Chrome's error page
+	if info, infoErr := page.Info(); infoErr == nil && strings.HasPrefix(info.URL, "chrome-error:") {
+		if refused := filter.refusedNavigation(); refused != "" {
+			return nil, fmt.Errorf("%w: %s", ErrTargetNotAllowed, refused)
+		}
+	}
+
 	log.Printf("Rod: Extracting HTML content for URL: %s", url)
 	html, err := page.HTML()
 	if err != nil {
-		return "", fmt.Errorf("failed to get HTML content for %s: %w", url, err)
+		return nil, fmt.Errorf("failed to get HTML content for %s: %w", url, err)
 	}
 	log.Printf("Rod: Successfully extracted HTML content for URL: %s (length: %d characters)", url, len(html))
 
-	return html, nil
+	eventMutex.Lock()
+	result = &RenderResult{HTML: html, StatusCode: statusCode, FinalURL: navigations.finalURL(), RedirectChain: navigations.redirectChain()}
+	if result.FinalURL == "" {
+		result.FinalURL = withoutFragment(responseURL)
+	}
+	eventMutex.Unlock()
+	if len(result.RedirectChain) > 0 {
+		log.Printf("Rod: URL %s redirected to %s (%d hops)", url, result.FinalURL, len(result.RedirectChain)-1)
+	}
+	if metaCode, ok := statusCodeFromMeta(html); ok {
+		log.Printf("Rod: Page declares prerender-status-code %d (HTTP status was %d) for URL: %s", metaCode, result.StatusCode, url)
+		result.StatusCode = metaCode
+	}
+	log.Printf("Rod: Main document status for URL: %s is %d", url, result.StatusCode)
+
+	return result, nil
 }
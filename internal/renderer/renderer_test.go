@@ -0,0 +1,139 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusCodeFromMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		wantCode int
+		wantOK   bool
+	}{
+		{
+			name:     "name before content",
+			html:     `<html><head><meta name="prerender-status-code" content="404"></head></html>`,
+			wantCode: 404,
+			wantOK:   true,
+		},
+		{
+			name:     "content before name",
+			html:     `<html><head><meta content='410' name='prerender-status-code'/></head></html>`,
+			wantCode: 410,
+			wantOK:   true,
+		},
+		{
+			name:     "case insensitive",
+			html:     `<META NAME="Prerender-Status-Code" CONTENT="503">`,
+			wantCode: 503,
+			wantOK:   true,
+		},
+		{
+			name:   "no meta tag",
+			html:   `<html><head><meta name="description" content="200"></head></html>`,
+			wantOK: false,
+		},
+		{
+			name:   "out of range code",
+			html:   `<meta name="prerender-status-code" content="999">`,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, ok := statusCodeFromMeta(tt.html)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestRenderRefusesDisallowedSchemes(t *testing.T) {
+	for _, url := range []string{"file:///etc/passwd", "javascript:alert(1)", "chrome://settings", "%zz"} {
+		_, err := RenderPageWithRod(url, RenderOptions{})
+		assert.ErrorIs(t, err, ErrSchemeNotAllowed, url)
+	}
+	assert.NoError(t, checkScheme("https://example.com/"))
+}
+
+func TestNavigationRecorder(t *testing.T) {
+	type step struct {
+		request, redirectedFrom string // A document request, when request is set
+		commit                  string // Otherwise a committed navigation
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		wantFinal string
+		wantChain []string
+	}{
+		{
+			name:      "no redirect",
+			steps:     []step{{commit: "about:blank"}, {request: "https://a.com/"}, {commit: "https://a.com/"}},
+			wantFinal: "https://a.com/",
+		},
+		{
+			name: "server redirects",
+			steps: []step{
+				{request: "http://a.com/"},
+				{request: "https://a.com/", redirectedFrom: "http://a.com/"},
+				{request: "https://www.a.com/", redirectedFrom: "https://a.com/"},
+				{commit: "https://www.a.com/"},
+			},
+			wantFinal: "https://www.a.com/",
+			wantChain: []string{"http://a.com/", "https://a.com/", "https://www.a.com/"},
+		},
+		{
+			name: "client-side redirect after a server redirect",
+			steps: []step{
+				{request: "https://a.com/"},
+				{request: "https://a.com/home", redirectedFrom: "https://a.com/"},
+				{commit: "https://a.com/home"},
+				{request: "https://b.com/"},
+				{commit: "https://b.com/"},
+			},
+			wantFinal: "https://b.com/",
+			wantChain: []string{"https://a.com/", "https://a.com/home", "https://b.com/"},
+		},
+		{
+			name: "navigation that never commits",
+			steps: []step{
+				{request: "https://a.com/"},
+				{commit: "https://a.com/"},
+				{request: "https://a.com/report.pdf"},
+			},
+			wantFinal: "https://a.com/",
+		},
+		{
+			name: "fragments are ignored",
+			steps: []step{
+				{request: "https://a.com/"},
+				{commit: "https://a.com/#/dashboard"},
+				{request: "https://a.com/#top"},
+				{commit: "https://a.com/"},
+			},
+			wantFinal: "https://a.com/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n navigationRecorder
+			for _, s := range tt.steps {
+				if s.request != "" {
+					n.requestSent(s.request, s.redirectedFrom)
+				} else {
+					n.committed(s.commit)
+				}
+			}
+			assert.Equal(t, tt.wantFinal, n.finalURL())
+			assert.Equal(t, tt.wantChain, n.redirectChain())
+		})
+	}
+}
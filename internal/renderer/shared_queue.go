@@ -0,0 +1,181 @@
+package renderer
+
+import (
+	"log"
+	"prerender-url-shortener/internal/db"
+	"time"
+)
+
+// Replicas split into api and worker modes share the render queue through the
+// database: API replicas request renders with db.RequestRender and worker
+// replicas poll for the requests with StartPolling.
+
+// remoteWatchInterval is how often a queue without workers checks whether the
+// renders it requested have finished.
+var remoteWatchInterval = time.Second
+
+// InitRemoteRenderQueue initializes the global render queue of a replica
+// without render workers. Renders are requested from the workers of other
+// replicas through the database, which is watched to wake up WaitForRender
+// when they finish.
+func InitRemoteRenderQueue() {
+	GlobalRenderQueue = newRemoteRenderQueue()
+	go GlobalRenderQueue.watchRemote(remoteWatchInterval)
+	log.Println("Initialized render queue without workers, renders are left to worker replicas")
+}
+
+func newRemoteRenderQueue() *RenderQueue {
+	return &RenderQueue{
+		jobs:       make(chan RenderJob),
+		inProgress: make(map[string]string),
+		waiting:    make(map[string][]chan bool),
+		remote:     make(map[string]bool),
+		quit:       make(chan struct{}),
+	}
+}
+
+// requestRender queues a render in the database for the worker replicas.
+func (rq *RenderQueue) requestRender(shortCode, originalURL string) {
+	if err := db.RequestRender(shortCode); err != nil {
+		log.Printf("Queue: Failed to request a render of %s from the workers: %v", shortCode, err)
+		return
+	}
+	log.Printf("Queue: Requested a render of URL: %s (short code: %s) from the workers", originalURL, shortCode)
+
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	rq.inProgress[shortCode] = originalURL
+	rq.remote[shortCode] = true
+}
+
+// watchRemote checks every interval whether the requested renders have
+// finished, until Shutdown.
+func (rq *RenderQueue) watchRemote(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rq.checkRemote()
+		case <-rq.quit:
+			return
+		}
+	}
+}
+
+// checkRemote wakes up the waiters of the requested renders that finished.
+// Links deleted meanwhile count as finished.
+func (rq *RenderQueue) checkRemote() {
+	rq.mutex.RLock()
+	checked := make(map[string]bool, len(rq.remote))
+	codes := make([]string, 0, len(rq.remote))
+	for shortCode := range rq.remote {
+		checked[shortCode] = true
+		codes = append(codes, shortCode)
+	}
+	rq.mutex.RUnlock()
+	if len(codes) == 0 {
+		return
+	}
+
+	statuses, err := db.GetRenderStatuses(codes)
+	if err != nil {
+		log.Printf("Queue: Failed to check requested renders: %v", err)
+		return
+	}
+
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	for shortCode := range rq.remote {
+		if !checked[shortCode] {
+			continue // Requested after the check
+		}
+		if status, ok := statuses[shortCode]; ok && status != db.RenderStatusCompleted && status != db.RenderStatusFailed {
+			continue
+		}
+		for _, waitChan := range rq.waiting[shortCode] {
+			select {
+			case waitChan <- true:
+			default:
+			}
+		}
+		delete(rq.waiting, shortCode)
+		delete(rq.inProgress, shortCode)
+		delete(rq.remote, shortCode)
+	}
+}
+
+// StartPolling hands the renders requested in the database, e.g. by replicas
+// in api mode, to the queue's workers, checking every interval. It returns a
+// function that stops polling.
+func (rq *RenderQueue) StartPolling(interval time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rq.pollRequests()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	log.Printf("Queue: Polling for requested renders every %s", interval)
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// pollRequests claims as many requested renders as there are idle workers and
+// queues them. Claiming no more than can start right away leaves the rest to
+// other replicas, and keeps claims from going stale in the jobs channel. The
+// claim happens in the database, so replicas polling concurrently each get
+// different links. A claimed link that can't be queued after all is released
+// back to the database for another poll.
+func (rq *RenderQueue) pollRequests() {
+	rq.mutex.RLock()
+	free := min(rq.workerCount-len(rq.inProgress), cap(rq.jobs)-len(rq.jobs))
+	if rq.resumed != nil {
+		free = 0 // Paused, the requests stay in the database meanwhile
+	}
+	rq.mutex.RUnlock()
+	if free <= 0 {
+		return
+	}
+	links, err := db.ClaimRenderRequests(free, renderClaimTimeout())
+	if err != nil {
+		log.Printf("Queue: Failed to claim requested renders: %v", err)
+		return
+	}
+	for _, link := range links {
+		if rq.queueClaimed(link.ShortCode, link.OriginalURL) {
+			continue
+		}
+		if err := db.ReleaseRenderClaim(link.ShortCode); err != nil {
+			log.Printf("Queue: Failed to release the claim on %s: %v", link.ShortCode, err)
+		}
+	}
+}
+
+// queueClaimed queues a render of a link claimed by pollRequests. It reports
+// false if the link is already in progress here or the queue is full or closed.
+func (rq *RenderQueue) queueClaimed(shortCode, originalURL string) bool {
+	rq.mutex.Lock()
+	defer rq.mutex.Unlock()
+	if _, ok := rq.inProgress[shortCode]; rq.closed || ok {
+		return false
+	}
+	select {
+	case rq.jobs <- RenderJob{ShortCode: shortCode, OriginalURL: originalURL, Claimed: true}:
+		rq.inProgress[shortCode] = originalURL
+		log.Printf("Queue: Queued requested render of URL: %s (short code: %s)", originalURL, shortCode)
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+package renderer
+
+import (
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupSharedQueueDB(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate())
+}
+
+func TestRemoteRenderQueue(t *testing.T) {
+	setupSharedQueueDB(t)
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "REMOTE", OriginalURL: "https://remote.com", RenderStatus: db.RenderStatusPending}))
+
+	queue := newRemoteRenderQueue()
+	defer queue.Shutdown()
+	go queue.watchRemote(10 * time.Millisecond)
+
+	// Queuing requests the render from the workers instead of running it
+	queue.QueueRender("REMOTE", "https://remote.com")
+	assert.True(t, queue.IsInProgress("REMOTE"))
+	assert.Equal(t, 0, len(queue.jobs))
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "REMOTE", requests[0].ShortCode)
+
+	// Still pending, so waiting times out
+	assert.False(t, queue.WaitForRender("REMOTE", 50*time.Millisecond))
+
+	// A worker replica finishes the render
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		db.UpdateLinkRenderStatus("REMOTE", db.RenderStatusCompleted)
+	}()
+	assert.True(t, queue.WaitForRender("REMOTE", 2*time.Second))
+	assert.False(t, queue.IsInProgress("REMOTE"))
+	assert.Equal(t, "remote", queue.GetStatus()["mode"])
+}
+
+func TestRemoteRenderQueueSameURLForTwoTenants(t *testing.T) {
+	setupSharedQueueDB(t)
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "ACME01", TenantID: "acme", OriginalURL: "https://shared.com", RenderStatus: db.RenderStatusPending}))
+	require.NoError(t, db.CreateLink(&db.Link{ShortCode: "BETA01", TenantID: "beta", OriginalURL: "https://shared.com", RenderStatus: db.RenderStatusPending}))
+
+	queue := newRemoteRenderQueue()
+	defer queue.Shutdown()
+	queue.QueueRender("ACME01", "https://shared.com")
+	queue.QueueRender("BETA01", "https://shared.com")
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	assert.Len(t, requests, 2)
+
+	// Only the link whose render finished is done
+	require.NoError(t, db.UpdateLinkRenderStatus("ACME01", db.RenderStatusCompleted))
+	queue.checkRemote()
+	assert.False(t, queue.IsInProgress("ACME01"))
+	assert.True(t, queue.IsInProgress("BETA01"))
+
+	// A worker replica rendering one tenant's link still takes the other's
+	worker := &RenderQueue{
+		jobs:        make(chan RenderJob, 2),
+		inProgress:  map[string]string{"ACME01": "https://shared.com"},
+		waiting:     make(map[string][]chan bool),
+		workerCount: 2,
+	}
+	assert.True(t, worker.queueClaimed("BETA01", "https://shared.com"))
+	assert.False(t, worker.queueClaimed("ACME01", "https://shared.com"), "already in progress")
+}
+
+func TestPollRequests(t *testing.T) {
+	setupSharedQueueDB(t)
+	config.Set(&config.Config{RenderTimeoutSeconds: 30})
+	for _, code := range []string{"POLL01", "POLL02", "POLL03", "POLL04"} {
+		require.NoError(t, db.CreateLink(&db.Link{ShortCode: code, OriginalURL: "https://poll.com/" + code}))
+		require.NoError(t, db.RequestRender(code))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	queue := &RenderQueue{
+		jobs:        make(chan RenderJob, 10),
+		inProgress:  map[string]string{"POLL01": "https://poll.com/POLL01"},
+		waiting:     make(map[string][]chan bool),
+		workerCount: 3,
+	}
+
+	// Only as many as there are idle workers, already claimed. The one in
+	// progress here is released back to the database.
+	queue.pollRequests()
+	require.Equal(t, 1, len(queue.jobs))
+	job := <-queue.jobs
+	assert.Equal(t, "POLL02", job.ShortCode)
+	assert.True(t, job.Claimed)
+	link, err := db.GetLinkByShortCode("POLL02")
+	require.NoError(t, err)
+	assert.Equal(t, db.RenderStatusRendering, link.RenderStatus)
+
+	requests, err := db.ListRenderRequests(10)
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	assert.Equal(t, "POLL03", requests[0].ShortCode)
+	assert.Equal(t, "POLL01", requests[2].ShortCode, "released requests go to the back")
+
+	queue.pollRequests()
+	require.Equal(t, 1, len(queue.jobs))
+	assert.Equal(t, "POLL03", (<-queue.jobs).ShortCode)
+
+	// Every worker busy
+	queue.pollRequests()
+	assert.Equal(t, 0, len(queue.jobs))
+
+	for _, code := range []string{"POLL01", "POLL02", "POLL03"} {
+		queue.finishLocked(0, code)
+	}
+	queue.Pause()
+	queue.pollRequests()
+	assert.Equal(t, 0, len(queue.jobs), "paused, requests stay in the database")
+	queue.Resume()
+	queue.pollRequests()
+	require.Equal(t, 2, len(queue.jobs))
+	assert.Equal(t, "POLL04", (<-queue.jobs).ShortCode)
+	assert.Equal(t, "POLL01", (<-queue.jobs).ShortCode)
+}
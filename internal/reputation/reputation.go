@@ -0,0 +1,47 @@
+// Package reputation screens URLs against malware and phishing lists before they
+// are shortened and while their links live. The checker is pluggable; Google
+// Safe Browsing is built in.
+package reputation
+
+import (
+	"context"
+	"sync"
+)
+
+// Checker looks URLs up in a reputation service.
+type Checker interface {
+	// Check returns the threat type each flagged URL matched, keyed by URL.
+	// URLs that aren't flagged are absent.
+	Check(ctx context.Context, urls []string) (map[string]string, error)
+}
+
+var (
+	checkerMu sync.RWMutex
+	checker   Checker
+)
+
+// SetChecker installs the checker used by Check. A nil checker disables screening.
+func SetChecker(c Checker) {
+	checkerMu.Lock()
+	defer checkerMu.Unlock()
+	checker = c
+}
+
+// Enabled reports whether a checker is installed.
+func Enabled() bool {
+	checkerMu.RLock()
+	defer checkerMu.RUnlock()
+	return checker != nil
+}
+
+// Check looks urls up with the installed checker. It flags nothing while
+// screening is disabled.
+func Check(ctx context.Context, urls ...string) (map[string]string, error) {
+	checkerMu.RLock()
+	c := checker
+	checkerMu.RUnlock()
+	if c == nil || len(urls) == 0 {
+		return nil, nil
+	}
+	return c.Check(ctx, urls)
+}
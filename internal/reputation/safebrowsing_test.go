@@ -0,0 +1,68 @@
+package reputation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeBrowsingCheck(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "test-key", r.Header.Get("X-Goog-Api-Key"))
+		var body findRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.LessOrEqual(t, len(body.ThreatInfo.ThreatEntries), safeBrowsingBatchSize)
+
+		var result findResponse
+		for _, entry := range body.ThreatInfo.ThreatEntries {
+			if strings.Contains(entry.URL, "malware") {
+				result.Matches = append(result.Matches, struct {
+					ThreatType string      `json:"threatType"`
+					Threat     threatEntry `json:"threat"`
+				}{"MALWARE", entry})
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	checker := NewSafeBrowsing("test-key")
+	checker.endpoint = server.URL
+
+	urls := []string{"https://malware.test/a"}
+	for i := 0; i < safeBrowsingBatchSize; i++ {
+		urls = append(urls, "https://clean.test/")
+	}
+	threats, err := checker.Check(context.Background(), urls)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"https://malware.test/a": "MALWARE"}, threats)
+	assert.Equal(t, 2, requests, "URLs are sent in batches")
+}
+
+func TestSafeBrowsingCheckError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "API key not valid"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	checker := NewSafeBrowsing("bad-key")
+	checker.endpoint = server.URL
+	_, err := checker.Check(context.Background(), []string{"https://example.com"})
+	assert.ErrorContains(t, err, "API key not valid")
+}
+
+func TestCheckWithoutChecker(t *testing.T) {
+	SetChecker(nil)
+	assert.False(t, Enabled())
+	threats, err := Check(context.Background(), "https://malware.test/")
+	assert.NoError(t, err)
+	assert.Empty(t, threats)
+}
@@ -0,0 +1,91 @@
+package shortener
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AliasError is returned by ValidateAlias for an alias breaking a rule.
+type AliasError struct {
+	Reason string // Which rule is broken, meant to be shown to the client
+}
+
+func (e *AliasError) Error() string {
+	return "invalid alias: " + e.Reason
+}
+
+// MaxAliasLength is the longest alias AliasRules may allow, which is what the
+// short_code columns of other tables hold.
+const MaxAliasLength = 64
+
+// AliasRules are the rules custom aliases must follow.
+type AliasRules struct {
+	MinLength int    // Shortest alias accepted
+	MaxLength int    // Longest alias accepted, at most MaxAliasLength
+	Charset   string // Characters an alias may contain, empty allowing letters, digits, '-' and '_'
+	Pattern   string // Regular expression the whole alias must match, empty matching anything
+	FoldCase  bool   // Lowercase aliases, so that they are case-insensitive
+}
+
+// DefaultAliasRules are the rules used unless SetAliasRules is called.
+var DefaultAliasRules = AliasRules{MinLength: 3, MaxLength: 32}
+
+// aliasRules are the rules ValidateAlias enforces, with the pattern compiled.
+var (
+	aliasRules   = DefaultAliasRules
+	aliasPattern *regexp.Regexp
+)
+
+// SetAliasRules sets the rules custom aliases are validated against.
+func SetAliasRules(rules AliasRules) error {
+	if rules.MinLength < 1 || rules.MaxLength > MaxAliasLength || rules.MinLength > rules.MaxLength {
+		return fmt.Errorf("alias lengths must be between 1 and %d with the minimum not above the maximum, got %d to %d",
+			MaxAliasLength, rules.MinLength, rules.MaxLength)
+	}
+	for _, c := range rules.Charset {
+		if !isCodeChar(c) {
+			return fmt.Errorf("alias charset contains %q, only letters, digits, '-' and '_' are allowed", c)
+		}
+	}
+	var pattern *regexp.Regexp
+	if rules.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(`^(?:` + rules.Pattern + `)$`); err != nil {
+			return fmt.Errorf("invalid alias pattern: %w", err)
+		}
+	}
+	aliasRules, aliasPattern = rules, pattern
+	return nil
+}
+
+// ValidateAlias checks a custom alias against the alias rules and reserved
+// words, returning it case-folded if the rules say so. Errors are *AliasError.
+func ValidateAlias(alias string) (string, error) {
+	if aliasRules.FoldCase {
+		alias = strings.ToLower(alias)
+	}
+	if n := len([]rune(alias)); n < aliasRules.MinLength || n > aliasRules.MaxLength {
+		return "", aliasError("must be %d to %d characters long, got %d", aliasRules.MinLength, aliasRules.MaxLength, n)
+	}
+	for _, c := range alias {
+		allowed := isCodeChar(c)
+		if aliasRules.Charset != "" {
+			allowed = strings.ContainsRune(aliasRules.Charset, c)
+		}
+		if !allowed {
+			return "", aliasError("character %q is not allowed", c)
+		}
+	}
+	if aliasPattern != nil && !aliasPattern.MatchString(alias) {
+		return "", aliasError("must match %s", aliasRules.Pattern)
+	}
+	if IsReserved(alias) {
+		return "", aliasError("%q is reserved", alias)
+	}
+	return alias, nil
+}
+
+func aliasError(format string, args ...interface{}) error {
+	return &AliasError{Reason: fmt.Sprintf(format, args...)}
+}
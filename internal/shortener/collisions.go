@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// DefaultMaxAttempts is how many codes are tried for a new link before giving
+// up, and DefaultGrowAfter how many of them collide before random codes are
+// made longer, unless SetCollisionPolicy is called.
+const (
+	DefaultMaxAttempts = 5
+	DefaultGrowAfter   = 3
+)
+
+// MaxMaxAttempts bounds SetCollisionPolicy's attempts, each of which is an insert.
+const MaxMaxAttempts = 100
+
+// maxAttempts and growAfter are set with SetCollisionPolicy.
+var (
+	maxAttempts = DefaultMaxAttempts
+	growAfter   = DefaultGrowAfter
+)
+
+// SetCollisionPolicy sets how many codes are tried for a new link, and after
+// how many collisions CodeGenerator makes random codes a character longer for
+// each further attempt, so a crowded length doesn't fail the link. A growAfter
+// of 0 keeps the length.
+func SetCollisionPolicy(attempts, grow int) error {
+	if attempts < 1 || attempts > MaxMaxAttempts {
+		return fmt.Errorf("short code attempts must be between 1 and %d, got %d", MaxMaxAttempts, attempts)
+	}
+	if grow < 0 {
+		return fmt.Errorf("short code growth threshold can't be negative, got %d", grow)
+	}
+	maxAttempts, growAfter = attempts, grow
+	return nil
+}
+
+// MaxAttempts returns how many codes are tried for a new link before giving up.
+func MaxAttempts() int {
+	return maxAttempts
+}
+
+// grownLength is the length of the random code tried for a link once
+// collisions of its codes were found taken.
+func grownLength(collisions int) int {
+	if growAfter == 0 || collisions < growAfter {
+		return shortCodeLength
+	}
+	return min(shortCodeLength+collisions-growAfter+1, MaxCodeLength)
+}
+
+// CollisionStats counts the links allocated a generated code since startup.
+// Aliases aren't counted.
+type CollisionStats struct {
+	Allocations   uint64  `json:"allocations"`    // Links allocated or given up on
+	Collided      uint64  `json:"collided"`       // Of those, links whose first code was taken
+	Collisions    uint64  `json:"collisions"`     // Codes found taken, in total
+	Lengthened    uint64  `json:"lengthened"`     // Links given a longer random code
+	Exhausted     uint64  `json:"exhausted"`      // Links given up on after every attempt collided
+	CollisionRate float64 `json:"collision_rate"` // Collided per allocation
+}
+
+var (
+	statsMu sync.Mutex
+	stats   CollisionStats
+)
+
+// RecordAllocation counts a link's allocation, in which collisions codes were
+// found taken, exhausted telling whether it was given up on. Allocations that
+// collided are logged with the running collision rate, which creeping up means
+// SHORT_CODE_LENGTH is due to be raised.
+func RecordAllocation(collisions int, exhausted bool) {
+	statsMu.Lock()
+	stats.Allocations++
+	if collisions > 0 {
+		stats.Collided++
+		stats.Collisions += uint64(collisions)
+		if mode == ModeRandom && !exhausted && grownLength(collisions) > shortCodeLength {
+			stats.Lengthened++
+		}
+	}
+	if exhausted {
+		stats.Exhausted++
+	}
+	current := stats
+	statsMu.Unlock()
+
+	if collisions > 0 {
+		log.Printf("Short codes: %d collisions allocating a link; %d of %d links collided since startup (%.2f%%), %d were lengthened and %d exhausted",
+			collisions, current.Collided, current.Allocations, 100*float64(current.Collided)/float64(current.Allocations), current.Lengthened, current.Exhausted)
+	}
+}
+
+// GetCollisionStats returns the allocations counted since startup.
+func GetCollisionStats() CollisionStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	current := stats
+	if current.Allocations > 0 {
+		current.CollisionRate = float64(current.Collided) / float64(current.Allocations)
+	}
+	return current
+}
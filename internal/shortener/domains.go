@@ -0,0 +1,33 @@
+package shortener
+
+import "strings"
+
+// MatchDomain reports whether host matches any of the comma-separated domain
+// patterns in list. A pattern is either a host name, matched exactly,
+// "*.example.com", matching any subdomain of example.com but not example.com
+// itself, or ".example.com", matching example.com and all of its subdomains.
+// Matching ignores case and a trailing dot.
+func MatchDomain(host string, list string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return false
+	}
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+		switch {
+		case pattern == "":
+			continue
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case strings.HasPrefix(pattern, "."):
+			if host == pattern[1:] || strings.HasSuffix(host, pattern) {
+				return true
+			}
+		case host == pattern:
+			return true
+		}
+	}
+	return false
+}
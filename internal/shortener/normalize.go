@@ -0,0 +1,94 @@
+package shortener
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// NormalizeOptions are the optional rewrites NormalizeURL applies on top of the
+// ones that never change which page a URL points to.
+type NormalizeOptions struct {
+	StripFragment bool   // Drop "#..." fragments, unless the site routes on them
+	SortQuery     bool   // Order query parameters by name
+	StripParams   string // Comma-separated query parameters to drop, a trailing "*" matching any suffix
+}
+
+// normalizeOptions are the options set with SetNormalizeOptions.
+var normalizeOptions NormalizeOptions
+
+// SetNormalizeOptions configures the optional rewrites of NormalizeURL.
+func SetNormalizeOptions(opts NormalizeOptions) {
+	normalizeOptions = opts
+}
+
+// defaultPorts are the ports implied by each scheme, which NormalizeURL drops.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// NormalizeURL returns the canonical spelling of a URL used to store and
+// deduplicate links. Scheme and host are case-insensitive, so they are
+// lowercased, and the scheme's default port is dropped. Fragments and query
+// parameters are rewritten as SetNormalizeOptions says; everything else is kept
+// as given.
+func NormalizeURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); port == "" || port == defaultPorts[parsed.Scheme] {
+		parsed.Host = strings.TrimSuffix(parsed.Host, ":"+port)
+	}
+
+	opts := normalizeOptions
+	if opts.StripFragment {
+		parsed.Fragment, parsed.RawFragment = "", ""
+	}
+	if opts.SortQuery || opts.StripParams != "" {
+		parsed.RawQuery = normalizeQuery(parsed.RawQuery, opts)
+		parsed.ForceQuery = false
+	}
+	return parsed.String(), nil
+}
+
+// normalizeQuery drops and orders the parameters of a raw query. Parameters keep
+// their original encoding, and ones with the same name keep their order.
+func normalizeQuery(rawQuery string, opts NormalizeOptions) string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		if name, err := url.QueryUnescape(queryParamName(param)); err == nil && strippedParam(name, opts.StripParams) {
+			continue
+		}
+		params = append(params, param)
+	}
+	if opts.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return queryParamName(params[i]) < queryParamName(params[j]) })
+	}
+	return strings.Join(params, "&")
+}
+
+func queryParamName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	return name
+}
+
+// strippedParam reports whether name matches an entry of the comma-separated
+// list, ignoring case.
+func strippedParam(name, list string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern != "" && name == pattern {
+			return true
+		}
+	}
+	return false
+}
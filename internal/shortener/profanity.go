@@ -0,0 +1,40 @@
+package shortener
+
+import "strings"
+
+// offensiveWords are substrings that make a generated code unfit to show to
+// customers. Matching is done on the lowercased code with look-alike digits
+// read as letters, so "5H1T" counts as well.
+var offensiveWords = []string{
+	"anal", "anus", "arse", "ass", "bitch", "boob", "butt", "cock", "coon", "crap",
+	"cum", "cunt", "damn", "dick", "dildo", "fag", "fuck", "hitler", "jizz", "kike",
+	"kkk", "nazi", "nigg", "penis", "piss", "poop", "porn", "pube", "pussy", "rape",
+	"scum", "sex", "shit", "slut", "spic", "tit", "twat", "vagina", "wank", "whore",
+	"xxx",
+}
+
+// lookAlikes reads digits as the letters they resemble and drops separators.
+var lookAlikes = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g",
+	"-", "", "_", "",
+)
+
+// profanityFilter is whether CodeGenerator screens codes with IsOffensive.
+var profanityFilter = true
+
+// SetProfanityFilter turns the screening of generated codes for offensive words
+// on or off.
+func SetProfanityFilter(enabled bool) {
+	profanityFilter = enabled
+}
+
+// IsOffensive reports whether code contains an offensive word.
+func IsOffensive(code string) bool {
+	normalized := lookAlikes.Replace(strings.ToLower(code))
+	for _, word := range offensiveWords {
+		if strings.Contains(normalized, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,26 +2,271 @@ package shortener
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
 	"math/big"
+	"strings"
 )
 
-const shortCodeLength = 6 // Length of the generated short code
+// DefaultCodeLength is the length of generated short codes unless SetCodeLength
+// is called.
+const DefaultCodeLength = 6
+
+// Bounds for SetCodeLength. Shorter codes collide too often to be generated
+// randomly, and longer ones defeat the point of a short link.
+const (
+	MinCodeLength = 4
+	MaxCodeLength = 32
+)
+
+// shortCodeLength is the length of the generated short code.
+var shortCodeLength = DefaultCodeLength
+
+// SetCodeLength sets the length of short codes generated from now on. Existing
+// links keep their codes.
+func SetCodeLength(length int) error {
+	if length < MinCodeLength || length > MaxCodeLength {
+		return fmt.Errorf("short code length must be between %d and %d, got %d", MinCodeLength, MaxCodeLength, length)
+	}
+	shortCodeLength = length
+	return nil
+}
 
 // customAlphabet excludes characters that can be easily confused (e.g., 0/O, 1/l/I).
 const customAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
 
+// MinAlphabetLength is the smallest alphabet SetAlphabet accepts, which allows digits-only codes.
+const MinAlphabetLength = 10
+
+// alphabet holds the characters generated short codes are made of.
+var alphabet = customAlphabet
+
+// SetAlphabet sets the characters short codes generated from now on are made of,
+// e.g. "abcdefghijkmnpqrstuvwxyz23456789" for lowercase codes. Only letters,
+// digits, '-' and '_' are accepted, so codes never need escaping in a URL path,
+// and each may appear once. An empty alphabet restores the default.
+func SetAlphabet(chars string) error {
+	if chars == "" {
+		alphabet = customAlphabet
+		return nil
+	}
+	seen := map[rune]bool{}
+	for _, c := range chars {
+		if !isCodeChar(c) {
+			return fmt.Errorf("short code alphabet contains %q, only letters, digits, '-' and '_' are allowed", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("short code alphabet contains %q more than once", c)
+		}
+		seen[c] = true
+	}
+	if len(chars) < MinAlphabetLength {
+		return fmt.Errorf("short code alphabet must have at least %d characters, got %d", MinAlphabetLength, len(chars))
+	}
+	alphabet = chars
+	return nil
+}
+
+// isCodeChar reports whether c can appear in a URL path segment unescaped and
+// unambiguously.
+func isCodeChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// builtinReserved are top-level routes of the server, which a link with the
+// same code would shadow or be shadowed by, and names kept for routes to come.
+var builtinReserved = []string{"health", "ready", "status", "generate", "metrics", "admin", "api", "links", "version", "quick", "og"}
+
+// reserved holds the lowercased codes never handed out.
+var reserved = reservedSet("")
+
+// SetReservedWords reserves the comma-separated words in addition to the
+// built-in route names, so no link is created under them.
+func SetReservedWords(list string) {
+	reserved = reservedSet(list)
+}
+
+// reservedSet builds the set of reserved codes from the built-in words and list.
+func reservedSet(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range builtinReserved {
+		set[word] = true
+	}
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			set[strings.ToLower(word)] = true
+		}
+	}
+	return set
+}
+
+// IsReserved reports whether code is a reserved word, ignoring case so that
+// codes can't pass for routes either.
+func IsReserved(code string) bool {
+	return reserved[strings.ToLower(code)]
+}
+
+// Short code generation modes for SetMode.
+const (
+	ModeRandom     = "random"     // Random codes, the default
+	ModeHash       = "hash"       // Codes derived from a hash of the URL
+	ModeSequential = "sequential" // Codes encoding an ID from an auto-increment counter
+)
+
+// mode is the generation mode used by CodeGenerator.
+var mode = ModeRandom
+
+// SetMode selects how CodeGenerator makes short codes for new links.
+func SetMode(m string) error {
+	switch m {
+	case "", ModeRandom:
+		mode = ModeRandom
+	case ModeHash, ModeSequential:
+		mode = m
+	default:
+		return fmt.Errorf("unknown short code mode %q", m)
+	}
+	return nil
+}
+
+// CodeGenerator returns the generator of candidate short codes for a new link
+// identified by key, its normalized URL qualified by anything else that tells
+// links apart. In ModeHash successive candidates are HashShortCode(key, 0),
+// HashShortCode(key, 1) and so on, so a URL gets the same code in every
+// database unless that code is taken. In ModeSequential each candidate is
+// EncodeID of a fresh ID from nextID. Otherwise codes are random, and each one
+// generated after SetCollisionPolicy's growAfter ones is a character longer.
+// Reserved words are skipped in every mode, and offensive codes unless in
+// ModeHash.
+func CodeGenerator(key string, nextID func() (uint64, error)) func() (string, error) {
+	collisions := -1 // Every code asked for after the first replaces a taken one
+	var next func() (string, error)
+	switch mode {
+	case ModeHash:
+		extension := 0
+		next = func() (string, error) {
+			code := HashShortCode(key, extension)
+			extension++
+			return code, nil
+		}
+	case ModeSequential:
+		next = func() (string, error) {
+			id, err := nextID()
+			if err != nil {
+				return "", err
+			}
+			return EncodeID(id), nil
+		}
+	default:
+		next = func() (string, error) {
+			return randomCode(grownLength(collisions))
+		}
+	}
+	// Extending a hash code keeps the offending part, so only other modes retry
+	screen := profanityFilter && mode != ModeHash
+	return func() (string, error) {
+		collisions++
+		for {
+			code, err := next()
+			if err != nil || !IsReserved(code) && !(screen && IsOffensive(code)) {
+				return code, err
+			}
+		}
+	}
+}
+
+// HashShortCode derives a short code from the SHA-256 of key, written in the
+// alphabet and truncated to the code length plus extension characters. A longer
+// code starts with the shorter one, which is how collisions are resolved.
+func HashShortCode(key string, extension int) string {
+	sum := sha256.Sum256([]byte(key))
+	n := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(len(alphabet)))
+	digit := new(big.Int)
+	code := make([]byte, shortCodeLength+extension)
+	for i := range code {
+		n.DivMod(n, base, digit)
+		code[i] = alphabet[digit.Int64()]
+	}
+	return string(code)
+}
+
+// obfuscationKey scrambles the codes of EncodeID if set.
+var obfuscationKey string
+
+// SetObfuscationKey makes EncodeID shuffle the codes of each length with a
+// permutation derived from key, so consecutive IDs don't get consecutive codes.
+// This hides the order and number of links from casual inspection; it is not
+// encryption. Changing the key changes the code of every future ID and may
+// collide with existing codes. An empty key turns the shuffle off.
+func SetObfuscationKey(key string) {
+	obfuscationKey = key
+}
+
+// EncodeID writes id, counting from 1, in the alphabet using as few characters
+// as possible: the first len(alphabet) IDs get one-character codes, the next
+// len(alphabet)² two characters, and so on. Distinct IDs always get distinct
+// codes, with or without obfuscation.
+func EncodeID(id uint64) string {
+	base := big.NewInt(int64(len(alphabet)))
+	n := new(big.Int).SetUint64(id - 1)
+	size := new(big.Int).Set(base)
+	length := 1
+	for n.Cmp(size) >= 0 {
+		n.Sub(n, size)
+		size.Mul(size, base)
+		length++
+	}
+	if obfuscationKey != "" {
+		n = permute(n, size, length)
+	}
+
+	digit := new(big.Int)
+	code := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		code[i] = alphabet[digit.Int64()]
+	}
+	return string(code)
+}
+
+// permute maps n, below size = len(alphabet)^length, to another number below
+// size with the affine permutation n*a + c. a and c are derived from the
+// obfuscation key, and a shares no factor with the alphabet length, which makes
+// the mapping one-to-one.
+func permute(n *big.Int, size *big.Int, length int) *big.Int {
+	derive := func(label string) *big.Int {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d", obfuscationKey, label, length)))
+		return new(big.Int).Mod(new(big.Int).SetBytes(sum[:]), size)
+	}
+	a, c := derive("a"), derive("c")
+	base := big.NewInt(int64(len(alphabet)))
+	one := big.NewInt(1)
+	for new(big.Int).GCD(nil, nil, a, base).Cmp(one) != 0 {
+		a.Add(a, one)
+	}
+	n = new(big.Int).Mul(n, a)
+	n.Add(n, c)
+	return n.Mod(n, size)
+}
+
 // GenerateShortCode creates a random, URL-safe, and more readable short code.
 // It does not check for collisions; that should be handled by the caller.
 func GenerateShortCode() (string, error) {
-	bytes := make([]byte, shortCodeLength)
-	alphabetLength := big.NewInt(int64(len(customAlphabet)))
+	return randomCode(shortCodeLength)
+}
+
+// randomCode returns length random characters of the alphabet.
+func randomCode(length int) (string, error) {
+	bytes := make([]byte, length)
+	alphabetLength := big.NewInt(int64(len(alphabet)))
 
 	for i := range bytes {
 		num, err := rand.Int(rand.Reader, alphabetLength)
 		if err != nil {
 			return "", err
 		}
-		bytes[i] = customAlphabet[num.Int64()]
+		bytes[i] = alphabet[num.Int64()]
 	}
 	return string(bytes), nil
 }
@@ -0,0 +1,74 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// DefaultSignatureLength is the number of signature characters appended to
+// short codes unless configured otherwise. Each character carries 6 bits, so
+// 4 characters leave a guess a 1 in 16 million chance of hitting a real link.
+const DefaultSignatureLength = 4
+
+// Bounds for the signature length.
+const (
+	MinSignatureLength = 2
+	MaxSignatureLength = 16
+)
+
+// signingKey and signatureLength are set with SetSigningKey. Short codes are
+// served unsigned while the key is empty.
+var (
+	signingKey      []byte
+	signatureLength = DefaultSignatureLength
+)
+
+// SetSigningKey makes SignCode append an HMAC of length characters, keyed with
+// key, to every short code, and VerifyCode require it. An empty key turns
+// signing off.
+func SetSigningKey(key string, length int) error {
+	if length < MinSignatureLength || length > MaxSignatureLength {
+		return fmt.Errorf("signature length must be between %d and %d, got %d", MinSignatureLength, MaxSignatureLength, length)
+	}
+	signingKey, signatureLength = []byte(key), length
+	return nil
+}
+
+// SigningEnabled reports whether short codes are signed.
+func SigningEnabled() bool {
+	return len(signingKey) > 0
+}
+
+// signature returns the signature characters of code.
+func signature(code string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(code))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:signatureLength]
+}
+
+// SignCode returns the short code to serve for code: the code itself followed
+// by its signature, or code unchanged while signing is off.
+func SignCode(code string) string {
+	if !SigningEnabled() {
+		return code
+	}
+	return code + signature(code)
+}
+
+// VerifyCode checks the signature of a served short code and returns the code
+// it signs. While signing is off every code is valid as is.
+func VerifyCode(served string) (string, bool) {
+	if !SigningEnabled() {
+		return served, true
+	}
+	if len(served) <= signatureLength {
+		return "", false
+	}
+	code, sig := served[:len(served)-signatureLength], served[len(served)-signatureLength:]
+	if !hmac.Equal([]byte(sig), []byte(signature(code))) {
+		return "", false
+	}
+	return code, true
+}
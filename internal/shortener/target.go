@@ -0,0 +1,144 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// TargetError explains why a URL may not be rendered.
+type TargetError struct {
+	Reason string
+}
+
+func (e *TargetError) Error() string {
+	return "unsafe target: " + e.Reason
+}
+
+// lookupHost resolves host names for CheckTarget. Tests replace it to avoid DNS.
+var lookupHost = net.DefaultResolver.LookupNetIP
+
+// internalNetworks are ranges not covered by the netip.Addr predicates that
+// nonetheless only reach the server's own network.
+var internalNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT, also used by some clouds for metadata
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // Reserved, including the broadcast address
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which can embed any of the above
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64
+	netip.MustParsePrefix("fec0::/10"),      // Deprecated site-local
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which can embed any IPv4 address
+	netip.MustParsePrefix("2001::/32"),      // Teredo, likewise
+}
+
+// isInternal reports whether addr is loopback, private, link-local or otherwise
+// not a public unicast address.
+func isInternal(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	// Link-local covers 169.254.169.254 and private covers fd00:ec2::254, the
+	// cloud metadata endpoints
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range internalNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetworks parses a comma-separated list of CIDR prefixes and single
+// addresses, as accepted by CheckTarget.
+func ParseNetworks(list string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// CheckTarget reports whether rawURL is safe for the renderer to fetch: it must
+// have an allowed scheme and a host that resolves only to public addresses, so
+// links can't be used to make the browser read internal services or cloud
+// metadata.
+// Addresses inside the comma-separated CIDR prefixes in allowed are accepted
+// anyway. Unsafe URLs yield a *TargetError; other errors mean the host couldn't
+// be resolved.
+func CheckTarget(ctx context.Context, rawURL string, allowed string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if !SchemeAllowed(parsed.Scheme) {
+		return &TargetError{Reason: fmt.Sprintf("scheme %q is not allowed", parsed.Scheme)}
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return &TargetError{Reason: "missing host"}
+	}
+	return CheckHost(ctx, host, allowed)
+}
+
+// CheckHost reports whether host resolves only to public addresses or to
+// addresses inside the comma-separated CIDR prefixes in allowed. Internal
+// addresses yield a *TargetError; other errors mean the host couldn't be
+// resolved.
+func CheckHost(ctx context.Context, host string, allowed string) error {
+	allowedNetworks, err := ParseNetworks(allowed)
+	if err != nil {
+		return fmt.Errorf("invalid allowed networks: %w", err)
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else if addrs, err = lookupHost(ctx, "ip", host); err != nil {
+		return fmt.Errorf("resolving %s: %w", host, err)
+	}
+
+	// Every address must be safe, since the browser may connect to any of them
+	for _, addr := range addrs {
+		if !isInternal(addr) || allowedAddr(addr, allowedNetworks) {
+			continue
+		}
+		if addr.String() == host {
+			return &TargetError{Reason: fmt.Sprintf("%s is an internal address", host)}
+		}
+		return &TargetError{Reason: fmt.Sprintf("%s resolves to internal address %s", host, addr)}
+	}
+	return nil
+}
+
+func allowedAddr(addr netip.Addr, networks []netip.Prefix) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range networks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
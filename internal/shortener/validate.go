@@ -0,0 +1,123 @@
+package shortener
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Codes of URLError, returned to API clients so they can tell rejections apart.
+const (
+	URLInvalid          = "url_invalid"
+	URLTooLong          = "url_too_long"
+	URLControlChars     = "url_control_characters"
+	URLSchemeNotAllowed = "url_scheme_not_allowed"
+	URLHasCredentials   = "url_credentials"
+	URLMissingHost      = "url_missing_host"
+	URLInvalidHost      = "url_invalid_host"
+)
+
+// URLError explains why ValidateURL rejected a URL.
+type URLError struct {
+	Code   string
+	Reason string
+}
+
+func (e *URLError) Error() string {
+	return e.Reason
+}
+
+// DefaultAllowedSchemes are the URL schemes accepted unless configured otherwise.
+const DefaultAllowedSchemes = "http,https"
+
+// allowedSchemes holds the lowercased schemes set with SetAllowedSchemes.
+var allowedSchemes = []string{"http", "https"}
+
+// SetAllowedSchemes sets the comma-separated URL schemes that ValidateURL
+// accepts and the renderer navigates to. Schemes are case-insensitive.
+func SetAllowedSchemes(list string) error {
+	var schemes []string
+	for _, scheme := range strings.Split(list, ",") {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme == "" {
+			continue
+		}
+		if parsed, err := url.Parse(scheme + ":"); err != nil || parsed.Scheme != scheme {
+			return fmt.Errorf("invalid URL scheme %q", scheme)
+		}
+		schemes = append(schemes, scheme)
+	}
+	if len(schemes) == 0 {
+		return fmt.Errorf("at least one URL scheme must be allowed")
+	}
+	allowedSchemes = schemes
+	return nil
+}
+
+// SchemeAllowed reports whether URLs with scheme may be shortened and rendered.
+func SchemeAllowed(scheme string) bool {
+	return slices.Contains(allowedSchemes, strings.ToLower(scheme))
+}
+
+// DefaultMaxURLLength is the longest URL accepted unless configured otherwise,
+// in line with what browsers and search engines reliably handle.
+const DefaultMaxURLLength = 2048
+
+// ValidateURL rejects URLs that are too long or shaped to mislead: schemes other
+// than the allowed ones, such as javascript: and data: URLs, URLs with credentials,
+// which read as a trusted host in "https://bank.com@evil.com", and hosts that
+// aren't valid names or addresses. A maxLength of 0 allows any length. Errors
+// are *URLError.
+func ValidateURL(rawURL string, maxLength int) error {
+	if maxLength > 0 && len(rawURL) > maxLength {
+		return &URLError{URLTooLong, fmt.Sprintf("URL is %d characters long, at most %d are allowed", len(rawURL), maxLength)}
+	}
+	if strings.ContainsFunc(rawURL, func(r rune) bool { return unicode.IsControl(r) || unicode.IsSpace(r) }) {
+		return &URLError{URLControlChars, "URL contains whitespace or control characters"}
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return &URLError{URLInvalid, err.Error()}
+	}
+	if !SchemeAllowed(parsed.Scheme) {
+		return &URLError{URLSchemeNotAllowed, fmt.Sprintf("%s: URLs are not allowed, only %s", strings.ToLower(parsed.Scheme), strings.Join(allowedSchemes, ", "))}
+	}
+	if parsed.User != nil {
+		return &URLError{URLHasCredentials, "URLs with a username or password are not allowed"}
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return &URLError{URLMissingHost, "URL has no host"}
+	}
+	if !validHost(host) {
+		return &URLError{URLInvalidHost, fmt.Sprintf("%q is not a valid host name or IP address", host)}
+	}
+	return nil
+}
+
+// validHost reports whether host is an IP address or a DNS name of at most 253
+// characters made of labels of letters, digits, '-' and '_'. Letters may be
+// non-ASCII for internationalized names.
+func validHost(host string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+// Package tenant resolves which tenant a request belongs to. Tenants are
+// configured with TENANTS, a JSON object such as
+//
+//	{"acme": {"api_keys": ["secret"], "hosts": ["go.acme.com"]}}
+//
+// Requests matching no tenant belong to the default tenant, whose ID is "".
+package tenant
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"prerender-url-shortener/internal/config"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default is the ID of the tenant that requests matching no configured tenant
+// belong to, and that links created before multi-tenancy were assigned to.
+const Default = ""
+
+// Tenant is a TENANTS entry.
+type Tenant struct {
+	APIKeys []string `json:"api_keys"` // Keys sent in the X-API-Key header
+	Hosts   []string `json:"hosts"`    // Host names the short links are served on
+}
+
+// idPattern limits tenant IDs to what fits the tenant_id column and reads well in URLs and logs.
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// parsed caches the tenants parsed from the TENANTS value in raw.
+var (
+	parsedMu sync.Mutex
+	raw      string
+	parsed   map[string]Tenant
+)
+
+// Parse parses a TENANTS value, rejecting invalid IDs and keys or hosts claimed
+// by more than one tenant.
+func Parse(value string) (map[string]Tenant, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var tenants map[string]Tenant
+	if err := json.Unmarshal([]byte(value), &tenants); err != nil {
+		return nil, err
+	}
+	keys := map[string]string{}
+	hosts := map[string]string{}
+	for id, t := range tenants {
+		if !idPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid tenant ID %q", id)
+		}
+		for _, key := range t.APIKeys {
+			if key == "" {
+				return nil, fmt.Errorf("tenant %q has an empty API key", id)
+			}
+			if other, ok := keys[key]; ok {
+				return nil, fmt.Errorf("tenants %q and %q share an API key", other, id)
+			}
+			keys[key] = id
+		}
+		for i, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				return nil, fmt.Errorf("tenants %q and %q share host %s", other, id, host)
+			}
+			hosts[host] = id
+			t.Hosts[i] = host
+		}
+	}
+	return tenants, nil
+}
+
+// configured returns the tenants in config.Get().Tenants, parsing it again
+// only when it changes. An invalid value configures no tenants.
+func configured() map[string]Tenant {
+	cfg := config.Get()
+	parsedMu.Lock()
+	defer parsedMu.Unlock()
+	if cfg.Tenants != raw {
+		raw = cfg.Tenants
+		tenants, err := Parse(raw)
+		if err != nil {
+			log.Printf("Tenant: Ignoring invalid TENANTS: %v", err)
+		}
+		parsed = tenants
+	}
+	return parsed
+}
+
+// Enabled reports whether any tenants are configured.
+func Enabled() bool {
+	return len(configured()) > 0
+}
+
+// IDs returns the configured tenant IDs in order.
+func IDs() []string {
+	tenants := configured()
+	ids := make([]string, 0, len(tenants))
+	for id := range tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// FromAPIKey returns the tenant owning key.
+func FromAPIKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	for id, t := range configured() {
+		for _, candidate := range t.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FromHost returns the tenant serving host, which may include a port.
+func FromHost(host string) (string, bool) {
+	host = strings.ToLower(host)
+	if i := strings.LastIndexByte(host, ':'); i != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	for id, t := range configured() {
+		for _, candidate := range t.Hosts {
+			if candidate == host {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package tenant
+
+import (
+	"testing"
+
+	"prerender-url-shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tenants, err := Parse(`{"acme": {"api_keys": ["k1", "k2"], "hosts": ["Go.Acme.com"]}}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "k2"}, tenants["acme"].APIKeys)
+	assert.Equal(t, []string{"go.acme.com"}, tenants["acme"].Hosts)
+
+	tenants, err = Parse("")
+	require.NoError(t, err)
+	assert.Empty(t, tenants)
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"Acme": {}}`,
+		`{"": {}}`,
+		`{"acme": {"api_keys": [""]}}`,
+		`{"acme": {"api_keys": ["k1"]}, "beta": {"api_keys": ["k1"]}}`,
+		`{"acme": {"hosts": ["go.example.com"]}, "beta": {"hosts": ["GO.example.com"]}}`,
+	} {
+		_, err := Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	config.Set(&config.Config{})
+	assert.False(t, Enabled())
+	_, ok := FromAPIKey("k1")
+	assert.False(t, ok)
+
+	config.Get().Tenants = `{"acme": {"api_keys": ["k1"], "hosts": ["go.acme.com"]}, "beta": {"hosts": ["[::1]"]}}`
+	assert.True(t, Enabled())
+	assert.Equal(t, []string{"acme", "beta"}, IDs())
+
+	id, ok := FromAPIKey("k1")
+	assert.True(t, ok)
+	assert.Equal(t, "acme", id)
+	_, ok = FromAPIKey("k2")
+	assert.False(t, ok)
+	_, ok = FromAPIKey("")
+	assert.False(t, ok)
+
+	for host, want := range map[string]string{"go.acme.com": "acme", "GO.ACME.COM:8080": "acme", "[::1]": "beta"} {
+		id, ok := FromHost(host)
+		assert.True(t, ok, host)
+		assert.Equal(t, want, id, host)
+	}
+	_, ok = FromHost("other.com")
+	assert.False(t, ok)
+
+	config.Get().Tenants = `not json`
+	assert.False(t, Enabled(), "an invalid TENANTS configures no tenants")
+}
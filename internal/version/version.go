@@ -0,0 +1,69 @@
+// Package version describes the running build. The values are set at build
+// time with the linker, e.g.
+//
+//	go build -ldflags "-X prerender-url-shortener/internal/version.Version=v1.2.0 \
+//	  -X prerender-url-shortener/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X prerender-url-shortener/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// as the Makefile and Dockerfile do.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X. The commit and build date fall back to the version
+// control information the go command embeds when building from a checkout.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info describes a build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a checkout with uncommitted changes
+}
+
+// Get returns the running build's information.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// String returns the version and the short commit, e.g. "v1.2.0 (3f9c2ab)".
+func (i Info) String() string {
+	commit := i.Commit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit == "" {
+		commit = "unknown commit"
+	}
+	if i.Modified {
+		commit += ", modified"
+	}
+	return fmt.Sprintf("%s (%s)", i.Version, commit)
+}
@@ -0,0 +1,27 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	defer func(version, commit, buildDate string) {
+		Version, Commit, BuildDate = version, commit, buildDate
+	}(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.2.0", "3f9c2ab5d1e0c4b7a8e6f2d9c0b1a3e5f7d9c2b4", "2026-10-16T12:00:00Z"
+
+	info := Get()
+	assert.Equal(t, "v1.2.0", info.Version)
+	assert.Equal(t, "3f9c2ab5d1e0c4b7a8e6f2d9c0b1a3e5f7d9c2b4", info.Commit)
+	assert.Equal(t, "2026-10-16T12:00:00Z", info.BuildDate)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "v1.2.0 (3f9c2ab)", Info{Version: "v1.2.0", Commit: "3f9c2ab5d1e0"}.String())
+	assert.Equal(t, "dev (3f9c2ab, modified)", Info{Version: "dev", Commit: "3f9c2ab5d1e0", Modified: true}.String())
+	assert.Equal(t, "dev (unknown commit)", Info{Version: "dev"}.String())
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventType identifies a render lifecycle event.
+type EventType string
+
+const (
+	EventRenderStarted   EventType = "render.started"
+	EventRenderSucceeded EventType = "render.succeeded"
+	EventRenderFailed    EventType = "render.failed"
+)
+
+// EventTypes are the event types subscriptions can choose from.
+var EventTypes = []EventType{EventRenderStarted, EventRenderSucceeded, EventRenderFailed}
+
+// maxBackoff caps the wait between two attempts at a subscription's delivery.
+const maxBackoff = time.Hour
+
+// Event is the JSON payload POSTed to the configured webhook URL.
+type Event struct {
+	Type             EventType `json:"type"`
+	ShortCode        string    `json:"short_code"`
+	OriginalURL      string    `json:"original_url"`
+	WorkerID         int       `json:"worker_id"`
+	Timestamp        time.Time `json:"timestamp"`
+	RenderDurationMs int64     `json:"render_duration_ms,omitempty"`
+	TotalDurationMs  int64     `json:"total_duration_ms,omitempty"`
+	TargetStatusCode int       `json:"target_status_code,omitempty"`
+	HTMLLength       int       `json:"html_length,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	WillRetry        bool      `json:"will_retry,omitempty"` // The failure is retryable and the job was requeued
+}
+
+var client = &http.Client{}
+
+var (
+	// inFlight counts the background deliveries, for Drain to wait for.
+	inFlight sync.WaitGroup
+
+	retriesMutex sync.Mutex
+	// retriesCancelled is closed by Drain to give up on the retries still
+	// waiting out their backoff.
+	retriesCancelled = make(chan struct{})
+)
+
+// Send delivers an event in the background, so a slow or unavailable receiver
+// never holds up a render worker: once to RENDER_WEBHOOK_URL if configured, and
+// to every enabled subscription wanting its type, with retries.
+func Send(event Event) {
+	cfg := config.Get()
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	timeout := time.Duration(cfg.RenderWebhookTimeoutSeconds) * time.Second
+	retriesMutex.Lock()
+	cancelled := retriesCancelled
+	retriesMutex.Unlock()
+
+	if url := cfg.RenderWebhookURL; url != "" {
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			if err := deliver(url, event, timeout); err != nil {
+				log.Printf("Webhook: Failed to deliver %s event for %s: %v", event.Type, event.ShortCode, err)
+			}
+		}()
+	}
+	inFlight.Add(1)
+	go func() {
+		defer inFlight.Done()
+		subs, err := db.ListEnabledWebhookSubscriptions()
+		if err != nil {
+			log.Printf("Webhook: Failed to load subscriptions for %s event of %s: %v", event.Type, event.ShortCode, err)
+			return
+		}
+		for _, sub := range subs {
+			if sub.Wants(string(event.Type)) {
+				inFlight.Add(1)
+				go func() {
+					defer inFlight.Done()
+					deliverToSubscription(sub, event, timeout, cancelled)
+				}()
+			}
+		}
+	}()
+}
+
+// Drain gives up on the retries waiting out their backoff and waits for the
+// delivery attempts in flight, each bounded by RENDER_WEBHOOK_TIMEOUT_SECONDS.
+// It is called on shutdown, once the render workers stopped sending events.
+// Events sent afterwards are delivered as usual.
+func Drain() {
+	retriesMutex.Lock()
+	close(retriesCancelled)
+	retriesCancelled = make(chan struct{})
+	retriesMutex.Unlock()
+	inFlight.Wait()
+}
+
+// deliverToSubscription delivers an event to a subscription, retrying failed
+// attempts up to its MaxAttempts after its backoff, doubled for each retry.
+// Every attempt is recorded in the delivery log. Retries wait in memory, so
+// those still pending when cancelled is closed, see Drain, are dropped.
+func deliverToSubscription(sub db.WebhookSubscription, event Event, timeout time.Duration, cancelled <-chan struct{}) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Webhook: Failed to encode %s event for %s: %v", event.Type, event.ShortCode, err)
+		return
+	}
+	backoff := time.Duration(sub.BackoffSeconds) * time.Second
+	for attempt := 1; attempt <= max(sub.MaxAttempts, 1); attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(backoff):
+			case <-cancelled:
+				log.Printf("Webhook: Dropping attempt %d of %d to deliver %s event for %s to subscription %d on shutdown",
+					attempt, sub.MaxAttempts, event.Type, event.ShortCode, sub.ID)
+				return
+			}
+			backoff = min(2*backoff, maxBackoff)
+		}
+		headers := map[string]string{
+			"X-Webhook-Event":     string(event.Type),
+			"X-Webhook-Attempt":   strconv.Itoa(attempt),
+			"X-Webhook-Signature": Signature(sub.Secret, body),
+		}
+		start := time.Now()
+		status, err := post(sub.URL, body, headers, timeout)
+		delivery := &db.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventType:      string(event.Type),
+			ShortCode:      event.ShortCode,
+			Attempt:        attempt,
+			StatusCode:     status,
+			DurationMs:     time.Since(start).Milliseconds(),
+			Succeeded:      err == nil,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if dbErr := db.RecordWebhookDelivery(delivery); dbErr != nil {
+			log.Printf("Webhook: Failed to log delivery to subscription %d: %v", sub.ID, dbErr)
+		}
+		if err == nil {
+			return
+		}
+		log.Printf("Webhook: Attempt %d of %d to deliver %s event for %s to subscription %d failed: %v",
+			attempt, sub.MaxAttempts, event.Type, event.ShortCode, sub.ID, err)
+	}
+}
+
+// Signature returns the X-Webhook-Signature of body for a subscription with
+// secret: "sha256=" followed by the hex HMAC-SHA256 of the body.
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver POSTs a single event and treats any non-2xx response as a failure.
+func deliver(url string, event Event, timeout time.Duration) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = post(url, body, nil, timeout)
+	return err
+}
+
+// post POSTs a JSON body with the extra headers and returns the response
+// status, treating any non-2xx response as a failure.
+func post(url string, body []byte, headers map[string]string, timeout time.Duration) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "prerender-url-shortener-webhook")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	httpClient := *client
+	httpClient.Timeout = timeout
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
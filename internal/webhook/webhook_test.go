@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prerender-url-shortener/internal/config"
+	"prerender-url-shortener/internal/db"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) {
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	t.Cleanup(Drain) // Runs first, so deliveries are done with the database
+	require.NoError(t, db.Migrate())
+}
+
+func TestDeliver(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := Event{
+		Type:             EventRenderFailed,
+		ShortCode:        "ABC123",
+		OriginalURL:      "https://example.com",
+		WorkerID:         2,
+		RenderDurationMs: 1500,
+		Error:            "rendering timeout",
+	}
+	err := deliver(server.URL, event, time.Second)
+	assert.NoError(t, err)
+
+	assert.Equal(t, EventRenderFailed, received.Type)
+	assert.Equal(t, "ABC123", received.ShortCode)
+	assert.Equal(t, "https://example.com", received.OriginalURL)
+	assert.Equal(t, 2, received.WorkerID)
+	assert.Equal(t, int64(1500), received.RenderDurationMs)
+	assert.Equal(t, "rendering timeout", received.Error)
+}
+
+func TestDeliverNonSuccessStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := deliver(server.URL, Event{Type: EventRenderStarted}, time.Second)
+	assert.Error(t, err)
+}
+
+func TestSend(t *testing.T) {
+	setupTestDB(t)
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			received <- event
+		}
+	}))
+	defer server.Close()
+
+	config.Set(&config.Config{
+		RenderWebhookURL:            server.URL,
+		RenderWebhookTimeoutSeconds: 5,
+	})
+
+	Send(Event{Type: EventRenderSucceeded, ShortCode: "SEND123"})
+
+	select {
+	case event := <-received:
+		assert.Equal(t, EventRenderSucceeded, event.Type)
+		assert.Equal(t, "SEND123", event.ShortCode)
+		assert.False(t, event.Timestamp.IsZero())
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestSendToSubscriptions(t *testing.T) {
+	setupTestDB(t)
+	var calls atomic.Int32
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails and is retried
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, Signature("topsecret", body), r.Header.Get("X-Webhook-Signature"))
+		received <- r
+	}))
+	defer server.Close()
+	config.Set(&config.Config{RenderWebhookTimeoutSeconds: 5})
+
+	failures := &db.WebhookSubscription{URL: server.URL, EventTypes: "render.failed", Secret: "topsecret", MaxAttempts: 3, Enabled: true}
+	require.NoError(t, db.CreateWebhookSubscription(failures))
+
+	Send(Event{Type: EventRenderSucceeded, ShortCode: "SUB001"}) // Not subscribed to
+	Send(Event{Type: EventRenderFailed, ShortCode: "SUB002"})
+	select {
+	case r := <-received:
+		assert.Equal(t, "render.failed", r.Header.Get("X-Webhook-Event"))
+		assert.Equal(t, "2", r.Header.Get("X-Webhook-Attempt"))
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	var deliveries []db.WebhookDelivery
+	require.Eventually(t, func() bool {
+		deliveries, _ = db.ListWebhookDeliveries(failures.ID, 10)
+		return len(deliveries) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.True(t, deliveries[0].Succeeded)
+	assert.Equal(t, "SUB002", deliveries[0].ShortCode)
+	assert.False(t, deliveries[1].Succeeded)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[1].StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestDrainDropsPendingRetries(t *testing.T) {
+	setupTestDB(t)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	config.Set(&config.Config{RenderWebhookTimeoutSeconds: 5})
+
+	sub := &db.WebhookSubscription{URL: server.URL, EventTypes: "render.failed", MaxAttempts: 3, BackoffSeconds: 3600, Enabled: true}
+	require.NoError(t, db.CreateWebhookSubscription(sub))
+
+	Send(Event{Type: EventRenderFailed, ShortCode: "DRAIN1"})
+	require.Eventually(t, func() bool {
+		deliveries, _ := db.ListWebhookDeliveries(sub.ID, 10)
+		return len(deliveries) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	drained := make(chan struct{})
+	go func() {
+		Drain()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain waited for the retry's backoff")
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}